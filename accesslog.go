@@ -0,0 +1,149 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// AccessLogEntry holds an access log entry
+// recorded by an AccessLog handler.
+type AccessLogEntry struct {
+	Method string
+	Path   string
+	Query  string
+	Proto  string
+
+	// Status holds the response status. It is
+	// zero if the handler panicked before writing
+	// the response header.
+	Status int
+
+	// Bytes holds the number of bytes written
+	// in the response body.
+	Bytes int64
+
+	// Duration holds the time taken by the handler.
+	Duration time.Duration
+
+	// RequestHeader and ResponseHeader hold the request
+	// headers and the response headers as written.
+	RequestHeader  http.Header
+	ResponseHeader http.Header
+
+	// Panicked records whether the handler panicked.
+	Panicked bool
+}
+
+// AccessLog is an http.Handler that records an access log entry for
+// each request after passing it on to Handler. It can be used to
+// inspect the requests reaching a handler or, by wrapping the handler
+// of a logging middleware, to compare what the middleware logs with
+// what actually happened.
+//
+// The zero value is ready to use and responds
+// with http.StatusOK to all requests.
+type AccessLog struct {
+	// Handler, if non-nil, is used to respond to requests.
+	Handler http.Handler
+
+	mu      sync.Mutex
+	entries []AccessLogEntry
+}
+
+// ServeHTTP implements http.Handler.
+func (l *AccessLog) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	lw := &accessLogResponseWriter{
+		ResponseWriter: w,
+	}
+	e := AccessLogEntry{
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Query:         req.URL.RawQuery,
+		Proto:         req.Proto,
+		RequestHeader: cloneHeader(req.Header),
+		Panicked:      true,
+	}
+	start := DefaultClock.Now()
+	defer func() {
+		e.Duration = DefaultClock.Now().Sub(start)
+		e.Status = lw.status
+		e.Bytes = lw.bytes
+		if e.Status == 0 && !e.Panicked {
+			e.Status = http.StatusOK
+		}
+		if lw.header != nil {
+			e.ResponseHeader = lw.header
+		} else {
+			e.ResponseHeader = cloneHeader(w.Header())
+		}
+		l.mu.Lock()
+		l.entries = append(l.entries, e)
+		l.mu.Unlock()
+	}()
+	if l.Handler != nil {
+		l.Handler.ServeHTTP(lw, req)
+	}
+	e.Panicked = false
+}
+
+// Entries returns all the entries recorded so far.
+func (l *AccessLog) Entries() []AccessLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]AccessLogEntry(nil), l.entries...)
+}
+
+// LastEntry returns the most recently recorded entry.
+// It fails the test if there are no entries.
+func (l *AccessLog) LastEntry(c *qt.C) AccessLogEntry {
+	entries := l.Entries()
+	c.Assert(entries, qt.Not(qt.HasLen), 0, qt.Commentf("no access log entries recorded"))
+	return entries[len(entries)-1]
+}
+
+// Reset discards all the recorded entries.
+func (l *AccessLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	header http.Header
+}
+
+func (w *accessLogResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = cloneHeader(w.ResponseWriter.Header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogResponseWriter) Write(buf []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(buf)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *accessLogResponseWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
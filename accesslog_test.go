@@ -0,0 +1,86 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestAccessLog(t *testing.T) {
+	c := qt.New(t)
+	l := &qthttptest.AccessLog{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/created":
+				w.Header().Set("Location", "/things/1")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			case "/slow":
+				time.Sleep(20 * time.Millisecond)
+			case "/panic":
+				panic(http.ErrAbortHandler)
+			default:
+				w.Write([]byte("hello, world"))
+				w.Header().Set("X-Too-Late", "value")
+			}
+		}),
+	}
+	srv := qthttptest.NewServer(c, l)
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		Method: "POST",
+		URL:    "/created?x=1",
+		Header: http.Header{
+			"X-Foo": {"bar"},
+		},
+	})
+	e := l.LastEntry(c)
+	c.Assert(e.Method, qt.Equals, "POST")
+	c.Assert(e.Path, qt.Equals, "/created")
+	c.Assert(e.Query, qt.Equals, "x=1")
+	c.Assert(e.Proto, qt.Equals, "HTTP/1.1")
+	c.Assert(e.Status, qt.Equals, http.StatusCreated)
+	c.Assert(e.Bytes, qt.Equals, int64(7))
+	c.Assert(e.RequestHeader.Get("X-Foo"), qt.Equals, "bar")
+	c.Assert(e.ResponseHeader.Get("Location"), qt.Equals, "/things/1")
+	c.Assert(e.Panicked, qt.Equals, false)
+
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/",
+	})
+	e = l.LastEntry(c)
+	c.Assert(e.Status, qt.Equals, http.StatusOK)
+	c.Assert(e.Bytes, qt.Equals, int64(12))
+	c.Assert(e.ResponseHeader.Get("X-Too-Late"), qt.Equals, "")
+
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/slow",
+	})
+	e = l.LastEntry(c)
+	c.Assert(e.Status, qt.Equals, http.StatusOK)
+	c.Assert(e.Bytes, qt.Equals, int64(0))
+	c.Assert(e.Duration >= 20*time.Millisecond, qt.Equals, true)
+
+	// Use POST so that the client does not retry the request.
+	qthttptest.Do(c, qthttptest.DoRequestParams{
+		Method:      "POST",
+		URL:         srv.URL() + "/panic",
+		ExpectError: `.*EOF`,
+	})
+	e = l.LastEntry(c)
+	c.Assert(e.Status, qt.Equals, 0)
+	c.Assert(e.Panicked, qt.Equals, true)
+
+	c.Assert(l.Entries(), qt.HasLen, 4)
+	l.Reset()
+	c.Assert(l.Entries(), qt.HasLen, 0)
+	checkFails(c, `no access log entries recorded`, func(c *qt.C) {
+		l.LastEntry(c)
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"io"
+	"net/http"
+)
+
+// BodyErrorTransport is an http.RoundTripper that makes requests
+// with Transport but returns responses whose bodies fail after a
+// given number of bytes have been read. It can be used to test
+// the handling of truncated responses and failed reads.
+type BodyErrorTransport struct {
+	// Transport is used to make requests. If it is
+	// nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// After holds the number of body bytes that can be
+	// read before the error is returned.
+	After int64
+
+	// Err holds the error returned when reading past After bytes.
+	// If it is nil, io.ErrUnexpectedEOF is used.
+	Err error
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *BodyErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	failBody(resp, t.After, t.Err)
+	return resp, nil
+}
+
+// FailBodyAfter returns a function suitable for use as
+// DoRequestParams.Do that makes requests with do but returns
+// responses whose bodies fail with err after n bytes have been read.
+// If do is nil, http.DefaultClient.Do is used. If err is nil,
+// io.ErrUnexpectedEOF is used.
+func FailBodyAfter(do func(*http.Request) (*http.Response, error), n int64, err error) func(*http.Request) (*http.Response, error) {
+	if do == nil {
+		do = http.DefaultClient.Do
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		resp, rerr := do(req)
+		if rerr != nil {
+			return nil, rerr
+		}
+		failBody(resp, n, err)
+		return resp, nil
+	}
+}
+
+// failBody replaces the body of resp with one that
+// fails with err after n bytes have been read.
+func failBody(resp *http.Response, n int64, err error) {
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	resp.Body = &errorAfterReader{
+		r:   resp.Body,
+		n:   n,
+		err: err,
+	}
+}
+
+// errorAfterReader is an io.ReadCloser that reads from r but
+// returns err once n bytes have been read. If r ends first,
+// it returns err at that point instead of io.EOF.
+type errorAfterReader struct {
+	r   io.ReadCloser
+	n   int64
+	err error
+}
+
+func (r *errorAfterReader) Read(buf []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+	if int64(len(buf)) > r.n {
+		buf = buf[:r.n]
+	}
+	n, err := r.r.Read(buf)
+	r.n -= int64(n)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func (r *errorAfterReader) Close() error {
+	return r.r.Close()
+}
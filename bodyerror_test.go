@@ -0,0 +1,70 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var helloHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("hello, world"))
+})
+
+func TestFailBodyAfter(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, helloHandler)
+	resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/",
+		Do:  qthttptest.FailBodyAfter(nil, 5, nil),
+	})
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+	c.Assert(string(data), qt.Equals, "hello")
+}
+
+func TestFailBodyAfterShortBody(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, helloHandler)
+	errBroken := errors.New("connection reset")
+	resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/",
+		Do:  qthttptest.FailBodyAfter(nil, 1000, errBroken),
+	})
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, qt.Equals, errBroken)
+	c.Assert(string(data), qt.Equals, "hello, world")
+}
+
+func TestBodyErrorTransport(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, helloHandler)
+	client := &http.Client{
+		Transport: &qthttptest.BodyErrorTransport{},
+	}
+	resp, err := client.Get(srv.URL())
+	c.Assert(err, qt.Equals, nil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+	c.Assert(data, qt.HasLen, 0)
+
+	// The error is reported by the assertion helpers too.
+	checkFails(c, `unexpected EOF`, func(c *qt.C) {
+		srv.DoRequest(c, qthttptest.DoRequestParams{
+			URL: "/",
+			Do:  client.Do,
+		})
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Call provides a fluent alternative to JSONCallParams. A Call is
+// created with NewCall and built up by calling its methods, each of
+// which returns a new Call, leaving the original unchanged. This
+// means that a partially built Call can be used as the base for
+// several others. For example:
+//
+//	qthttptest.NewCall("POST", "/items").
+//		JSON(body).
+//		Header("X-Tenant", "t1").
+//		ExpectStatus(http.StatusCreated).
+//		ExpectJSON(expected).
+//		Assert(c, handler)
+type Call struct {
+	p JSONCallParams
+}
+
+// NewCall returns a new Call that will make a request
+// with the given method and URL.
+func NewCall(method, url string) *Call {
+	return &Call{
+		p: JSONCallParams{
+			Method: method,
+			URL:    url,
+		},
+	}
+}
+
+// with returns a copy of the call with f applied to its parameters.
+func (call *Call) with(f func(p *JSONCallParams)) *Call {
+	call1 := *call
+	call1.p.Header = cloneHeaderOrNil(call.p.Header)
+	call1.p.ExpectHeader = cloneHeaderOrNil(call.p.ExpectHeader)
+	call1.p.Cookies = append([]*http.Cookie(nil), call.p.Cookies...)
+	f(&call1.p)
+	return &call1
+}
+
+// JSON sets the request body to the JSON encoding of v,
+// as for JSONCallParams.JSONBody.
+func (call *Call) JSON(v interface{}) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.JSONBody = v
+	})
+}
+
+// Body sets the request body.
+func (call *Call) Body(r io.Reader) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.Body = r
+	})
+}
+
+// Header adds the given header to the request.
+func (call *Call) Header(key, value string) *Call {
+	return call.with(func(p *JSONCallParams) {
+		if p.Header == nil {
+			p.Header = make(http.Header)
+		}
+		p.Header.Add(key, value)
+	})
+}
+
+// BasicAuth sets the credentials to use for HTTP basic authentication.
+func (call *Call) BasicAuth(username, password string) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.Username = username
+		p.Password = password
+	})
+}
+
+// Cookie adds the given cookie to the request.
+func (call *Call) Cookie(cookie *http.Cookie) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.Cookies = append(p.Cookies, cookie)
+	})
+}
+
+// Do sets the function used to make the HTTP request,
+// as for JSONCallParams.Do.
+func (call *Call) Do(do func(req *http.Request) (*http.Response, error)) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.Do = do
+	})
+}
+
+// ExpectError sets the regular expression that the
+// error returned when making the request must match.
+func (call *Call) ExpectError(pattern string) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectError = pattern
+	})
+}
+
+// ExpectStatus sets the expected response status code.
+func (call *Call) ExpectStatus(status int) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectStatus = status
+	})
+}
+
+// ExpectJSON sets the expected JSON response body.
+// As for JSONCallParams.ExpectBody, v may be a BodyAsserter.
+func (call *Call) ExpectJSON(v interface{}) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectBody = v
+	})
+}
+
+// ExpectNoBody specifies that the response must not have a body.
+func (call *Call) ExpectNoBody() *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectNoBody = true
+	})
+}
+
+// ExpectHeader adds a header value that must be present in the response.
+func (call *Call) ExpectHeader(key, value string) *Call {
+	return call.with(func(p *JSONCallParams) {
+		if p.ExpectHeader == nil {
+			p.ExpectHeader = make(http.Header)
+		}
+		p.ExpectHeader.Add(key, value)
+	})
+}
+
+// ExpectContentType sets the pattern that the response
+// Content-Type must match, as for JSONCallParams.ExpectContentType.
+func (call *Call) ExpectContentType(pattern string) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectContentType = pattern
+	})
+}
+
+// ExpectMaxDuration sets the maximum time the call may take.
+func (call *Call) ExpectMaxDuration(d time.Duration) *Call {
+	return call.with(func(p *JSONCallParams) {
+		p.ExpectMaxDuration = d
+	})
+}
+
+// Params returns the parameters that will be passed
+// to AssertJSONCall.
+func (call *Call) Params() JSONCallParams {
+	return call.with(func(*JSONCallParams) {}).p
+}
+
+// Assert calls AssertJSONCall with the call's parameters. If handler
+// is non-nil, it is used as the handler for the call; it may be nil
+// when the call's URL contains a host.
+func (call *Call) Assert(c *qt.C, handler http.Handler) {
+	p := call.Params()
+	if handler != nil {
+		p.Handler = handler
+	}
+	AssertJSONCall(c, p)
+}
+
+// cloneHeaderOrNil is like cloneHeader except
+// that it returns nil if h is nil.
+func cloneHeaderOrNil(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	return cloneHeader(h)
+}
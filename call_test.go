@@ -0,0 +1,48 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestCall(t *testing.T) {
+	c := qt.New(t)
+	base := qthttptest.NewCall("POST", "/items").Header("X-Tenant", "t1")
+	base.JSON(map[string]int{"a": 1}).
+		BasicAuth("who", "bad-wolf").
+		ExpectStatus(http.StatusCreated).
+		ExpectJSON(handlerResponse{
+			URL:    "/items",
+			Method: "POST",
+			Body:   `{"a":1}`,
+			Auth:   true,
+			Header: http.Header{
+				"X-Tenant":     {"t1"},
+				"Content-Type": {"application/json"},
+			},
+		}).
+		Assert(c, makeHandler(c, http.StatusCreated, "application/json"))
+
+	// The base call is not affected by derived calls.
+	c.Assert(base.Params(), qt.DeepEquals, qthttptest.JSONCallParams{
+		Method: "POST",
+		URL:    "/items",
+		Header: http.Header{"X-Tenant": {"t1"}},
+	})
+}
+
+func TestCallDoesNotShareHeaders(t *testing.T) {
+	c := qt.New(t)
+	base := qthttptest.NewCall("GET", "/").Header("A", "1")
+	call1 := base.Header("B", "2")
+	call2 := base.Header("C", "3")
+	c.Assert(call1.Params().Header, qt.DeepEquals, http.Header{"A": {"1"}, "B": {"2"}})
+	c.Assert(call2.Params().Header, qt.DeepEquals, http.Header{"A": {"1"}, "C": {"3"}})
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Caller makes calls using a shared set of default parameters.
+// Fields in the per-call parameters take precedence over the
+// defaults held in the Caller.
+type Caller struct {
+	// BaseURL is used as the base URL for calls that
+	// do not specify one. See DoRequestParams.BaseURL.
+	BaseURL string
+
+	// Handler is used for calls that specify
+	// neither a Handler nor a BaseURL.
+	Handler http.Handler
+
+	// Header holds headers to add to each request. Headers
+	// specified in a call replace those with the same key,
+	// compared case-insensitively.
+	Header http.Header
+
+	// Username and Password are used for HTTP basic authentication
+	// in calls that do not specify either.
+	Username string
+	Password string
+
+	// Do is used for calls that do not specify one.
+	Do func(req *http.Request) (*http.Response, error)
+
+	// Cookies holds cookies to add to each request. Cookies
+	// specified in a call replace those with the same name.
+	Cookies []*http.Cookie
+}
+
+// AssertJSONCall is like the AssertJSONCall function except that
+// the caller's defaults are applied to p first.
+func (caller *Caller) AssertJSONCall(c *qt.C, p JSONCallParams) {
+	p.setDoRequestParams(caller.DoRequestParams(p.doRequestParams()))
+	AssertJSONCall(c, p)
+}
+
+// DoRequest is like the DoRequest function except that
+// the caller's defaults are applied to p first.
+func (caller *Caller) DoRequest(c *qt.C, p DoRequestParams) *httptest.ResponseRecorder {
+	return DoRequest(c, caller.DoRequestParams(p))
+}
+
+// DoRequestParams returns p with the caller's defaults applied.
+// This can be used to call Do with the caller's defaults.
+func (caller *Caller) DoRequestParams(p DoRequestParams) DoRequestParams {
+	if p.Handler == nil && p.BaseURL == "" {
+		p.Handler = caller.Handler
+	}
+	if p.BaseURL == "" {
+		p.BaseURL = caller.BaseURL
+	}
+	if p.Do == nil {
+		p.Do = caller.Do
+	}
+	if p.Username == "" && p.Password == "" {
+		p.Username = caller.Username
+		p.Password = caller.Password
+	}
+	if len(caller.Header) > 0 {
+		h := cloneHeader(caller.Header)
+		for k := range p.Header {
+			for hk := range h {
+				if strings.EqualFold(hk, k) {
+					delete(h, hk)
+				}
+			}
+		}
+		for k, v := range p.Header {
+			h[k] = v
+		}
+		p.Header = h
+	}
+	if len(caller.Cookies) > 0 {
+		cookies := make([]*http.Cookie, 0, len(caller.Cookies)+len(p.Cookies))
+		for _, cookie := range caller.Cookies {
+			if !hasCookie(p.Cookies, cookie.Name) {
+				cookies = append(cookies, cookie)
+			}
+		}
+		p.Cookies = append(cookies, p.Cookies...)
+	}
+	return p
+}
+
+// hasCookie reports whether cookies contains
+// a cookie with the given name.
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
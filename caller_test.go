@@ -0,0 +1,110 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestCallerAssertJSONCall(t *testing.T) {
+	c := qt.New(t)
+	caller := &qthttptest.Caller{
+		Handler: makeHandler(c, http.StatusOK, "application/json"),
+		Header: http.Header{
+			"X-Tenant": {"t1"},
+			"X-Other":  {"default"},
+		},
+		Username: "who",
+		Password: "bad-wolf",
+	}
+	caller.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/foo",
+		Header: http.Header{
+			"X-Other": {"override"},
+		},
+		ExpectBody: handlerResponse{
+			URL:    "/foo",
+			Method: "GET",
+			Auth:   true,
+			Header: http.Header{
+				"X-Tenant": {"t1"},
+				"X-Other":  {"override"},
+			},
+		},
+	})
+	// The caller's defaults are left unchanged.
+	c.Assert(caller.Header, qt.DeepEquals, http.Header{
+		"X-Tenant": {"t1"},
+		"X-Other":  {"default"},
+	})
+}
+
+func TestCallerWithBaseURL(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Header.Get("Cookie"), qt.Equals, "a=1; b=override")
+		w.Write([]byte(req.URL.Path))
+	}))
+	defer srv.Close()
+	caller := &qthttptest.Caller{
+		BaseURL: srv.URL + "/api",
+		Cookies: []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+	}
+	rec := caller.DoRequest(c, qthttptest.DoRequestParams{
+		URL:     "/items",
+		Cookies: []*http.Cookie{{Name: "b", Value: "override"}},
+	})
+	c.Assert(rec.Body.String(), qt.Equals, "/api/items")
+}
+
+func TestCallerHeaderCaseInsensitive(t *testing.T) {
+	c := qt.New(t)
+	caller := &qthttptest.Caller{
+		Handler: makeHandler(c, http.StatusOK, "application/json"),
+		Header: http.Header{
+			"x-other": {"default"},
+		},
+	}
+	caller.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/foo",
+		Header: http.Header{
+			"X-Other": {"override"},
+		},
+		ExpectBody: handlerResponse{
+			URL:    "/foo",
+			Method: "GET",
+			Header: http.Header{
+				"X-Other": {"override"},
+			},
+		},
+	})
+}
+
+func TestCallerPerCallBaseURL(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("server " + req.URL.Path))
+	}))
+	defer srv.Close()
+	caller := &qthttptest.Caller{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("handler " + req.URL.Path))
+		}),
+	}
+	rec := caller.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/items",
+	})
+	c.Assert(rec.Body.String(), qt.Equals, "handler /items")
+	rec = caller.DoRequest(c, qthttptest.DoRequestParams{
+		BaseURL: srv.URL + "/api",
+		URL:     "/items",
+	})
+	c.Assert(rec.Body.String(), qt.Equals, "server /api/items")
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Log levels for LogLevel.
+const (
+	// LogNone disables call logging.
+	LogNone = iota
+
+	// LogCalls logs a one-line summary of each call: the method,
+	// URL, status, duration and the sizes of the request and
+	// response bodies.
+	LogCalls
+
+	// LogHeaders also logs the request and response headers.
+	LogHeaders
+
+	// LogBodies also logs the start of each response body.
+	LogBodies
+)
+
+// LogLevel controls the logging of calls made with Do and the
+// functions that use it, such as AssertJSONCall and DoResponse.
+// Calls are logged with c.Logf, so the output is shown only for
+// failing tests or when running go test -v, which makes it useful
+// for debugging long scenario tests.
+//
+// Its initial value is taken from the QTHTTPTEST_LOG environment
+// variable, which may hold a number or one of "calls", "headers"
+// or "bodies"; logging is disabled if it is not set.
+var LogLevel = logLevelFromEnv(os.Getenv("QTHTTPTEST_LOG"))
+
+// maxLoggedBody holds the maximum number of
+// body bytes logged at the LogBodies level.
+const maxLoggedBody = 512
+
+func logLevelFromEnv(s string) int {
+	switch strings.ToLower(s) {
+	case "calls":
+		return LogCalls
+	case "headers":
+		return LogHeaders
+	case "bodies":
+		return LogBodies
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// logCall arranges for the call that made the given request to be
+// logged according to LogLevel. An error is logged immediately; a
+// response is logged when its body is closed, so that the size of
+// the body is known.
+func logCall(c *qt.C, req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	level := LogLevel
+	if level < LogCalls {
+		return
+	}
+	summary := fmt.Sprintf("%s %s", req.Method, req.URL)
+	if err != nil {
+		c.Logf("%s: error after %v: %v", summary, elapsed, err)
+		return
+	}
+	summary = fmt.Sprintf("%s: %s in %v; sent %s", summary, resp.Status, elapsed.Round(time.Microsecond), bodySize(req.ContentLength))
+	resp.Body = &loggedBody{
+		ReadCloser: resp.Body,
+		log: func(n int64, body []byte) {
+			var buf strings.Builder
+			fmt.Fprintf(&buf, "%s; received %d bytes", summary, n)
+			if level >= LogHeaders {
+				buf.WriteString("\nrequest header:")
+				writeLoggedHeader(&buf, req.Header)
+				buf.WriteString("\nresponse header:")
+				writeLoggedHeader(&buf, resp.Header)
+			}
+			if level >= LogBodies && len(body) > 0 {
+				fmt.Fprintf(&buf, "\nresponse body: %q", body)
+				if n > int64(len(body)) {
+					buf.WriteString("...")
+				}
+			}
+			c.Logf("%s", buf.String())
+		},
+	}
+}
+
+func bodySize(n int64) string {
+	if n < 0 {
+		return "a body of unknown length"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+func writeLoggedHeader(buf *strings.Builder, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(buf, "\n  %s: %s", k, v)
+		}
+	}
+}
+
+// loggedBody counts the bytes read from a response body,
+// retaining the first maxLoggedBody of them, and calls log
+// when it is closed.
+type loggedBody struct {
+	io.ReadCloser
+	log func(n int64, body []byte)
+
+	once sync.Once
+	n    int64
+	buf  bytes.Buffer
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := maxLoggedBody - b.buf.Len(); room > 0 {
+		if room > n {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	b.once.Do(func() {
+		b.log(b.n, b.buf.Bytes())
+	})
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// loggingTB is a testing.TB that records log messages.
+type loggingTB struct {
+	testing.TB
+	mu   sync.Mutex
+	logs []string
+}
+
+func (t *loggingTB) Log(args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, fmt.Sprint(args...))
+}
+
+func (t *loggingTB) Logf(format string, args ...interface{}) {
+	t.Log(fmt.Sprintf(format, args...))
+}
+
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Foo", "bar")
+	w.Write([]byte(`{"hello": "world"}`))
+})
+
+var logLevelTests = []struct {
+	level       int
+	expectLog   string
+	expectNoLog string
+}{{
+	level: qthttptest.LogNone,
+}, {
+	level:       qthttptest.LogCalls,
+	expectLog:   `POST http://127\.0\.0\.1:\d+/x: 200 OK in \S+; sent 5 bytes; received 18 bytes`,
+	expectNoLog: "header",
+}, {
+	level: qthttptest.LogHeaders,
+	expectLog: `POST http://127\.0\.0\.1:\d+/x: 200 OK in \S+; sent 5 bytes; received 18 bytes
+request header:
+  X-Req: a
+response header:
+  Content-Length: 18
+  Content-Type: application/json
+  Date: .*
+  X-Foo: bar`,
+	expectNoLog: "response body",
+}, {
+	level:     qthttptest.LogBodies,
+	expectLog: `.*\nresponse header:(\n  .*)+\nresponse body: "{\\"hello\\": \\"world\\"}"`,
+}}
+
+func TestLogLevel(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range logLevelTests {
+		test := test
+		c.Run(fmt.Sprint(test.level), func(c *qt.C) {
+			c.Patch(&qthttptest.LogLevel, test.level)
+			tb := &loggingTB{TB: c.TB}
+			qthttptest.AssertJSONCall(qt.New(tb), qthttptest.JSONCallParams{
+				Method:     "POST",
+				Handler:    echoHandler,
+				URL:        "/x",
+				Header:     http.Header{"X-Req": {"a"}},
+				Body:       strings.NewReader("hello"),
+				ExpectBody: map[string]string{"hello": "world"},
+			})
+			// AssertJSONCall always logs the URL.
+			c.Assert(tb.logs[0], qt.Equals, `JSON call, url "/x"`)
+			logs := tb.logs[1:]
+			if test.expectLog == "" {
+				c.Assert(logs, qt.HasLen, 0)
+				return
+			}
+			c.Assert(logs, qt.HasLen, 1)
+			c.Assert(logs[0], qt.Matches, "(?s)"+test.expectLog)
+			if test.expectNoLog != "" {
+				c.Assert(strings.Contains(logs[0], test.expectNoLog), qt.Equals, false)
+			}
+		})
+	}
+}
+
+func TestLogLevelError(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.LogLevel, qthttptest.LogCalls)
+	tb := &loggingTB{TB: c.TB}
+	qthttptest.Do(qt.New(tb), qthttptest.DoRequestParams{
+		URL: "http://0.1.2.3/",
+		Do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("no connection")
+		},
+		ExpectError: "no connection",
+	})
+	c.Assert(tb.logs, qt.HasLen, 1)
+	c.Assert(tb.logs[0], qt.Matches, `GET http://0\.1\.2\.3/: error after \S+: no connection`)
+}
+
+func TestLogLevelTruncatesBody(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.LogLevel, qthttptest.LogBodies)
+	tb := &loggingTB{TB: c.TB}
+	resp := qthttptest.DoResponse(qt.New(tb), qthttptest.DoRequestParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(strings.Repeat("x", 2000)))
+		}),
+		URL: "/",
+	})
+	c.Assert(resp.Body, qt.HasLen, 2000)
+	c.Assert(tb.logs, qt.HasLen, 1)
+	c.Assert(tb.logs[0], qt.Matches, `(?s).*; sent 0 bytes; received 2000 bytes\n.*\nresponse body: "x{512}"\.\.\.`)
+}
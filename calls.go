@@ -0,0 +1,48 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// NamedJSONCallParams holds a named entry for AssertJSONCalls.
+type NamedJSONCallParams struct {
+	// Name holds the name of the subtest for the call.
+	Name string
+
+	// Parallel specifies that the call may run
+	// in parallel with other parallel calls.
+	Parallel bool
+
+	// Params holds the parameters for the call.
+	Params JSONCallParams
+}
+
+// AssertJSONCalls runs AssertJSONCall for each of the given calls,
+// each in a subtest with the call's name. If handler is non-nil, a
+// single server running it is started for all calls and shut down
+// when the test completes; calls that specify their own Handler or
+// a URL with a host are not made against that server.
+func AssertJSONCalls(c *qt.C, handler http.Handler, calls []NamedJSONCallParams) {
+	var srv *Server
+	if handler != nil {
+		srv = NewServer(c, handler)
+	}
+	for _, call := range calls {
+		call := call
+		c.Run(call.Name, func(c *qt.C) {
+			if call.Parallel {
+				c.Parallel()
+			}
+			if srv != nil && call.Params.Handler == nil {
+				srv.AssertJSONCall(c, call.Params)
+			} else {
+				AssertJSONCall(c, call.Params)
+			}
+		})
+	}
+}
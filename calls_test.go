@@ -0,0 +1,46 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestAssertJSONCalls(t *testing.T) {
+	c := qt.New(t)
+	var calls []qthttptest.NamedJSONCallParams
+	for _, path := range []string{"/a", "/b", "/c"} {
+		calls = append(calls, qthttptest.NamedJSONCallParams{
+			Name:     path,
+			Parallel: path != "/a",
+			Params: qthttptest.JSONCallParams{
+				URL: path,
+				ExpectBody: handlerResponse{
+					URL:    path,
+					Method: "GET",
+					Header: make(http.Header),
+				},
+			},
+		})
+	}
+	calls = append(calls, qthttptest.NamedJSONCallParams{
+		Name: "own handler",
+		Params: qthttptest.JSONCallParams{
+			URL:          "/d",
+			Handler:      makeHandler(c, http.StatusTeapot, "application/json"),
+			ExpectStatus: http.StatusTeapot,
+			ExpectBody: handlerResponse{
+				URL:    "/d",
+				Method: "GET",
+				Header: make(http.Header),
+			},
+		},
+	})
+	qthttptest.AssertJSONCalls(c, makeHandler(c, http.StatusOK, "application/json"), calls)
+}
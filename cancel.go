@@ -0,0 +1,234 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// CancelMode specifies how AssertCancelledCall abandons a request.
+type CancelMode int
+
+const (
+	// CancelContext cancels the context of the client request.
+	CancelContext CancelMode = iota
+
+	// CloseConnection closes the client's connection
+	// to the server without cancelling the request.
+	CloseConnection
+)
+
+// CancelCallParams holds parameters for AssertCancelledCall.
+type CancelCallParams struct {
+	// DoRequestParams holds the request to make. The Handler field
+	// must be set and the URL must not contain a host. The Do and
+	// ExpectError fields are ignored.
+	DoRequestParams
+
+	// Mode specifies how the request is abandoned.
+	Mode CancelMode
+
+	// CancelAfter holds the number of response body bytes to read
+	// before abandoning the request. If it is negative, the request
+	// is abandoned as soon as the handler is called, before the
+	// response header is received.
+	CancelAfter int64
+
+	// Timeout holds how long to wait for the handler to return
+	// after the request is abandoned. If it is zero, five
+	// seconds is used.
+	Timeout time.Duration
+}
+
+// CancelResult describes how a handler reacted to
+// a request abandoned by AssertCancelledCall.
+type CancelResult struct {
+	// BytesRead holds the number of response body bytes
+	// read by the client before abandoning the request.
+	BytesRead int64
+
+	// BytesWritten holds the total number of response body
+	// bytes written successfully by the handler.
+	BytesWritten int64
+
+	// WritesAfterCancel holds the number of calls to Write
+	// made by the handler after the request was abandoned.
+	WritesAfterCancel int
+
+	// WriteErr holds the first error returned
+	// to the handler from Write, if any.
+	WriteErr error
+
+	// ContextErr holds the error from the request
+	// context when the handler returned.
+	ContextErr error
+
+	// ReturnDelay holds the time between the request being
+	// abandoned and the handler returning.
+	ReturnDelay time.Duration
+}
+
+// AssertCancelledCall makes the request described by p and abandons
+// it part way through as specified by p.Mode and p.CancelAfter, then
+// asserts that the handler returns within p.Timeout. It returns a
+// description of what the handler did, which can be used to assert
+// that it stopped writing, for example. Other effects, such as
+// logging or the release of resources, can be checked once
+// AssertCancelledCall has returned.
+//
+// Note that the server only notices that the connection has closed,
+// cancelling the request context, once the handler has read the
+// whole request body or has failed to write to the response.
+func AssertCancelledCall(c *qt.C, p CancelCallParams) CancelResult {
+	c.Assert(p.Handler, qt.Not(qt.IsNil), qt.Commentf("AssertCancelledCall requires a handler"))
+	if p.Method == "" {
+		p.Method = "GET"
+	}
+	if p.Timeout == 0 {
+		p.Timeout = 5 * time.Second
+	}
+	// The handler may still be running after we return,
+	// so it must not read DefaultClock then.
+	clock := DefaultClock
+	var (
+		mu        sync.Mutex
+		result    CancelResult
+		cancelled time.Time
+	)
+	entered := make(chan struct{})
+	returned := make(chan struct{})
+	var enterOnce sync.Once
+	handler := p.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		enterOnce.Do(func() {
+			close(entered)
+		})
+		defer func() {
+			mu.Lock()
+			result.ContextErr = req.Context().Err()
+			if !cancelled.IsZero() {
+				result.ReturnDelay = clock.Now().Sub(cancelled)
+			}
+			mu.Unlock()
+			close(returned)
+		}()
+		handler.ServeHTTP(&cancelResponseWriter{
+			ResponseWriter: w,
+			write: func(n int, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				result.BytesWritten += int64(n)
+				if err != nil && result.WriteErr == nil {
+					result.WriteErr = err
+				}
+				if !cancelled.IsZero() {
+					result.WritesAfterCancel++
+				}
+			},
+		}, req)
+	}))
+	defer func() {
+		select {
+		case <-returned:
+			srv.Close()
+		default:
+			// Close blocks until all handlers have returned,
+			// so don't wait for a handler that is stuck.
+			srv.CloseClientConnections()
+			go srv.Close()
+		}
+	}()
+
+	var conn net.Conn
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			mu.Lock()
+			conn = c
+			mu.Unlock()
+			return c, err
+		},
+	}
+	defer transport.CloseIdleConnections()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.URL = srv.URL + p.URL
+	p.Handler = nil
+	req, err := newRequest(p.DoRequestParams)
+	c.Assert(err, qt.Equals, nil)
+	req = req.WithContext(ctx)
+
+	abandon := func() {
+		mu.Lock()
+		cancelled = clock.Now()
+		conn := conn
+		mu.Unlock()
+		if p.Mode == CloseConnection {
+			conn.Close()
+		} else {
+			cancel()
+		}
+	}
+	if p.CancelAfter < 0 {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		select {
+		case <-entered:
+		case <-time.After(p.Timeout):
+			c.Fatalf("handler not called within %v", p.Timeout)
+		}
+		abandon()
+		<-done
+	} else {
+		resp, err := transport.RoundTrip(req)
+		c.Assert(err, qt.Equals, nil)
+		n, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, p.CancelAfter))
+		c.Assert(err, qt.Equals, nil)
+		c.Assert(n, qt.Equals, p.CancelAfter, qt.Commentf("response body ended before the request could be abandoned"))
+		result.BytesRead = n
+		abandon()
+		resp.Body.Close()
+	}
+	select {
+	case <-returned:
+	case <-time.After(p.Timeout):
+		c.Fatalf("handler did not return within %v of the request being abandoned", p.Timeout)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return result
+}
+
+type cancelResponseWriter struct {
+	http.ResponseWriter
+	write func(n int, err error)
+}
+
+func (w *cancelResponseWriter) Write(buf []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buf)
+	w.write(n, err)
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *cancelResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
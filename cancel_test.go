@@ -0,0 +1,102 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// streamingHandler writes lines until the request is cancelled.
+// If checkContext is false, it only notices cancellation
+// when a write fails.
+func streamingHandler(checkContext bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		line := strings.Repeat("x", 99) + "\n"
+		for {
+			if checkContext && req.Context().Err() != nil {
+				return
+			}
+			if _, err := w.Write([]byte(line)); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+func TestAssertCancelledCall(t *testing.T) {
+	c := qt.New(t)
+	for _, mode := range []qthttptest.CancelMode{qthttptest.CancelContext, qthttptest.CloseConnection} {
+		r := qthttptest.AssertCancelledCall(c, qthttptest.CancelCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: streamingHandler(true),
+				URL:     "/",
+			},
+			Mode:        mode,
+			CancelAfter: 250,
+		})
+		c.Assert(r.BytesRead, qt.Equals, int64(250))
+		c.Assert(r.BytesWritten >= 300, qt.Equals, true)
+		c.Assert(r.ContextErr, qt.Equals, context.Canceled)
+		c.Assert(r.ReturnDelay < time.Second, qt.Equals, true)
+	}
+}
+
+func TestAssertCancelledCallWriteError(t *testing.T) {
+	c := qt.New(t)
+	r := qthttptest.AssertCancelledCall(c, qthttptest.CancelCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: streamingHandler(false),
+			URL:     "/",
+		},
+		CancelAfter: 100,
+	})
+	c.Assert(r.WriteErr, qt.Not(qt.IsNil))
+	c.Assert(r.WritesAfterCancel > 0, qt.Equals, true)
+}
+
+func TestAssertCancelledCallBeforeResponse(t *testing.T) {
+	c := qt.New(t)
+	r := qthttptest.AssertCancelledCall(c, qthttptest.CancelCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				ioutil.ReadAll(req.Body)
+				<-req.Context().Done()
+			}),
+			Method: "POST",
+			URL:    "/",
+			Body:   strings.NewReader("data"),
+		},
+		CancelAfter: -1,
+	})
+	c.Assert(r.ContextErr, qt.Equals, context.Canceled)
+	c.Assert(r.BytesWritten, qt.Equals, int64(0))
+	c.Assert(r.WritesAfterCancel, qt.Equals, 0)
+}
+
+func TestAssertCancelledCallHandlerIgnoresCancellation(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `handler did not return within 50ms of the request being abandoned`, func(c *qt.C) {
+		qthttptest.AssertCancelledCall(c, qthttptest.CancelCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					time.Sleep(500 * time.Millisecond)
+				}),
+				URL: "/",
+			},
+			CancelAfter: -1,
+			Timeout:     50 * time.Millisecond,
+		})
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Challenge holds an authentication challenge parsed from a
+// WWW-Authenticate header as specified by RFC 7235.
+type Challenge struct {
+	// Scheme holds the authentication scheme, for example "Bearer".
+	Scheme string
+
+	// Params holds the auth parameters, keyed by lower-case
+	// name, for example "realm", "error" and "error_description".
+	Params map[string]string
+
+	// Token68 holds the token68 form of the challenge
+	// credentials, if present instead of parameters.
+	Token68 string
+}
+
+// ParseChallenges parses all the WWW-Authenticate headers in h.
+func ParseChallenges(h http.Header) ([]Challenge, error) {
+	var challenges []Challenge
+	for _, v := range h.Values("WWW-Authenticate") {
+		cs, err := parseChallenges(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WWW-Authenticate header %q: %v", v, err)
+		}
+		challenges = append(challenges, cs...)
+	}
+	return challenges, nil
+}
+
+// AssertChallenge asserts that the WWW-Authenticate headers in h
+// contain a challenge with the same scheme as expect, compared
+// case-insensitively, that has all the parameters in expect.Params.
+// Other parameters are ignored. If expect.Token68 is non-empty, it
+// must also match. It returns the challenge that was found.
+func AssertChallenge(c *qt.C, h http.Header, expect Challenge) Challenge {
+	challenges, err := ParseChallenges(h)
+	c.Assert(err, qt.Equals, nil)
+	for _, ch := range challenges {
+		if !strings.EqualFold(ch.Scheme, expect.Scheme) {
+			continue
+		}
+		for name, want := range expect.Params {
+			got, ok := ch.Params[strings.ToLower(name)]
+			c.Assert(ok, qt.Equals, true, qt.Commentf("no %q parameter in %s challenge %q", name, ch.Scheme, h.Values("WWW-Authenticate")))
+			c.Assert(got, qt.Equals, want, qt.Commentf("%q parameter of %s challenge", name, ch.Scheme))
+		}
+		if expect.Token68 != "" {
+			c.Assert(ch.Token68, qt.Equals, expect.Token68, qt.Commentf("token68 of %s challenge", ch.Scheme))
+		}
+		return ch
+	}
+	c.Fatalf("no %s challenge found in %q", expect.Scheme, h.Values("WWW-Authenticate"))
+	return Challenge{}
+}
+
+// parseChallenges parses a single WWW-Authenticate header value,
+// which may hold several comma-separated challenges.
+func parseChallenges(s string) ([]Challenge, error) {
+	var challenges []Challenge
+	s = strings.TrimLeft(s, " \t,")
+	for s != "" {
+		scheme, rest := challengeToken(s)
+		if scheme == "" {
+			return nil, fmt.Errorf("expected auth scheme at %q", s)
+		}
+		ch := Challenge{
+			Scheme: scheme,
+			Params: make(map[string]string),
+		}
+		s = strings.TrimLeft(rest, " \t")
+		if tok, rest, ok := token68(s); ok {
+			ch.Token68 = tok
+			s = rest
+		} else {
+			// Parse auth params until we find something
+			// that is not followed by '=', which must
+			// be the start of the next challenge.
+			for {
+				s = strings.TrimLeft(s, " \t,")
+				name, rest := challengeToken(s)
+				rest = strings.TrimLeft(rest, " \t")
+				if name == "" || rest == "" || rest[0] != '=' {
+					break
+				}
+				val, rest, err := parseParamValue(strings.TrimLeft(rest[1:], " \t"))
+				if err != nil {
+					return nil, err
+				}
+				name = strings.ToLower(name)
+				if _, ok := ch.Params[name]; ok {
+					return nil, fmt.Errorf("duplicate %q parameter", name)
+				}
+				ch.Params[name] = val
+				s = rest
+			}
+		}
+		challenges = append(challenges, ch)
+		s = strings.TrimLeft(s, " \t,")
+	}
+	return challenges, nil
+}
+
+// challengeToken returns the token at the start
+// of s and the rest of s.
+func challengeToken(s string) (tok, rest string) {
+	i := strings.IndexAny(s, " \t,=\"")
+	if i == -1 {
+		i = len(s)
+	}
+	return s[:i], s[i:]
+}
+
+// token68 returns the token68 at the start of s,
+// if there is one, and the rest of s.
+func token68(s string) (tok, rest string, ok bool) {
+	tok, rest = challengeToken(s)
+	if tok == "" {
+		return "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, "="))
+	after := strings.TrimLeft(rest[n:], " \t")
+	if after != "" && after[0] != ',' {
+		// It is an auth param name.
+		return "", "", false
+	}
+	return tok + rest[:n], rest[n:], true
+}
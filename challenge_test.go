@@ -0,0 +1,143 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var parseChallengesTests = []struct {
+	about       string
+	header      []string
+	expect      []qthttptest.Challenge
+	expectError string
+}{{
+	about:  "basic",
+	header: []string{`Basic realm="example"`},
+	expect: []qthttptest.Challenge{{
+		Scheme: "Basic",
+		Params: map[string]string{"realm": "example"},
+	}},
+}, {
+	about:  "bearer error",
+	header: []string{`Bearer realm="api", Error="invalid_token", error_description="The access token expired, sorry"`},
+	expect: []qthttptest.Challenge{{
+		Scheme: "Bearer",
+		Params: map[string]string{
+			"realm":             "api",
+			"error":             "invalid_token",
+			"error_description": "The access token expired, sorry",
+		},
+	}},
+}, {
+	about:  "multiple challenges in one header",
+	header: []string{`Newauth realm="apps", type=1, title="Login \"here\"", Basic realm="simple"`},
+	expect: []qthttptest.Challenge{{
+		Scheme: "Newauth",
+		Params: map[string]string{
+			"realm": "apps",
+			"type":  "1",
+			"title": `Login "here"`,
+		},
+	}, {
+		Scheme: "Basic",
+		Params: map[string]string{"realm": "simple"},
+	}},
+}, {
+	about:  "multiple headers, no params and token68",
+	header: []string{`Negotiate`, `Negotiate abc+/def==, Basic`},
+	expect: []qthttptest.Challenge{{
+		Scheme: "Negotiate",
+		Params: map[string]string{},
+	}, {
+		Scheme:  "Negotiate",
+		Params:  map[string]string{},
+		Token68: "abc+/def==",
+	}, {
+		Scheme: "Basic",
+		Params: map[string]string{},
+	}},
+}, {
+	about:       "unterminated quote",
+	header:      []string{`Basic realm="example`},
+	expectError: `invalid WWW-Authenticate header "Basic realm=\\"example": unterminated quoted string`,
+}, {
+	about:       "duplicate parameter",
+	header:      []string{`Basic realm=a, realm=b`},
+	expectError: `invalid WWW-Authenticate header .*: duplicate "realm" parameter`,
+}, {
+	about:       "missing scheme",
+	header:      []string{`="x"`},
+	expectError: `invalid WWW-Authenticate header .*: expected auth scheme at "=\\"x\\""`,
+}}
+
+func TestParseChallenges(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parseChallengesTests {
+		c.Run(test.about, func(c *qt.C) {
+			challenges, err := qthttptest.ParseChallenges(http.Header{
+				"Www-Authenticate": test.header,
+			})
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+				return
+			}
+			c.Assert(err, qt.Equals, nil)
+			c.Assert(challenges, qt.DeepEquals, test.expect)
+		})
+	}
+}
+
+func TestAssertChallenge(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{
+		"Www-Authenticate": {`Basic realm="x"`, `bearer realm="api", error="invalid_token"`},
+	}
+	ch := qthttptest.AssertChallenge(c, h, qthttptest.Challenge{
+		Scheme: "Bearer",
+		Params: map[string]string{"Error": "invalid_token"},
+	})
+	c.Assert(ch.Params["realm"], qt.Equals, "api")
+
+	checkFails(c, `no Digest challenge found`, func(c *qt.C) {
+		qthttptest.AssertChallenge(c, h, qthttptest.Challenge{Scheme: "Digest"})
+	})
+	checkFails(c, `"error" parameter of bearer challenge`, func(c *qt.C) {
+		qthttptest.AssertChallenge(c, h, qthttptest.Challenge{
+			Scheme: "Bearer",
+			Params: map[string]string{"error": "insufficient_scope"},
+		})
+	})
+	checkFails(c, `no "scope" parameter in bearer challenge`, func(c *qt.C) {
+		qthttptest.AssertChallenge(c, h, qthttptest.Challenge{
+			Scheme: "Bearer",
+			Params: map[string]string{"scope": "read"},
+		})
+	})
+}
+
+func TestAssertJSONCallWithExpectChallenge(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token", error_description="expired"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:      handler,
+		URL:          "/",
+		ExpectStatus: http.StatusUnauthorized,
+		ExpectChallenge: &qthttptest.Challenge{
+			Scheme: "Bearer",
+			Params: map[string]string{
+				"error":             "invalid_token",
+				"error_description": "expired",
+			},
+		},
+	})
+}
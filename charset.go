@@ -0,0 +1,149 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// charsetDecoders holds the functions used to transcode response
+// bodies to UTF-8, keyed by lower-case charset name.
+var charsetDecoders = map[string]func([]byte) ([]byte, error){
+	"utf-8":        decodeUTF8,
+	"utf8":         decodeUTF8,
+	"us-ascii":     decodeASCII,
+	"ascii":        decodeASCII,
+	"iso-8859-1":   decodeLatin1,
+	"iso8859-1":    decodeLatin1,
+	"latin1":       decodeLatin1,
+	"windows-1252": decodeWindows1252,
+	"cp1252":       decodeWindows1252,
+	"utf-16":       decodeUTF16(nil),
+	"utf-16be":     decodeUTF16(bigEndian),
+	"utf-16le":     decodeUTF16(littleEndian),
+}
+
+// decodeBodyCharset returns the given response body transcoded to
+// UTF-8 according to the charset parameter of the given Content-Type
+// header value. If there is no charset parameter, the body is returned
+// unchanged.
+func decodeBodyCharset(ctype string, body []byte) ([]byte, error) {
+	if ctype == "" {
+		return body, nil
+	}
+	_, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %v", ctype, err)
+	}
+	charset := strings.ToLower(params["charset"])
+	if charset == "" {
+		return body, nil
+	}
+	decode := charsetDecoders[charset]
+	if decode == nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	data, err := decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode body as %s: %v", charset, err)
+	}
+	return data, nil
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func decodeUTF8(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("invalid UTF-8")
+	}
+	return data, nil
+}
+
+func decodeASCII(data []byte) ([]byte, error) {
+	for i, b := range data {
+		if b >= utf8.RuneSelf {
+			return nil, fmt.Errorf("non-ASCII byte %#x at offset %d", b, i)
+		}
+	}
+	return data, nil
+}
+
+func decodeLatin1(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, b := range data {
+		buf.WriteRune(rune(b))
+	}
+	return buf.Bytes(), nil
+}
+
+// windows1252 holds the code points for bytes 0x80 to 0x9f
+// in the Windows-1252 encoding. Zero entries are undefined.
+var windows1252 = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+func decodeWindows1252(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, b := range data {
+		r := rune(b)
+		if b >= 0x80 && b <= 0x9f {
+			r = windows1252[b-0x80]
+			if r == 0 {
+				return nil, fmt.Errorf("undefined byte %#x at offset %d", b, i)
+			}
+		}
+		buf.WriteRune(r)
+	}
+	return buf.Bytes(), nil
+}
+
+type byteOrder func(b0, b1 byte) uint16
+
+func bigEndian(b0, b1 byte) uint16 {
+	return uint16(b0)<<8 | uint16(b1)
+}
+
+func littleEndian(b0, b1 byte) uint16 {
+	return uint16(b1)<<8 | uint16(b0)
+}
+
+// decodeUTF16 returns a function that decodes UTF-16 using the given
+// byte order. If order is nil, the byte order is determined from the
+// byte order mark if present, defaulting to big-endian as specified
+// by RFC 2781.
+func decodeUTF16(order byteOrder) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("odd number of bytes")
+		}
+		order := order
+		if order == nil {
+			order = bigEndian
+			if bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+				order = littleEndian
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i < len(data); i += 2 {
+			units = append(units, order(data[i], data[i+1]))
+		}
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		var buf bytes.Buffer
+		for _, r := range utf16.Decode(units) {
+			buf.WriteRune(r)
+		}
+		return buf.Bytes(), nil
+	}
+}
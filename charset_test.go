@@ -0,0 +1,87 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var charsetTests = []struct {
+	about  string
+	ctype  string
+	body   string
+	expect string
+}{{
+	about: "no charset",
+	ctype: "application/json",
+	body:  "\"caf\xc3\xa9\"",
+}, {
+	about: "utf-8 with BOM",
+	ctype: "application/json; charset=UTF-8",
+	body:  "\xef\xbb\xbf\"caf\xc3\xa9\"",
+}, {
+	about: "iso-8859-1",
+	ctype: "application/json; charset=ISO-8859-1",
+	body:  "\"caf\xe9\"",
+}, {
+	about:  "windows-1252",
+	ctype:  "application/json; charset=windows-1252",
+	body:   "\"caf\xe9 \x80\"",
+	expect: "café €",
+}, {
+	about: "utf-16 with little-endian BOM",
+	ctype: "application/json; charset=utf-16",
+	body:  "\xff\xfe\"\x00c\x00a\x00f\x00\xe9\x00\"\x00",
+}, {
+	about: "utf-16 without BOM",
+	ctype: "application/json; charset=utf-16",
+	body:  "\x00\"\x00c\x00a\x00f\x00\xe9\x00\"",
+}, {
+	about: "utf-16be",
+	ctype: "application/json; charset=utf-16be",
+	body:  "\x00\"\x00c\x00a\x00f\x00\xe9\x00\"",
+}, {
+	about: "utf-16le",
+	ctype: "application/json; charset=utf-16le",
+	body:  "\"\x00c\x00a\x00f\x00\xe9\x00\"\x00",
+}}
+
+func TestAssertJSONCallWithCharset(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range charsetTests {
+		c.Run(test.about, func(c *qt.C) {
+			expect := test.expect
+			if expect == "" {
+				expect = "café"
+			}
+			qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+				URL: "/",
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Header().Set("Content-Type", test.ctype)
+					w.Write([]byte(test.body))
+				}),
+				ExpectBody: expect,
+			})
+		})
+	}
+}
+
+func TestAssertJSONCallWithUnsupportedCharset(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `comment:\n  body: "\\"caf\\xe9\\""\n`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL: "/",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json; charset=koi8-r")
+				w.Write([]byte("\"caf\xe9\""))
+			}),
+			ExpectBody: "café",
+		})
+	})
+}
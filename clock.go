@@ -0,0 +1,158 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Clock provides the current time and timers to the helpers in this
+// package that wait for or measure time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current
+	// time once the given duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// DefaultClock holds the clock used by the helpers in this package
+// that wait for or measure time. Tests can replace it to control time
+// instead of sleeping, for example with a FakeClock:
+//
+//	clock := qthttptest.NewFakeClock(time.Now())
+//	c.Patch(&qthttptest.DefaultClock, clock)
+//
+// A SkewedClock can be used to simulate a client with a wrong clock.
+//
+// WaitForURL and WaitForHealthy use it to pace their attempts and
+// to decide when to give up. Do, AssertJSONCall, AssertLoad,
+// AssertStreamCall, AssertCancelledCall and AccessLog use it to
+// measure durations. ParseRateLimit, RateLimitTracker,
+// AssertSetCookies and AssertDateHeader use it as the current time,
+// as do OAuth2Server and OIDCProvider for the expiry of their tokens.
+// AssertLongPoll and DribbleHandler use it to wait.
+//
+// Timeouts that guard against leaked goroutines and stuck
+// servers always use real time.
+var DefaultClock Clock = systemClock{}
+
+// systemClock is the Clock implemented by the time package.
+type systemClock struct{}
+
+// Now implements Clock.Now.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.After.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// fakeClockTimeout holds how long FakeClock.WaitForTimers
+// waits in real time.
+const fakeClockTimeout = 5 * time.Second
+
+// FakeClock is a Clock whose time changes only when Advance is called.
+// It is safe to use concurrently.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	// changed is closed and replaced when a timer is added.
+	changed chan struct{}
+}
+
+// fakeTimer is a timer created by FakeClock.After.
+type fakeTimer struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock returns a FakeClock with the given current time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now implements Clock.Now.
+func (clock *FakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// After implements Clock.After. The channel receives the time
+// when Advance moves the clock to or past the timer's deadline,
+// or immediately if d is not positive.
+func (clock *FakeClock) After(d time.Duration) <-chan time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- clock.now
+		return ch
+	}
+	clock.timers = append(clock.timers, fakeTimer{
+		deadline: clock.now.Add(d),
+		ch:       ch,
+	})
+	close(clock.changed)
+	clock.changed = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing any
+// timers whose deadlines are reached, earliest first.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+	sort.SliceStable(clock.timers, func(i, j int) bool {
+		return clock.timers[i].deadline.Before(clock.timers[j].deadline)
+	})
+	n := 0
+	for n < len(clock.timers) && !clock.timers[n].deadline.After(clock.now) {
+		clock.timers[n].ch <- clock.now
+		n++
+	}
+	clock.timers = append(clock.timers[:0], clock.timers[n:]...)
+}
+
+// Timers returns the number of timers that have not fired yet,
+// including any that are no longer being waited for.
+func (clock *FakeClock) Timers() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return len(clock.timers)
+}
+
+// WaitForTimers waits until at least n timers are waiting to fire,
+// so that the code under test is known to be waiting for the clock
+// before it is advanced. It fails the test if that does not happen
+// within five seconds of real time.
+func (clock *FakeClock) WaitForTimers(c *qt.C, n int) {
+	timeout := time.After(fakeClockTimeout)
+	for {
+		clock.mu.Lock()
+		count, changed := len(clock.timers), clock.changed
+		clock.mu.Unlock()
+		if count >= n {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			c.Fatalf("%d timers waiting after %v, want %d", count, fakeClockTimeout, n)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var epoch = time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func TestFakeClock(t *testing.T) {
+	c := qt.New(t)
+	clock := qthttptest.NewFakeClock(epoch)
+	c.Assert(clock.Now(), qt.Equals, epoch)
+	ch1 := clock.After(2 * time.Second)
+	ch2 := clock.After(time.Second)
+	c.Assert(<-clock.After(0), qt.Equals, epoch)
+	clock.WaitForTimers(c, 2)
+
+	clock.Advance(time.Second)
+	c.Assert(<-ch2, qt.Equals, epoch.Add(time.Second))
+	select {
+	case <-ch1:
+		c.Fatalf("timer fired early")
+	default:
+	}
+	c.Assert(clock.Timers(), qt.Equals, 1)
+	clock.Advance(time.Minute)
+	c.Assert(<-ch1, qt.Equals, epoch.Add(time.Minute+time.Second))
+	c.Assert(clock.Timers(), qt.Equals, 0)
+}
+
+// advance advances clock by d each time a timer is
+// waiting, n times.
+func advance(c *qt.C, clock *qthttptest.FakeClock, d time.Duration, n int) {
+	go func() {
+		for i := 0; i < n; i++ {
+			clock.WaitForTimers(c, 1)
+			clock.Advance(d)
+		}
+	}()
+}
+
+func TestWaitForURLWithFakeClock(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	clock := qthttptest.NewFakeClock(epoch)
+	c.Patch(&qthttptest.DefaultClock, clock)
+
+	srv := qthttptest.NewServer(c, startingHandler(2))
+	advance(c, clock, 50*time.Millisecond, 2)
+	qthttptest.WaitForURL(c, srv.URL()+"/health", time.Minute)
+
+	srv = qthttptest.NewServer(c, startingHandler(1000))
+	advance(c, clock, 30*time.Second, 2)
+	checkFails(c, `http://.*/health not ready after 1m0s \(3 attempts\); last attempt: status 503`, func(c *qt.C) {
+		qthttptest.WaitForURL(c, srv.URL()+"/health", time.Minute)
+	})
+}
+
+func TestAssertJSONCallWithFakeClock(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	clock := qthttptest.NewFakeClock(epoch)
+	c.Patch(&qthttptest.DefaultClock, clock)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clock.Advance(time.Second)
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:           handler,
+		URL:               "/",
+		ExpectMaxDuration: time.Second,
+	})
+	checkFails(c, `call took 1s, longer than 999ms`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:           handler,
+			URL:               "/",
+			ExpectMaxDuration: 999 * time.Millisecond,
+		})
+	})
+}
+
+func TestAccessLogWithFakeClock(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	clock := qthttptest.NewFakeClock(epoch)
+	c.Patch(&qthttptest.DefaultClock, clock)
+	l := &qthttptest.AccessLog{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			clock.Advance(time.Minute)
+		}),
+	}
+	qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		Handler: l,
+		URL:     "/",
+	})
+	c.Assert(l.LastEntry(c).Duration, qt.Equals, time.Minute)
+}
+
+func TestRateLimitTrackerWithFakeClock(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	clock := qthttptest.NewFakeClock(epoch)
+	c.Patch(&qthttptest.DefaultClock, clock)
+	h := http.Header{
+		"Ratelimit-Limit":     {"5"},
+		"Ratelimit-Remaining": {"4"},
+		"Ratelimit-Reset":     {"10"},
+	}
+	var tracker qthttptest.RateLimitTracker
+	rl := tracker.Observe(c, h)
+	c.Assert(rl.Reset, qt.Equals, epoch.Add(10*time.Second))
+
+	h.Set("Ratelimit-Reset", "1641136000")
+	clock.Advance(time.Hour)
+	checkFails(c, `reset time .* is in the past`, func(c *qt.C) {
+		var tracker qthttptest.RateLimitTracker
+		tracker.Observe(c, h)
+	})
+}
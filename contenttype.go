@@ -0,0 +1,90 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ContentTypeMatches is a checker that checks whether a Content-Type
+// header value matches the given media type pattern.
+//
+// The pattern holds a media type, optionally followed by parameters,
+// for instance "application/json" or "text/plain; charset=utf-8". The
+// type and subtype may contain shell-style wildcards as understood by
+// path.Match, so "application/*+json" matches
+// "application/vnd.api+json" and "*/*" matches any media type.
+//
+// Parameters in the obtained value that are not mentioned in the
+// pattern are ignored. Parameters that are mentioned must be present
+// with the same value. Media types, parameter names and the charset
+// parameter value are compared case-insensitively.
+//
+// For instance:
+//
+//	c.Assert(resp.Header.Get("Content-Type"), qthttptest.ContentTypeMatches, "application/json")
+var ContentTypeMatches qt.Checker = &contentTypeChecker{
+	argNames: []string{"got", "pattern"},
+}
+
+type contentTypeChecker struct {
+	argNames
+}
+
+// Check implements qt.Checker.Check.
+func (c *contentTypeChecker) Check(got interface{}, args []interface{}, note func(key string, value interface{})) error {
+	gotStr, ok := got.(string)
+	if !ok {
+		return qt.BadCheckf("first argument is not a string")
+	}
+	pattern, ok := args[0].(string)
+	if !ok {
+		return qt.BadCheckf("pattern is not a string")
+	}
+	return matchContentType(gotStr, pattern)
+}
+
+// matchContentType checks that the Content-Type header value ctype
+// matches the given pattern as described in ContentTypeMatches.
+func matchContentType(ctype, pattern string) error {
+	wantType, wantParams, err := mime.ParseMediaType(pattern)
+	if err != nil {
+		return qt.BadCheckf("invalid content type pattern %q: %v", pattern, err)
+	}
+	if ctype == "" {
+		return fmt.Errorf("no content type found")
+	}
+	gotType, gotParams, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %v", ctype, err)
+	}
+	if ok, err := path.Match(wantType, gotType); err != nil {
+		return qt.BadCheckf("invalid content type pattern %q: %v", pattern, err)
+	} else if !ok {
+		return fmt.Errorf("media type %q does not match %q", gotType, wantType)
+	}
+	for name, want := range wantParams {
+		got, ok := gotParams[name]
+		if !ok {
+			return fmt.Errorf("parameter %q not found in %q", name, ctype)
+		}
+		if got != want && !(name == "charset" && strings.EqualFold(got, want)) {
+			return fmt.Errorf("parameter %q has value %q, want %q", name, got, want)
+		}
+	}
+	return nil
+}
+
+// argNames helps implementing qt.Checker.ArgNames.
+type argNames []string
+
+// ArgNames implements qt.Checker.ArgNames by returning the argument names.
+func (a argNames) ArgNames() []string {
+	return a
+}
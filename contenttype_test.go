@@ -0,0 +1,86 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var contentTypeMatchesTests = []struct {
+	about       string
+	ctype       string
+	pattern     string
+	expectError string
+}{{
+	about:   "exact match",
+	ctype:   "application/json",
+	pattern: "application/json",
+}, {
+	about:   "parameters ignored",
+	ctype:   "application/json; charset=utf-8",
+	pattern: "application/json",
+}, {
+	about:   "case insensitive media type",
+	ctype:   "Application/JSON",
+	pattern: "application/json",
+}, {
+	about:   "parameter match",
+	ctype:   "text/plain; charset=UTF-8; format=flowed",
+	pattern: "text/plain; charset=utf-8",
+}, {
+	about:       "parameter mismatch",
+	ctype:       "text/plain; charset=iso-8859-1",
+	pattern:     "text/plain; charset=utf-8",
+	expectError: `parameter "charset" has value "iso-8859-1", want "utf-8"`,
+}, {
+	about:       "parameter missing",
+	ctype:       "text/plain",
+	pattern:     "text/plain; charset=utf-8",
+	expectError: `parameter "charset" not found in "text/plain"`,
+}, {
+	about:   "subtype wildcard",
+	ctype:   "application/vnd.api+json; charset=utf-8",
+	pattern: "application/*+json",
+}, {
+	about:   "full wildcard",
+	ctype:   "image/png",
+	pattern: "*/*",
+}, {
+	about:       "media type mismatch",
+	ctype:       "text/html",
+	pattern:     "application/*+json",
+	expectError: `media type "text/html" does not match "application/\*\+json"`,
+}, {
+	about:       "wildcard does not match slash",
+	ctype:       "application/json",
+	pattern:     "*",
+	expectError: `.*`,
+}, {
+	about:       "no content type",
+	pattern:     "application/json",
+	expectError: `no content type found`,
+}, {
+	about:       "bad pattern",
+	ctype:       "application/json",
+	pattern:     "application/json;;",
+	expectError: `bad check: invalid content type pattern .*`,
+}}
+
+func TestContentTypeMatches(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range contentTypeMatchesTests {
+		c.Run(test.about, func(c *qt.C) {
+			err := qthttptest.ContentTypeMatches.Check(test.ctype, []interface{}{test.pattern}, func(string, interface{}) {})
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+			} else {
+				c.Assert(err, qt.Equals, nil)
+			}
+		})
+	}
+}
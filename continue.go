@@ -0,0 +1,136 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ContinueCallParams holds parameters for AssertContinueCall.
+type ContinueCallParams struct {
+	// DoRequestParams holds the request to make. It should have a
+	// body. Method defaults to POST. If Do is nil, a client that
+	// waits up to ContinueTimeout for the interim response is used.
+	DoRequestParams
+
+	// ContinueTimeout holds how long the client waits for the 100
+	// (Continue) response before sending the body anyway. If it is
+	// zero, five seconds is used. It is ignored if Do is non-nil.
+	ContinueTimeout time.Duration
+
+	// ExpectStatus holds the expected status of the final response.
+	// http.StatusOK is assumed if this is zero.
+	ExpectStatus int
+
+	// ExpectContinue specifies that the server must send a 100
+	// (Continue) response before the body is uploaded. If it is
+	// false, the server must instead reject the request early: no
+	// 100 response may be sent and the body must not be uploaded.
+	ExpectContinue bool
+}
+
+// ContinueResult holds the result of AssertContinueCall.
+type ContinueResult struct {
+	// Got100Continue records whether a 100 (Continue)
+	// response was received.
+	Got100Continue bool
+
+	// BodySent holds the number of body bytes read by the client.
+	BodySent int64
+
+	// Resp holds the final response.
+	Resp *Resp
+}
+
+// AssertContinueCall makes a request with an "Expect: 100-continue"
+// header and asserts whether the server sent the interim 100
+// (Continue) response before the client uploaded the body, as
+// specified by p.ExpectContinue. This can be used to test handlers
+// that inspect the request headers and reject unwanted uploads
+// before reading the body.
+func AssertContinueCall(c *qt.C, p ContinueCallParams) ContinueResult {
+	if p.Method == "" {
+		p.Method = "POST"
+	}
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if p.Do == nil {
+		timeout := p.ContinueTimeout
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ExpectContinueTimeout = timeout
+		c.Cleanup(transport.CloseIdleConnections)
+		p.Do = (&http.Client{Transport: transport}).Do
+	}
+	p.Header = cloneHeader(p.Header)
+	p.Header.Set("Expect", "100-continue")
+
+	var (
+		mu            sync.Mutex
+		result        ContinueResult
+		readBefore100 bool
+	)
+	do := p.Do
+	p.Do = func(req *http.Request) (*http.Response, error) {
+		trace := &httptrace.ClientTrace{
+			Got100Continue: func() {
+				mu.Lock()
+				defer mu.Unlock()
+				result.Got100Continue = true
+			},
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		if req.Body != nil {
+			req.Body = &continueBody{
+				ReadCloser: req.Body,
+				onRead: func(n int) {
+					mu.Lock()
+					defer mu.Unlock()
+					if !result.Got100Continue && n > 0 {
+						readBefore100 = true
+					}
+					result.BodySent += int64(n)
+				},
+			}
+		}
+		return do(req)
+	}
+	resp := DoResponse(c, p.DoRequestParams)
+	if resp == nil {
+		return ContinueResult{}
+	}
+	resp.AssertStatus(c, p.ExpectStatus)
+	mu.Lock()
+	defer mu.Unlock()
+	result.Resp = resp
+	if p.ExpectContinue {
+		c.Assert(result.Got100Continue, qt.Equals, true, qt.Commentf("no 100 Continue response received"))
+		c.Assert(readBefore100, qt.Equals, false, qt.Commentf("body uploaded before 100 Continue response"))
+	} else {
+		c.Assert(result.Got100Continue, qt.Equals, false, qt.Commentf("unexpected 100 Continue response"))
+		c.Assert(result.BodySent, qt.Equals, int64(0), qt.Commentf("body uploaded although request was rejected"))
+	}
+	return result
+}
+
+// continueBody wraps a request body to report reads from it.
+type continueBody struct {
+	io.ReadCloser
+	onRead func(n int)
+}
+
+func (b *continueBody) Read(buf []byte) (int, error) {
+	n, err := b.ReadCloser.Read(buf)
+	b.onRead(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// uploadHandler accepts uploads only from authorized clients,
+// rejecting others without reading the body.
+var uploadHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "ok" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	n, _ := io.Copy(ioutil.Discard, req.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"n":` + strconv.FormatInt(n, 10) + `}`))
+})
+
+func TestAssertContinueCall(t *testing.T) {
+	c := qt.New(t)
+	body := bytes.Repeat([]byte("x"), 1<<20)
+	result := qthttptest.AssertContinueCall(c, qthttptest.ContinueCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: uploadHandler,
+			URL:     "/upload",
+			Header:  http.Header{"Authorization": {"ok"}},
+			Body:    bytes.NewReader(body),
+		},
+		ExpectContinue: true,
+	})
+	c.Assert(result.Got100Continue, qt.Equals, true)
+	c.Assert(result.BodySent, qt.Equals, int64(len(body)))
+	result.Resp.AssertJSON(c, map[string]int{"n": len(body)})
+
+	result = qthttptest.AssertContinueCall(c, qthttptest.ContinueCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: uploadHandler,
+			URL:     "/upload",
+			Body:    bytes.NewReader(body),
+		},
+		ExpectStatus: http.StatusForbidden,
+	})
+	c.Assert(result.Got100Continue, qt.Equals, false)
+	c.Assert(result.BodySent, qt.Equals, int64(0))
+
+	checkFails(c, `no 100 Continue response received`, func(c *qt.C) {
+		qthttptest.AssertContinueCall(c, qthttptest.ContinueCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: uploadHandler,
+				URL:     "/upload",
+				Body:    bytes.NewReader(body),
+			},
+			ExpectStatus:   http.StatusForbidden,
+			ExpectContinue: true,
+		})
+	})
+	checkFails(c, `unexpected 100 Continue response`, func(c *qt.C) {
+		qthttptest.AssertContinueCall(c, qthttptest.ContinueCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: uploadHandler,
+				URL:     "/upload",
+				Header:  http.Header{"Authorization": {"ok"}},
+				Body:    bytes.NewReader(body),
+			},
+		})
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// CountedHandler is an http.Handler that counts the number of
+// times it is called. It can be used to check that an expensive
+// handler behind a cache or conditional request check is not
+// called more often than expected.
+type CountedHandler struct {
+	// Handler, if non-nil, is used to respond to requests.
+	Handler http.Handler
+
+	n int64
+}
+
+// Counted returns a handler that counts calls to h.
+func Counted(h http.Handler) *CountedHandler {
+	return &CountedHandler{
+		Handler: h,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *CountedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&h.n, 1)
+	if h.Handler != nil {
+		h.Handler.ServeHTTP(w, req)
+	}
+}
+
+// Count returns the number of times the handler has been called.
+func (h *CountedHandler) Count() int {
+	return int(atomic.LoadInt64(&h.n))
+}
+
+// Reset resets the count to zero.
+func (h *CountedHandler) Reset() {
+	atomic.StoreInt64(&h.n, 0)
+}
+
+// AssertCount asserts that the handler has
+// been called exactly n times.
+func (h *CountedHandler) AssertCount(c *qt.C, n int) {
+	c.Assert(h.Count(), qt.Equals, n, qt.Commentf("handler calls"))
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestCounted(t *testing.T) {
+	c := qt.New(t)
+	expensive := qthttptest.Counted(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"expensive"`))
+	}))
+	// The front handler answers conditional requests
+	// without calling the expensive handler.
+	front := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		expensive.ServeHTTP(w, req)
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:    front,
+		URL:        "/",
+		ExpectBody: "expensive",
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:      front,
+		URL:          "/",
+		Header:       http.Header{"If-None-Match": {`"v1"`}},
+		ExpectStatus: http.StatusNotModified,
+	})
+	expensive.AssertCount(c, 1)
+	checkFails(c, `comment:
+  handler calls
+got:
+  int\(1\)
+want:
+  int\(2\)
+`, func(c *qt.C) {
+		expensive.AssertCount(c, 2)
+	})
+	expensive.Reset()
+	c.Assert(expensive.Count(), qt.Equals, 0)
+}
+
+func TestAssertJSONCallWithExpectHandlerCalls(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/old" {
+			http.Redirect(w, req, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"new"`))
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:            handler,
+		URL:                "/old",
+		ExpectBody:         "new",
+		ExpectHandlerCalls: 2,
+	})
+	checkFails(c, `comment:
+  handler calls
+got:
+  int\(1\)
+want:
+  int\(2\)
+`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:            handler,
+			URL:                "/new",
+			ExpectBody:         "new",
+			ExpectHandlerCalls: 2,
+		})
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// AssertDateHeader asserts that h holds a single Date header in the
+// IMF-fixdate format required of senders by RFC 7231, such as "Sun, 06
+// Nov 1994 08:49:37 GMT", and returns the time it holds. The obsolete
+// RFC 850 and asctime formats are rejected.
+//
+// If tolerance is non-zero, it also asserts that the date is within
+// tolerance of the current time according to DefaultClock. As the
+// header only holds whole seconds, the current time is truncated to
+// the second before comparing.
+func AssertDateHeader(c *qt.C, h http.Header, tolerance time.Duration) time.Time {
+	dates := h.Values("Date")
+	c.Assert(dates, qt.HasLen, 1, qt.Commentf("Date headers"))
+	date, err := time.Parse(http.TimeFormat, dates[0])
+	c.Assert(err, qt.Equals, nil, qt.Commentf("Date header %q is not in IMF-fixdate format", dates[0]))
+	c.Assert(date.Format(http.TimeFormat), qt.Equals, dates[0], qt.Commentf("Date header %q is not in IMF-fixdate format", dates[0]))
+	if tolerance != 0 {
+		now := DefaultClock.Now().Truncate(time.Second)
+		skew := date.Sub(now)
+		if skew < 0 {
+			skew = -skew
+		}
+		c.Assert(skew <= tolerance, qt.Equals, true, qt.Commentf("Date header %q is %v from the current time %v, more than %v", dates[0], date.Sub(now), now.UTC().Format(http.TimeFormat), tolerance))
+	}
+	return date
+}
+
+// SkewedClock returns a Clock whose current time is skew ahead of
+// that of clock, or behind it if skew is negative. Its timers are
+// those of clock.
+//
+// It can be used to simulate a client whose clock is wrong, for
+// example to test that a handler tolerates tokens issued by an
+// OIDCProvider or OAuth2Server, or cookie dates checked by
+// AssertSetCookies, that are slightly in the future or the past:
+//
+//	c.Patch(&qthttptest.DefaultClock, qthttptest.SkewedClock(qthttptest.DefaultClock, 5*time.Minute))
+func SkewedClock(clock Clock, skew time.Duration) Clock {
+	return skewedClock{
+		Clock: clock,
+		skew:  skew,
+	}
+}
+
+type skewedClock struct {
+	Clock
+	skew time.Duration
+}
+
+// Now implements Clock.Now.
+func (clock skewedClock) Now() time.Time {
+	return clock.Clock.Now().Add(clock.skew)
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestAssertDateHeader(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	clock := qthttptest.NewFakeClock(epoch.Add(500 * time.Millisecond))
+	c.Patch(&qthttptest.DefaultClock, clock)
+
+	date := qthttptest.AssertDateHeader(c, http.Header{
+		"Date": {"Sun, 02 Jan 2022 15:04:35 GMT"},
+	}, 30*time.Second)
+	c.Assert(date, qt.Equals, epoch.Add(30*time.Second))
+
+	// The tolerance is not checked when it is zero.
+	qthttptest.AssertDateHeader(c, http.Header{
+		"Date": {"Sun, 06 Nov 1994 08:49:37 GMT"},
+	}, 0)
+
+	checkFails(c, `Date header "Sun, 02 Jan 2022 15:04:36 GMT" is 31s from the current time Sun, 02 Jan 2022 15:04:05 GMT, more than 30s`, func(c *qt.C) {
+		qthttptest.AssertDateHeader(c, http.Header{
+			"Date": {"Sun, 02 Jan 2022 15:04:36 GMT"},
+		}, 30*time.Second)
+	})
+	checkFails(c, `Date header "Sunday, 02-Jan-22 15:04:05 GMT" is not in IMF-fixdate format`, func(c *qt.C) {
+		qthttptest.AssertDateHeader(c, http.Header{
+			"Date": {"Sunday, 02-Jan-22 15:04:05 GMT"},
+		}, 0)
+	})
+	checkFails(c, `Date header "Sun, 2 Jan 2022 15:04:05 GMT" is not in IMF-fixdate format`, func(c *qt.C) {
+		qthttptest.AssertDateHeader(c, http.Header{
+			"Date": {"Sun, 2 Jan 2022 15:04:05 GMT"},
+		}, 0)
+	})
+	checkFails(c, `Date headers`, func(c *qt.C) {
+		qthttptest.AssertDateHeader(c, http.Header{}, 0)
+	})
+}
+
+func TestSkewedClock(t *testing.T) {
+	c := qt.New(t)
+	clock := qthttptest.NewFakeClock(epoch)
+	skewed := qthttptest.SkewedClock(clock, -time.Minute)
+	c.Assert(skewed.Now(), qt.Equals, epoch.Add(-time.Minute))
+	ch := skewed.After(time.Second)
+	clock.Advance(time.Second)
+	c.Assert(<-ch, qt.Equals, epoch.Add(time.Second))
+	c.Assert(skewed.Now(), qt.Equals, epoch.Add(-time.Minute+time.Second))
+}
+
+func TestAssertJSONCallWithExpectDateWithin(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:          handler,
+		URL:              "/",
+		ExpectDateWithin: time.Minute,
+	})
+	c.Patch(&qthttptest.DefaultClock, qthttptest.SkewedClock(qthttptest.DefaultClock, time.Hour))
+	checkFails(c, `Date header ".*" is -1h0m[0-9]+s from the current time .*, more than 1m0s`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:          handler,
+			URL:              "/",
+			ExpectDateWithin: time.Minute,
+		})
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ContentDisposition holds a parsed Content-Disposition header as
+// specified by RFC 6266.
+type ContentDisposition struct {
+	// Type holds the disposition type, lower-cased,
+	// for example "attachment" or "inline".
+	Type string
+
+	// Filename holds the file name. It is taken from the
+	// filename* parameter, decoded as specified by RFC 5987,
+	// if that is present, and from the filename parameter
+	// otherwise.
+	Filename string
+
+	// Params holds all the parameters as found in the header,
+	// keyed by lower-case name, so the filename and filename*
+	// parameters can be checked separately.
+	Params map[string]string
+}
+
+// ParseContentDisposition parses a Content-Disposition header value.
+func ParseContentDisposition(s string) (ContentDisposition, error) {
+	d, err := parseContentDisposition(s)
+	if err != nil {
+		return ContentDisposition{}, fmt.Errorf("invalid Content-Disposition header %q: %v", s, err)
+	}
+	return d, nil
+}
+
+func parseContentDisposition(s string) (ContentDisposition, error) {
+	i := strings.IndexByte(s, ';')
+	if i == -1 {
+		i = len(s)
+	}
+	d := ContentDisposition{
+		Type:   strings.ToLower(strings.TrimSpace(s[:i])),
+		Params: make(map[string]string),
+	}
+	if d.Type == "" {
+		return ContentDisposition{}, fmt.Errorf("no disposition type")
+	}
+	s = s[i:]
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		if s[0] != ';' {
+			return ContentDisposition{}, fmt.Errorf("expected ';' at %q", s)
+		}
+		s = strings.TrimLeft(s[1:], " \t")
+		i := strings.IndexAny(s, "=;")
+		if i == -1 || s[i] != '=' {
+			return ContentDisposition{}, fmt.Errorf("parameter with no value at %q", s)
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		if _, ok := d.Params[name]; ok {
+			return ContentDisposition{}, fmt.Errorf("duplicate parameter %q", name)
+		}
+		var val string
+		var err error
+		val, s, err = parseParamValue(strings.TrimLeft(s[i+1:], " \t"))
+		if err != nil {
+			return ContentDisposition{}, err
+		}
+		d.Params[name] = val
+	}
+	d.Filename = d.Params["filename"]
+	if ext, ok := d.Params["filename*"]; ok {
+		filename, err := decodeExtValue(ext)
+		if err != nil {
+			return ContentDisposition{}, fmt.Errorf("invalid filename* parameter: %v", err)
+		}
+		d.Filename = filename
+	}
+	return d, nil
+}
+
+// decodeExtValue decodes an RFC 5987 ext-value such
+// as UTF-8'en'%e2%82%ac%20rates.
+func decodeExtValue(s string) (string, error) {
+	parts := strings.SplitN(s, "'", 3)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%q is not of the form charset'language'value", s)
+	}
+	for i := 0; i < len(parts[2]); i++ {
+		if b := parts[2][i]; b != '%' && !isAttrChar(b) {
+			return "", fmt.Errorf("invalid character %q in %q", b, s)
+		}
+	}
+	val, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		if !utf8.ValidString(val) {
+			return "", fmt.Errorf("%q is not valid UTF-8", val)
+		}
+		return val, nil
+	case "iso-8859-1":
+		// ISO-8859-1 bytes are the same as the
+		// first 256 Unicode code points.
+		runes := make([]rune, len(val))
+		for i := 0; i < len(val); i++ {
+			runes[i] = rune(val[i])
+		}
+		return string(runes), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", parts[0])
+}
+
+// isAttrChar reports whether b is an attr-char as
+// specified by RFC 5987.
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) != -1
+}
+
+// AssertContentDisposition asserts that h holds a valid
+// Content-Disposition header with the given type, which is compared
+// case-insensitively, and file name, and returns it. If filename is
+// empty, any file name is allowed. In any case, the file name must
+// not contain a path separator.
+func AssertContentDisposition(c *qt.C, h http.Header, dispositionType, filename string) ContentDisposition {
+	values := h.Values("Content-Disposition")
+	c.Assert(values, qt.HasLen, 1, qt.Commentf("Content-Disposition header"))
+	d, err := ParseContentDisposition(values[0])
+	c.Assert(err, qt.Equals, nil)
+	comment := qt.Commentf("Content-Disposition: %s", values[0])
+	c.Assert(d.Type, qt.Equals, strings.ToLower(dispositionType), comment)
+	if filename != "" {
+		c.Assert(d.Filename, qt.Equals, filename, comment)
+	}
+	if strings.ContainsAny(d.Filename, `/\`) {
+		c.Fatalf("file name %q contains a path separator; Content-Disposition: %s", d.Filename, values[0])
+	}
+	return d
+}
+
+// AssertDownload asserts that the response is a file download
+// with a Content-Disposition header as checked by
+// AssertContentDisposition, and a Content-Length header that
+// matches the length of the body as sent.
+func (r *Resp) AssertDownload(c *qt.C, dispositionType, filename string) *Resp {
+	AssertContentDisposition(c, r.Response.Header, dispositionType, filename)
+	cl := r.Header(c, "Content-Length")
+	n, err := strconv.ParseInt(cl, 10, 64)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("Content-Length"))
+	// The response body holds the bytes
+	// before any content decoding.
+	raw, err := ioutil.ReadAll(r.Response.Body)
+	c.Assert(err, qt.Equals, nil)
+	r.Response.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	c.Assert(int64(len(raw)), qt.Equals, n, qt.Commentf("body length does not match Content-Length"))
+	return r
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var parseContentDispositionTests = []struct {
+	s           string
+	expect      qthttptest.ContentDisposition
+	expectError string
+}{{
+	s: "inline",
+	expect: qthttptest.ContentDisposition{
+		Type:   "inline",
+		Params: map[string]string{},
+	},
+}, {
+	s: `Attachment; FileName="a \"b\".txt"`,
+	expect: qthttptest.ContentDisposition{
+		Type:     "attachment",
+		Filename: `a "b".txt`,
+		Params:   map[string]string{"filename": `a "b".txt`},
+	},
+}, {
+	s: `attachment; filename=rates.txt; filename*=UTF-8''%e2%82%ac%20rates.txt`,
+	expect: qthttptest.ContentDisposition{
+		Type:     "attachment",
+		Filename: "€ rates.txt",
+		Params: map[string]string{
+			"filename":  "rates.txt",
+			"filename*": "UTF-8''%e2%82%ac%20rates.txt",
+		},
+	},
+}, {
+	s: `attachment; filename*=iso-8859-1'en'%A3%20rates.txt`,
+	expect: qthttptest.ContentDisposition{
+		Type:     "attachment",
+		Filename: "£ rates.txt",
+		Params: map[string]string{
+			"filename*": "iso-8859-1'en'%A3%20rates.txt",
+		},
+	},
+}, {
+	s:           `; filename=a`,
+	expectError: `invalid Content-Disposition header "; filename=a": no disposition type`,
+}, {
+	s:           `attachment; filename`,
+	expectError: `invalid Content-Disposition header .*: parameter with no value at "filename"`,
+}, {
+	s:           `attachment; filename=a; filename=b`,
+	expectError: `invalid Content-Disposition header .*: duplicate parameter "filename"`,
+}, {
+	s:           `attachment; filename="a`,
+	expectError: `invalid Content-Disposition header .*: unterminated quoted string`,
+}, {
+	s:           `attachment; filename*=a.txt`,
+	expectError: `invalid Content-Disposition header .*: invalid filename\* parameter: "a.txt" is not of the form charset'language'value`,
+}, {
+	s:           `attachment; filename*=UTF-8''a b`,
+	expectError: `invalid Content-Disposition header .*: invalid filename\* parameter: invalid character ' ' in "UTF-8''a b"`,
+}, {
+	s:           `attachment; filename*=UTF-8''%ff`,
+	expectError: `invalid Content-Disposition header .*: invalid filename\* parameter: "\\xff" is not valid UTF-8`,
+}, {
+	s:           `attachment; filename*=EBCDIC''a`,
+	expectError: `invalid Content-Disposition header .*: invalid filename\* parameter: unsupported charset "EBCDIC"`,
+}}
+
+func TestParseContentDisposition(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parseContentDispositionTests {
+		d, err := qthttptest.ParseContentDisposition(test.s)
+		if test.expectError != "" {
+			c.Check(err, qt.ErrorMatches, test.expectError, qt.Commentf("%s", test.s))
+			continue
+		}
+		c.Check(err, qt.Equals, nil, qt.Commentf("%s", test.s))
+		c.Check(d, qt.DeepEquals, test.expect, qt.Commentf("%s", test.s))
+	}
+}
+
+func TestAssertContentDisposition(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{"Content-Disposition": {`attachment; filename="report.csv"`}}
+	d := qthttptest.AssertContentDisposition(c, h, "Attachment", "report.csv")
+	c.Assert(d.Filename, qt.Equals, "report.csv")
+	qthttptest.AssertContentDisposition(c, h, "attachment", "")
+
+	checkFails(c, `comment:
+  Content-Disposition: attachment; filename="report.csv"
+got:
+  "attachment"
+want:
+  "inline"
+`, func(c *qt.C) {
+		qthttptest.AssertContentDisposition(c, h, "inline", "report.csv")
+	})
+	checkFails(c, `comment:
+  Content-Disposition: attachment; filename="report.csv"
+got:
+  "report.csv"
+want:
+  "other.csv"
+`, func(c *qt.C) {
+		qthttptest.AssertContentDisposition(c, h, "attachment", "other.csv")
+	})
+	checkFails(c, `file name "../etc/passwd" contains a path separator; Content-Disposition: attachment; filename\*=UTF-8''..%2fetc%2fpasswd`, func(c *qt.C) {
+		qthttptest.AssertContentDisposition(c, http.Header{
+			"Content-Disposition": {`attachment; filename*=UTF-8''..%2fetc%2fpasswd`},
+		}, "attachment", "")
+	})
+	checkFails(c, `comment:
+  Content-Disposition header
+`, func(c *qt.C) {
+		qthttptest.AssertContentDisposition(c, http.Header{}, "attachment", "")
+	})
+}
+
+func TestAssertDownload(t *testing.T) {
+	c := qt.New(t)
+	download := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		http.ServeContent(w, req, "report.csv", time.Time{}, strings.NewReader("a,b\n1,2\n"))
+	}
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler: http.HandlerFunc(download),
+		URL:     "/",
+	})
+	resp.AssertDownload(c, "attachment", "report.csv")
+	c.Assert(string(resp.Body), qt.Equals, "a,b\n1,2\n")
+
+	resp = qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+			w.(http.Flusher).Flush()
+			w.Write([]byte("a,b\n1,2\n"))
+		}),
+		URL: "/",
+	})
+	checkFails(c, `header "Content-Length" not found`, func(c *qt.C) {
+		resp.AssertDownload(c, "attachment", "report.csv")
+	})
+}
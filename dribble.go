@@ -0,0 +1,122 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DribbleHandler is an http.Handler that writes a canned response
+// slowly, in small chunks, optionally aborting the connection
+// part way through the body. It can be used to test client
+// timeouts and the handling of partial response bodies.
+//
+// Writing stops early if the request is cancelled.
+type DribbleHandler struct {
+	// Status holds the response status.
+	// If it is zero, http.StatusOK is used.
+	Status int
+
+	// Header holds headers to add to the response.
+	Header http.Header
+
+	// Body holds the response body.
+	Body []byte
+
+	// HeaderDelay holds the time to wait before
+	// writing the response header.
+	HeaderDelay time.Duration
+
+	// ChunkSize holds the number of bytes written at a time.
+	// If it is zero, 1 is used.
+	ChunkSize int
+
+	// Delay holds the time to wait before writing each chunk.
+	Delay time.Duration
+
+	// Chunked specifies that the response is sent with
+	// chunked transfer encoding. Otherwise the Content-Length
+	// header is set to the length of Body.
+	Chunked bool
+
+	// Abort specifies that the connection is aborted
+	// after AbortAfter bytes of the body have been written.
+	Abort      bool
+	AbortAfter int
+}
+
+// ServeHTTP implements http.Handler.
+func (h *DribbleHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if !sleepContext(ctx.Done(), h.HeaderDelay) {
+		return
+	}
+	for k, v := range h.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	if !h.Chunked {
+		w.Header().Set("Content-Length", strconv.Itoa(len(h.Body)))
+	}
+	status := h.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	flush(w)
+	chunkSize := h.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+	body := h.Body
+	if h.Abort && h.AbortAfter < len(body) {
+		body = body[:h.AbortAfter]
+	}
+	for len(body) > 0 {
+		if !sleepContext(ctx.Done(), h.Delay) {
+			return
+		}
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		flush(w)
+		body = body[n:]
+	}
+	if h.Abort {
+		// The server closes the connection without
+		// logging anything when it sees this panic.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// flush flushes w if it implements http.Flusher.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sleepContext waits for the given duration and reports whether it
+// did so without done being closed first.
+func sleepContext(done <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-done:
+			return false
+		default:
+			return true
+		}
+	}
+	select {
+	case <-DefaultClock.After(d):
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestDribbleHandler(t *testing.T) {
+	c := qt.New(t)
+	h := &qthttptest.DribbleHandler{
+		Status: http.StatusCreated,
+		Header: http.Header{
+			"Content-Type": {"text/plain"},
+		},
+		Body:      []byte("hello, world"),
+		ChunkSize: 5,
+		Delay:     10 * time.Millisecond,
+	}
+	start := time.Now()
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler: h,
+		URL:     "/",
+	})
+	c.Assert(time.Since(start) >= 30*time.Millisecond, qt.Equals, true)
+	resp.AssertStatus(c, http.StatusCreated)
+	c.Assert(string(resp.Body), qt.Equals, "hello, world")
+	c.Assert(resp.Response.ContentLength, qt.Equals, int64(12))
+	c.Assert(resp.Response.Header.Get("Content-Type"), qt.Equals, "text/plain")
+}
+
+func TestDribbleHandlerHeaderDelay(t *testing.T) {
+	c := qt.New(t)
+	client := &http.Client{
+		Timeout: 20 * time.Millisecond,
+	}
+	qthttptest.Do(c, qthttptest.DoRequestParams{
+		Handler: &qthttptest.DribbleHandler{
+			HeaderDelay: time.Second,
+		},
+		URL:         "/",
+		Do:          client.Do,
+		ExpectError: `.*Client.Timeout exceeded while awaiting headers.*`,
+	})
+}
+
+var dribbleAbortTests = []struct {
+	about      string
+	chunked    bool
+	abortAfter int
+}{{
+	about:      "content length",
+	abortAfter: 4,
+}, {
+	about:      "chunked",
+	chunked:    true,
+	abortAfter: 4,
+}, {
+	about: "before body",
+}}
+
+func TestDribbleHandlerAbort(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range dribbleAbortTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			srv := qthttptest.NewServer(c, &qthttptest.DribbleHandler{
+				Body:       []byte("hello, world"),
+				ChunkSize:  2,
+				Chunked:    test.chunked,
+				Abort:      true,
+				AbortAfter: test.abortAfter,
+			})
+			resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+				URL: srv.URL() + "/",
+			})
+			defer resp.Body.Close()
+			c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+			data, err := ioutil.ReadAll(resp.Body)
+			c.Assert(err, qt.ErrorMatches, `unexpected EOF`)
+			c.Assert(string(data), qt.Equals, "hello, world"[:test.abortAfter])
+		})
+	}
+}
+
+func TestDribbleHandlerStopsOnCancel(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, &qthttptest.DribbleHandler{
+		Body:  make([]byte, 1000),
+		Delay: 10 * time.Millisecond,
+	})
+	client := &http.Client{
+		Timeout: 50 * time.Millisecond,
+	}
+	resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/",
+		Do:  client.Do,
+	})
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, qt.ErrorMatches, `.*Client.Timeout.*`)
+	c.Assert(len(data) < 1000, qt.Equals, true)
+}
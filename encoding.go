@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ContentDecoders holds the decoders used to remove the
+// Content-Encoding from response bodies before they are checked,
+// keyed by lower-case encoding name. Decoders for gzip, deflate and
+// br (brotli) are provided by default; other encodings can be
+// supported by adding an entry, for example for zstd:
+//
+//	qthttptest.ContentDecoders["zstd"] = func(r io.Reader) (io.Reader, error) {
+//		return zstd.NewReader(r)
+//	}
+//
+// Responses with an encoding that has no decoder cause the body
+// checks to fail.
+var ContentDecoders = map[string]func(r io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": newDeflateReader,
+	"br": func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	},
+}
+
+// newDeflateReader returns a reader that decodes the "deflate" content
+// encoding. This is specified to be zlib-wrapped (RFC 1950) but some
+// servers send raw DEFLATE data (RFC 1951), so accept both.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	hdr, err := br.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read deflate header: %v", err)
+	}
+	// A zlib header has a compression method of 8 and a
+	// check value such that the header is a multiple of 31.
+	if hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// contentEncoding returns the content codings listed in the
+// Content-Encoding header of h, lower-cased and comma-separated.
+func contentEncoding(h http.Header) string {
+	codings := contentCodings(h)
+	if len(codings) == 0 {
+		return "identity"
+	}
+	return strings.Join(codings, ", ")
+}
+
+// contentCodings returns the content codings applied to a body with
+// the given header in the order they were applied, omitting "identity".
+func contentCodings(h http.Header) []string {
+	var codings []string
+	for _, v := range h.Values("Content-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
+
+// decodeContent returns the body with all the content codings
+// specified in h removed.
+func decodeContent(h http.Header, body []byte) ([]byte, error) {
+	if len(contentCodings(h)) == 0 {
+		return body, nil
+	}
+	r, err := decodeContentReader(h, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// decodeContentReader returns a reader that reads the body from r
+// with all the content codings specified in h removed.
+func decodeContentReader(h http.Header, r io.Reader) (io.Reader, error) {
+	codings := contentCodings(h)
+	for i := len(codings) - 1; i >= 0; i-- {
+		decode := ContentDecoders[codings[i]]
+		if decode == nil {
+			return nil, fmt.Errorf("unsupported content encoding %q", codings[i])
+		}
+		dr, err := decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s content: %v", codings[i], err)
+		}
+		r = &decodeErrorReader{coding: codings[i], r: dr}
+	}
+	return r, nil
+}
+
+// decodeErrorReader annotates errors from a content decoder.
+type decodeErrorReader struct {
+	coding string
+	r      io.Reader
+}
+
+func (r *decodeErrorReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*decodeError); !ok {
+			err = &decodeError{coding: r.coding, err: err}
+		}
+	}
+	return n, err
+}
+
+type decodeError struct {
+	coding string
+	err    error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("cannot decode %s content: %v", e.coding, e.err)
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func makeEncodingHandler(c *qt.C, encoding string, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Header.Get("Accept-Encoding"), qt.Not(qt.Equals), "")
+		var buf bytes.Buffer
+		var wc io.WriteCloser
+		switch encoding {
+		case "gzip":
+			wc = gzip.NewWriter(&buf)
+		case "deflate":
+			wc = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			wc, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			encoding = "deflate"
+		case "br":
+			wc = brotli.NewWriter(&buf)
+		}
+		wc.Write([]byte(body))
+		wc.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(buf.Bytes())
+	})
+}
+
+func TestAssertJSONCallWithContentEncoding(t *testing.T) {
+	c := qt.New(t)
+	body := `"` + strings.Repeat("hello ", 100) + `"`
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "br"} {
+		c.Run(encoding, func(c *qt.C) {
+			expectEncoding := strings.TrimPrefix(encoding, "raw-")
+			qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+				URL:                    "/",
+				Handler:                makeEncodingHandler(c, encoding, body),
+				ExpectContentEncoding:  expectEncoding,
+				ExpectMaxEncodedLength: len(body) / 2,
+				ExpectBody:             strings.Repeat("hello ", 100),
+			})
+		})
+	}
+}
+
+func TestAssertJSONCallWithIdentityEncoding(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			c.Check(req.Header.Get("Accept-Encoding"), qt.Equals, "identity")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`"ok"`))
+		}),
+		ExpectContentEncoding: "identity",
+		ExpectBody:            "ok",
+	})
+}
+
+func TestCustomContentDecoder(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.ContentDecoders, map[string]func(io.Reader) (io.Reader, error){
+		"reverse": func(r io.Reader) (io.Reader, error) {
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+				data[i], data[j] = data[j], data[i]
+			}
+			return bytes.NewReader(data), nil
+		},
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "reverse")
+			w.Write([]byte(`"olleh"`))
+		}),
+		ExpectContentEncoding: "reverse",
+		ExpectBody:            "hello",
+	})
+}
+
+func TestDoResponseEncodedLength(t *testing.T) {
+	c := qt.New(t)
+	body := `"` + strings.Repeat("hello ", 100) + `"`
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL:     "/",
+		Header:  http.Header{"Accept-Encoding": {"br"}},
+		Handler: makeEncodingHandler(c, "br", body),
+	})
+	c.Assert(string(resp.Body), qt.Equals, body)
+	c.Assert(resp.EncodedLength > 0, qt.Equals, true)
+	c.Assert(resp.EncodedLength < len(body)/2, qt.Equals, true)
+}
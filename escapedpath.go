@@ -0,0 +1,39 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	qt "github.com/frankban/quicktest"
+)
+
+// AssertEscapedPath makes the request described by p, which must
+// have a Handler, and asserts that the handler receives a request
+// whose URL.EscapedPath is expect. The raw path to send can be set
+// with p.RawPath. It returns the request as received by the handler.
+//
+// To check the path seen by a handler behind a router,
+// wrap it in a RecordingHandler and check the URL of the
+// recorded request.
+func AssertEscapedPath(c *qt.C, p DoRequestParams, expect string) RecordedRequest {
+	c.Assert(p.Handler, qt.Not(qt.IsNil), qt.Commentf("AssertEscapedPath requires a Handler"))
+	h := &RecordingHandler{
+		Handler: p.Handler,
+	}
+	p.Handler = h
+	resp := Do(c, p)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	reqs := h.Requests()
+	if len(reqs) == 0 {
+		status := ""
+		if resp != nil {
+			status = resp.Status
+		}
+		c.Fatalf("handler was not called; response status %q", status)
+	}
+	got := reqs[0].URL
+	c.Assert(got.EscapedPath(), qt.Equals, expect, qt.Commentf("request URI %q; unescaped path %q", got.RequestURI(), got.Path))
+	return reqs[0]
+}
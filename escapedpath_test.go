@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var assertEscapedPathTests = []struct {
+	about       string
+	url         string
+	rawPath     string
+	expect      string
+	expectPath  string
+	expectQuery string
+}{{
+	about:      "escaped slash in URL",
+	url:        "/a%2Fb",
+	expect:     "/a%2Fb",
+	expectPath: "/a/b",
+}, {
+	about:      "dot segments",
+	url:        "/",
+	rawPath:    "/a/../b/./c",
+	expect:     "/a/../b/./c",
+	expectPath: "/a/../b/./c",
+}, {
+	about:      "escaped dot segment and semicolon",
+	url:        "/",
+	rawPath:    "/a;b=c/%2e%2e",
+	expect:     "/a;b=c/%2e%2e",
+	expectPath: "/a;b=c/..",
+}, {
+	about:      "double slash",
+	url:        "/",
+	rawPath:    "//x//y",
+	expect:     "//x//y",
+	expectPath: "//x//y",
+}, {
+	about:       "query from URL",
+	url:         "/ignored?q=a%2Fb",
+	rawPath:     "/a%2fb",
+	expect:      "/a%2fb",
+	expectPath:  "/a/b",
+	expectQuery: "q=a%2Fb",
+}}
+
+func TestAssertEscapedPath(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertEscapedPathTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			req := qthttptest.AssertEscapedPath(c, qthttptest.DoRequestParams{
+				Handler: http.NotFoundHandler(),
+				URL:     test.url,
+				RawPath: test.rawPath,
+			}, test.expect)
+			c.Assert(req.URL.Path, qt.Equals, test.expectPath)
+			c.Assert(req.URL.RawQuery, qt.Equals, test.expectQuery)
+		})
+	}
+}
+
+func TestAssertEscapedPathBehindRouter(t *testing.T) {
+	c := qt.New(t)
+	rec := &qthttptest.RecordingHandler{}
+	qthttptest.AssertEscapedPath(c, qthttptest.DoRequestParams{
+		Handler: http.StripPrefix("/api", rec),
+		URL:     "/",
+		RawPath: "/api/a%2Fb",
+	}, "/api/a%2Fb")
+	reqs := rec.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].URL.EscapedPath(), qt.Equals, "/a%2Fb")
+}
+
+func TestAssertEscapedPathFailure(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `values are not equal
+comment:
+  request URI "/a/b"; unescaped path "/a/b"
+got:
+  "/a/b"
+want:
+  "/a%2Fb"
+`, func(c *qt.C) {
+		qthttptest.AssertEscapedPath(c, qthttptest.DoRequestParams{
+			Handler: http.NotFoundHandler(),
+			URL:     "/a/b",
+		}, "/a%2Fb")
+	})
+}
+
+func TestDoRequestRawPath(t *testing.T) {
+	c := qt.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b", func(w http.ResponseWriter, req *http.Request) {})
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Do: (&http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}).Do,
+		Handler: mux,
+		URL:     "/",
+		RawPath: "/a/../b",
+	})
+	resp.AssertStatus(c, http.StatusMovedPermanently)
+	c.Assert(resp.Header(c, "Location"), qt.Equals, "/b")
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ETag holds an entity tag as specified by RFC 7232.
+type ETag struct {
+	// Weak records whether the tag is a weak validator.
+	Weak bool
+
+	// Opaque holds the opaque tag, without quotes.
+	Opaque string
+}
+
+// String returns the tag in header form, for example W/"abc".
+func (t ETag) String() string {
+	s := `"` + t.Opaque + `"`
+	if t.Weak {
+		s = "W/" + s
+	}
+	return s
+}
+
+// ParseETag parses an entity tag such as "abc" or W/"abc".
+func ParseETag(s string) (ETag, error) {
+	var t ETag
+	rest := s
+	if strings.HasPrefix(rest, "W/") {
+		t.Weak = true
+		rest = rest[2:]
+	}
+	if len(rest) < 2 || rest[0] != '"' || rest[len(rest)-1] != '"' {
+		return ETag{}, fmt.Errorf("invalid entity tag %q: opaque tag is not quoted", s)
+	}
+	t.Opaque = rest[1 : len(rest)-1]
+	for i := 0; i < len(t.Opaque); i++ {
+		if b := t.Opaque[i]; b == '"' || b <= ' ' || b == 0x7f {
+			return ETag{}, fmt.Errorf("invalid entity tag %q: invalid character %q", s, b)
+		}
+	}
+	return t, nil
+}
+
+// AssertETag asserts that h holds a single valid ETag header
+// equal to expect, and returns it.
+func AssertETag(c *qt.C, h http.Header, expect ETag) ETag {
+	t := headerETag(c, h)
+	c.Assert(t, qt.Equals, expect, qt.Commentf("ETag: %s", h.Get("ETag")))
+	return t
+}
+
+// ETag asserts that the response has a single valid ETag
+// header and returns it.
+func (r *Resp) ETag(c *qt.C) ETag {
+	return headerETag(c, r.Response.Header)
+}
+
+// AssertETag asserts that the response has
+// an ETag header equal to expect.
+func (r *Resp) AssertETag(c *qt.C, expect ETag) *Resp {
+	AssertETag(c, r.Response.Header, expect)
+	return r
+}
+
+func headerETag(c *qt.C, h http.Header) ETag {
+	values := h.Values("ETag")
+	c.Assert(values, qt.HasLen, 1, qt.Commentf("ETag header"))
+	t, err := ParseETag(values[0])
+	c.Assert(err, qt.Equals, nil)
+	return t
+}
+
+// ETagCallParams holds parameters for AssertETagChanges.
+type ETagCallParams struct {
+	// DoRequestParams holds the request that fetches the resource.
+	// The ExpectError field is ignored.
+	DoRequestParams
+
+	// Change is called to change the resource.
+	Change func(c *qt.C)
+
+	// ExpectStatus holds the expected status of each response.
+	// If it is zero, http.StatusOK is assumed.
+	ExpectStatus int
+}
+
+// AssertETagChanges checks that the ETag of a resource is a
+// usable validator. It fetches the resource twice and asserts that
+// the ETag is the same both times, and that the bodies are identical
+// if it is a strong ETag. It then calls p.Change, fetches the resource
+// again and asserts that the ETag has changed. It returns the ETags
+// from before and after the change.
+func AssertETagChanges(c *qt.C, p ETagCallParams) (before, after ETag) {
+	c.Assert(p.Change, qt.Not(qt.IsNil), qt.Commentf("AssertETagChanges requires a Change function"))
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	p.ExpectError = ""
+	fetch := func() (ETag, []byte) {
+		resp := DoResponse(c, p.DoRequestParams)
+		resp.AssertStatus(c, p.ExpectStatus)
+		return resp.ETag(c), resp.Body
+	}
+	before, body0 := fetch()
+	again, body1 := fetch()
+	c.Assert(again, qt.Equals, before, qt.Commentf("ETag changed although the resource did not"))
+	if !before.Weak && !bytes.Equal(body0, body1) {
+		c.Fatalf("strong ETag %v is unchanged but the body changed from %q to %q", before, body0, body1)
+	}
+	p.Change(c)
+	after, _ = fetch()
+	if after == before {
+		c.Fatalf("ETag %v did not change when the resource changed", before)
+	}
+	return before, after
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var parseETagTests = []struct {
+	s           string
+	expect      qthttptest.ETag
+	expectError string
+}{{
+	s:      `"abc"`,
+	expect: qthttptest.ETag{Opaque: "abc"},
+}, {
+	s:      `W/"abc"`,
+	expect: qthttptest.ETag{Weak: true, Opaque: "abc"},
+}, {
+	s:      `""`,
+	expect: qthttptest.ETag{},
+}, {
+	s:           `abc`,
+	expectError: `invalid entity tag "abc": opaque tag is not quoted`,
+}, {
+	s:           `w/"abc"`,
+	expectError: `invalid entity tag "w/\\"abc\\"": opaque tag is not quoted`,
+}, {
+	s:           `"a"b"`,
+	expectError: `invalid entity tag "\\"a\\"b\\"": invalid character '"'`,
+}, {
+	s:           `"a b"`,
+	expectError: `invalid entity tag "\\"a b\\"": invalid character ' '`,
+}}
+
+func TestParseETag(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parseETagTests {
+		etag, err := qthttptest.ParseETag(test.s)
+		if test.expectError != "" {
+			c.Check(err, qt.ErrorMatches, test.expectError, qt.Commentf("%s", test.s))
+			continue
+		}
+		c.Check(err, qt.Equals, nil, qt.Commentf("%s", test.s))
+		c.Check(etag, qt.Equals, test.expect, qt.Commentf("%s", test.s))
+		c.Check(etag.String(), qt.Equals, test.s)
+	}
+}
+
+func TestAssertETag(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{"Etag": {`W/"abc"`}}
+	t0 := qthttptest.AssertETag(c, h, qthttptest.ETag{Weak: true, Opaque: "abc"})
+	c.Assert(t0.String(), qt.Equals, `W/"abc"`)
+
+	checkFails(c, `comment:
+  ETag: W/"abc"
+`, func(c *qt.C) {
+		qthttptest.AssertETag(c, h, qthttptest.ETag{Opaque: "abc"})
+	})
+	checkFails(c, `comment:
+  ETag header
+`, func(c *qt.C) {
+		qthttptest.AssertETag(c, http.Header{}, qthttptest.ETag{Opaque: "abc"})
+	})
+	checkFails(c, `invalid entity tag "abc": opaque tag is not quoted`, func(c *qt.C) {
+		qthttptest.AssertETag(c, http.Header{"Etag": {"abc"}}, qthttptest.ETag{Opaque: "abc"})
+	})
+}
+
+// versionedHandler serves a resource whose version is incremented
+// by the Change method. The etag and body functions are called with
+// the current version and the number of requests served so far.
+type versionedHandler struct {
+	version int
+	calls   int
+	etag    func(version, call int) string
+	body    func(version, call int) string
+}
+
+func (h *versionedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.calls++
+	if etag := h.etag(h.version, h.calls); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Write([]byte(h.body(h.version, h.calls)))
+}
+
+func (h *versionedHandler) Change(c *qt.C) {
+	h.version++
+}
+
+func versionETag(version, call int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+func versionBody(version, call int) string {
+	return fmt.Sprintf("version %d", version)
+}
+
+var assertETagChangesTests = []struct {
+	about       string
+	etag        func(version, call int) string
+	body        func(version, call int) string
+	expectError string
+}{{
+	about: "strong ETag",
+	etag:  versionETag,
+	body:  versionBody,
+}, {
+	about: "weak ETag with changing body",
+	etag: func(version, call int) string {
+		return fmt.Sprintf(`W/"v%d"`, version)
+	},
+	body: func(version, call int) string {
+		return fmt.Sprintf("version %d; call %d", version, call)
+	},
+}, {
+	about: "strong ETag with changing body",
+	etag:  versionETag,
+	body: func(version, call int) string {
+		return fmt.Sprintf("version %d; call %d", version, call)
+	},
+	expectError: `strong ETag "v0" is unchanged but the body changed from "version 0; call 1" to "version 0; call 2"`,
+}, {
+	about: "unstable ETag",
+	etag: func(version, call int) string {
+		return fmt.Sprintf(`"c%d"`, call)
+	},
+	body: versionBody,
+	expectError: `values are not equal
+comment:
+  ETag changed although the resource did not
+`,
+}, {
+	about: "unchanged ETag",
+	etag: func(version, call int) string {
+		return `"v"`
+	},
+	body:        versionBody,
+	expectError: `ETag "v" did not change when the resource changed`,
+}, {
+	about: "missing ETag",
+	etag: func(version, call int) string {
+		return ""
+	},
+	body: versionBody,
+	expectError: `unexpected length
+comment:
+  ETag header
+`,
+}}
+
+func TestAssertETagChanges(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertETagChangesTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			h := &versionedHandler{
+				etag: test.etag,
+				body: test.body,
+			}
+			p := qthttptest.ETagCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: h,
+					URL:     "/",
+				},
+				Change: h.Change,
+			}
+			if test.expectError == "" {
+				before, after := qthttptest.AssertETagChanges(c, p)
+				c.Assert(before.Opaque, qt.Equals, "v0")
+				c.Assert(after.Opaque, qt.Equals, "v1")
+				return
+			}
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertETagChanges(c, p)
+			})
+		})
+	}
+}
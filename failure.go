@@ -0,0 +1,168 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// CallFailure describes a failed assertion made
+// by AssertJSONCall.
+type CallFailure struct {
+	// Method and URL hold the method and URL of the request.
+	// The URL includes the host once the request has been made.
+	Method string
+	URL    string
+
+	// RequestHeader and RequestBody hold the headers and body of
+	// the request as it was sent. They are nil if the assertion
+	// failed before the request was made.
+	RequestHeader http.Header
+	RequestBody   []byte
+
+	// Response holds the response, or nil if the
+	// assertion failed before it was received.
+	Response *http.Response
+
+	// Body holds the response body as received, before any
+	// content decoding. It is nil if it has not been read.
+	Body []byte
+
+	// ExpectBody holds the ExpectBody parameter of the call.
+	ExpectBody interface{}
+
+	// Message holds the failure report
+	// produced by quicktest.
+	Message string
+}
+
+// FailureFormatter formats the failure reports of AssertJSONCall.
+type FailureFormatter interface {
+	// FormatFailure returns the report to use for the
+	// given failure.
+	FormatFailure(f CallFailure) string
+}
+
+// FailureFormatterFunc implements FailureFormatter
+// by calling the function.
+type FailureFormatterFunc func(f CallFailure) string
+
+// FormatFailure implements FailureFormatter.FormatFailure.
+func (f FailureFormatterFunc) FormatFailure(failure CallFailure) string {
+	return f(failure)
+}
+
+// CallFailureFormatter, if non-nil, is used to format the reports
+// of assertions that fail within AssertJSONCall and the functions
+// that use it, such as Server.AssertJSONCall. It can be set once,
+// for example in TestMain, to render mismatches in a house style,
+// or to add a link to the documentation of the endpoint that was
+// called.
+//
+// If the QTHTTPTEST_HAR_DIR environment variable is set, its initial
+// value is a HARExporter that writes failed calls to that directory.
+var CallFailureFormatter = harExporterFromEnv(os.Getenv("QTHTTPTEST_HAR_DIR"))
+
+// failureContext holds the state of a call for a
+// FailureFormatter and implements testing.TB so that
+// it can format failures as they are reported.
+type failureContext struct {
+	testing.TB
+	formatter FailureFormatter
+	failure   CallFailure
+}
+
+// withFailureFormatter returns a C that reports failures through
+// CallFailureFormatter, if it is set, along with the context that
+// holds the details of the call. Otherwise it returns c and a nil
+// context.
+func withFailureFormatter(c *qt.C, p JSONCallParams) (*qt.C, *failureContext) {
+	if CallFailureFormatter == nil {
+		return c, nil
+	}
+	method := p.Method
+	if method == "" {
+		method = "GET"
+	}
+	fc := &failureContext{
+		TB:        c.TB,
+		formatter: CallFailureFormatter,
+		failure: CallFailure{
+			Method:     method,
+			URL:        p.URL,
+			ExpectBody: p.ExpectBody,
+		},
+	}
+	return qt.New(fc), fc
+}
+
+// recordRequest is request middleware that
+// records the request made by the call.
+func (fc *failureContext) recordRequest(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		if req.Body != nil {
+			data, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			body = data
+			req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		}
+		fc.failure.URL = req.URL.String()
+		fc.failure.RequestHeader = cloneHeader(req.Header)
+		fc.failure.RequestBody = body
+		return rt.RoundTrip(req)
+	})
+}
+
+// setResponse records the response to the call.
+func (fc *failureContext) setResponse(resp *http.Response, body []byte) {
+	if fc == nil {
+		return
+	}
+	if resp.Request != nil {
+		fc.failure.URL = resp.Request.URL.String()
+	}
+	fc.failure.Response = resp
+	fc.failure.Body = body
+}
+
+func (fc *failureContext) format(msg string) string {
+	f := fc.failure
+	f.Message = msg
+	return fc.formatter.FormatFailure(f)
+}
+
+// Error implements testing.TB.Error.
+func (fc *failureContext) Error(args ...interface{}) {
+	fc.TB.Helper()
+	fc.TB.Error(fc.format(fmt.Sprint(args...)))
+}
+
+// Errorf implements testing.TB.Errorf.
+func (fc *failureContext) Errorf(format string, args ...interface{}) {
+	fc.TB.Helper()
+	fc.TB.Error(fc.format(fmt.Sprintf(format, args...)))
+}
+
+// Fatal implements testing.TB.Fatal.
+func (fc *failureContext) Fatal(args ...interface{}) {
+	fc.TB.Helper()
+	fc.TB.Fatal(fc.format(fmt.Sprint(args...)))
+}
+
+// Fatalf implements testing.TB.Fatalf.
+func (fc *failureContext) Fatalf(format string, args ...interface{}) {
+	fc.TB.Helper()
+	fc.TB.Fatal(fc.format(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestCallFailureFormatter(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	var failures []qthttptest.CallFailure
+	c.Patch(&qthttptest.CallFailureFormatter, qthttptest.FailureFormatterFunc(func(f qthttptest.CallFailure) string {
+		failures = append(failures, f)
+		status := "no response"
+		if f.Response != nil {
+			status = f.Response.Status
+		}
+		u, _ := url.Parse(f.URL)
+		return fmt.Sprintf("%s %s (%s); see https://docs.example.com/api%s\n%s", f.Method, f.URL, status, u.Path, f.Message)
+	}))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"n": 1}`))
+	})
+	checkFails(c, `^GET http://127\.0\.0\.1:\d+/items \(200 OK\); see https://docs\.example\.com/api/items
+
+error:
+  values are not deep equal
+`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:    handler,
+			URL:        "/items",
+			ExpectBody: map[string]int{"n": 2},
+		})
+	})
+	c.Assert(failures, qt.HasLen, 1)
+	c.Assert(string(failures[0].Body), qt.Equals, `{"n": 1}`)
+	c.Assert(failures[0].Message, qt.Matches, `(?s).*values are not deep equal.*`)
+
+	// Failures before the request is made have no response.
+	failures = nil
+	checkFails(c, `^POST /items \(no response\); see https://docs\.example\.com/api/items
+
+error:
+  "x" is not nil
+comment:
+  ExpectBody specified with ExpectNoBody
+`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Method:       "POST",
+			Handler:      handler,
+			URL:          "/items",
+			ExpectBody:   "x",
+			ExpectNoBody: true,
+		})
+	})
+	c.Assert(failures, qt.HasLen, 1)
+	c.Assert(failures[0].Response, qt.IsNil)
+
+	// Successful calls are not affected.
+	failures = nil
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:    handler,
+		URL:        "/items",
+		ExpectBody: map[string]int{"n": 1},
+	})
+	c.Assert(failures, qt.HasLen, 0)
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// MaxBodyInFailure holds the maximum number of bytes of each body
+// that AssertJSONCall and AssertJSONResponse include in a failure
+// report. When a body is longer, only the part around the first
+// difference between the obtained and expected bodies is shown,
+// or the start of the body when there is nothing to compare it
+// with. If it is zero or negative, bodies are never truncated.
+var MaxBodyInFailure = 16 * 1024
+
+// indentedJSON formats JSON data with one value per line when
+// printed, so that nested values are easy to compare in failure
+// reports. Data that is not valid JSON is printed as is. The
+// output is truncated to MaxBodyInFailure bytes.
+type indentedJSON []byte
+
+func (data indentedJSON) String() string {
+	return truncateAround(indentJSON(data), 0, MaxBodyInFailure)
+}
+
+// jsonBodyEquals is like JSONEquals except that when the check
+// fails it reports the obtained and expected bodies as indented
+// JSON, truncated around their first difference, instead of
+// printing them in full.
+var jsonBodyEquals qt.Checker = jsonBodyChecker{JSONEquals}
+
+type jsonBodyChecker struct {
+	qt.Checker
+}
+
+type note struct {
+	key   string
+	value interface{}
+}
+
+// Check implements qt.Checker.Check.
+func (checker jsonBodyChecker) Check(got interface{}, args []interface{}, addNote func(key string, value interface{})) error {
+	var notes []note
+	err := checker.Checker.Check(got, args, func(key string, value interface{}) {
+		notes = append(notes, note{key, value})
+	})
+	if err == nil || qt.IsBadCheck(err) {
+		for _, n := range notes {
+			addNote(n.key, n.value)
+		}
+		return err
+	}
+	if err != qt.ErrSilent {
+		// Report the error here so that the checker arguments,
+		// which hold the complete bodies, are not printed.
+		addNote("error", qt.Unquoted(err.Error()))
+	}
+	for _, n := range notes {
+		addNote(n.key, n.value)
+	}
+	gotBody, wantBody := indentJSON([]byte(got.(string))), indentValue(args[0])
+	offset := firstDifference(gotBody, wantBody)
+	addNote("got body", qt.Unquoted(truncateAround(gotBody, offset, MaxBodyInFailure)))
+	addNote("want body", qt.Unquoted(truncateAround(wantBody, offset, MaxBodyInFailure)))
+	return qt.ErrSilent
+}
+
+func indentJSON(data []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return string(data)
+	}
+	return strings.Join(indentedLines(v), "\n")
+}
+
+func indentValue(x interface{}) string {
+	v, err := normalizeJSON(x)
+	if err != nil {
+		return fmt.Sprintf("%#v", x)
+	}
+	return strings.Join(indentedLines(v), "\n")
+}
+
+// firstDifference returns the offset of the start of
+// the first line at which a and b differ.
+func firstDifference(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return strings.LastIndexByte(a[:n], '\n') + 1
+}
+
+// truncateAround returns at most about max bytes of s, starting a
+// little before offset and cut at line boundaries where possible,
+// with a note of the number of bytes omitted at either end.
+func truncateAround(s string, offset, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	// Show some context before the point of interest.
+	start := offset - max/4
+	if start > len(s)-max {
+		start = len(s) - max
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + max
+	if start > 0 {
+		if i := strings.IndexByte(s[start:end], '\n'); i >= 0 && start+i+1 <= offset {
+			start += i + 1
+		}
+		for start < end && !utf8.RuneStart(s[start]) {
+			start++
+		}
+	}
+	if end < len(s) {
+		if i := strings.LastIndexByte(s[start:end], '\n'); i > 0 && start+i > offset {
+			end = start + i
+		}
+		for end > start && !utf8.RuneStart(s[end]) {
+			end--
+		}
+	}
+	var buf strings.Builder
+	if start > 0 {
+		fmt.Fprintf(&buf, "... (%d bytes omitted)\n", start)
+	}
+	buf.WriteString(s[start:end])
+	if end < len(s) {
+		fmt.Fprintf(&buf, "\n... (%d bytes omitted)", len(s)-end)
+	}
+	return buf.String()
+}
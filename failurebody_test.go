@@ -0,0 +1,85 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestMaxBodyInFailure(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.MaxBodyInFailure, 300)
+
+	items := make([]string, 1000)
+	for i := range items {
+		items[i] = fmt.Sprintf("item-%04d", i)
+	}
+	data, err := json.Marshal(items)
+	c.Assert(err, qt.Equals, nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	expect := append([]string(nil), items...)
+	expect[500] = "changed"
+
+	msg := failureMessage(c, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:    handler,
+			URL:        "/",
+			ExpectBody: expect,
+		})
+	})
+	c.Assert(msg, qt.Matches, `(?s).*
+got body:
+  \.\.\. \(\d+ bytes omitted\)
+(  .*\n)*  +"item-0500",
+(  .*\n)*  \.\.\. \(\d+ bytes omitted\)
+want body:
+  \.\.\. \(\d+ bytes omitted\)
+(  .*\n)*  +"changed",
+(  .*\n)*  \.\.\. \(\d+ bytes omitted\)
+.*`)
+	c.Assert(msg, qt.Not(qt.Matches), `(?s).*"item-0(000|999)".*`)
+
+	// Without an expected body to compare with,
+	// the start of the body is shown.
+	msg = failureMessage(c, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:      handler,
+			URL:          "/",
+			ExpectStatus: http.StatusNotFound,
+		})
+	})
+	c.Assert(msg, qt.Matches, `(?s).*body: \[\n +"item-0000",\n.*`)
+	c.Assert(msg, qt.Not(qt.Matches), `(?s).*"item-0999".*`)
+	omitted := regexp.MustCompile(`\.\.\. \(\d+ bytes omitted\)`).FindAllString(msg, -1)
+	c.Assert(omitted, qt.HasLen, 1)
+}
+
+// failureMessage runs f, checks that it fails
+// and returns the failure message.
+func failureMessage(c *qt.C, f func(c *qt.C)) string {
+	tb := &failingTB{TB: c.TB}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c1 := qt.New(tb)
+		defer c1.Done()
+		f(c1)
+	}()
+	<-done
+	c.Assert(tb.Failed(), qt.Equals, true, qt.Commentf("test did not fail"))
+	return strings.Join(tb.msgs, "\n")
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// SessionRotationParams holds parameters for AssertSessionRotated.
+type SessionRotationParams struct {
+	// Scenario holds the steps that log in. Steps before the login
+	// step are made without authentication, for example to fetch
+	// a login form.
+	Scenario *Scenario
+
+	// LoginStep holds the name of the step that authenticates.
+	// If it is empty, the last step is used.
+	LoginStep string
+
+	// Cookie holds the name of the session cookie.
+	Cookie string
+
+	// URL holds the URL for which the session cookie is looked up
+	// in the cookie jar. A URL without a host is resolved as for
+	// Session.Cookies. If it is empty, the URL of the login step
+	// is used.
+	URL string
+}
+
+// SessionRotation holds the session cookie values
+// observed by AssertSessionRotated.
+type SessionRotation struct {
+	// Before holds the session id before the login step.
+	Before string
+
+	// After holds the session id after the login step.
+	After string
+
+	// Planted records whether Before was planted by
+	// AssertSessionRotated rather than set by the server.
+	Planted bool
+}
+
+// AssertSessionRotated runs the scenario in p and asserts that the
+// session cookie changes when the login step is made, as a defence
+// against session fixation. If the server has not set the session
+// cookie by the time of the login step, a random session id is
+// planted in the cookie jar first, as an attacker would do, so the
+// server must either replace it or issue a new one. It returns the
+// session ids that were seen.
+func AssertSessionRotated(c *qt.C, p SessionRotationParams) SessionRotation {
+	c.Assert(p.Scenario, qt.Not(qt.IsNil), qt.Commentf("AssertSessionRotated requires a scenario"))
+	c.Assert(p.Cookie, qt.Not(qt.Equals), "", qt.Commentf("AssertSessionRotated requires a cookie name"))
+	login := len(p.Scenario.Steps) - 1
+	if p.LoginStep != "" {
+		login = -1
+		for i, step := range p.Scenario.Steps {
+			if step.Name == p.LoginStep {
+				login = i
+				break
+			}
+		}
+	}
+	if login < 0 {
+		c.Fatalf("login step %q not found in scenario", p.LoginStep)
+	}
+	var (
+		result SessionRotation
+		after  bool
+	)
+	p.Scenario.run(c, func(i int, caller *Caller, jar http.CookieJar) {
+		u := p.URL
+		if u == "" {
+			u = p.Scenario.expand(c, p.Scenario.Steps[login].Params.URL)
+		}
+		cookieURL := resolveURL(c, caller.BaseURL, u)
+		switch i {
+		case login:
+			if cookie := findCookie(jar.Cookies(cookieURL), p.Cookie); cookie != nil {
+				result.Before = cookie.Value
+				return
+			}
+			result.Before = randomHex(16)
+			result.Planted = true
+			jar.SetCookies(cookieURL, []*http.Cookie{{
+				Name:  p.Cookie,
+				Value: result.Before,
+				Path:  "/",
+			}})
+		case login + 1:
+			after = true
+			if cookie := findCookie(jar.Cookies(cookieURL), p.Cookie); cookie != nil {
+				result.After = cookie.Value
+			}
+		}
+	})
+	if !after {
+		c.Fatalf("scenario failed before the session could be checked")
+	}
+	if result.After == "" {
+		c.Fatalf("no %q cookie after login", p.Cookie)
+	}
+	if result.After == result.Before {
+		what := "issued"
+		if result.Planted {
+			what = "planted"
+		}
+		c.Fatalf("session cookie %q was not rotated on login; the %s value %q was kept", p.Cookie, what, result.Before)
+	}
+	return result
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// loginHandler issues a session cookie from /form and
+// authenticates the session on POST /login.
+type loginHandler struct {
+	// rotate specifies that a new session id is issued on login.
+	rotate bool
+	// deleteCookie specifies that the session cookie
+	// is deleted on login.
+	deleteCookie bool
+	// redirect specifies that login redirects to /profile.
+	redirect bool
+
+	mu sync.Mutex
+	n  int
+}
+
+func (h *loginHandler) newID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.n++
+	return fmt.Sprintf("s%d", h.n)
+}
+
+func (h *loginHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id := ""
+	if cookie, err := req.Cookie("session"); err == nil {
+		id = cookie.Value
+	}
+	switch req.URL.Path {
+	case "/form":
+		id = h.newID()
+	case "/login":
+		if h.deleteCookie {
+			http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+			id = ""
+		} else if id == "" || h.rotate {
+			id = h.newID()
+		}
+	}
+	if id != "" {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: id, Path: "/"})
+	}
+	if req.URL.Path == "/login" && h.redirect {
+		http.Redirect(w, req, "/profile", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func loginScenario(h http.Handler, withForm bool) *qthttptest.Scenario {
+	s := &qthttptest.Scenario{
+		Handler: h,
+	}
+	if withForm {
+		s.Steps = append(s.Steps, qthttptest.ScenarioStep{
+			Name: "form",
+			Params: qthttptest.JSONCallParams{
+				URL:        "/form",
+				ExpectBody: map[string]interface{}{},
+			},
+		})
+	}
+	s.Steps = append(s.Steps, qthttptest.ScenarioStep{
+		Name: "login",
+		Params: qthttptest.JSONCallParams{
+			Method:     "POST",
+			URL:        "/login",
+			ExpectBody: map[string]interface{}{},
+		},
+	}, qthttptest.ScenarioStep{
+		Name: "profile",
+		Params: qthttptest.JSONCallParams{
+			URL:        "/profile",
+			ExpectBody: map[string]interface{}{},
+		},
+	})
+	return s
+}
+
+func TestAssertSessionRotated(t *testing.T) {
+	c := qt.New(t)
+	result := qthttptest.AssertSessionRotated(c, qthttptest.SessionRotationParams{
+		Scenario:  loginScenario(&loginHandler{rotate: true}, true),
+		LoginStep: "login",
+		Cookie:    "session",
+	})
+	c.Assert(result, qt.DeepEquals, qthttptest.SessionRotation{
+		Before: "s1",
+		After:  "s2",
+	})
+}
+
+func TestAssertSessionRotatedWithRedirect(t *testing.T) {
+	c := qt.New(t)
+	result := qthttptest.AssertSessionRotated(c, qthttptest.SessionRotationParams{
+		Scenario:  loginScenario(&loginHandler{rotate: true, redirect: true}, true),
+		LoginStep: "login",
+		Cookie:    "session",
+	})
+	c.Assert(result, qt.DeepEquals, qthttptest.SessionRotation{
+		Before: "s1",
+		After:  "s2",
+	})
+}
+
+func TestAssertSessionRotatedPlanted(t *testing.T) {
+	c := qt.New(t)
+	result := qthttptest.AssertSessionRotated(c, qthttptest.SessionRotationParams{
+		Scenario:  loginScenario(&loginHandler{rotate: true}, false),
+		LoginStep: "login",
+		Cookie:    "session",
+	})
+	c.Assert(result.Planted, qt.Equals, true)
+	c.Assert(result.Before, qt.Matches, "[0-9a-f]{32}")
+	c.Assert(result.After, qt.Equals, "s1")
+}
+
+var assertSessionRotatedFailureTests = []struct {
+	about       string
+	handler     func() *loginHandler
+	withForm    bool
+	loginStep   string
+	expectError string
+}{{
+	about:       "issued session kept",
+	handler:     func() *loginHandler { return &loginHandler{} },
+	withForm:    true,
+	loginStep:   "login",
+	expectError: `session cookie "session" was not rotated on login; the issued value "s1" was kept`,
+}, {
+	about:       "planted session kept",
+	handler:     func() *loginHandler { return &loginHandler{} },
+	loginStep:   "login",
+	expectError: `session cookie "session" was not rotated on login; the planted value "[0-9a-f]{32}" was kept`,
+}, {
+	about:       "cookie deleted on login",
+	handler:     func() *loginHandler { return &loginHandler{deleteCookie: true} },
+	loginStep:   "login",
+	expectError: `no "session" cookie after login`,
+}, {
+	about:       "no such step",
+	handler:     func() *loginHandler { return &loginHandler{} },
+	loginStep:   "signin",
+	expectError: `login step "signin" not found in scenario`,
+}}
+
+func TestAssertSessionRotatedFailures(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertSessionRotatedFailureTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertSessionRotated(c, qthttptest.SessionRotationParams{
+					Scenario:  loginScenario(test.handler(), test.withForm),
+					LoginStep: test.loginStep,
+					Cookie:    "session",
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"sync"
+)
+
+// FlakyHandler is an http.Handler that fails a number of
+// requests before delegating to another handler. It can be
+// used to test client retry and backoff logic.
+type FlakyHandler struct {
+	handler http.Handler
+	status  int
+	n       int
+
+	mu       sync.Mutex
+	requests int
+}
+
+// FailFirstN returns a handler that responds to the first n requests
+// with the given status and delegates subsequent requests to handler.
+// Failed responses have a plain text body containing the status text.
+func FailFirstN(n, status int, handler http.Handler) *FlakyHandler {
+	return &FlakyHandler{
+		handler: handler,
+		status:  status,
+		n:       n,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *FlakyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	fail := h.requests <= h.n
+	h.mu.Unlock()
+	if fail {
+		http.Error(w, http.StatusText(h.status), h.status)
+		return
+	}
+	h.handler.ServeHTTP(w, req)
+}
+
+// Requests returns the total number of requests received.
+func (h *FlakyHandler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests
+}
+
+// Failures returns the number of requests that have been failed.
+func (h *FlakyHandler) Failures() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.requests < h.n {
+		return h.requests
+	}
+	return h.n
+}
+
+// Successes returns the number of requests
+// that have been passed to the handler.
+func (h *FlakyHandler) Successes() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.requests < h.n {
+		return 0
+	}
+	return h.requests - h.n
+}
+
+// Reset resets the request count so that the next
+// n requests fail again.
+func (h *FlakyHandler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = 0
+}
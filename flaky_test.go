@@ -0,0 +1,44 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestFailFirstN(t *testing.T) {
+	c := qt.New(t)
+	h := qthttptest.FailFirstN(2, http.StatusServiceUnavailable, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv := qthttptest.NewServer(c, h)
+	call := func() *qthttptest.Resp {
+		return qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+			URL: srv.URL() + "/",
+		})
+	}
+	call().AssertStatus(c, http.StatusServiceUnavailable)
+	c.Assert(h.Requests(), qt.Equals, 1)
+	c.Assert(h.Failures(), qt.Equals, 1)
+	c.Assert(h.Successes(), qt.Equals, 0)
+
+	resp := call().AssertStatus(c, http.StatusServiceUnavailable)
+	c.Assert(string(resp.Body), qt.Equals, "Service Unavailable\n")
+
+	resp = call().AssertStatus(c, http.StatusOK)
+	c.Assert(string(resp.Body), qt.Equals, "ok")
+	call().AssertStatus(c, http.StatusOK)
+	c.Assert(h.Requests(), qt.Equals, 4)
+	c.Assert(h.Failures(), qt.Equals, 2)
+	c.Assert(h.Successes(), qt.Equals, 2)
+
+	h.Reset()
+	c.Assert(h.Requests(), qt.Equals, 0)
+	call().AssertStatus(c, http.StatusServiceUnavailable)
+}
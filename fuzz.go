@@ -0,0 +1,218 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// FuzzInput holds the parts of a request
+// that are varied by FuzzCall.
+type FuzzInput struct {
+	// Query holds the raw query of the request URL.
+	Query string
+
+	// Header holds headers to add to the request.
+	Header http.Header
+
+	// Body holds the request body.
+	Body []byte
+}
+
+// String returns a description of the input
+// suitable for use in failure messages.
+func (in FuzzInput) String() string {
+	return fmt.Sprintf("query %q; header %q; body %q", in.Query, encodeFuzzHeader(in.Header), in.Body)
+}
+
+// FuzzCallParams holds parameters for FuzzCall and AssertRobustCall.
+type FuzzCallParams struct {
+	// Handler holds the handler under test.
+	Handler http.Handler
+
+	// Method holds the request method.
+	// If it is empty, POST is used.
+	Method string
+
+	// URL holds the request path. It must not contain
+	// a host or query. If it is empty, "/" is used.
+	URL string
+
+	// Header holds headers sent with every request. Headers
+	// in the input override those with the same name.
+	Header http.Header
+
+	// Corpus holds the seed inputs for the fuzzer.
+	Corpus []FuzzInput
+
+	// AllowServerErrors specifies that the handler may respond
+	// with a 5xx status. By default this is treated as a failure,
+	// because the handler should reject a bad request with a
+	// 4xx status instead.
+	AllowServerErrors bool
+
+	// Check, if non-nil, is called for each input
+	// to make further assertions about the response.
+	Check func(c *qt.C, in FuzzInput, resp *Resp)
+}
+
+// FuzzCall fuzzes the handler in p with Go's native fuzzing, starting
+// from the inputs in p.Corpus, and calls AssertRobustCall for each
+// input. It is intended to be called from a fuzz target:
+//
+//	func FuzzHandler(f *testing.F) {
+//		qthttptest.FuzzCall(f, qthttptest.FuzzCallParams{
+//			Handler: newHandler(),
+//			URL:     "/items",
+//			Corpus: []qthttptest.FuzzInput{{
+//				Header: http.Header{"Content-Type": {"application/json"}},
+//				Body:   []byte(`{"name":"x"}`),
+//			}},
+//		})
+//	}
+func FuzzCall(f *testing.F, p FuzzCallParams) {
+	if p.Handler == nil {
+		f.Fatal("FuzzCall requires a handler")
+	}
+	if len(p.Corpus) == 0 {
+		f.Add("", "", []byte(nil))
+	}
+	for _, in := range p.Corpus {
+		f.Add(in.Query, encodeFuzzHeader(in.Header), in.Body)
+	}
+	f.Fuzz(func(t *testing.T, query, header string, body []byte) {
+		AssertRobustCall(qt.New(t), p, FuzzInput{
+			Query:  query,
+			Header: decodeFuzzHeader(header),
+			Body:   body,
+		})
+	})
+}
+
+// AssertRobustCall calls the handler in p with the request described by
+// p and in, and asserts that the handler does not panic and that the
+// response is well formed: the status is valid and, unless
+// p.AllowServerErrors is set, not a server error, the Content-Length
+// header, if any, matches the body, the Content-Type header, if any,
+// can be parsed, the content encoding can be decoded, and a JSON body
+// is valid JSON. It then calls p.Check, if set, and returns the
+// response.
+func AssertRobustCall(c *qt.C, p FuzzCallParams, in FuzzInput) *Resp {
+	c.Assert(p.Handler, qt.Not(qt.IsNil), qt.Commentf("AssertRobustCall requires a handler"))
+	if p.Method == "" {
+		p.Method = "POST"
+	}
+	if p.URL == "" {
+		p.URL = "/"
+	}
+	req := httptest.NewRequest(p.Method, p.URL, bytes.NewReader(in.Body))
+	req.URL.RawQuery = in.Query
+	req.RequestURI = req.URL.RequestURI()
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+	for k, v := range in.Header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	var (
+		panicked bool
+		value    interface{}
+		stack    []byte
+	)
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				panicked, value, stack = true, v, debug.Stack()
+			}
+		}()
+		p.Handler.ServeHTTP(rec, req)
+	}()
+	if panicked {
+		c.Fatalf("handler panicked: %v\ninput: %v\n%s", value, in, stack)
+	}
+	resp := rec.Result()
+	rawBody := rec.Body.Bytes()
+	if resp.StatusCode < 100 || resp.StatusCode > 599 {
+		c.Fatalf("invalid status %d\ninput: %v", resp.StatusCode, in)
+	}
+	if resp.StatusCode >= 500 && !p.AllowServerErrors {
+		c.Fatalf("server error %d; body: %s\ninput: %v", resp.StatusCode, rawBody, in)
+	}
+	if cl := resp.Header.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n != int64(len(rawBody)) {
+			c.Fatalf("Content-Length %q does not match body length %d\ninput: %v", cl, len(rawBody), in)
+		}
+	}
+	body, err := decodeContent(resp.Header, rawBody)
+	if err != nil {
+		c.Fatalf("invalid response body: %v\ninput: %v", err, in)
+	}
+	if ctype := resp.Header.Get("Content-Type"); ctype != "" {
+		mediaType, _, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			c.Fatalf("invalid Content-Type %q: %v\ninput: %v", ctype, err, in)
+		}
+		if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && len(body) > 0 && !json.Valid(body) {
+			c.Fatalf("invalid JSON body: %s\ninput: %v", body, in)
+		}
+	}
+	r := &Resp{
+		Response: resp,
+		Body:     body,
+	}
+	if p.Check != nil {
+		p.Check(c, in, r)
+	}
+	return r
+}
+
+// encodeFuzzHeader encodes h as lines of the form "Name: value",
+// sorted by name, so that it can be passed to the fuzzer.
+func encodeFuzzHeader(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var buf strings.Builder
+	for _, k := range names {
+		for _, v := range h[k] {
+			fmt.Fprintf(&buf, "%s: %s\n", k, v)
+		}
+	}
+	return buf.String()
+}
+
+// decodeFuzzHeader decodes a header encoded by encodeFuzzHeader.
+// Lines without a name are ignored.
+func decodeFuzzHeader(s string) http.Header {
+	h := make(http.Header)
+	for _, line := range strings.Split(s, "\n") {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		name := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(line[:i]))
+		if name == "" {
+			continue
+		}
+		h[name] = append(h[name], strings.TrimSpace(line[i+1:]))
+	}
+	return h
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// itemHandler decodes a JSON item from the request
+// body and echoes its name back.
+func itemHandler(w http.ResponseWriter, req *http.Request) {
+	var item struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":   item.Name,
+		"filter": req.URL.Query().Get("filter"),
+	})
+}
+
+func FuzzFuzzCall(f *testing.F) {
+	qthttptest.FuzzCall(f, qthttptest.FuzzCallParams{
+		Handler: http.HandlerFunc(itemHandler),
+		URL:     "/items",
+		Corpus: []qthttptest.FuzzInput{{
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   []byte(`{"name":"x"}`),
+		}, {
+			Query: "filter=a%20b",
+			Body:  []byte(`{"name":`),
+		}},
+	})
+}
+
+func TestAssertRobustCall(t *testing.T) {
+	c := qt.New(t)
+	var checked []string
+	resp := qthttptest.AssertRobustCall(c, qthttptest.FuzzCallParams{
+		Handler: http.HandlerFunc(itemHandler),
+		Header:  http.Header{"X-Foo": {"bar"}},
+		Check: func(c *qt.C, in qthttptest.FuzzInput, resp *qthttptest.Resp) {
+			checked = append(checked, in.Query)
+		},
+	}, qthttptest.FuzzInput{
+		Query: "filter=f",
+		Body:  []byte(`{"name":"x"}`),
+	})
+	resp.AssertStatus(c, http.StatusOK)
+	resp.AssertJSON(c, map[string]string{"name": "x", "filter": "f"})
+	c.Assert(checked, qt.DeepEquals, []string{"filter=f"})
+}
+
+var assertRobustCallFailureTests = []struct {
+	about       string
+	handler     http.HandlerFunc
+	expectError string
+}{{
+	about: "panic",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		panic(fmt.Sprintf("cannot handle %s", body))
+	},
+	expectError: `handler panicked: cannot handle hello\ninput: query "q=1"; header "X-Foo: bar\\n"; body "hello"\n.*`,
+}, {
+	about: "server error",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	},
+	expectError: `server error 500; body: oops\n\ninput: .*`,
+}, {
+	about: "wrong content length",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("short"))
+	},
+	expectError: `Content-Length "10" does not match body length 5\ninput: .*`,
+}, {
+	about: "invalid content type",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/")
+		w.Write([]byte("x"))
+	},
+	expectError: `invalid Content-Type "application/": .*`,
+}, {
+	about: "invalid JSON",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Write([]byte(`{"title":`))
+	},
+	expectError: `invalid JSON body: {"title":\ninput: .*`,
+}}
+
+func TestAssertRobustCallFailures(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertRobustCallFailureTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertRobustCall(c, qthttptest.FuzzCallParams{
+					Handler: test.handler,
+				}, qthttptest.FuzzInput{
+					Query:  "q=1",
+					Header: http.Header{"X-Foo": {"bar"}},
+					Body:   []byte("hello"),
+				})
+			})
+		})
+	}
+}
+
+func TestAssertRobustCallAllowServerErrors(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.AssertRobustCall(c, qthttptest.FuzzCallParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}),
+		AllowServerErrors: true,
+	}, qthttptest.FuzzInput{})
+	resp.AssertStatus(c, http.StatusServiceUnavailable)
+}
@@ -1,8 +1,9 @@
 module github.com/juju/qthttptest
 
-go 1.17
+go 1.18
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/frankban/quicktest v1.7.2
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
@@ -0,0 +1,128 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// GraphQLCallParams holds parameters for AssertGraphQLCall.
+type GraphQLCallParams struct {
+	// DoRequestParams holds the parameters used to make the
+	// request. The Method, JSONBody and Body fields are ignored:
+	// the query is always POSTed as JSON.
+	DoRequestParams
+
+	// Query holds the GraphQL query document.
+	Query string
+
+	// OperationName, if non-empty, holds the name
+	// of the operation in Query to execute.
+	OperationName string
+
+	// Variables holds any variables for the query.
+	Variables map[string]interface{}
+
+	// ExpectStatus holds the expected HTTP status code.
+	// http.StatusOK is assumed if this is zero.
+	ExpectStatus int
+
+	// ExpectData holds the expected contents of the data member
+	// of the response, compared with JSONEquals. It may be a
+	// BodyAsserter, in which case it is called with the data. If
+	// it is nil, data must be null or absent.
+	ExpectData interface{}
+
+	// ExpectErrors holds regular expressions that must match the
+	// messages of the errors in the response, in order. If it is
+	// empty, the response must not contain any errors. Set
+	// both ExpectData and ExpectErrors to check a
+	// partial result.
+	ExpectErrors []string
+}
+
+// GraphQLError holds an error returned in a GraphQL response.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLErrorLocation `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLErrorLocation holds the location of a GraphQL error
+// in the query document.
+type GraphQLErrorLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// graphQLRequest holds the standard GraphQL request envelope.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphQLResponse holds the standard GraphQL response envelope.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []GraphQLError  `json:"errors"`
+}
+
+// AssertGraphQLCall asserts that when the GraphQL query in p is
+// posted, the response has the expected status, data and errors.
+func AssertGraphQLCall(c *qt.C, p GraphQLCallParams) {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	jp := JSONCallParams{
+		ExpectStatus: p.ExpectStatus,
+		ExpectBody: BodyAsserter(func(c *qt.C, body json.RawMessage) {
+			var resp graphQLResponse
+			err := json.Unmarshal(body, &resp)
+			c.Assert(err, qt.Equals, nil, qt.Commentf("invalid GraphQL response: %s", body))
+			assertGraphQLErrors(c, resp.Errors, p.ExpectErrors)
+			assertGraphQLData(c, resp.Data, p.ExpectData)
+		}),
+	}
+	dp := p.DoRequestParams
+	dp.Method = "POST"
+	dp.Body = nil
+	dp.JSONBody = graphQLRequest{
+		Query:         p.Query,
+		OperationName: p.OperationName,
+		Variables:     p.Variables,
+	}
+	jp.setDoRequestParams(dp)
+	AssertJSONCall(c, jp)
+}
+
+func assertGraphQLErrors(c *qt.C, errs []GraphQLError, expect []string) {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Message
+	}
+	c.Assert(msgs, qt.HasLen, len(expect), qt.Commentf("GraphQL errors"))
+	for i, pattern := range expect {
+		c.Assert(msgs[i], qt.Matches, pattern, qt.Commentf("GraphQL error %d", i))
+	}
+}
+
+func assertGraphQLData(c *qt.C, data json.RawMessage, expect interface{}) {
+	if expect == nil {
+		if len(data) > 0 {
+			c.Assert(string(data), qt.Equals, "null", qt.Commentf("unexpected GraphQL data"))
+		}
+		return
+	}
+	c.Assert(len(data) > 0 && string(data) != "null", qt.Equals, true, qt.Commentf("no GraphQL data in response"))
+	if assertData, ok := expect.(BodyAsserter); ok {
+		assertData(c, data)
+		return
+	}
+	c.Assert(string(data), JSONEquals, expect)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// graphQLHandler returns a handler that checks the GraphQL request
+// envelope and responds with the given response.
+func graphQLHandler(c *qt.C, response string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Method, qt.Equals, "POST")
+		c.Check(req.Header.Get("Content-Type"), qt.Equals, "application/json")
+		var body map[string]interface{}
+		err := json.NewDecoder(req.Body).Decode(&body)
+		c.Check(err, qt.Equals, nil)
+		c.Check(body, qt.DeepEquals, map[string]interface{}{
+			"query":         "query Q($id: ID!) { item(id: $id) { name } }",
+			"operationName": "Q",
+			"variables":     map[string]interface{}{"id": "1"},
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	})
+}
+
+var graphQLTests = []struct {
+	about         string
+	response      string
+	expectData    interface{}
+	expectErrors  []string
+	expectFailure string
+}{{
+	about:      "data only",
+	response:   `{"data": {"item": {"name": "foo"}}}`,
+	expectData: map[string]interface{}{"item": map[string]string{"name": "foo"}},
+}, {
+	about:        "errors only",
+	response:     `{"data": null, "errors": [{"message": "not found", "path": ["item"]}]}`,
+	expectErrors: []string{"not found"},
+}, {
+	about:        "partial result",
+	response:     `{"data": {"item": null}, "errors": [{"message": "item 1 not found"}]}`,
+	expectData:   map[string]interface{}{"item": nil},
+	expectErrors: []string{"item .* not found"},
+}, {
+	about:         "unexpected error",
+	response:      `{"data": {"item": null}, "errors": [{"message": "boom"}]}`,
+	expectData:    map[string]interface{}{"item": nil},
+	expectFailure: "GraphQL errors",
+}, {
+	about:         "missing data",
+	response:      `{"errors": [{"message": "boom"}]}`,
+	expectData:    map[string]interface{}{"item": nil},
+	expectErrors:  []string{"boom"},
+	expectFailure: "no GraphQL data in response",
+}}
+
+func TestAssertGraphQLCall(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range graphQLTests {
+		c.Run(test.about, func(c *qt.C) {
+			assert := func(c *qt.C) {
+				qthttptest.AssertGraphQLCall(c, qthttptest.GraphQLCallParams{
+					DoRequestParams: qthttptest.DoRequestParams{
+						URL:     "/graphql",
+						Handler: graphQLHandler(c, test.response),
+					},
+					Query:         "query Q($id: ID!) { item(id: $id) { name } }",
+					OperationName: "Q",
+					Variables:     map[string]interface{}{"id": "1"},
+					ExpectData:    test.expectData,
+					ExpectErrors:  test.expectErrors,
+				})
+			}
+			if test.expectFailure != "" {
+				checkFails(c, test.expectFailure, assert)
+			} else {
+				assert(c)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// GRPCWebResponse holds a parsed gRPC-Web response.
+type GRPCWebResponse struct {
+	// Messages holds the payloads of the data frames,
+	// in order. They are usually protobuf-encoded.
+	Messages [][]byte
+
+	// Trailer holds the trailers from the trailer frame,
+	// along with any grpc-* fields sent as HTTP headers,
+	// as in a trailers-only response.
+	Trailer http.Header
+
+	// Status holds the gRPC status code.
+	Status int
+
+	// Message holds the gRPC status message.
+	Message string
+}
+
+// grpcWebTrailerFlag is set in the flags byte of a trailer frame.
+const grpcWebTrailerFlag = 0x80
+
+// GRPCWebFrame returns msg encoded as a gRPC-Web data frame.
+func GRPCWebFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// ParseGRPCWebResponse parses the gRPC-Web response body with the given
+// headers. Both the binary (application/grpc-web) and base64
+// (application/grpc-web-text) encodings are supported.
+func ParseGRPCWebResponse(h http.Header, body []byte) (*GRPCWebResponse, error) {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %v", err)
+	}
+	if strings.HasPrefix(mediaType, "application/grpc-web-text") {
+		body, err = decodeGRPCWebText(body)
+		if err != nil {
+			return nil, err
+		}
+	} else if !strings.HasPrefix(mediaType, "application/grpc-web") {
+		return nil, fmt.Errorf("unexpected content type %q", mediaType)
+	}
+	resp := &GRPCWebResponse{
+		Trailer: make(http.Header),
+	}
+	for k, v := range h {
+		if strings.HasPrefix(strings.ToLower(k), "grpc-") {
+			resp.Trailer[k] = v
+		}
+	}
+	sawTrailer := false
+	for len(body) > 0 {
+		if sawTrailer {
+			return nil, fmt.Errorf("data after trailer frame")
+		}
+		if len(body) < 5 {
+			return nil, fmt.Errorf("truncated frame header")
+		}
+		flags := body[0]
+		n := binary.BigEndian.Uint32(body[1:5])
+		if uint64(len(body)-5) < uint64(n) {
+			return nil, fmt.Errorf("truncated frame: want %d bytes, got %d", n, len(body)-5)
+		}
+		payload := body[5 : 5+n]
+		body = body[5+n:]
+		if flags&grpcWebTrailerFlag == 0 {
+			resp.Messages = append(resp.Messages, payload)
+			continue
+		}
+		sawTrailer = true
+		// Add a blank line so that a trailer block without a
+		// final empty line is still parsed correctly.
+		r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(payload), strings.NewReader("\r\n"))))
+		mh, err := r.ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("invalid trailer frame: %v", err)
+		}
+		for k, v := range mh {
+			resp.Trailer[k] = v
+		}
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		return nil, fmt.Errorf("no grpc-status found")
+	}
+	resp.Status, err = strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc-status %q", status)
+	}
+	resp.Message = resp.Trailer.Get("Grpc-Message")
+	return resp, nil
+}
+
+// decodeGRPCWebText decodes a grpc-web-text body, which may consist of
+// several concatenated padded base64 chunks.
+func decodeGRPCWebText(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	body = bytes.TrimSpace(body)
+	for len(body) > 0 {
+		// Each chunk ends at the end of the body or after padding.
+		end := len(body)
+		if i := bytes.IndexByte(body, '='); i != -1 {
+			end = i
+			for end < len(body) && body[end] == '=' {
+				end++
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(string(body[:end]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc-web-text body: %v", err)
+		}
+		buf.Write(data)
+		body = body[end:]
+	}
+	return buf.Bytes(), nil
+}
+
+// GRPCWebCallParams holds parameters for AssertGRPCWebCall.
+type GRPCWebCallParams struct {
+	// DoRequestParams holds the parameters used to make the
+	// request. The Method and body fields (Body, BodyFile,
+	// JSONBody and JSONBodyFile) are ignored.
+	DoRequestParams
+
+	// Messages holds the request messages, which are sent
+	// as gRPC-Web data frames.
+	Messages [][]byte
+
+	// Text specifies that the application/grpc-web-text
+	// encoding should be used.
+	Text bool
+
+	// ExpectGRPCStatus holds the expected gRPC status code.
+	ExpectGRPCStatus int
+
+	// ExpectGRPCMessage holds a regular expression that the
+	// gRPC status message must match. If it is empty, the
+	// message is not checked.
+	ExpectGRPCMessage string
+
+	// ExpectMessages, if non-nil, is called with
+	// the response messages.
+	ExpectMessages func(c *qt.C, msgs [][]byte)
+}
+
+// AssertGRPCWebCall POSTs the gRPC-Web request described by p,
+// asserts that the response is well formed with the expected gRPC
+// status, and returns the parsed response.
+func AssertGRPCWebCall(c *qt.C, p GRPCWebCallParams) *GRPCWebResponse {
+	var body []byte
+	for _, msg := range p.Messages {
+		body = append(body, GRPCWebFrame(msg)...)
+	}
+	ctype := "application/grpc-web+proto"
+	if p.Text {
+		ctype = "application/grpc-web-text+proto"
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	dp := p.DoRequestParams
+	dp.Method = "POST"
+	dp.JSONBody = nil
+	dp.JSONBodyFile = ""
+	dp.BodyFile = ""
+	dp.Body = bytes.NewReader(body)
+	dp.Header = cloneHeader(dp.Header)
+	dp.Header.Set("Content-Type", ctype)
+	if dp.Header.Get("X-Grpc-Web") == "" {
+		dp.Header.Set("X-Grpc-Web", "1")
+	}
+	rec := DoRequest(c, dp)
+	if dp.ExpectError != "" {
+		return nil
+	}
+	c.Assert(rec.Code, qt.Equals, http.StatusOK, qt.Commentf("body: %q", rec.Body.Bytes()))
+	resp, err := ParseGRPCWebResponse(rec.Header(), rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil, qt.Commentf("body: %q", rec.Body.Bytes()))
+	c.Assert(resp.Status, qt.Equals, p.ExpectGRPCStatus, qt.Commentf("grpc-message: %q", resp.Message))
+	if p.ExpectGRPCMessage != "" {
+		c.Assert(resp.Message, qt.Matches, p.ExpectGRPCMessage)
+	}
+	if p.ExpectMessages != nil {
+		p.ExpectMessages(c, resp.Messages)
+	}
+	return resp
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// grpcWebEchoHandler echoes each request message twice,
+// followed by a trailer frame with the given status.
+func grpcWebEchoHandler(c *qt.C, text bool, status string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Header.Get("X-Grpc-Web"), qt.Equals, "1")
+		body, err := ioutil.ReadAll(req.Body)
+		c.Check(err, qt.Equals, nil)
+		if text {
+			body, err = base64.StdEncoding.DecodeString(string(body))
+			c.Check(err, qt.Equals, nil)
+		}
+		var out bytes.Buffer
+		for len(body) >= 5 {
+			n := int(body[4])
+			msg := body[5 : 5+n]
+			body = body[5+n:]
+			out.Write(qthttptest.GRPCWebFrame(msg))
+			out.Write(qthttptest.GRPCWebFrame(msg))
+		}
+		trailer := []byte("grpc-status: " + status + "\r\ngrpc-message: some%20message\r\n")
+		frame := qthttptest.GRPCWebFrame(trailer)
+		frame[0] = 0x80
+		out.Write(frame)
+		if text {
+			w.Header().Set("Content-Type", "application/grpc-web-text+proto")
+			// Encode the data and trailer frames as separate chunks.
+			w.Write([]byte(base64.StdEncoding.EncodeToString(out.Bytes()[:out.Len()-len(frame)])))
+			w.Write([]byte(base64.StdEncoding.EncodeToString(frame)))
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Write(out.Bytes())
+	})
+}
+
+func TestAssertGRPCWebCall(t *testing.T) {
+	c := qt.New(t)
+	for _, text := range []bool{false, true} {
+		resp := qthttptest.AssertGRPCWebCall(c, qthttptest.GRPCWebCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				URL:     "/pkg.Service/Method",
+				Handler: grpcWebEchoHandler(c, text, "0"),
+				// The body fields are ignored.
+				BodyFile:     "no-such-file",
+				JSONBodyFile: "no-such-file",
+			},
+			Text:              text,
+			Messages:          [][]byte{[]byte("a"), []byte("bc")},
+			ExpectGRPCMessage: "some%20message",
+			ExpectMessages: func(c *qt.C, msgs [][]byte) {
+				c.Assert(msgs, qt.DeepEquals, [][]byte{[]byte("a"), []byte("a"), []byte("bc"), []byte("bc")})
+			},
+		})
+		c.Assert(resp.Trailer.Get("Grpc-Status"), qt.Equals, "0")
+	}
+}
+
+func TestAssertGRPCWebCallStatus(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertGRPCWebCall(c, qthttptest.GRPCWebCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/pkg.Service/Method",
+			Handler: grpcWebEchoHandler(c, false, "5"),
+		},
+		ExpectGRPCStatus: 5,
+	})
+	checkFails(c, `grpc-message: "some%20message"`, func(c *qt.C) {
+		qthttptest.AssertGRPCWebCall(c, qthttptest.GRPCWebCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				URL:     "/pkg.Service/Method",
+				Handler: grpcWebEchoHandler(c, false, "5"),
+			},
+		})
+	})
+}
+
+func TestParseGRPCWebResponseTrailersOnly(t *testing.T) {
+	c := qt.New(t)
+	resp, err := qthttptest.ParseGRPCWebResponse(http.Header{
+		"Content-Type": {"application/grpc-web"},
+		"Grpc-Status":  {"12"},
+		"Grpc-Message": {"unimplemented"},
+	}, nil)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(resp.Status, qt.Equals, 12)
+	c.Assert(resp.Message, qt.Equals, "unimplemented")
+	c.Assert(resp.Messages, qt.HasLen, 0)
+}
+
+func TestParseGRPCWebResponseErrors(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{"Content-Type": {"application/grpc-web"}}
+	_, err := qthttptest.ParseGRPCWebResponse(h, []byte{0, 0, 0, 0, 5, 'a'})
+	c.Assert(err, qt.ErrorMatches, `truncated frame: want 5 bytes, got 1`)
+	_, err = qthttptest.ParseGRPCWebResponse(h, qthttptest.GRPCWebFrame([]byte("a")))
+	c.Assert(err, qt.ErrorMatches, `no grpc-status found`)
+	_, err = qthttptest.ParseGRPCWebResponse(http.Header{"Content-Type": {"application/json"}}, nil)
+	c.Assert(err, qt.ErrorMatches, `unexpected content type "application/json"`)
+}
@@ -0,0 +1,391 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// HAR holds an HTTP Archive, the format in which browser developer
+// tools and many proxies export recorded traffic. Only the parts used
+// by ReplayHAR and NewHARServer are represented.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the log recorded in a HAR.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator holds the application that created a HAR.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry holds a single recorded request and its response.
+type HAREntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+
+	// Time holds the total time taken by the
+	// call in milliseconds.
+	Time float64 `json:"time"`
+
+	Request  HARRequest  `json:"request"`
+	Response HARResponse `json:"response"`
+}
+
+// HARRequest holds a request recorded in a HAR.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+}
+
+// HARPostData holds the body of a request recorded in a HAR.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+
+	// Params holds the fields of a form body. It is used
+	// to make the body when Text is empty.
+	Params []HARNameValue `json:"params,omitempty"`
+}
+
+// HARResponse holds a response recorded in a HAR.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+}
+
+// HARContent holds the body of a response recorded in a HAR, with
+// any content coding removed.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+
+	// Encoding holds "base64" if Text holds the
+	// body encoded as base64.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARNameValue holds a header, query parameter
+// or form field recorded in a HAR.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ParseHAR parses a HAR from its JSON encoding.
+func ParseHAR(data []byte) (*HAR, error) {
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %v", err)
+	}
+	for i, e := range har.Log.Entries {
+		if _, err := url.Parse(e.Request.URL); err != nil {
+			return nil, fmt.Errorf("invalid HAR: entry %d: %v", i, err)
+		}
+		if _, err := e.Response.Content.body(); err != nil {
+			return nil, fmt.Errorf("invalid HAR: entry %d: %v", i, err)
+		}
+	}
+	return &har, nil
+}
+
+// ReadHAR reads and parses the HAR file at the given path.
+func ReadHAR(c *qt.C, path string) *HAR {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.Equals, nil)
+	har, err := ParseHAR(data)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("file %s", path))
+	return har
+}
+
+// HARReplayParams holds parameters for ReplayHAR.
+type HARReplayParams struct {
+	// Handler, if non-nil, is used to start a server
+	// that all the requests are sent to.
+	Handler http.Handler
+
+	// BaseURL holds the URL that the requests are sent to when
+	// Handler is nil. The path and query of each recorded URL are
+	// resolved relative to it.
+	BaseURL string
+
+	// Filter, if non-nil, is called with each entry. Entries
+	// for which it returns false are not replayed.
+	Filter func(e HAREntry) bool
+
+	// Adjust, if non-nil, is called with each entry and the
+	// parameters of the call made for it so that they can be
+	// changed, for example to replace credentials or to tolerate
+	// volatile values. NormalizeBody, if set, is applied to the
+	// recorded body as well as to the response body.
+	Adjust func(e HAREntry, p *JSONCallParams)
+}
+
+// ReplayHAR replays the requests recorded in har in order, each in
+// its own subtest, and asserts that each response has the recorded
+// status and body. JSON bodies are compared as for AssertJSONCall;
+// other bodies must be identical to the recorded ones and have the
+// same media type. Response headers are not compared, as they
+// usually vary; use HARReplayParams.Adjust to check any that matter.
+//
+// The recorded request headers are sent, including any Cookie
+// headers, except for those that are specific to the recorded
+// connection such as Host and Content-Length. Redirects are not
+// followed, as the recorded redirect responses are checked and the
+// requests that followed them are usually recorded too. Replay
+// carries on after a failed subtest, as later entries rarely depend
+// on the exact content of earlier responses.
+func ReplayHAR(c *qt.C, har *HAR, p HARReplayParams) {
+	caller := &Caller{
+		BaseURL: p.BaseURL,
+	}
+	if p.Handler != nil {
+		caller = &NewServer(c, p.Handler).Caller
+	}
+	for i, e := range har.Log.Entries {
+		e := e
+		if p.Filter != nil && !p.Filter(e) {
+			continue
+		}
+		u, _ := url.Parse(e.Request.URL)
+		c.Run(fmt.Sprintf("%d %s %s", i, e.Request.Method, u.Path), func(c *qt.C) {
+			replayHAREntry(c, caller, e, p.Adjust)
+		})
+	}
+}
+
+// replayHAREntry replays a single entry for ReplayHAR.
+func replayHAREntry(c *qt.C, caller *Caller, e HAREntry, adjust func(e HAREntry, p *JSONCallParams)) {
+	expectBody, err := e.Response.Content.body()
+	c.Assert(err, qt.Equals, nil)
+	p := JSONCallParams{
+		Method:       e.Request.Method,
+		URL:          e.Request.requestURI(),
+		Header:       harHeader(e.Request.Headers, harRequestHeaderSkip),
+		ExpectStatus: e.Response.Status,
+		Do:           harClient.Do,
+	}
+	if body := e.Request.body(); body != nil {
+		p.Body = bytes.NewReader(body)
+	}
+	isJSON := expectRecordedBody(&p, e.Response.Content.MimeType, expectBody)
+	if adjust != nil {
+		adjust(e, &p)
+	}
+	assertRecordedResponse(c, caller, p, expectBody, isJSON)
+}
+
+// expectRecordedBody sets the expectations in p for a recorded
+// response body with the given media type, and reports whether
+// the body is compared as JSON.
+func expectRecordedBody(p *JSONCallParams, contentType string, body []byte) (isJSON bool) {
+	if len(body) == 0 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	p.ExpectContentType = mediaType
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return false
+	}
+	p.ExpectBody = json.RawMessage(body)
+	return true
+}
+
+// assertRecordedResponse makes the call described by p and asserts
+// that the response matches it, where expectBody holds the recorded
+// body and isJSON reports whether it is compared as JSON.
+// NormalizeBody, if set, is applied to both bodies.
+func assertRecordedResponse(c *qt.C, caller *Caller, p JSONCallParams, expectBody []byte, isJSON bool) {
+	if p.NormalizeBody != nil {
+		raw, ok := p.ExpectBody.(json.RawMessage)
+		recorded := ok && isJSON && bytes.Equal(raw, expectBody)
+		expectBody = p.NormalizeBody(expectBody)
+		if recorded {
+			p.ExpectBody = json.RawMessage(expectBody)
+		}
+	}
+	if isJSON || len(expectBody) == 0 {
+		caller.AssertJSONCall(c, p)
+		return
+	}
+	// AssertJSONCall only checks JSON bodies, so
+	// compare other bodies directly.
+	resp := DoResponse(c, caller.DoRequestParams(p.doRequestParams()))
+	resp.AssertStatus(c, p.ExpectStatus)
+	if p.ExpectContentType != "" {
+		c.Assert(resp.Response.Header.Get("Content-Type"), ContentTypeMatches, p.ExpectContentType)
+	}
+	body := resp.Body
+	if p.NormalizeBody != nil {
+		body = p.NormalizeBody(body)
+	}
+	c.Assert(string(body), qt.Equals, string(expectBody), qt.Commentf("response body"))
+}
+
+// harClient is used to replay requests so that recorded
+// redirect responses are checked rather than followed.
+var harClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// harRequestHeaderSkip holds the request headers that are not
+// replayed because they relate to the recorded connection.
+var harRequestHeaderSkip = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// harResponseHeaderSkip holds the response headers that are not
+// served by NewHARServer, as they describe the recorded encoding
+// of the body rather than its recorded content.
+var harResponseHeaderSkip = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// harHeader returns the given headers, leaving out those in skip
+// and any HTTP/2 pseudo-headers such as ":authority".
+func harHeader(nvs []HARNameValue, skip map[string]bool) http.Header {
+	h := make(http.Header)
+	for _, nv := range nvs {
+		if strings.HasPrefix(nv.Name, ":") || skip[http.CanonicalHeaderKey(nv.Name)] {
+			continue
+		}
+		h.Add(nv.Name, nv.Value)
+	}
+	return h
+}
+
+// requestURI returns the path and query of the request URL.
+func (r HARRequest) requestURI() string {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return r.URL
+	}
+	return u.RequestURI()
+}
+
+// body returns the request body, or nil if there is none.
+func (r HARRequest) body() []byte {
+	if r.PostData == nil {
+		return nil
+	}
+	if r.PostData.Text == "" && len(r.PostData.Params) > 0 {
+		form := make(url.Values)
+		for _, nv := range r.PostData.Params {
+			form.Add(nv.Name, nv.Value)
+		}
+		return []byte(form.Encode())
+	}
+	return []byte(r.PostData.Text)
+}
+
+// body returns the decoded response body.
+func (c HARContent) body() ([]byte, error) {
+	if c.Encoding != "base64" {
+		return []byte(c.Text), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(c.Text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 response content: %v", err)
+	}
+	return data, nil
+}
+
+// NewHARServer starts a stub server, shut down when the test
+// completes, that serves the responses recorded in har. A request
+// receives the response of an entry with the same method, path and
+// query parameters, regardless of their order. When several entries
+// match, they are served in the order they were recorded, the last
+// being served for any further requests. A request that matches no
+// entry receives a 404 response.
+func NewHARServer(c *qt.C, har *HAR) *Server {
+	return NewServer(c, &harServer{
+		entries: har.Log.Entries,
+		served:  make(map[string]int),
+	})
+}
+
+type harServer struct {
+	entries []HAREntry
+
+	mu sync.Mutex
+	// served holds the number of requests
+	// served for each request key.
+	served map[string]int
+}
+
+// ServeHTTP implements http.Handler.
+func (s *harServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := harRequestKey(req.Method, req.URL)
+	var matches []HAREntry
+	for _, e := range s.entries {
+		u, err := url.Parse(e.Request.URL)
+		if err == nil && harRequestKey(e.Request.Method, u) == key {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) == 0 {
+		http.Error(w, fmt.Sprintf("no HAR entry for %s %s", req.Method, req.URL), http.StatusNotFound)
+		return
+	}
+	s.mu.Lock()
+	n := s.served[key]
+	s.served[key]++
+	s.mu.Unlock()
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	resp := matches[n].Response
+	body, _ := resp.Content.body()
+	for k, v := range harHeader(resp.Headers, harResponseHeaderSkip) {
+		w.Header()[k] = v
+	}
+	if w.Header().Get("Content-Type") == "" && resp.Content.MimeType != "" {
+		w.Header().Set("Content-Type", resp.Content.MimeType)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(body)
+}
+
+// harRequestKey returns a key identifying requests with
+// the given method, path and query parameters.
+func harRequestKey(method string, u *url.URL) string {
+	return method + " " + u.EscapedPath() + "?" + sortedQuery(u.Query()).Encode()
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+const testHAR = `{
+	"log": {
+		"version": "1.2",
+		"creator": {"name": "test", "version": "1.0"},
+		"entries": [{
+			"startedDateTime": "2022-01-02T15:04:05.000Z",
+			"time": 12.5,
+			"request": {
+				"method": "GET",
+				"url": "https://example.com/items?id=1",
+				"httpVersion": "HTTP/2.0",
+				"headers": [
+					{"name": ":authority", "value": "example.com"},
+					{"name": "Host", "value": "example.com"},
+					{"name": "X-Client", "value": "browser"}
+				],
+				"queryString": [{"name": "id", "value": "1"}]
+			},
+			"response": {
+				"status": 200,
+				"statusText": "OK",
+				"httpVersion": "HTTP/2.0",
+				"headers": [
+					{"name": "Content-Type", "value": "application/json"},
+					{"name": "Content-Encoding", "value": "gzip"},
+					{"name": "X-Served-By", "value": "production"}
+				],
+				"content": {"size": 23, "mimeType": "application/json", "text": "{\"id\":1,\"name\":\"one\"}"}
+			}
+		}, {
+			"startedDateTime": "2022-01-02T15:04:06.000Z",
+			"time": 20,
+			"request": {
+				"method": "POST",
+				"url": "https://example.com/items",
+				"httpVersion": "HTTP/2.0",
+				"headers": [
+					{"name": "Content-Type", "value": "application/x-www-form-urlencoded"},
+					{"name": "Content-Length", "value": "8"}
+				],
+				"queryString": [],
+				"postData": {
+					"mimeType": "application/x-www-form-urlencoded",
+					"params": [{"name": "name", "value": "two"}]
+				}
+			},
+			"response": {
+				"status": 303,
+				"statusText": "See Other",
+				"httpVersion": "HTTP/2.0",
+				"headers": [{"name": "Location", "value": "/page"}],
+				"content": {"size": 0, "mimeType": ""},
+				"redirectURL": "/page"
+			}
+		}, {
+			"startedDateTime": "2022-01-02T15:04:07.000Z",
+			"time": 5,
+			"request": {
+				"method": "GET",
+				"url": "https://example.com/page",
+				"httpVersion": "HTTP/2.0",
+				"headers": [],
+				"queryString": []
+			},
+			"response": {
+				"status": 200,
+				"statusText": "OK",
+				"httpVersion": "HTTP/2.0",
+				"headers": [{"name": "Content-Type", "value": "text/html; charset=utf-8"}],
+				"content": {"size": 9, "mimeType": "text/html; charset=utf-8", "text": "PHA+aGk8L3A+", "encoding": "base64"}
+			}
+		}]
+	}
+}`
+
+// harHandler returns a handler that responds to
+// the requests recorded in testHAR.
+func harHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "GET" && req.URL.Path == "/items":
+			if req.Header.Get("X-Client") != "browser" {
+				http.Error(w, "missing header", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"name": %q, "id": 1}`, name)
+		case req.Method == "POST" && req.URL.Path == "/items":
+			if req.PostFormValue("name") != "two" {
+				http.Error(w, "bad form", http.StatusBadRequest)
+				return
+			}
+			http.Redirect(w, req, "/page", http.StatusSeeOther)
+		case req.URL.Path == "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<p>hi</p>"))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
+
+func TestReplayHAR(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "test.har")
+	err := ioutil.WriteFile(path, []byte(testHAR), 0666)
+	c.Assert(err, qt.Equals, nil)
+	har := qthttptest.ReadHAR(c, path)
+	c.Assert(har.Log.Entries, qt.HasLen, 3)
+	c.Assert(har.Log.Entries[0].Time, qt.Equals, 12.5)
+
+	qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+		Handler: harHandler("one"),
+	})
+
+	srv := qthttptest.NewServer(c, harHandler("other"))
+	checkFails(c, `want body:\n  {\n    "id": 1,\n    "name": "one"`, func(c *qt.C) {
+		qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+			BaseURL: srv.URL(),
+		})
+	})
+	qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+		BaseURL: srv.URL(),
+		Filter: func(e qthttptest.HAREntry) bool {
+			return e.Request.Method == "POST"
+		},
+	})
+	qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+		BaseURL: srv.URL(),
+		Adjust: func(e qthttptest.HAREntry, p *qthttptest.JSONCallParams) {
+			p.NormalizeBody = qthttptest.JSONNormalizer(func(v interface{}) interface{} {
+				if m, ok := v.(map[string]interface{}); ok {
+					m["name"] = "NAME"
+				}
+				return v
+			})
+		},
+	})
+
+	checkFails(c, `response body\ngot:\n  "<p>bye</p>"\nwant:\n  "<p>hi</p>"`, func(c *qt.C) {
+		qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<p>bye</p>"))
+			}),
+			Filter: func(e qthttptest.HAREntry) bool {
+				return e.Request.Method == "GET" && e.Request.URL == "https://example.com/page"
+			},
+		})
+	})
+}
+
+func TestParseHARError(t *testing.T) {
+	c := qt.New(t)
+	_, err := qthttptest.ParseHAR([]byte(`{"log": []}`))
+	c.Assert(err, qt.ErrorMatches, `invalid HAR: json: .*`)
+	_, err = qthttptest.ParseHAR([]byte(`{"log": {"entries": [{"request": {"url": "http://x/"}, "response": {"content": {"text": "!", "encoding": "base64"}}}]}}`))
+	c.Assert(err, qt.ErrorMatches, `invalid HAR: entry 0: invalid base64 response content: .*`)
+}
+
+func TestNewHARServer(t *testing.T) {
+	c := qt.New(t)
+	var har qthttptest.HAR
+	err := json.Unmarshal([]byte(testHAR), &har)
+	c.Assert(err, qt.Equals, nil)
+	// Record a second response to the same request.
+	e := har.Log.Entries[0]
+	e.Response.Content.Text = `{"id":1,"name":"updated"}`
+	har.Log.Entries = append(har.Log.Entries, e)
+
+	srv := qthttptest.NewHARServer(c, &har)
+	for _, name := range []string{"one", "updated", "updated"} {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL: "/items?id=1",
+			ExpectHeader: http.Header{
+				"X-Served-By": {"production"},
+			},
+			ExpectBody: map[string]interface{}{
+				"id":   1,
+				"name": name,
+			},
+		})
+	}
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/page",
+	})
+	resp.AssertStatus(c, http.StatusOK)
+	c.Assert(string(resp.Body), qt.Equals, "<p>hi</p>")
+	c.Assert(resp.Response.Header.Get("Content-Type"), qt.Equals, "text/html; charset=utf-8")
+
+	resp = qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/items?id=2",
+	})
+	resp.AssertStatus(c, http.StatusNotFound)
+	c.Assert(string(resp.Body), qt.Equals, "no HAR entry for GET /items?id=2\n")
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"unicode/utf8"
+)
+
+// HARExporter is a FailureFormatter that writes each failed call,
+// with its request and response in full, to a new HAR file and adds
+// the path of the file to the failure report. The file can be
+// loaded with ReadHAR to replay the call with ReplayHAR or to serve
+// its response with NewHARServer, or opened in a browser's developer
+// tools.
+//
+// The files are not removed when the test completes.
+type HARExporter struct {
+	// Dir holds the directory in which to write the files. It
+	// is created if it does not exist. If it is empty, the
+	// default directory for temporary files is used.
+	Dir string
+
+	// Formatter, if non-nil, is used to format the rest of
+	// the report.
+	Formatter FailureFormatter
+}
+
+// FormatFailure implements FailureFormatter.FormatFailure.
+func (e HARExporter) FormatFailure(f CallFailure) string {
+	msg := f.Message
+	if e.Formatter != nil {
+		msg = e.Formatter.FormatFailure(f)
+	}
+	path, err := e.write(f)
+	if err != nil {
+		return fmt.Sprintf("%s\ncannot write HAR file: %v\n", msg, err)
+	}
+	return fmt.Sprintf("%s\ncall written to %s\n", msg, path)
+}
+
+// write writes the HAR file for f and returns its path.
+func (e HARExporter) write(f CallFailure) (string, error) {
+	data, err := json.MarshalIndent(failureHAR(f), "", "\t")
+	if err != nil {
+		return "", err
+	}
+	dir := e.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	} else if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	file, err := ioutil.TempFile(dir, "qthttptest-*.har")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// harExporterFromEnv returns the FailureFormatter to use when the
+// QTHTTPTEST_HAR_DIR environment variable holds dir.
+func harExporterFromEnv(dir string) FailureFormatter {
+	if dir == "" {
+		return nil
+	}
+	return HARExporter{
+		Dir: dir,
+	}
+}
+
+// failureHAR returns a HAR holding the call described by f.
+func failureHAR(f CallFailure) *HAR {
+	e := HAREntry{
+		StartedDateTime: DefaultClock.Now().UTC(),
+		Request: HARRequest{
+			Method:      f.Method,
+			URL:         f.URL,
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harNameValues(f.RequestHeader),
+			QueryString: []HARNameValue{},
+		},
+		Response: HARResponse{
+			Headers: []HARNameValue{},
+		},
+	}
+	if u, err := url.Parse(f.URL); err == nil {
+		e.Request.QueryString = harNameValues(u.Query())
+	}
+	if len(f.RequestBody) > 0 {
+		e.Request.PostData = &HARPostData{
+			MimeType: f.RequestHeader.Get("Content-Type"),
+			Text:     string(f.RequestBody),
+		}
+	}
+	if resp := f.Response; resp != nil {
+		e.Response.Status = resp.StatusCode
+		e.Response.StatusText = http.StatusText(resp.StatusCode)
+		e.Response.HTTPVersion = resp.Proto
+		e.Response.Headers = harNameValues(resp.Header)
+		e.Response.RedirectURL = resp.Header.Get("Location")
+		e.Response.Content = harContent(resp.Header, f.Body)
+	}
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{
+				Name: "qthttptest",
+			},
+			Entries: []HAREntry{e},
+		},
+	}
+}
+
+// harContent returns the HAR content of a response with the given
+// header and body, as received before any content decoding.
+func harContent(h http.Header, body []byte) HARContent {
+	if decoded, err := decodeContent(h, body); err == nil {
+		body = decoded
+	}
+	content := HARContent{
+		Size:     int64(len(body)),
+		MimeType: h.Get("Content-Type"),
+		Text:     string(body),
+	}
+	if !utf8.Valid(body) {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return content
+}
+
+// harNameValues returns the values in m in name order.
+func harNameValues(m map[string][]string) []HARNameValue {
+	nvs := []HARNameValue{}
+	for name, vals := range m {
+		for _, val := range vals {
+			nvs = append(nvs, HARNameValue{
+				Name:  name,
+				Value: val,
+			})
+		}
+	}
+	sort.SliceStable(nvs, func(i, j int) bool {
+		return nvs[i].Name < nvs[j].Name
+	})
+	return nvs
+}
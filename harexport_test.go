@@ -0,0 +1,83 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestHARExporter(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	dir := filepath.Join(c.TempDir(), "failures")
+	c.Patch(&qthttptest.CallFailureFormatter, qthttptest.HARExporter{
+		Dir: dir,
+		Formatter: qthttptest.FailureFormatterFunc(func(f qthttptest.CallFailure) string {
+			return "formatted: " + f.Message
+		}),
+	})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"n": 1}`))
+	})
+	msg := failureMessage(c, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:    handler,
+			Method:     "POST",
+			URL:        "/items?x=1",
+			Header:     http.Header{"X-Test": {"a"}},
+			JSONBody:   map[string]int{"n": 2},
+			ExpectBody: map[string]int{"n": 2},
+		})
+	})
+	c.Assert(msg, qt.Matches, `(?s)formatted: \nerror:\n  values are not deep equal\n.*\ncall written to .*\.har\n`)
+	path := regexp.MustCompile(`call written to (.*)\n`).FindStringSubmatch(msg)[1]
+	c.Assert(filepath.Dir(path), qt.Equals, dir)
+
+	har := qthttptest.ReadHAR(c, path)
+	c.Assert(har.Log.Entries, qt.HasLen, 1)
+	e := har.Log.Entries[0]
+	c.Assert(e.Request.Method, qt.Equals, "POST")
+	c.Assert(e.Request.URL, qt.Matches, `http://127\.0\.0\.1:\d+/items\?x=1`)
+	c.Assert(e.Request.QueryString, qt.DeepEquals, []qthttptest.HARNameValue{{Name: "x", Value: "1"}})
+	c.Assert(e.Request.Headers, qt.Contains, qthttptest.HARNameValue{Name: "X-Test", Value: "a"})
+	c.Assert(e.Request.PostData, qt.DeepEquals, &qthttptest.HARPostData{
+		MimeType: "application/json",
+		Text:     `{"n":2}`,
+	})
+	c.Assert(e.Response.Status, qt.Equals, http.StatusOK)
+	c.Assert(e.Response.Content.Text, qt.Equals, `{"n": 1}`)
+
+	// The recorded call can be replayed.
+	c.Patch(&qthttptest.CallFailureFormatter, nil)
+	qthttptest.ReplayHAR(c, har, qthttptest.HARReplayParams{
+		Handler: handler,
+	})
+}
+
+func TestHARExporterWriteError(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	file := filepath.Join(c.TempDir(), "file")
+	err := ioutil.WriteFile(file, nil, 0666)
+	c.Assert(err, qt.Equals, nil)
+	c.Patch(&qthttptest.CallFailureFormatter, qthttptest.HARExporter{
+		Dir: file,
+	})
+	checkFails(c, `values are not equal\n.*\ncannot write HAR file: mkdir .*: not a directory\n`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:      http.NotFoundHandler(),
+			URL:          "/",
+			ExpectStatus: http.StatusOK,
+		})
+	})
+}
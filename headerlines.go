@@ -0,0 +1,122 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// AssertHeaderLines asserts that h, which may come from a response
+// or a RecordedRequest, holds exactly the given values for the named
+// header, each sent as a separate header line. So a header sent as
+// the two lines "X-Foo: a" and "X-Foo: b" matches the lines "a" and
+// "b" but not the single line "a, b", and vice versa.
+func AssertHeaderLines(c *qt.C, h http.Header, name string, lines ...string) {
+	got := h.Values(name)
+	if len(got) == 0 {
+		got = nil
+	}
+	if len(lines) == 0 {
+		lines = nil
+	}
+	if reflect.DeepEqual(got, lines) {
+		return
+	}
+	comment := fmt.Sprintf("%s header lines", http.CanonicalHeaderKey(name))
+	if reflect.DeepEqual(splitHeaderList(got), splitHeaderList(lines)) {
+		comment += fmt.Sprintf("; the values are the same but were sent as %d line(s), not %d", len(got), len(lines))
+	}
+	c.Assert(got, qt.DeepEquals, lines, qt.Commentf("%s", comment))
+}
+
+// AssertHeaderList asserts that the named header in h holds the
+// given comma-separated list elements, regardless of how they are
+// split across header lines. So a header sent as the two lines
+// "X-Foo: a" and "X-Foo: b" and one sent as the single line
+// "X-Foo: a, b" both match the elements "a" and "b". Empty elements
+// are ignored, and commas within quoted strings do not separate
+// elements.
+func AssertHeaderList(c *qt.C, h http.Header, name string, elems ...string) {
+	got := splitHeaderList(h.Values(name))
+	if len(elems) == 0 {
+		elems = nil
+	}
+	c.Assert(got, qt.DeepEquals, elems, qt.Commentf("%s header list elements; lines: %q", http.CanonicalHeaderKey(name), h.Values(name)))
+}
+
+// AssertHeaderLines asserts that the response has the given header
+// lines, as for the AssertHeaderLines function.
+func (r *Resp) AssertHeaderLines(c *qt.C, name string, lines ...string) *Resp {
+	AssertHeaderLines(c, r.Response.Header, name, lines...)
+	return r
+}
+
+// AssertHeaderList asserts that the response has the given header
+// list elements, as for the AssertHeaderList function.
+func (r *Resp) AssertHeaderList(c *qt.C, name string, elems ...string) *Resp {
+	AssertHeaderList(c, r.Response.Header, name, elems...)
+	return r
+}
+
+// MatchHeaderLines returns a matcher that matches requests with
+// exactly the given lines for the named header, as described for
+// AssertHeaderLines.
+func MatchHeaderLines(name string, lines ...string) RequestMatcher {
+	return func(r RecordedRequest) error {
+		got := r.Header.Values(name)
+		if len(got) == len(lines) {
+			match := true
+			for i := range got {
+				if got[i] != lines[i] {
+					match = false
+					break
+				}
+			}
+			if match {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s header has lines %q, not %q", http.CanonicalHeaderKey(name), got, lines)
+	}
+}
+
+// splitHeaderList splits the given header lines into their
+// comma-separated elements, ignoring empty elements and
+// commas in quoted strings.
+func splitHeaderList(lines []string) []string {
+	var elems []string
+	for _, line := range lines {
+		start, quoted := 0, false
+		for i := 0; i <= len(line); i++ {
+			if i < len(line) {
+				switch line[i] {
+				case '\\':
+					if quoted && i+1 < len(line) {
+						i++
+					}
+					continue
+				case '"':
+					quoted = !quoted
+					continue
+				case ',':
+					if quoted {
+						continue
+					}
+				default:
+					continue
+				}
+			}
+			if elem := strings.TrimSpace(line[start:i]); elem != "" {
+				elems = append(elems, elem)
+			}
+			start = i + 1
+		}
+	}
+	return elems
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var headerLinesTests = []struct {
+	about       string
+	header      http.Header
+	lines       []string
+	elems       []string
+	expectLines string
+	expectList  string
+}{{
+	about:  "separate lines",
+	header: http.Header{"X-Foo": {"a", "b"}},
+	lines:  []string{"a", "b"},
+	elems:  []string{"a", "b"},
+}, {
+	about:       "single joined line",
+	header:      http.Header{"X-Foo": {"a, b"}},
+	lines:       []string{"a", "b"},
+	elems:       []string{"a", "b"},
+	expectLines: `X-Foo header lines; the values are the same but were sent as 1 line\(s\), not 2\n.*`,
+}, {
+	about:       "separate lines when a single line is expected",
+	header:      http.Header{"X-Foo": {"a", "b"}},
+	lines:       []string{"a,b"},
+	elems:       []string{"a", "b"},
+	expectLines: `X-Foo header lines; the values are the same but were sent as 2 line\(s\), not 1\n.*`,
+}, {
+	about:       "different values",
+	header:      http.Header{"X-Foo": {"a", "c"}},
+	lines:       []string{"a", "b"},
+	elems:       []string{"a", "b"},
+	expectLines: `X-Foo header lines\n.*`,
+	expectList:  `X-Foo header list elements; lines: \["a" "c"\]\n.*`,
+}, {
+	about:  "quoted commas and empty elements",
+	header: http.Header{"X-Foo": {`"a,b", , c`, `"d\"e"`}},
+	lines:  []string{`"a,b", , c`, `"d\"e"`},
+	elems:  []string{`"a,b"`, "c", `"d\"e"`},
+}, {
+	about:       "missing header",
+	header:      http.Header{},
+	lines:       []string{"a"},
+	elems:       []string{"a"},
+	expectLines: `X-Foo header lines\n.*`,
+	expectList:  `X-Foo header list elements; lines: \[\]\n.*`,
+}, {
+	about:  "missing header expected",
+	header: http.Header{},
+}}
+
+func TestAssertHeaderLines(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range headerLinesTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			if test.expectLines == "" {
+				qthttptest.AssertHeaderLines(c, test.header, "x-foo", test.lines...)
+				c.Assert(qthttptest.MatchHeaderLines("x-foo", test.lines...)(qthttptest.RecordedRequest{
+					Header: test.header,
+				}), qt.Equals, nil)
+			} else {
+				checkFails(c, test.expectLines, func(c *qt.C) {
+					qthttptest.AssertHeaderLines(c, test.header, "x-foo", test.lines...)
+				})
+				c.Assert(qthttptest.MatchHeaderLines("x-foo", test.lines...)(qthttptest.RecordedRequest{
+					Header: test.header,
+				}), qt.ErrorMatches, `X-Foo header has lines .*, not .*`)
+			}
+		})
+	}
+}
+
+func TestAssertHeaderList(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range headerLinesTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			if test.expectList == "" {
+				qthttptest.AssertHeaderList(c, test.header, "x-foo", test.elems...)
+				return
+			}
+			checkFails(c, test.expectList, func(c *qt.C) {
+				qthttptest.AssertHeaderList(c, test.header, "x-foo", test.elems...)
+			})
+		})
+	}
+}
+
+func TestRespAssertHeaderLines(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: "/",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept")
+			w.Header().Add("Vary", "Accept-Encoding")
+			w.Header().Set("Allow", "GET, HEAD")
+		}),
+	})
+	resp.AssertHeaderLines(c, "Vary", "Accept", "Accept-Encoding").
+		AssertHeaderList(c, "Vary", "Accept", "Accept-Encoding").
+		AssertHeaderLines(c, "Allow", "GET, HEAD").
+		AssertHeaderList(c, "Allow", "GET", "HEAD")
+}
+
+func TestRecordedRequestHeaderLines(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+		URL: "/",
+		Header: http.Header{
+			"X-Foo": {"a", "b"},
+			"X-Bar": {"a, b"},
+		},
+	})).AssertStatus(c, http.StatusOK)
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	qthttptest.AssertHeaderLines(c, reqs[0].Header, "X-Foo", "a", "b")
+	qthttptest.AssertHeaderLines(c, reqs[0].Header, "X-Bar", "a, b")
+	qthttptest.AssertHeaderList(c, reqs[0].Header, "X-Bar", "a", "b")
+}
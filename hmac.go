@@ -0,0 +1,120 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// HMACSignature describes how a request is signed with an HMAC.
+type HMACSignature struct {
+	// Header holds the name of the header holding the signature,
+	// for example "X-Hub-Signature-256".
+	Header string
+
+	// Key holds the shared secret.
+	Key []byte
+
+	// Hash returns the hash used for the HMAC.
+	// If it is nil, sha256.New is used.
+	Hash func() hash.Hash
+
+	// Prefix holds a prefix that precedes the encoded
+	// signature in the header, for example "sha256=".
+	Prefix string
+
+	// Base64 specifies that the signature is encoded
+	// with standard base64 encoding rather than hex.
+	Base64 bool
+
+	// Canonicalize returns the string that is signed for
+	// the given request. If it is nil, the request body
+	// is signed. See also CanonicalRequest.
+	Canonicalize func(req *RecordedRequest) []byte
+}
+
+// Sign returns the header value that signs the given data.
+func (s HMACSignature) Sign(data []byte) string {
+	hashf := s.Hash
+	if hashf == nil {
+		hashf = sha256.New
+	}
+	mac := hmac.New(hashf, s.Key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	if s.Base64 {
+		return s.Prefix + base64.StdEncoding.EncodeToString(sum)
+	}
+	return s.Prefix + hex.EncodeToString(sum)
+}
+
+// SignRequest returns the header value that signs the given request.
+func (s HMACSignature) SignRequest(req *RecordedRequest) string {
+	return s.Sign(s.signedString(req))
+}
+
+// Verify returns an error if the request does not hold a valid signature.
+func (s HMACSignature) Verify(req *RecordedRequest) error {
+	got := req.Header.Get(s.Header)
+	if got == "" {
+		return fmt.Errorf("missing %s header", s.Header)
+	}
+	if !strings.HasPrefix(got, s.Prefix) {
+		return fmt.Errorf("%s header %q does not have prefix %q", s.Header, got, s.Prefix)
+	}
+	if !hmac.Equal([]byte(got), []byte(s.SignRequest(req))) {
+		return fmt.Errorf("%s header %q does not match request", s.Header, got)
+	}
+	return nil
+}
+
+func (s HMACSignature) signedString(req *RecordedRequest) []byte {
+	if s.Canonicalize != nil {
+		return s.Canonicalize(req)
+	}
+	return req.Body
+}
+
+// AssertHMACSignature asserts that the given request, typically
+// captured by a RecordingServer, holds a valid signature as
+// described by s. On failure, the string that was signed is
+// shown alongside the received and computed signatures.
+func AssertHMACSignature(c *qt.C, req RecordedRequest, s HMACSignature) {
+	signed := s.signedString(&req)
+	got, ok := req.Header[http.CanonicalHeaderKey(s.Header)]
+	c.Assert(ok, qt.Equals, true, qt.Commentf("missing %s header", s.Header))
+	c.Assert(got, qt.HasLen, 1, qt.Commentf("multiple %s headers", s.Header))
+	c.Assert(got[0], qt.Equals, s.Sign(signed), qt.Commentf("%s header does not match computed signature; signed string:\n%s", s.Header, signed))
+}
+
+// CanonicalRequest returns a function suitable for use as
+// HMACSignature.Canonicalize that signs the method, the request
+// URI, the given headers and the body of a request, separated by
+// newlines. Each header is formatted as "name:value" with the
+// name in lower case and multiple values separated by commas.
+func CanonicalRequest(headers ...string) func(req *RecordedRequest) []byte {
+	return func(req *RecordedRequest) []byte {
+		var buf bytes.Buffer
+		buf.WriteString(req.Method)
+		buf.WriteByte('\n')
+		buf.WriteString(req.URL.RequestURI())
+		buf.WriteByte('\n')
+		for _, h := range headers {
+			fmt.Fprintf(&buf, "%s:%s\n", strings.ToLower(h), strings.Join(req.Header.Values(h), ","))
+		}
+		buf.WriteByte('\n')
+		buf.Write(req.Body)
+		return buf.Bytes()
+	}
+}
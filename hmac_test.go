@@ -0,0 +1,86 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"crypto/sha1"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestHMACSignature(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.HMACSignature{
+		Header: "X-Hub-Signature-256",
+		Key:    []byte("It's a Secret to Everybody"),
+		Prefix: "sha256=",
+	}
+	// Example from the GitHub webhook documentation.
+	c.Assert(s.Sign([]byte("Hello, World!")), qt.Equals, "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+
+	s = qthttptest.HMACSignature{
+		Header: "X-Signature",
+		Key:    []byte("key"),
+		Hash:   sha1.New,
+		Base64: true,
+	}
+	c.Assert(s.Sign([]byte("The quick brown fox jumps over the lazy dog")), qt.Equals, "3nybhbi3iqa8ino29wqQcBydtNk=")
+}
+
+func TestAssertHMACSignature(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.HMACSignature{
+		Header:       "Authorization",
+		Key:          []byte("secret"),
+		Prefix:       "HMAC ",
+		Canonicalize: qthttptest.CanonicalRequest("Date", "Content-Type"),
+	}
+	srv := qthttptest.NewRecordingServer(c, nil)
+
+	// Sign requests as a client would.
+	do := func(req *http.Request) (*http.Response, error) {
+		r := qthttptest.RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL,
+			Header: req.Header,
+			Body:   []byte(`{"a":1}`),
+		}
+		req.Header.Set("Authorization", s.SignRequest(&r))
+		return http.DefaultClient.Do(req)
+	}
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		Method:   "PUT",
+		URL:      "/things/1?x=y",
+		Header:   http.Header{"Date": {"Mon, 02 Jan 2006 15:04:05 GMT"}},
+		JSONBody: map[string]int{"a": 1},
+		Do:       do,
+	})
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	qthttptest.AssertHMACSignature(c, reqs[0], s)
+	c.Assert(s.Verify(&reqs[0]), qt.Equals, nil)
+
+	c.Assert(string(s.Canonicalize(&reqs[0])), qt.Equals, "PUT\n/things/1?x=y\ndate:Mon, 02 Jan 2006 15:04:05 GMT\ncontent-type:application/json\n\n{\"a\":1}")
+
+	// A tampered request fails with the signed string.
+	req := reqs[0]
+	req.Body = []byte(`{"a":2}`)
+	checkFails(c, `Authorization header does not match computed signature; signed string:\n(.|\n)*\{"a":2\}`, func(c *qt.C) {
+		qthttptest.AssertHMACSignature(c, req, s)
+	})
+	c.Assert(s.Verify(&req), qt.ErrorMatches, `Authorization header "HMAC .*" does not match request`)
+
+	req.Header = http.Header{}
+	checkFails(c, `missing Authorization header`, func(c *qt.C) {
+		qthttptest.AssertHMACSignature(c, req, s)
+	})
+	req.Header = http.Header{"Authorization": {"HMAC a", "HMAC b"}}
+	checkFails(c, `multiple Authorization headers`, func(c *qt.C) {
+		qthttptest.AssertHMACSignature(c, req, s)
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+)
+
+// HTTP10Transport is an http.RoundTripper that makes each request
+// as an HTTP/1.0 request on a new connection, which is closed once
+// the response has been read. Unlike http.Transport it adds no
+// headers other than Host and Content-Length, so it can be used to
+// check how a handler treats ancient clients, for example that it
+// sends a Content-Length rather than a chunked body, or that it
+// closes the connection unless asked to keep it alive.
+//
+// The request body is sent with a Content-Length header holding
+// its length; if req.ContentLength is negative, the body is sent
+// without one, as an HTTP/1.0 client that expects the server
+// to read until the end of the connection would. Each new connection
+// is reported to the GotConn hook of any httptrace.ClientTrace in the
+// request context. Only http URLs are supported. The zero value is
+// ready to use.
+type HTTP10Transport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (HTTP10Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	if req.URL.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported scheme %q for HTTP/1.0 request", req.URL.Scheme)
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	var reqBody []byte
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read request body: %v", err)
+		}
+		reqBody = data
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.0\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	// A ContentLength of zero with a body means that the length
+	// is unknown, but the body has been read, so its length is
+	// known now.
+	if req.ContentLength > 0 || req.ContentLength == 0 && req.Body != nil && req.Body != http.NoBody {
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(reqBody)) + "\r\n")
+	}
+	if err := req.Header.Write(&buf); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	buf.Write(reqBody)
+
+	conn, err := (&net.Dialer{}).DialContext(req.Context(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+	if deadline, ok := req.Context().Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func protoHandler(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Proto", req.Proto)
+	w.Header().Set("X-Content-Length", req.Header.Get("Content-Length"))
+	w.Header().Set("X-Body", string(body))
+	w.Write([]byte(`{}`))
+	if f, ok := w.(http.Flusher); ok && req.URL.Query().Get("flush") != "" {
+		f.Flush()
+		w.Write([]byte(" "))
+	}
+}
+
+var http10Tests = []struct {
+	about  string
+	params qthttptest.JSONCallParams
+	// body, if non-empty, is sent as the request body.
+	body string
+}{{
+	about: "simple request",
+	params: qthttptest.JSONCallParams{
+		URL:                   "/",
+		ExpectBody:            map[string]interface{}{},
+		ExpectConnectionClose: true,
+		ExpectProto:           "HTTP/1.0",
+		ExpectHeader: http.Header{
+			"X-Proto":          {"HTTP/1.0"},
+			"X-Content-Length": {""},
+			"Content-Length":   {"2"},
+		},
+	},
+}, {
+	about: "request with body",
+	params: qthttptest.JSONCallParams{
+		Method:                "POST",
+		URL:                   "/",
+		ExpectBody:            map[string]interface{}{},
+		ExpectConnectionClose: true,
+		ExpectHeader: http.Header{
+			"X-Content-Length": {"5"},
+			"X-Body":           {"hello"},
+		},
+	},
+	body: "hello",
+}, {
+	about: "body of unknown length is not seen by the server",
+	params: qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/",
+		Chunked:    true,
+		ExpectBody: map[string]interface{}{},
+		ExpectHeader: http.Header{
+			"X-Content-Length": {""},
+			"X-Body":           {""},
+		},
+	},
+	body: "hello",
+}, {
+	about: "keep-alive requested",
+	params: qthttptest.JSONCallParams{
+		URL:        "/",
+		Header:     http.Header{"Connection": {"keep-alive"}},
+		ExpectBody: map[string]interface{}{},
+		ExpectHeader: http.Header{
+			"Connection": {"keep-alive"},
+		},
+	},
+}}
+
+func TestHTTP10(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range http10Tests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			test.params.Handler = http.HandlerFunc(protoHandler)
+			test.params.HTTP10 = true
+			if test.body != "" {
+				test.params.Body = strings.NewReader(test.body)
+			}
+			qthttptest.AssertJSONCall(c, test.params)
+		})
+	}
+}
+
+func TestHTTP10BodyOfUnknownLength(t *testing.T) {
+	c := qt.New(t)
+	// The length of a body that is not a bytes or strings
+	// reader is not known before it is read.
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/",
+		Handler:    http.HandlerFunc(protoHandler),
+		HTTP10:     true,
+		Body:       ioutil.NopCloser(strings.NewReader("hello")),
+		ExpectBody: map[string]interface{}{},
+		ExpectHeader: http.Header{
+			"X-Content-Length": {"5"},
+			"X-Body":           {"hello"},
+		},
+	})
+}
+
+func TestHTTP10NewConnection(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(protoHandler))
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:                 "/",
+		HTTP10:              true,
+		ExpectBody:          map[string]interface{}{},
+		ExpectNewConnection: true,
+	})
+	checkFails(c, `connection was not reused`, func(c *qt.C) {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:                    "/",
+			Header:                 http.Header{"Connection": {"keep-alive"}},
+			HTTP10:                 true,
+			ExpectBody:             map[string]interface{}{},
+			ExpectConnectionReused: true,
+		})
+	})
+}
+
+func TestHTTP10StreamedResponse(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL:     "/?flush=1",
+		Handler: http.HandlerFunc(protoHandler),
+		HTTP10:  true,
+	})
+	resp.AssertStatus(c, http.StatusOK)
+	// HTTP/1.0 has no chunked encoding, so the
+	// body is terminated by closing the connection.
+	c.Assert(resp.Response.ContentLength, qt.Equals, int64(-1))
+	c.Assert(resp.Response.TransferEncoding, qt.IsNil)
+	c.Assert(resp.Response.Close, qt.Equals, true)
+	c.Assert(string(resp.Body), qt.Equals, "{} ")
+}
+
+func TestHTTP10TransportUnsupportedScheme(t *testing.T) {
+	c := qt.New(t)
+	client := &http.Client{Transport: qthttptest.HTTP10Transport{}}
+	qthttptest.Do(c, qthttptest.DoRequestParams{
+		Do:          client.Do,
+		URL:         "https://example.com/",
+		ExpectError: `Get "https://example.com/": unsupported scheme "https" for HTTP/1.0 request`,
+	})
+}
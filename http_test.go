@@ -5,14 +5,20 @@ package qthttptest_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 
@@ -53,6 +59,86 @@ func makeHandler(c *qt.C, status int, ctype string) http.Handler {
 	})
 }
 
+// failingTB is a testing.TB that records failures instead of
+// reporting them.
+type failingTB struct {
+	testing.TB
+	mu     sync.Mutex
+	failed bool
+	msgs   []string
+}
+
+func (t *failingTB) Error(args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+	t.msgs = append(t.msgs, fmt.Sprint(args...))
+}
+
+func (t *failingTB) Errorf(format string, args ...interface{}) {
+	t.Error(fmt.Sprintf(format, args...))
+}
+
+func (t *failingTB) Fatal(args ...interface{}) {
+	t.Error(args...)
+	runtime.Goexit()
+}
+
+func (t *failingTB) Fatalf(format string, args ...interface{}) {
+	t.Fatal(fmt.Sprintf(format, args...))
+}
+
+func (t *failingTB) Fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+}
+
+func (t *failingTB) FailNow() {
+	t.Fail()
+	runtime.Goexit()
+}
+
+func (t *failingTB) Failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+func (t *failingTB) Run(name string, f func(testing.TB)) bool {
+	t1 := &failingTB{TB: t.TB}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(t1)
+	}()
+	<-done
+	if t1.Failed() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.failed = true
+		t.msgs = append(t.msgs, t1.msgs...)
+		return false
+	}
+	return true
+}
+
+// checkFails runs f and checks that it fails with
+// an error message matching the given regular expression.
+func checkFails(c *qt.C, expectMsg string, f func(c *qt.C)) {
+	tb := &failingTB{TB: c.TB}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c1 := qt.New(tb)
+		defer c1.Done()
+		f(c1)
+	}()
+	<-done
+	c.Assert(tb.Failed(), qt.Equals, true, qt.Commentf("test did not fail"))
+	c.Assert(strings.Join(tb.msgs, "\n"), qt.Matches, "(?s).*"+expectMsg+".*")
+}
+
 var assertJSONCallTests = []struct {
 	about  string
 	params qthttptest.JSONCallParams
@@ -274,6 +360,32 @@ func TestAssertJSONCallWithBodyAsserter(t *testing.T) {
 	c.Assert(called, qt.Equals, true)
 }
 
+func TestAssertJSONCallWithResponseAsserter(t *testing.T) {
+	c := qt.New(t)
+	called := false
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Header().Set("X-Custom", "value")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"ok":true}`))
+			w.Header().Set("X-Checksum", "1234")
+		}),
+		ExpectStatus: http.StatusAccepted,
+		ExpectBody: qthttptest.ResponseAsserter(func(c1 *qt.C, resp *http.Response, body json.RawMessage) {
+			c.Assert(c1, qt.Equals, c)
+			c.Assert(resp.StatusCode, qt.Equals, http.StatusAccepted)
+			c.Assert(resp.Header.Get("X-Custom"), qt.Equals, "value")
+			c.Assert(resp.Trailer.Get("X-Checksum"), qt.Equals, "1234")
+			c.Assert(string(body), qt.Equals, `{"ok":true}`)
+			called = true
+		}),
+	})
+	c.Assert(called, qt.Equals, true)
+}
+
 func TestAssertJSONCallWithHostedURL(t *testing.T) {
 	c := qt.New(t)
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -287,6 +399,125 @@ func TestAssertJSONCallWithHostedURL(t *testing.T) {
 	})
 }
 
+func TestAssertJSONCallWithExpectContentType(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:               "/",
+		Handler:           makeHandler(c, http.StatusOK, "application/vnd.api+json; charset=utf-8"),
+		ExpectContentType: "application/*+json; charset=utf-8",
+		ExpectBody: handlerResponse{
+			URL:    "/",
+			Method: "GET",
+			Header: make(http.Header),
+		},
+	})
+}
+
+func TestAssertJSONCallIgnoresContentTypeParameters(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:     "/",
+		Handler: makeHandler(c, http.StatusOK, "application/json; charset=utf-8"),
+		ExpectBody: handlerResponse{
+			URL:    "/",
+			Method: "GET",
+			Header: make(http.Header),
+		},
+	})
+}
+
+func TestAssertJSONCallWithExpectMaxDuration(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:               "/",
+		Handler:           makeHandler(c, http.StatusOK, "application/json"),
+		ExpectMaxDuration: time.Minute,
+		ExpectBody: handlerResponse{
+			URL:    "/",
+			Method: "GET",
+			Header: make(http.Header),
+		},
+	})
+	checkFails(c, `call took .*, longer than 10ms`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL: "/",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+			}),
+			ExpectMaxDuration: 10 * time.Millisecond,
+		})
+	})
+}
+
+var baseURLTests = []struct {
+	about     string
+	basePath  string
+	url       string
+	expectURI string
+}{{
+	about:     "no slashes",
+	basePath:  "/api",
+	url:       "items",
+	expectURI: "/api/items",
+}, {
+	about:     "both slashes",
+	basePath:  "/api/",
+	url:       "/items",
+	expectURI: "/api/items",
+}, {
+	about:     "empty base path",
+	url:       "/items",
+	expectURI: "/items",
+}, {
+	about:     "empty URL",
+	basePath:  "/api/",
+	expectURI: "/api/",
+}, {
+	about:     "query in URL",
+	basePath:  "/api",
+	url:       "/items?a=1",
+	expectURI: "/api/items?a=1",
+}, {
+	about:     "query in both",
+	basePath:  "/api?key=k",
+	url:       "/items?a=1&b=2",
+	expectURI: "/api/items?key=k&a=1&b=2",
+}, {
+	about:     "escaped path preserved",
+	basePath:  "/api/",
+	url:       "/a%2Fb",
+	expectURI: "/api/a%2Fb",
+}}
+
+func TestBaseURL(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.RequestURI))
+	}))
+	defer srv.Close()
+	for _, test := range baseURLTests {
+		c.Run(test.about, func(c *qt.C) {
+			rec := qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+				BaseURL: srv.URL + test.basePath,
+				URL:     test.url,
+			})
+			c.Assert(rec.Body.String(), qt.Equals, test.expectURI)
+		})
+	}
+}
+
+func TestBaseURLIgnoredWithHandler(t *testing.T) {
+	c := qt.New(t)
+	rec := qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		BaseURL: "http://0.1.2.3/api",
+		URL:     "/items",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(req.RequestURI))
+		}),
+	})
+	c.Assert(rec.Body.String(), qt.Equals, "/items")
+}
+
 var bodyReaderFuncs = []func(string) io.Reader{
 	func(s string) io.Reader {
 		return strings.NewReader(s)
@@ -316,6 +547,564 @@ func TestDoRequestWithInferrableContentLength(t *testing.T) {
 	}
 }
 
+func TestDoRequestChunked(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"contentLength":    req.ContentLength,
+			"transferEncoding": req.TransferEncoding,
+			"body":             string(data),
+		})
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:       handler,
+		Method:        "PUT",
+		URL:           "/",
+		Body:          strings.NewReader("hello"),
+		ContentLength: 5,
+		Chunked:       true,
+		ExpectBody: map[string]interface{}{
+			"contentLength":    -1,
+			"transferEncoding": []string{"chunked"},
+			"body":             "hello",
+		},
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:  handler,
+		Method:   "PUT",
+		URL:      "/",
+		JSONBody: "hello",
+		ExpectBody: map[string]interface{}{
+			"contentLength":    7,
+			"transferEncoding": nil,
+			"body":             `"hello"`,
+		},
+	})
+}
+
+func TestAssertJSONCallWithConnectionReuse(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/close" {
+			w.Header().Set("Connection", "close")
+		}
+	}))
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:                 "/",
+		ExpectNewConnection: true,
+	})
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:                    "/close",
+		ExpectConnectionReused: true,
+	})
+	checkFails(c, `connection was not reused`, func(c *qt.C) {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:                    "/",
+			ExpectConnectionReused: true,
+		})
+	})
+	checkFails(c, `connection was reused`, func(c *qt.C) {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:                 "/",
+			ExpectNewConnection: true,
+		})
+	})
+}
+
+func TestAssertJSONCallWithExpectConnectionClose(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/close" {
+			w.Header().Set("Connection", "close")
+		}
+	}))
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:                   "/close",
+		ExpectConnectionClose: true,
+	})
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:                 "/",
+		ExpectNewConnection: true,
+	})
+	checkFails(c, `server did not close connection; Connection header \[\]`, func(c *qt.C) {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:                   "/",
+			ExpectConnectionClose: true,
+		})
+	})
+}
+
+func TestAssertJSONCallWithExpectTransferEncoding(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/stream" {
+			w.Write([]byte("["))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("1]"))
+			return
+		}
+		w.Write([]byte("[1]"))
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:       handler,
+		URL:           "/stream",
+		ExpectBody:    []int{1},
+		ExpectChunked: true,
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:                handler,
+		URL:                    "/stream",
+		ExpectBody:             []int{1},
+		ExpectTransferEncoding: []string{"chunked"},
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:                handler,
+		URL:                    "/",
+		ExpectBody:             []int{1},
+		ExpectTransferEncoding: []string{},
+	})
+	checkFails(c, `response was not chunked; transfer codings \[\]; Content-Length 3`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:       handler,
+			URL:           "/",
+			ExpectBody:    []int{1},
+			ExpectChunked: true,
+		})
+	})
+	checkFails(c, `transfer codings; Content-Length -1`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:                handler,
+			URL:                    "/stream",
+			ExpectBody:             []int{1},
+			ExpectTransferEncoding: []string{},
+		})
+	})
+}
+
+func TestAssertJSONCallWithExpectProto(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + req.Proto + `"`))
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:         srv.URL,
+		Do:          srv.Client().Do,
+		ExpectProto: "HTTP/2.0",
+		ExpectBody:  "HTTP/2.0",
+	})
+
+	// Without HTTP/2 enabled on the server, ALPN
+	// negotiation falls back to HTTP/1.1.
+	srv1 := httptest.NewTLSServer(handler)
+	defer srv1.Close()
+	checkFails(c, `response protocol`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:         srv1.URL,
+			Do:          srv1.Client().Do,
+			ExpectProto: "HTTP/2.0",
+			ExpectBody:  "HTTP/1.1",
+		})
+	})
+}
+
+func TestBodyFile(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	dir := c.Mkdir()
+	jsonFile := filepath.Join(dir, "req.json")
+	err := ioutil.WriteFile(jsonFile, []byte(`{"name": "x"}`), 0644)
+	c.Assert(err, qt.Equals, nil)
+	textFile := filepath.Join(dir, "req.txt")
+	err = ioutil.WriteFile(textFile, []byte("hello"), 0644)
+	c.Assert(err, qt.Equals, nil)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"contentType":   req.Header.Get("Content-Type"),
+			"contentLength": req.ContentLength,
+			"body":          string(data),
+		})
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:      echo,
+		Method:       "POST",
+		URL:          "/",
+		JSONBodyFile: jsonFile,
+		ExpectBody: map[string]interface{}{
+			"contentType":   "application/json",
+			"contentLength": 13,
+			"body":          `{"name": "x"}`,
+		},
+	})
+	// The file is read for each request, so the
+	// body can be sent again by a custom Do function.
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:  echo,
+		Method:   "POST",
+		URL:      "/",
+		BodyFile: textFile,
+		Do: func(req *http.Request) (*http.Response, error) {
+			_, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, qt.Equals, nil)
+			_, err = req.Body.(io.Seeker).Seek(0, io.SeekStart)
+			c.Assert(err, qt.Equals, nil)
+			return http.DefaultClient.Do(req)
+		},
+		ExpectBody: map[string]interface{}{
+			"contentType":   "",
+			"contentLength": 5,
+			"body":          "hello",
+		},
+	})
+
+	err = ioutil.WriteFile(jsonFile, []byte(`{"name": `), 0644)
+	c.Assert(err, qt.Equals, nil)
+	checkFails(c, `invalid JSON in ".*req.json"`, func(c *qt.C) {
+		qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+			Handler:      echo,
+			JSONBodyFile: jsonFile,
+		})
+	})
+	checkFails(c, `open .*missing.txt: no such file or directory`, func(c *qt.C) {
+		qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+			Handler:  echo,
+			BodyFile: filepath.Join(dir, "missing.txt"),
+		})
+	})
+}
+
+func TestAssertJSONCallWithHEAD(t *testing.T) {
+	c := qt.New(t)
+	handler := func(writeHEADBody bool) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "13")
+			if req.Method != "HEAD" || writeHEADBody {
+				w.Write([]byte(`{"name":"x"}` + "\n"))
+			}
+		})
+	}
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:             handler(false),
+		Method:              "HEAD",
+		URL:                 "/",
+		ExpectBody:          map[string]string{"name": "x"},
+		ExpectContentLength: 13,
+	})
+	checkFails(c, `handler wrote body in response to HEAD`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler: handler(true),
+			Method:  "HEAD",
+			URL:     "/",
+		})
+	})
+	checkFails(c, `Content-Length`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:             handler(false),
+			Method:              "HEAD",
+			URL:                 "/",
+			ExpectContentLength: 12,
+		})
+	})
+}
+
+func TestAssertJSONCallWithOPTIONS(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.Header().Add("Allow", "OPTIONS")
+		if req.Method != "OPTIONS" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("not allowed"))
+		}
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:     handler,
+		Method:      "OPTIONS",
+		URL:         "/",
+		ExpectAllow: []string{"OPTIONS", "GET", "HEAD"},
+	})
+	checkFails(c, `Allow header \["GET, HEAD" "OPTIONS"\]`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:     handler,
+			Method:      "OPTIONS",
+			URL:         "/",
+			ExpectAllow: []string{"GET", "POST"},
+		})
+	})
+	checkFails(c, `got:\n  \[\]uint8\("x"\)`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte("x"))
+			}),
+			Method: "OPTIONS",
+			URL:    "/",
+		})
+	})
+}
+
+func TestAssertJSONCallWithExpectNoBody(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		URL:          "/",
+		ExpectStatus: http.StatusNoContent,
+		ExpectNoBody: true,
+	})
+
+	// A server that sends a body with a 204 response.
+	do := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusNoContent,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("oops")),
+		}, nil
+	}
+	checkFails(c, `unexpected body: "oops"`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:          "http://0.1.2.3/",
+			Do:           do,
+			ExpectStatus: http.StatusNoContent,
+			ExpectNoBody: true,
+		})
+	})
+
+	// An empty gzipped body has empty content but is not empty.
+	gzipped := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gzip.NewWriter(w).Close()
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler: gzipped,
+		URL:     "/",
+		Header:  http.Header{"Accept-Encoding": {"gzip"}},
+	})
+	checkFails(c, `unexpected body: "\\x1f\\x8b`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:      gzipped,
+			URL:          "/",
+			Header:       http.Header{"Accept-Encoding": {"gzip"}},
+			ExpectNoBody: true,
+		})
+	})
+	checkFails(c, `ExpectBody specified with ExpectNoBody`, func(c *qt.C) {
+		qthttptest.NewCall("GET", "/").ExpectJSON("x").ExpectNoBody().Assert(c, gzipped)
+	})
+}
+
+func TestAssertJSONCallIndentsMismatchedBodies(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1,"tags":["a","b"],"owner":{"name":"bob"}}`))
+	})
+	checkFails(c, `got body:
+  {
+    "id": 1,
+    "owner": {
+      "name": "bob"
+    },
+    "tags": \[
+      "a",
+      "b"
+    \]
+  }
+want body:
+  {
+    "id": 1,
+    "owner": {
+      "name": "alice"
+    }
+  }
+`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler: handler,
+			URL:     "/",
+			ExpectBody: map[string]interface{}{
+				"id":    1,
+				"owner": map[string]string{"name": "alice"},
+			},
+		})
+	})
+	checkFails(c, `comment:
+  body: {
+    "id": 1,
+    "owner": {
+`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:      handler,
+			URL:          "/",
+			ExpectStatus: http.StatusNotFound,
+		})
+	})
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	c := qt.New(t)
+	// The handler waits for work that never completes
+	// unless the request context is done.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+			http.Error(w, req.Context().Err().Error(), http.StatusGatewayTimeout)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	start := time.Now()
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler:        handler,
+		URL:            "/",
+		HandlerTimeout: 20 * time.Millisecond,
+	})
+	resp.AssertStatus(c, http.StatusGatewayTimeout)
+	c.Assert(string(resp.Body), qt.Equals, "context deadline exceeded\n")
+	c.Assert(time.Since(start) < 5*time.Second, qt.Equals, true)
+
+	// An expired deadline makes http.TimeoutHandler give up
+	// immediately even though its own timeout is much longer.
+	resp = qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler:        http.TimeoutHandler(handler, time.Minute, "timed out"),
+		URL:            "/",
+		HandlerTimeout: -1,
+	})
+	resp.AssertStatus(c, http.StatusServiceUnavailable)
+	c.Assert(string(resp.Body), qt.Equals, "timed out")
+}
+
+func TestAssertJSONCallWithHooks(t *testing.T) {
+	c := qt.New(t)
+	var calls []string
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls = append(calls, "handler")
+			w.Header().Set("X-Echo", req.Header.Get("X-Trace"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`"ok"`))
+		}),
+		URL: "/",
+		BeforeRequest: func(c *qt.C, req *http.Request) {
+			calls = append(calls, "before")
+			req.Header.Set("X-Trace", "abc")
+		},
+		AfterResponse: func(c *qt.C, resp *http.Response) {
+			calls = append(calls, "after "+resp.Header.Get("X-Echo"))
+		},
+		ExpectBody:   "ok",
+		ExpectHeader: http.Header{"X-Echo": {"abc"}},
+	})
+	c.Assert(calls, qt.DeepEquals, []string{"before", "handler", "after abc"})
+
+	// AfterResponse is not called when an error is expected.
+	calls = nil
+	qthttptest.Do(c, qthttptest.DoRequestParams{
+		URL: "http://0.1.2.3:0/",
+		Do: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("no connection")
+		},
+		BeforeRequest: func(c *qt.C, req *http.Request) {
+			calls = append(calls, "before")
+		},
+		AfterResponse: func(c *qt.C, resp *http.Response) {
+			calls = append(calls, "after")
+		},
+		ExpectError: "no connection",
+	})
+	c.Assert(calls, qt.DeepEquals, []string{"before"})
+}
+
+// headerMiddleware returns middleware that adds a value to the
+// X-Chain request header and records the calls in calls.
+func headerMiddleware(name string, calls *[]string) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*calls = append(*calls, name)
+			req = req.Clone(req.Context())
+			req.Header.Add("X-Chain", name)
+			return rt.RoundTrip(req)
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDoRequestWithRequestMiddleware(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, "/", http.StatusFound)
+			return
+		}
+		w.Write([]byte(strings.Join(req.Header.Values("X-Chain"), ",")))
+	})
+	var calls []string
+	rec := &qthttptest.RecordingTransport{}
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler: handler,
+		URL:     "/redirect",
+		RequestMiddleware: []func(http.RoundTripper) http.RoundTripper{
+			headerMiddleware("a", &calls),
+			func(rt http.RoundTripper) http.RoundTripper {
+				rec.Transport = rt
+				return rec
+			},
+			headerMiddleware("b", &calls),
+		},
+	})
+	c.Assert(string(resp.Body), qt.Equals, "a,b")
+	// The redirect passes through the middleware too.
+	c.Assert(calls, qt.DeepEquals, []string{"a", "b", "a", "b"})
+	reqs := rec.Requests()
+	c.Assert(reqs, qt.HasLen, 2)
+	c.Assert(reqs[0].URL.Path, qt.Equals, "/redirect")
+	c.Assert(reqs[0].Header.Values("X-Chain"), qt.DeepEquals, []string{"a"})
+
+	// With a Do function, the middleware wraps it.
+	calls = nil
+	resp = qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Handler: handler,
+		URL:     "/",
+		Do: func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, "do")
+			return http.DefaultClient.Do(req)
+		},
+		RequestMiddleware: []func(http.RoundTripper) http.RoundTripper{
+			headerMiddleware("a", &calls),
+		},
+	})
+	c.Assert(string(resp.Body), qt.Equals, "a")
+	c.Assert(calls, qt.DeepEquals, []string{"a", "do"})
+
+	// Middleware can inject faults.
+	qthttptest.Do(c, qthttptest.DoRequestParams{
+		Handler: handler,
+		URL:     "/",
+		RequestMiddleware: []func(http.RoundTripper) http.RoundTripper{
+			func(http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(*http.Request) (*http.Response, error) {
+					return nil, errors.New("injected fault")
+				})
+			},
+		},
+		ExpectError: `Get "http://.*/": injected fault`,
+	})
+}
+
 // The TestAssertJSONCall above exercises the testing.AssertJSONCall succeeding
 // calls. Failures are already massively tested in practice. DoRequest and
 // AssertJSONResponse are also indirectly tested as they are called by
@@ -0,0 +1,99 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// IdempotentCallParams holds parameters for AssertIdempotentCall.
+type IdempotentCallParams struct {
+	// DoRequestParams holds the request that is made twice.
+	// Method defaults to POST. The ExpectError field is ignored.
+	DoRequestParams
+
+	// Key holds the value of the Idempotency-Key header.
+	// If it is empty, a random key is generated.
+	Key string
+
+	// KeyHeader holds the name of the header holding the key.
+	// If it is empty, "Idempotency-Key" is used.
+	KeyHeader string
+
+	// ExpectStatus holds the expected status of both responses.
+	// If it is zero, the status is not checked other than
+	// to ensure that both are the same.
+	ExpectStatus int
+
+	// CompareHeaders holds the names of response headers that
+	// must be identical in both responses, for example "Location".
+	CompareHeaders []string
+
+	// SideEffects, if non-nil, is called before the first request
+	// and after the second to count the side effects performed by
+	// the handler, for example the number of rows inserted. The
+	// count must have increased by exactly one.
+	SideEffects func() int
+}
+
+// AssertIdempotentCall makes the same request twice with the same
+// idempotency key and asserts that the second response replays the
+// first: the status, body and selected headers must be identical,
+// and the side effect must have been performed only once. It
+// returns the first response.
+func AssertIdempotentCall(c *qt.C, p IdempotentCallParams) *Resp {
+	if p.Method == "" {
+		p.Method = "POST"
+	}
+	if p.KeyHeader == "" {
+		p.KeyHeader = "Idempotency-Key"
+	}
+	if p.Key == "" {
+		var key [16]byte
+		_, err := rand.Read(key[:])
+		c.Assert(err, qt.Equals, nil)
+		p.Key = hex.EncodeToString(key[:])
+	}
+	p.ExpectError = ""
+	p.Header = cloneHeader(p.Header)
+	p.Header.Set(p.KeyHeader, p.Key)
+	var body []byte
+	if p.Body != nil {
+		data, err := ioutil.ReadAll(p.Body)
+		c.Assert(err, qt.Equals, nil)
+		body = data
+	}
+	before := 0
+	if p.SideEffects != nil {
+		before = p.SideEffects()
+	}
+	do := func() *Resp {
+		p := p.DoRequestParams
+		if body != nil {
+			p.Body = bytes.NewReader(body)
+		}
+		return DoResponse(c, p)
+	}
+	first := do()
+	second := do()
+	if p.ExpectStatus != 0 {
+		first.AssertStatus(c, p.ExpectStatus)
+	}
+	c.Assert(second.Response.StatusCode, qt.Equals, first.Response.StatusCode, qt.Commentf("status of replayed response"))
+	c.Assert(string(second.Body), qt.Equals, string(first.Body), qt.Commentf("body of replayed response"))
+	for _, key := range p.CompareHeaders {
+		key = http.CanonicalHeaderKey(key)
+		c.Assert(second.Response.Header[key], qt.DeepEquals, first.Response.Header[key], qt.Commentf("header %q of replayed response", key))
+	}
+	if p.SideEffects != nil {
+		c.Assert(p.SideEffects()-before, qt.Equals, 1, qt.Commentf("number of side effects performed"))
+	}
+	return first
+}
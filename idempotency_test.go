@@ -0,0 +1,105 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// ordersHandler creates an order for each POST. If idempotent is
+// true, requests with a previously seen Idempotency-Key are
+// replayed rather than creating another order.
+type ordersHandler struct {
+	idempotent bool
+
+	mu      sync.Mutex
+	orders  []string
+	replies map[string]string
+}
+
+func (h *ordersHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := req.Header.Get("Idempotency-Key")
+	if reply, ok := h.replies[key]; ok && h.idempotent {
+		w.Header().Set("Location", reply)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%q", reply)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	h.orders = append(h.orders, string(body))
+	reply := fmt.Sprintf("/orders/%d", len(h.orders))
+	if h.replies == nil {
+		h.replies = make(map[string]string)
+	}
+	h.replies[key] = reply
+	w.Header().Set("Location", reply)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%q", reply)
+}
+
+func (h *ordersHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.orders)
+}
+
+func TestAssertIdempotentCall(t *testing.T) {
+	c := qt.New(t)
+	h := &ordersHandler{idempotent: true}
+	resp := qthttptest.AssertIdempotentCall(c, qthttptest.IdempotentCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: h,
+			URL:     "/orders",
+			Body:    strings.NewReader("order1"),
+		},
+		ExpectStatus:   http.StatusCreated,
+		CompareHeaders: []string{"location"},
+		SideEffects:    h.count,
+	})
+	c.Assert(string(resp.Body), qt.Equals, `"/orders/1"`)
+	c.Assert(h.orders, qt.DeepEquals, []string{"order1"})
+	c.Assert(h.replies, qt.HasLen, 1)
+
+	h = &ordersHandler{}
+	checkFails(c, `body of replayed response`, func(c *qt.C) {
+		qthttptest.AssertIdempotentCall(c, qthttptest.IdempotentCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler:  h,
+				URL:      "/orders",
+				JSONBody: "order1",
+			},
+			Key: "k1",
+		})
+	})
+	c.Assert(h.orders, qt.DeepEquals, []string{`"order1"`, `"order1"`})
+}
+
+func TestAssertIdempotentCallSideEffects(t *testing.T) {
+	c := qt.New(t)
+	h := &ordersHandler{idempotent: true}
+	n := 0
+	checkFails(c, `number of side effects performed`, func(c *qt.C) {
+		qthttptest.AssertIdempotentCall(c, qthttptest.IdempotentCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: h,
+				URL:     "/orders",
+			},
+			SideEffects: func() int {
+				n += 2
+				return n
+			},
+		})
+	})
+}
@@ -0,0 +1,299 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// interleaveHeader holds the request header used to
+// identify the calls started by Interleaving.Start.
+const interleaveHeader = "Qthttptest-Interleaved-Call"
+
+// interleaveTimeout holds how long Interleaving waits
+// for a call to reach a rendezvous point or to finish.
+const interleaveTimeout = 5 * time.Second
+
+// Interleaving runs concurrent calls against a handler and lets the
+// test control the order in which they proceed, so that the behavior
+// of handlers under concurrency, such as their locking or idempotency,
+// can be tested deterministically.
+//
+// The handler marks the places where a call may be held back by
+// calling Rendezvous with the request context. Each time a call
+// started with Start reaches a rendezvous point, it stops until the
+// test has called WaitFor to wait for it to arrive there and Release
+// to let it continue. For example, to check that two concurrent
+// updates are serialized:
+//
+//	il := qthttptest.NewInterleaving(c, handler)
+//	il.Start(c, "a", qthttptest.JSONCallParams{Method: "PUT", URL: "/item", JSONBody: 1})
+//	il.WaitFor(c, "a", "locked")
+//	il.Start(c, "b", qthttptest.JSONCallParams{Method: "PUT", URL: "/item", JSONBody: 2})
+//	il.Release(c, "a")
+//	il.Wait(c, "a")
+//	il.WaitFor(c, "b", "locked")
+//	il.Release(c, "b")
+//	il.Wait(c, "b")
+type Interleaving struct {
+	srv *Server
+
+	mu    sync.Mutex
+	calls map[string]*interleavedCall
+}
+
+// interleavedCall holds the state of a call started by Interleaving.Start.
+type interleavedCall struct {
+	// arrived receives the name of each rendezvous
+	// point reached by the call.
+	arrived chan string
+
+	// release is used to let the call continue
+	// from a rendezvous point.
+	release chan struct{}
+
+	// free is closed when the call may run
+	// through any remaining rendezvous points.
+	free     chan struct{}
+	freeOnce sync.Once
+
+	// done is closed when the call has finished.
+	done chan struct{}
+
+	// parked holds the rendezvous point at which the call
+	// is known to be waiting. It is only accessed by the
+	// test goroutine.
+	parked string
+
+	tb *callTB
+}
+
+// NewInterleaving returns an Interleaving that makes calls against
+// a server running the given handler. The server is shut down
+// when the test completes, once any calls that are still running
+// have been allowed to finish.
+func NewInterleaving(c *qt.C, handler http.Handler) *Interleaving {
+	il := &Interleaving{
+		calls: make(map[string]*interleavedCall),
+	}
+	il.srv = NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if name := req.Header.Get(interleaveHeader); name != "" {
+			il.mu.Lock()
+			call := il.calls[name]
+			il.mu.Unlock()
+			if call != nil {
+				req = req.WithContext(context.WithValue(req.Context(), interleaveKey{}, call))
+			}
+			req.Header = cloneHeader(req.Header)
+			req.Header.Del(interleaveHeader)
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	c.Cleanup(func() {
+		il.mu.Lock()
+		calls := make([]*interleavedCall, 0, len(il.calls))
+		for _, call := range il.calls {
+			calls = append(calls, call)
+		}
+		il.mu.Unlock()
+		for _, call := range calls {
+			call.setFree()
+			select {
+			case <-call.done:
+			case <-time.After(interleaveTimeout):
+			}
+		}
+	})
+	return il
+}
+
+// Start starts the call described by p, which is made against the
+// server in the same way as Server.AssertJSONCall. The name identifies
+// the call in the other methods and must be unique.
+func (il *Interleaving) Start(c *qt.C, name string, p JSONCallParams) {
+	il.mu.Lock()
+	_, ok := il.calls[name]
+	il.mu.Unlock()
+	c.Assert(ok, qt.Equals, false, qt.Commentf("call %q already started", name))
+	call := &interleavedCall{
+		arrived: make(chan string),
+		release: make(chan struct{}),
+		free:    make(chan struct{}),
+		done:    make(chan struct{}),
+		tb:      &callTB{TB: c.TB},
+	}
+	il.mu.Lock()
+	il.calls[name] = call
+	il.mu.Unlock()
+	p.Header = cloneHeader(p.Header)
+	p.Header.Set(interleaveHeader, name)
+	go func() {
+		defer close(call.done)
+		il.srv.AssertJSONCall(qt.New(call.tb), p)
+	}()
+}
+
+// WaitFor waits for the named call to reach the given rendezvous
+// point. The call stays there until Release is called.
+func (il *Interleaving) WaitFor(c *qt.C, name, point string) {
+	call := il.call(c, name)
+	c.Assert(call.parked, qt.Equals, "", qt.Commentf("call %q is already waiting at %q", name, call.parked))
+	select {
+	case got := <-call.arrived:
+		call.parked = got
+		c.Assert(got, qt.Equals, point, qt.Commentf("rendezvous point reached by call %q", name))
+	case <-call.done:
+		c.Fatalf("call %q finished without reaching %q%s", name, point, call.tb.failures())
+	case <-time.After(interleaveTimeout):
+		c.Fatalf("call %q did not reach %q within %v", name, point, interleaveTimeout)
+	}
+}
+
+// Release lets the named call continue from the
+// rendezvous point at which it is waiting.
+func (il *Interleaving) Release(c *qt.C, name string) {
+	call := il.call(c, name)
+	c.Assert(call.parked, qt.Not(qt.Equals), "", qt.Commentf("call %q is not waiting at a rendezvous point", name))
+	call.parked = ""
+	select {
+	case call.release <- struct{}{}:
+	case <-call.done:
+		// The request was abandoned while it was waiting.
+	}
+}
+
+// Wait lets the named call run through any remaining rendezvous
+// points, waits for it to finish and fails if any of its assertions
+// failed.
+func (il *Interleaving) Wait(c *qt.C, name string) {
+	call := il.call(c, name)
+	if call.parked != "" {
+		il.Release(c, name)
+	}
+	call.setFree()
+	select {
+	case <-call.done:
+	case <-time.After(interleaveTimeout):
+		c.Fatalf("call %q did not finish within %v", name, interleaveTimeout)
+	}
+	if call.tb.Failed() {
+		c.Fatalf("call %q failed%s", name, call.tb.failures())
+	}
+}
+
+func (il *Interleaving) call(c *qt.C, name string) *interleavedCall {
+	il.mu.Lock()
+	call := il.calls[name]
+	il.mu.Unlock()
+	c.Assert(call, qt.Not(qt.IsNil), qt.Commentf("call %q not started", name))
+	return call
+}
+
+func (call *interleavedCall) setFree() {
+	call.freeOnce.Do(func() {
+		close(call.free)
+	})
+}
+
+type interleaveKey struct{}
+
+// Rendezvous marks a point in a handler at which a call started with
+// Interleaving.Start stops until the test lets it continue. The
+// context must be, or be derived from, the request context. It
+// returns immediately when called for any other request, so
+// handlers can call it unconditionally.
+func Rendezvous(ctx context.Context, point string) {
+	call, _ := ctx.Value(interleaveKey{}).(*interleavedCall)
+	if call == nil {
+		return
+	}
+	select {
+	case call.arrived <- point:
+	case <-call.free:
+		return
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-call.release:
+	case <-call.free:
+	case <-ctx.Done():
+	}
+}
+
+// callTB is a testing.TB that records the failures of a call
+// running in its own goroutine, so that they can be reported
+// from the test goroutine.
+type callTB struct {
+	testing.TB
+
+	mu     sync.Mutex
+	failed bool
+	msgs   []string
+}
+
+// Error implements testing.TB.Error.
+func (t *callTB) Error(args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+	t.msgs = append(t.msgs, fmt.Sprint(args...))
+}
+
+// Errorf implements testing.TB.Errorf.
+func (t *callTB) Errorf(format string, args ...interface{}) {
+	t.Error(fmt.Sprintf(format, args...))
+}
+
+// Fatal implements testing.TB.Fatal.
+func (t *callTB) Fatal(args ...interface{}) {
+	t.Error(args...)
+	runtime.Goexit()
+}
+
+// Fatalf implements testing.TB.Fatalf.
+func (t *callTB) Fatalf(format string, args ...interface{}) {
+	t.Fatal(fmt.Sprintf(format, args...))
+}
+
+// Fail implements testing.TB.Fail.
+func (t *callTB) Fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+}
+
+// FailNow implements testing.TB.FailNow.
+func (t *callTB) FailNow() {
+	t.Fail()
+	runtime.Goexit()
+}
+
+// Failed implements testing.TB.Failed.
+func (t *callTB) Failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+// failures returns the recorded failure messages, each
+// starting on a new line, or the empty string if there
+// were none.
+func (t *callTB) failures() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.msgs) == 0 {
+		return ""
+	}
+	return ":\n" + strings.Join(t.msgs, "\n")
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// counterHandler returns a handler that increments a counter
+// without holding a lock between reading and writing it.
+func counterHandler() http.Handler {
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		v := n
+		mu.Unlock()
+		qthttptest.Rendezvous(req.Context(), "read")
+		v++
+		mu.Lock()
+		n = v
+		mu.Unlock()
+		qthttptest.Rendezvous(req.Context(), "written")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	})
+}
+
+func TestInterleaving(t *testing.T) {
+	c := qt.New(t)
+	il := qthttptest.NewInterleaving(c, counterHandler())
+	il.Start(c, "a", qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/counter",
+		ExpectBody: 1,
+	})
+	il.WaitFor(c, "a", "read")
+	il.Start(c, "b", qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/counter",
+		ExpectBody: 1,
+	})
+	il.WaitFor(c, "b", "read")
+	// Both calls have read the same value, so one
+	// update is lost whichever finishes first.
+	il.Release(c, "b")
+	il.WaitFor(c, "b", "written")
+	il.Release(c, "a")
+	il.Wait(c, "a")
+	il.Wait(c, "b")
+
+	// Calls that are not held back see the earlier updates.
+	il.Start(c, "c", qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/counter",
+		ExpectBody: 2,
+	})
+	il.Wait(c, "c")
+}
+
+func TestInterleavingFailures(t *testing.T) {
+	c := qt.New(t)
+	il := qthttptest.NewInterleaving(c, counterHandler())
+	il.Start(c, "a", qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/counter",
+		ExpectBody: 2,
+	})
+	checkFails(c, `rendezvous point reached by call "a"`, func(c *qt.C) {
+		il.WaitFor(c, "a", "written")
+	})
+	checkFails(c, `call "a" failed:\n.*values are not deep equal`, func(c *qt.C) {
+		il.Wait(c, "a")
+	})
+	checkFails(c, `call "a" is not waiting at a rendezvous point`, func(c *qt.C) {
+		il.Release(c, "a")
+	})
+	checkFails(c, `call "a" already started`, func(c *qt.C) {
+		il.Start(c, "a", qthttptest.JSONCallParams{URL: "/counter"})
+	})
+	checkFails(c, `call "x" not started`, func(c *qt.C) {
+		il.Wait(c, "x")
+	})
+	il.Start(c, "b", qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/counter",
+		ExpectBody: 2,
+	})
+	il.WaitFor(c, "b", "read")
+	il.Release(c, "b")
+	il.WaitFor(c, "b", "written")
+	il.Release(c, "b")
+	checkFails(c, `call "b" finished without reaching "done"`, func(c *qt.C) {
+		il.WaitFor(c, "b", "done")
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// JSONRPCCallParams holds parameters for AssertJSONRPCCall.
+type JSONRPCCallParams struct {
+	// DoRequestParams holds the parameters used to make the
+	// request. The Method, JSONBody and Body fields are ignored:
+	// the request envelope is always POSTed as JSON.
+	DoRequestParams
+
+	// ExpectStatus holds the expected HTTP status code.
+	// http.StatusOK is assumed if this is zero.
+	ExpectStatus int
+
+	// Calls holds the calls to make. If there is more than
+	// one, or Batch is true, they are sent as a batch request.
+	Calls []JSONRPCCall
+
+	// Batch forces the calls to be sent as a batch
+	// request even when there is only one.
+	Batch bool
+}
+
+// JSONRPCCall holds a single JSON-RPC 2.0 call and the
+// expected response to it.
+type JSONRPCCall struct {
+	// Method holds the name of the method to call.
+	Method string
+
+	// Params holds the parameters for the call, if any.
+	Params interface{}
+
+	// ID holds the request id. If it is nil and Notification is
+	// false, an integer id is allocated automatically.
+	ID interface{}
+
+	// Notification specifies that the call is a notification,
+	// sent without an id, to which the server must not respond.
+	Notification bool
+
+	// ExpectResult holds the expected result, compared with
+	// JSONEquals. It may be a BodyAsserter, in which case it
+	// is called with the result.
+	ExpectResult interface{}
+
+	// ExpectError, if non-nil, holds the expected error. When it
+	// is set, the response must hold an error rather than a result.
+	ExpectError *JSONRPCError
+}
+
+// JSONRPCError holds a JSON-RPC 2.0 error object. When used as an
+// expectation, Message is a regular expression and Data, if non-nil,
+// is compared with JSONEquals.
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type jsonRPCRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      interface{} `json:"id,omitempty"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC *string          `json:"jsonrpc"`
+	Result  json.RawMessage  `json:"result"`
+	Error   *json.RawMessage `json:"error"`
+	ID      json.RawMessage  `json:"id"`
+}
+
+// AssertJSONRPCCall makes the JSON-RPC 2.0 calls in p and asserts that
+// the response envelopes are well formed according to the
+// specification, that each call has a response with a matching id,
+// and that the results and errors are as expected.
+func AssertJSONRPCCall(c *qt.C, p JSONRPCCallParams) {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	c.Assert(p.Calls, qt.Not(qt.HasLen), 0, qt.Commentf("no JSON-RPC calls specified"))
+	batch := p.Batch || len(p.Calls) > 1
+	reqs := make([]jsonRPCRequest, len(p.Calls))
+	expect := make(map[string]JSONRPCCall)
+	nextID := 1
+	for i, call := range p.Calls {
+		reqs[i] = jsonRPCRequest{
+			JSONRPC: "2.0",
+			Method:  call.Method,
+			Params:  call.Params,
+		}
+		if call.Notification {
+			continue
+		}
+		id := call.ID
+		if id == nil {
+			id = nextID
+			nextID++
+		}
+		reqs[i].ID = id
+		idData, err := json.Marshal(id)
+		c.Assert(err, qt.Equals, nil)
+		expect[string(idData)] = call
+	}
+	dp := p.DoRequestParams
+	dp.Method = "POST"
+	dp.Body = nil
+	if batch {
+		dp.JSONBody = reqs
+	} else {
+		dp.JSONBody = reqs[0]
+	}
+	rec := DoRequest(c, dp)
+	if dp.ExpectError != "" {
+		return
+	}
+	c.Assert(rec.Code, qt.Equals, p.ExpectStatus, qt.Commentf("body: %s", rec.Body.Bytes()))
+	body, err := decodeContent(rec.Header(), rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil)
+	if len(expect) == 0 {
+		// Only notifications were sent, so there must be no response.
+		c.Assert(string(bytes.TrimSpace(body)), qt.Equals, "", qt.Commentf("unexpected response to notifications"))
+		return
+	}
+	c.Assert(rec.Header().Get("Content-Type"), ContentTypeMatches, "application/json")
+	var resps []jsonRPCResponse
+	if batch {
+		err = json.Unmarshal(body, &resps)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("invalid JSON-RPC batch response: %s", body))
+	} else {
+		var resp jsonRPCResponse
+		err = json.Unmarshal(body, &resp)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("invalid JSON-RPC response: %s", body))
+		resps = []jsonRPCResponse{resp}
+	}
+	seen := make(map[string]bool)
+	for _, resp := range resps {
+		id := string(resp.ID)
+		call, ok := expect[id]
+		c.Assert(ok, qt.Equals, true, qt.Commentf("response with unexpected id %s", resp.ID))
+		c.Assert(seen[id], qt.Equals, false, qt.Commentf("duplicate response with id %s", resp.ID))
+		seen[id] = true
+		assertJSONRPCResponse(c, resp, call)
+	}
+	for id := range expect {
+		c.Assert(seen[id], qt.Equals, true, qt.Commentf("no response for id %s", id))
+	}
+}
+
+func assertJSONRPCResponse(c *qt.C, resp jsonRPCResponse, call JSONRPCCall) {
+	comment := qt.Commentf("response to %s with id %s", call.Method, resp.ID)
+	c.Assert(resp.JSONRPC, qt.Not(qt.IsNil), comment)
+	c.Assert(*resp.JSONRPC, qt.Equals, "2.0", comment)
+	hasResult := resp.Result != nil
+	hasError := resp.Error != nil
+	c.Assert(hasResult != hasError, qt.Equals, true, qt.Commentf("response to %s with id %s must have exactly one of result and error", call.Method, resp.ID))
+	if hasError {
+		var rpcErr struct {
+			Code    *int            `json:"code"`
+			Message *string         `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}
+		err := json.Unmarshal(*resp.Error, &rpcErr)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("invalid error object %s", *resp.Error))
+		c.Assert(rpcErr.Code, qt.Not(qt.IsNil), qt.Commentf("error object %s has no integer code", *resp.Error))
+		c.Assert(rpcErr.Message, qt.Not(qt.IsNil), qt.Commentf("error object %s has no message", *resp.Error))
+		c.Assert(call.ExpectError, qt.Not(qt.IsNil), qt.Commentf("unexpected error %s in %s", *resp.Error, comment))
+		c.Assert(*rpcErr.Code, qt.Equals, call.ExpectError.Code, comment)
+		c.Assert(*rpcErr.Message, qt.Matches, call.ExpectError.Message, comment)
+		if call.ExpectError.Data != nil {
+			c.Assert(string(rpcErr.Data), JSONEquals, call.ExpectError.Data, comment)
+		}
+		return
+	}
+	c.Assert(call.ExpectError, qt.IsNil, qt.Commentf("expected error, got result %s in %s", resp.Result, comment))
+	if assertResult, ok := call.ExpectResult.(BodyAsserter); ok {
+		assertResult(c, resp.Result)
+		return
+	}
+	c.Assert(string(resp.Result), JSONEquals, call.ExpectResult, comment)
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// jsonRPCHandler implements a JSON-RPC 2.0 server with "add" and
+// "notify" methods. Responses to batches are returned in reverse
+// order to check that they are matched by id.
+func jsonRPCHandler(c *qt.C) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var raw json.RawMessage
+		err := json.NewDecoder(req.Body).Decode(&raw)
+		c.Check(err, qt.Equals, nil)
+		type request struct {
+			JSONRPC string
+			Method  string
+			Params  []int
+			ID      *json.RawMessage
+		}
+		handle := func(r request) interface{} {
+			c.Check(r.JSONRPC, qt.Equals, "2.0")
+			if r.ID == nil {
+				return nil
+			}
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": r.ID}
+			switch r.Method {
+			case "add":
+				resp["result"] = r.Params[0] + r.Params[1]
+			default:
+				resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found", "data": r.Method}
+			}
+			return resp
+		}
+		var result interface{}
+		if raw[0] == '[' {
+			var reqs []request
+			json.Unmarshal(raw, &reqs)
+			var resps []interface{}
+			for i := len(reqs) - 1; i >= 0; i-- {
+				if resp := handle(reqs[i]); resp != nil {
+					resps = append(resps, resp)
+				}
+			}
+			if resps != nil {
+				result = resps
+			}
+		} else {
+			var r request
+			json.Unmarshal(raw, &r)
+			result = handle(r)
+		}
+		if result == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+func TestAssertJSONRPCCall(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONRPCCall(c, qthttptest.JSONRPCCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/rpc",
+			Handler: jsonRPCHandler(c),
+		},
+		Calls: []qthttptest.JSONRPCCall{{
+			Method:       "add",
+			Params:       []int{1, 2},
+			ID:           "a",
+			ExpectResult: 3,
+		}},
+	})
+}
+
+func TestAssertJSONRPCCallBatch(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONRPCCall(c, qthttptest.JSONRPCCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/rpc",
+			Handler: jsonRPCHandler(c),
+		},
+		Calls: []qthttptest.JSONRPCCall{{
+			Method:       "add",
+			Params:       []int{1, 2},
+			ExpectResult: 3,
+		}, {
+			Method:       "notify",
+			Notification: true,
+		}, {
+			Method:       "add",
+			Params:       []int{3, 4},
+			ExpectResult: 7,
+		}, {
+			Method: "other",
+			ExpectError: &qthttptest.JSONRPCError{
+				Code:    -32601,
+				Message: "method .* found",
+				Data:    "other",
+			},
+		}},
+	})
+}
+
+func TestAssertJSONRPCCallNotificationsOnly(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONRPCCall(c, qthttptest.JSONRPCCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/rpc",
+			Handler: jsonRPCHandler(c),
+		},
+		ExpectStatus: http.StatusNoContent,
+		Calls: []qthttptest.JSONRPCCall{{
+			Method:       "notify",
+			Notification: true,
+		}},
+	})
+}
+
+func TestAssertJSONRPCCallInvalidEnvelope(t *testing.T) {
+	c := qt.New(t)
+	respond := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		})
+	}
+	tests := []struct {
+		body   string
+		expect string
+	}{{
+		body:   `{"jsonrpc": "2.0", "id": 2, "result": 3}`,
+		expect: `response with unexpected id 2`,
+	}, {
+		body:   `{"jsonrpc": "2.0", "id": 1, "result": 3, "error": {"code": 1, "message": "x"}}`,
+		expect: `.*must have exactly one of result and error`,
+	}, {
+		body:   `{"jsonrpc": "1.0", "id": 1, "result": 3}`,
+		expect: `response to add with id 1`,
+	}, {
+		body:   `{"jsonrpc": "2.0", "id": 1, "error": {"message": "x"}}`,
+		expect: `error object .* has no integer code`,
+	}}
+	for _, test := range tests {
+		checkFails(c, test.expect, func(c *qt.C) {
+			qthttptest.AssertJSONRPCCall(c, qthttptest.JSONRPCCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					URL:     "/rpc",
+					Handler: respond(test.body),
+				},
+				Calls: []qthttptest.JSONRPCCall{{
+					Method:       "add",
+					ExpectResult: 3,
+				}},
+			})
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// JWTKey holds a key that can be used to sign and verify
+// JSON Web Tokens in tests.
+type JWTKey struct {
+	// Alg holds the signing algorithm, "HS256" or "RS256".
+	Alg string
+
+	// KeyID holds the key id that is included in the
+	// header of signed tokens.
+	KeyID string
+
+	secret  []byte
+	private *rsa.PrivateKey
+}
+
+// NewJWTKey returns a newly generated key for the given
+// algorithm, which must be "HS256" or "RS256".
+func NewJWTKey(c *qt.C, alg string) *JWTKey {
+	var kid [8]byte
+	_, err := rand.Read(kid[:])
+	c.Assert(err, qt.Equals, nil)
+	k := &JWTKey{
+		Alg:   alg,
+		KeyID: hex.EncodeToString(kid[:]),
+	}
+	switch alg {
+	case "HS256":
+		k.secret = make([]byte, 32)
+		_, err = rand.Read(k.secret)
+	case "RS256":
+		k.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		c.Fatalf("unsupported JWT algorithm %q", alg)
+	}
+	c.Assert(err, qt.Equals, nil)
+	return k
+}
+
+// Secret returns the shared secret of an HS256 key.
+func (k *JWTKey) Secret() []byte {
+	return k.secret
+}
+
+// PublicKey returns the public key of an RS256 key.
+func (k *JWTKey) PublicKey() *rsa.PublicKey {
+	if k.private == nil {
+		return nil
+	}
+	return &k.private.PublicKey
+}
+
+// Sign returns a token holding the given claims signed with the key.
+func (k *JWTKey) Sign(c *qt.C, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{
+		"alg": k.Alg,
+		"typ": "JWT",
+		"kid": k.KeyID,
+	})
+	c.Assert(err, qt.Equals, nil)
+	payload, err := json.Marshal(claims)
+	c.Assert(err, qt.Equals, nil)
+	signed := jwtEncode(header) + "." + jwtEncode(payload)
+	sig, err := k.sign([]byte(signed))
+	c.Assert(err, qt.Equals, nil)
+	return signed + "." + jwtEncode(sig)
+}
+
+// AuthorizationHeader returns a header holding a bearer token with
+// the given claims, suitable for use as DoRequestParams.Header.
+func (k *JWTKey) AuthorizationHeader(c *qt.C, claims map[string]interface{}) http.Header {
+	return http.Header{
+		"Authorization": {"Bearer " + k.Sign(c, claims)},
+	}
+}
+
+// Verify checks the signature on the given token
+// and returns its claims.
+func (k *JWTKey) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT: got %d parts, want 3", len(parts))
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := jwtDecode(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("cannot decode JWT header: %v", err)
+	}
+	if header.Alg != k.Alg {
+		return nil, fmt.Errorf("unexpected JWT algorithm %q, want %q", header.Alg, k.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JWT signature: %v", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch k.Alg {
+	case "HS256":
+		want, _ := k.sign(signed)
+		if !hmac.Equal(sig, want) {
+			return nil, fmt.Errorf("invalid JWT signature")
+		}
+	case "RS256":
+		sum := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(&k.private.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			return nil, fmt.Errorf("invalid JWT signature")
+		}
+	}
+	var claims map[string]interface{}
+	if err := jwtDecode(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("cannot decode JWT claims: %v", err)
+	}
+	return claims, nil
+}
+
+func (k *JWTKey) sign(data []byte) ([]byte, error) {
+	switch k.Alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case "RS256":
+		sum := sha256.Sum256(data)
+		return rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, sum[:])
+	}
+	return nil, fmt.Errorf("unsupported JWT algorithm %q", k.Alg)
+}
+
+// ExpectJWTClaims asserts that the given request, typically captured
+// by a RecordingServer, holds a bearer token in its Authorization
+// header that is signed by key and holds all the expected claims.
+// Claims that are not mentioned in expect are ignored; claim values
+// are compared after conversion to JSON. If key is nil, the signature
+// is not checked. It returns all the claims in the token.
+func ExpectJWTClaims(c *qt.C, req RecordedRequest, key *JWTKey, expect map[string]interface{}) map[string]interface{} {
+	auth := req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	c.Assert(len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix), qt.Equals, true, qt.Commentf("no bearer token in Authorization header %q", auth))
+	token := auth[len(prefix):]
+	var claims map[string]interface{}
+	if key != nil {
+		var err error
+		claims, err = key.Verify(token)
+		c.Assert(err, qt.Equals, nil)
+	} else {
+		parts := strings.Split(token, ".")
+		c.Assert(parts, qt.HasLen, 3, qt.Commentf("malformed JWT %q", token))
+		err := jwtDecode(parts[1], &claims)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("cannot decode JWT claims"))
+	}
+	got := make(map[string]interface{})
+	for name := range expect {
+		if v, ok := claims[name]; ok {
+			got[name] = v
+		}
+	}
+	data, err := json.Marshal(got)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(data, JSONEquals, expect, qt.Commentf("JWT claims %v", claims))
+	return claims
+}
+
+func jwtEncode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func jwtDecode(s string, x interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, x)
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestJWTKey(t *testing.T) {
+	c := qt.New(t)
+	for _, alg := range []string{"HS256", "RS256"} {
+		c.Run(alg, func(c *qt.C) {
+			key := qthttptest.NewJWTKey(c, alg)
+			token := key.Sign(c, map[string]interface{}{
+				"sub": "bob",
+				"exp": 1234,
+			})
+			claims, err := key.Verify(token)
+			c.Assert(err, qt.Equals, nil)
+			c.Assert(claims, qt.DeepEquals, map[string]interface{}{
+				"sub": "bob",
+				"exp": 1234.0,
+			})
+
+			other := qthttptest.NewJWTKey(c, alg)
+			_, err = other.Verify(token)
+			c.Assert(err, qt.ErrorMatches, `invalid JWT signature`)
+
+			_, err = key.Verify(strings.TrimSuffix(token, token[strings.LastIndex(token, "."):]))
+			c.Assert(err, qt.ErrorMatches, `malformed JWT: got 2 parts, want 3`)
+		})
+	}
+}
+
+func TestExpectJWTClaims(t *testing.T) {
+	c := qt.New(t)
+	key := qthttptest.NewJWTKey(c, "HS256")
+	srv := qthttptest.NewRecordingServer(c, nil)
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/",
+		Header: key.AuthorizationHeader(c, map[string]interface{}{
+			"sub":   "alice",
+			"aud":   []string{"api"},
+			"admin": true,
+		}),
+	})
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/",
+	})
+	reqs := srv.Requests()
+	claims := qthttptest.ExpectJWTClaims(c, reqs[0], key, map[string]interface{}{
+		"sub": "alice",
+		"aud": []string{"api"},
+	})
+	c.Assert(claims["admin"], qt.Equals, true)
+	qthttptest.ExpectJWTClaims(c, reqs[0], nil, map[string]interface{}{
+		"admin": true,
+	})
+
+	checkFails(c, `JWT claims`, func(c *qt.C) {
+		qthttptest.ExpectJWTClaims(c, reqs[0], key, map[string]interface{}{
+			"sub": "bob",
+		})
+	})
+	checkFails(c, `JWT claims`, func(c *qt.C) {
+		qthttptest.ExpectJWTClaims(c, reqs[0], key, map[string]interface{}{
+			"scope": "read",
+		})
+	})
+	checkFails(c, `invalid JWT signature`, func(c *qt.C) {
+		qthttptest.ExpectJWTClaims(c, reqs[0], qthttptest.NewJWTKey(c, "HS256"), nil)
+	})
+	checkFails(c, `no bearer token in Authorization header ""`, func(c *qt.C) {
+		qthttptest.ExpectJWTClaims(c, reqs[1], key, nil)
+	})
+}
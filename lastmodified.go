@@ -0,0 +1,71 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// LastModifiedCallParams holds parameters for AssertLastModified.
+type LastModifiedCallParams struct {
+	// DoRequestParams holds the request that fetches the resource.
+	// The ExpectError field is ignored, and any If-Modified-Since
+	// header is replaced.
+	DoRequestParams
+
+	// ExpectStatus holds the expected status of an unconditional
+	// response. If it is zero, http.StatusOK is assumed.
+	ExpectStatus int
+}
+
+// AssertLastModified checks that a resource honours If-Modified-Since
+// requests. It fetches the resource and asserts that the response has a
+// valid Last-Modified header that is no later than its Date header. It
+// then repeats the request with an If-Modified-Since header set to the
+// Last-Modified time, to one second after it and to one second before
+// it, and asserts that the first two responses are 304 Not Modified
+// with no body, and that the last has the same status as the
+// unconditional response.
+//
+// HTTP dates have a granularity of one second, so a server that
+// compares them against a modification time that has not been
+// truncated to the second will fail the first check. The
+// Last-Modified time is returned.
+func AssertLastModified(c *qt.C, p LastModifiedCallParams) time.Time {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	p.ExpectError = ""
+	p.Header = cloneHeader(p.Header)
+	p.Header.Del("If-Modified-Since")
+	resp := DoResponse(c, p.DoRequestParams)
+	resp.AssertStatus(c, p.ExpectStatus)
+	lastModified, err := http.ParseTime(resp.Header(c, "Last-Modified"))
+	c.Assert(err, qt.Equals, nil, qt.Commentf("Last-Modified header"))
+	if date, err := http.ParseTime(resp.Response.Header.Get("Date")); err == nil && lastModified.After(date) {
+		c.Fatalf("Last-Modified %v is later than Date %v", lastModified, date)
+	}
+	for _, test := range []struct {
+		skew   time.Duration
+		status int
+	}{
+		{0, http.StatusNotModified},
+		{time.Second, http.StatusNotModified},
+		{-time.Second, p.ExpectStatus},
+	} {
+		since := lastModified.Add(test.skew).UTC().Format(http.TimeFormat)
+		ps := p.DoRequestParams
+		ps.Header = cloneHeader(p.Header)
+		ps.Header.Set("If-Modified-Since", since)
+		r := DoResponse(c, ps)
+		c.Assert(r.Response.StatusCode, qt.Equals, test.status, qt.Commentf("If-Modified-Since: %s; Last-Modified: %s; body: %q", since, resp.Response.Header.Get("Last-Modified"), r.Body))
+		if test.status == http.StatusNotModified {
+			r.AssertNoBody(c)
+		}
+	}
+	return lastModified
+}
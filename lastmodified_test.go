@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var modTime = time.Date(2022, 3, 4, 5, 6, 7, 500e6, time.UTC)
+
+var assertLastModifiedTests = []struct {
+	about       string
+	handler     http.HandlerFunc
+	expectError string
+}{{
+	about: "ServeContent",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "x.txt", modTime, strings.NewReader("hello"))
+	},
+}, {
+	about: "modification time not truncated",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !modTime.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	},
+	expectError: `values are not equal
+comment:
+  If-Modified-Since: Fri, 04 Mar 2022 05:06:07 GMT; Last-Modified: Fri, 04 Mar 2022 05:06:07 GMT; body: "hello"
+got:
+  int\(200\)
+want:
+  int\(304\)
+`,
+}, {
+	about: "If-Modified-Since ignored",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	},
+	expectError: `values are not equal
+comment:
+  If-Modified-Since: Fri, 04 Mar 2022 05:06:07 GMT; .*`,
+}, {
+	about: "always not modified",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		if req.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	},
+	expectError: `values are not equal
+comment:
+  If-Modified-Since: Fri, 04 Mar 2022 05:06:06 GMT; .*`,
+}, {
+	about: "missing Last-Modified",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	},
+	expectError: `header "Last-Modified" not found`,
+}, {
+	about: "invalid Last-Modified",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", "yesterday")
+		w.Write([]byte("hello"))
+	},
+	expectError: `got non-nil error
+comment:
+  Last-Modified header
+got:
+  e.parsing time "yesterday" .*`,
+}, {
+	about: "Last-Modified after Date",
+	handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Date", modTime.Format(http.TimeFormat))
+		w.Header().Set("Last-Modified", modTime.Add(time.Hour).Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	},
+	expectError: `Last-Modified 2022-03-04 06:06:07 \+0000 UTC is later than Date 2022-03-04 05:06:07 \+0000 UTC`,
+}}
+
+func TestAssertLastModified(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertLastModifiedTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			p := qthttptest.LastModifiedCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: test.handler,
+					URL:     "/",
+				},
+			}
+			if test.expectError == "" {
+				lastModified := qthttptest.AssertLastModified(c, p)
+				c.Assert(lastModified.Equal(modTime.Truncate(time.Second)), qt.Equals, true)
+				return
+			}
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertLastModified(c, p)
+			})
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// leakTimeout holds how long AssertNoLeaks waits for
+// goroutines started by the function to finish.
+const leakTimeout = 2 * time.Second
+
+// AssertNoLeaks calls f and asserts that it does not leak any
+// goroutines or response bodies: any goroutine started while f was
+// running must finish shortly after it returns, and any response body
+// returned by Do while f was running must have been closed. Goroutines
+// serving idle connections from http.DefaultTransport are not counted
+// as leaked, as those connections are closed first. Leaked bodies
+// usually hold on to connections, so they are reported first.
+//
+// As all the goroutines in the process are considered, AssertNoLeaks
+// should not be used in parallel tests.
+func AssertNoLeaks(c *qt.C, f func()) {
+	tracker := bodyTrackerFor(c)
+	openBefore := tracker.open()
+	before := goroutineStacks()
+	f()
+	var leakedBodies []string
+	for b := range tracker.open() {
+		if !openBefore[b] {
+			leakedBodies = append(leakedBodies, b.call)
+		}
+	}
+	sort.Strings(leakedBodies)
+	if len(leakedBodies) > 0 {
+		c.Fatalf("response bodies not closed: %s", strings.Join(leakedBodies, ", "))
+	}
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	deadline := time.Now().Add(leakTimeout)
+	for {
+		var leaked []string
+		for id, stack := range goroutineStacks() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			sort.Strings(leaked)
+			c.Fatalf("%d goroutines started during the call still running after %v:\n\n%s", len(leaked), leakTimeout, strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// goroutineStacks returns the stacks of all
+// goroutines, keyed by goroutine id.
+func goroutineStacks() map[int]string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := make(map[int]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// Each stack starts with a line like "goroutine 23 [running]:".
+		fields := strings.Fields(string(stack))
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		stacks[id] = string(stack)
+	}
+	return stacks
+}
+
+// openBodies holds a bodyTracker for each
+// test that has called Do.
+var openBodies sync.Map
+
+// bodyTracker tracks the response bodies returned by Do in a test
+// that have not been closed yet, and closes any that remain when
+// the test finishes.
+type bodyTracker struct {
+	mu     sync.Mutex
+	bodies map[*trackedBody]bool
+}
+
+// closeOpenBodies closes any response bodies returned by
+// Do in the test of c that are still open.
+func closeOpenBodies(c *qt.C) {
+	if t, ok := openBodies.Load(trackerKey(c)); ok {
+		t.(*bodyTracker).closeAll()
+	}
+}
+
+// trackerKey returns the key of the body tracker for the test of c.
+func trackerKey(c *qt.C) testing.TB {
+	if fc, ok := c.TB.(*failureContext); ok {
+		return fc.TB
+	}
+	return c.TB
+}
+
+// bodyTrackerFor returns the body tracker for the test of c.
+func bodyTrackerFor(c *qt.C) *bodyTracker {
+	tb := trackerKey(c)
+	t, loaded := openBodies.LoadOrStore(tb, &bodyTracker{
+		bodies: make(map[*trackedBody]bool),
+	})
+	tracker := t.(*bodyTracker)
+	if !loaded {
+		tb.Cleanup(func() {
+			openBodies.Delete(tb)
+			tracker.closeAll()
+		})
+	}
+	return tracker
+}
+
+// track arranges for the body of resp, the response to req,
+// to be tracked.
+func (t *bodyTracker) track(req *http.Request, resp *http.Response) {
+	if _, ok := resp.Body.(io.Writer); ok {
+		// Leave writable bodies, as returned with 101 Switching
+		// Protocols responses, as they are.
+		return
+	}
+	b := &trackedBody{
+		ReadCloser: resp.Body,
+		tracker:    t,
+		call:       fmt.Sprintf("%s %s", req.Method, req.URL),
+	}
+	t.mu.Lock()
+	t.bodies[b] = true
+	t.mu.Unlock()
+	resp.Body = b
+}
+
+// open returns the bodies that have not been closed.
+func (t *bodyTracker) open() map[*trackedBody]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bodies := make(map[*trackedBody]bool, len(t.bodies))
+	for b := range t.bodies {
+		bodies[b] = true
+	}
+	return bodies
+}
+
+func (t *bodyTracker) closeAll() {
+	for b := range t.open() {
+		b.Close()
+	}
+}
+
+// trackedBody is a response body tracked by a bodyTracker.
+type trackedBody struct {
+	io.ReadCloser
+	tracker *bodyTracker
+	call    string
+}
+
+func (b *trackedBody) Close() error {
+	b.tracker.mu.Lock()
+	delete(b.tracker.bodies, b)
+	b.tracker.mu.Unlock()
+	return b.ReadCloser.Close()
+}
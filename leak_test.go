@@ -0,0 +1,90 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestDoClosesBodyAtCleanup(t *testing.T) {
+	c := qt.New(t)
+	body := &closeRecorder{Reader: strings.NewReader("hello")}
+	c.Run("call", func(c *qt.C) {
+		resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+			URL: "http://0.1.2.3/",
+			Do: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       body,
+				}, nil
+			},
+		})
+		c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+	})
+	c.Assert(body.closed, qt.Equals, true)
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	qthttptest.AssertNoLeaks(c, func() {
+		resp := qthttptest.Do(c, qthttptest.DoRequestParams{
+			URL: srv.URL() + "/x",
+		})
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+	})
+	checkFails(c, `response bodies not closed: GET http://.*/y`, func(c *qt.C) {
+		qthttptest.AssertNoLeaks(c, func() {
+			qthttptest.Do(c, qthttptest.DoRequestParams{
+				URL: srv.URL() + "/y",
+			})
+		})
+	})
+}
+
+func TestAssertJSONCallWithDetectLeaks(t *testing.T) {
+	c := qt.New(t)
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/leak" {
+			go func() {
+				<-release
+			}()
+		}
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:     handler,
+		URL:         "/",
+		DetectLeaks: true,
+	})
+	checkFails(c, `1 goroutines started during the call still running after 2s:\n\ngoroutine \d+ .*leak_test.go`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:     handler,
+			URL:         "/leak",
+			DetectLeaks: true,
+		})
+	})
+}
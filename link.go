@@ -0,0 +1,144 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Link holds a link parsed from a Link header as
+// specified by RFC 8288 (formerly RFC 5988).
+type Link struct {
+	// URL holds the target URL, as found in the header.
+	URL string
+
+	// Rels holds the link relation types, lower-cased.
+	Rels []string
+
+	// Params holds all the link parameters, keyed by
+	// lower-case name, including rel.
+	Params map[string]string
+}
+
+// ParseLinks parses all the Link headers in h.
+func ParseLinks(h http.Header) ([]Link, error) {
+	var links []Link
+	for _, v := range h.Values("Link") {
+		l, err := parseLinkHeader(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Link header %q: %v", v, err)
+		}
+		links = append(links, l...)
+	}
+	return links, nil
+}
+
+// AssertLinks asserts that the Link headers in h contain
+// links with the given relation types and URLs. A relation
+// mapped to the empty string must not be present. Other
+// relations are ignored.
+func AssertLinks(c *qt.C, h http.Header, expect map[string]string) {
+	links, err := ParseLinks(h)
+	c.Assert(err, qt.Equals, nil)
+	rels := make(map[string]string)
+	for _, l := range links {
+		for _, rel := range l.Rels {
+			if _, ok := rels[rel]; !ok {
+				rels[rel] = l.URL
+			}
+		}
+	}
+	for rel, want := range expect {
+		got, ok := rels[strings.ToLower(rel)]
+		if want == "" {
+			c.Assert(ok, qt.Equals, false, qt.Commentf("unexpected %q link to %q", rel, got))
+			continue
+		}
+		c.Assert(ok, qt.Equals, true, qt.Commentf("no %q link found in %q", rel, h.Values("Link")))
+		c.Assert(got, qt.Equals, want, qt.Commentf("%q link", rel))
+	}
+}
+
+// parseLinkHeader parses a single Link header value.
+func parseLinkHeader(s string) ([]Link, error) {
+	var links []Link
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return links, nil
+		}
+		if s[0] != '<' {
+			return nil, fmt.Errorf("expected '<' at %q", s)
+		}
+		end := strings.IndexByte(s, '>')
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated URL")
+		}
+		l := Link{
+			URL:    s[1:end],
+			Params: make(map[string]string),
+		}
+		s = s[end+1:]
+		for {
+			s = strings.TrimLeft(s, " \t")
+			if s == "" || s[0] == ',' {
+				break
+			}
+			if s[0] != ';' {
+				return nil, fmt.Errorf("expected ';' at %q", s)
+			}
+			s = strings.TrimLeft(s[1:], " \t")
+			i := strings.IndexAny(s, "=;,")
+			if i == -1 {
+				i = len(s)
+			}
+			name := strings.ToLower(strings.TrimSpace(s[:i]))
+			s = s[i:]
+			val := ""
+			if s != "" && s[0] == '=' {
+				var err error
+				val, s, err = parseParamValue(strings.TrimLeft(s[1:], " \t"))
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, ok := l.Params[name]; !ok {
+				l.Params[name] = val
+			}
+		}
+		l.Rels = strings.Fields(strings.ToLower(l.Params["rel"]))
+		links = append(links, l)
+	}
+}
+
+// parseParamValue parses a token or quoted string at the start of s
+// and returns it along with the rest of s.
+func parseParamValue(s string) (val, rest string, err error) {
+	if s == "" || s[0] != '"' {
+		i := strings.IndexAny(s, ";,")
+		if i == -1 {
+			i = len(s)
+		}
+		return strings.TrimSpace(s[:i]), s[i:], nil
+	}
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i < len(s) {
+				buf.WriteByte(s[i])
+			}
+		case '"':
+			return buf.String(), s[i+1:], nil
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted string")
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestParseLinks(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{
+		"Link": {
+			`<https://example.com/items?page=2>; rel="next", <https://example.com/items?page=9>; rel=last`,
+			`<https://example.com/items?page=1>; rel="prev first"; title="a, \"quoted\" title"`,
+		},
+	}
+	links, err := qthttptest.ParseLinks(h)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(links, qt.DeepEquals, []qthttptest.Link{{
+		URL:    "https://example.com/items?page=2",
+		Rels:   []string{"next"},
+		Params: map[string]string{"rel": "next"},
+	}, {
+		URL:    "https://example.com/items?page=9",
+		Rels:   []string{"last"},
+		Params: map[string]string{"rel": "last"},
+	}, {
+		URL:    "https://example.com/items?page=1",
+		Rels:   []string{"prev", "first"},
+		Params: map[string]string{"rel": "prev first", "title": `a, "quoted" title`},
+	}})
+
+	qthttptest.AssertLinks(c, h, map[string]string{
+		"next":  "https://example.com/items?page=2",
+		"PREV":  "https://example.com/items?page=1",
+		"first": "https://example.com/items?page=1",
+		"self":  "",
+	})
+	checkFails(c, `no "self" link found`, func(c *qt.C) {
+		qthttptest.AssertLinks(c, h, map[string]string{"self": "x"})
+	})
+	checkFails(c, `unexpected "next" link`, func(c *qt.C) {
+		qthttptest.AssertLinks(c, h, map[string]string{"next": ""})
+	})
+}
+
+func TestParseLinksError(t *testing.T) {
+	c := qt.New(t)
+	_, err := qthttptest.ParseLinks(http.Header{"Link": {`https://example.com; rel=next`}})
+	c.Assert(err, qt.ErrorMatches, `invalid Link header .*: expected '<' at .*`)
+	_, err = qthttptest.ParseLinks(http.Header{"Link": {`<https://example.com>; title="unterminated`}})
+	c.Assert(err, qt.ErrorMatches, `invalid Link header .*: unterminated quoted string`)
+}
+
+func TestAssertJSONCallWithExpectLinks(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/items",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Link", `</items?page=2>; rel="next"`)
+		}),
+		ExpectLinks: map[string]string{
+			"next": "/items?page=2",
+			"prev": "",
+		},
+	})
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// LoadOpts holds options for AssertLoad.
+type LoadOpts struct {
+	// Concurrency holds the number of requests to
+	// make concurrently. If it is zero, 1 is assumed.
+	Concurrency int
+
+	// Total holds the total number of requests to make.
+	// If it is zero, 100 is assumed.
+	Total int
+
+	// ExpectStatus holds the status code of a successful response.
+	// http.StatusOK is assumed if it is zero. Any other
+	// status, or an error from the Do function,
+	// counts as a failed request.
+	ExpectStatus int
+
+	// MaxErrorRate holds the maximum proportion of requests, from 0
+	// to 1, that are allowed to fail. If it is zero, all requests
+	// must succeed.
+	MaxErrorRate float64
+
+	// MaxP99, if non-zero, holds the maximum allowed 99th
+	// percentile latency of all requests.
+	MaxP99 time.Duration
+}
+
+// LoadResult holds the aggregate results of AssertLoad.
+type LoadResult struct {
+	// Total holds the number of requests made.
+	Total int
+
+	// Errors holds the number of requests that failed.
+	Errors int
+
+	// P50, P90 and P99 hold latency percentiles
+	// over all requests.
+	P50, P90, P99 time.Duration
+
+	// Max holds the latency of the slowest request.
+	Max time.Duration
+}
+
+// AssertLoad makes many requests concurrently as specified by p and
+// asserts that the aggregate error rate and latency are within the
+// limits given in opts. A single temporary server is started
+// for all the requests if p.URL does not contain a host.
+//
+// The requests are made as by Do, except that the ExpectError field
+// in p is ignored and BeforeRequest and AfterResponse are called
+// concurrently on other goroutines, so they must not call c.Assert
+// or c.Fatal; use c.Check instead. A Body reader is read once and
+// sent in every request. It returns the aggregate results.
+func AssertLoad(c *qt.C, p DoRequestParams, opts LoadOpts) LoadResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Total <= 0 {
+		opts.Total = 100
+	}
+	if opts.ExpectStatus == 0 {
+		opts.ExpectStatus = http.StatusOK
+	}
+	p, closeServer := prepareDo(c, p)
+	defer closeServer()
+	var body []byte
+	if p.Body != nil {
+		data, err := ioutil.ReadAll(p.Body)
+		c.Assert(err, qt.Equals, nil)
+		body = data
+	}
+	c.Logf("load test, url %q, %d requests, concurrency %d", p.URL, opts.Total, opts.Concurrency)
+
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, opts.Total)
+		errs      []string
+	)
+	work := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				p := p
+				if body != nil {
+					p.Body = bytes.NewReader(body)
+				}
+				start := DefaultClock.Now()
+				err := doLoadRequest(c, p, opts.ExpectStatus)
+				elapsed := DefaultClock.Now().Sub(start)
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < opts.Total; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	result := LoadResult{
+		Total:  opts.Total,
+		Errors: len(errs),
+		P50:    percentile(latencies, 50),
+		P90:    percentile(latencies, 90),
+		P99:    percentile(latencies, 99),
+		Max:    latencies[len(latencies)-1],
+	}
+	c.Logf("load test results: %d/%d errors, p50 %v, p90 %v, p99 %v, max %v", result.Errors, result.Total, result.P50, result.P90, result.P99, result.Max)
+
+	errorRate := float64(result.Errors) / float64(result.Total)
+	if errorRate > opts.MaxErrorRate {
+		if len(errs) > 5 {
+			errs = append(errs[:5], "...")
+		}
+		c.Fatalf("error rate %.2f%% exceeds %.2f%%; errors:\n%s", errorRate*100, opts.MaxErrorRate*100, strings.Join(errs, "\n"))
+	}
+	if opts.MaxP99 > 0 && result.P99 > opts.MaxP99 {
+		c.Fatalf("99th percentile latency %v exceeds %v", result.P99, opts.MaxP99)
+	}
+	return result
+}
+
+// doLoadRequest makes a single request for AssertLoad, reading
+// and discarding the response body. It returns an error
+// if the request failed or returned an unexpected status.
+func doLoadRequest(c *qt.C, p DoRequestParams, expectStatus int) error {
+	req, err := newRequest(p)
+	if err != nil {
+		return err
+	}
+	if p.BeforeRequest != nil {
+		p.BeforeRequest(c, req)
+	}
+	resp, err := p.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if p.AfterResponse != nil {
+		p.AfterResponse(c, resp)
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return fmt.Errorf("cannot read response body: %v", err)
+	}
+	if resp.StatusCode != expectStatus {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// percentile returns the nth percentile of the given
+// sorted durations using the nearest-rank method.
+func percentile(sorted []time.Duration, n int) time.Duration {
+	rank := (n*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
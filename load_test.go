@@ -0,0 +1,108 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestAssertLoad(t *testing.T) {
+	c := qt.New(t)
+	var count int64
+	result := qthttptest.AssertLoad(c, qthttptest.DoRequestParams{
+		Method:   "POST",
+		URL:      "/items",
+		JSONBody: map[string]int{"n": 1},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			c.Check(err, qt.Equals, nil)
+			c.Check(string(body), qt.Equals, `{"n":1}`)
+			c.Check(req.Header.Get("Content-Type"), qt.Equals, "application/json")
+			atomic.AddInt64(&count, 1)
+		}),
+	}, qthttptest.LoadOpts{
+		Concurrency: 5,
+		Total:       50,
+		MaxP99:      time.Minute,
+	})
+	c.Assert(atomic.LoadInt64(&count), qt.Equals, int64(50))
+	c.Assert(result.Total, qt.Equals, 50)
+	c.Assert(result.Errors, qt.Equals, 0)
+	c.Assert(result.P50 <= result.P99, qt.Equals, true)
+	c.Assert(result.P99 <= result.Max, qt.Equals, true)
+}
+
+func TestAssertLoadErrorRate(t *testing.T) {
+	c := qt.New(t)
+	var count int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&count, 1)%4 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	result := qthttptest.AssertLoad(c, qthttptest.DoRequestParams{
+		Handler: handler,
+	}, qthttptest.LoadOpts{
+		Concurrency:  4,
+		Total:        40,
+		MaxErrorRate: 0.25,
+	})
+	c.Assert(result.Errors, qt.Equals, 10)
+
+	checkFails(c, `error rate 25.00% exceeds 10.00%; errors:\nunexpected status 500`, func(c *qt.C) {
+		qthttptest.AssertLoad(c, qthttptest.DoRequestParams{
+			Handler: handler,
+		}, qthttptest.LoadOpts{
+			Total:        40,
+			MaxErrorRate: 0.1,
+		})
+	})
+}
+
+func TestAssertLoadRequestOptions(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.TempDir(), "body.json")
+	err := ioutil.WriteFile(path, []byte(`{"n":2}`), 0666)
+	c.Assert(err, qt.Equals, nil)
+	var middleware, after int64
+	qthttptest.AssertLoad(c, qthttptest.DoRequestParams{
+		Method:       "POST",
+		URL:          "/items",
+		JSONBodyFile: path,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			c.Check(err, qt.Equals, nil)
+			c.Check(string(body), qt.Equals, `{"n":2}`)
+			c.Check(req.Header.Get("X-Before"), qt.Equals, "yes")
+		}),
+		BeforeRequest: func(c *qt.C, req *http.Request) {
+			req.Header.Set("X-Before", "yes")
+		},
+		AfterResponse: func(c *qt.C, resp *http.Response) {
+			atomic.AddInt64(&after, 1)
+		},
+		RequestMiddleware: []func(http.RoundTripper) http.RoundTripper{
+			func(rt http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					atomic.AddInt64(&middleware, 1)
+					return rt.RoundTrip(req)
+				})
+			},
+		},
+	}, qthttptest.LoadOpts{
+		Concurrency: 2,
+		Total:       10,
+	})
+	c.Assert(atomic.LoadInt64(&middleware), qt.Equals, int64(10))
+	c.Assert(atomic.LoadInt64(&after), qt.Equals, int64(10))
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// LongPollParams holds parameters for AssertLongPoll.
+type LongPollParams struct {
+	// JSONCallParams holds the call to make and the
+	// response that is expected once Trigger has been called.
+	JSONCallParams
+
+	// Trigger is called while the request is outstanding. It should
+	// cause the endpoint to respond, for example by publishing the
+	// event that the request is waiting for.
+	Trigger func(c *qt.C)
+
+	// Wait holds how long the response must be held back before
+	// Trigger is called. If it is zero, 100 milliseconds is used.
+	Wait time.Duration
+
+	// Timeout holds how long to wait for the response after Trigger
+	// is called. If it is zero, five seconds is used.
+	Timeout time.Duration
+}
+
+// AssertLongPoll asserts that the long-poll endpoint called as
+// described by p holds back its response until an event occurs. It
+// makes the call and asserts that no response arrives within p.Wait,
+// then calls p.Trigger and asserts that the response arrives within
+// p.Timeout. The response is then checked as for AssertJSONCall. It
+// returns the time between calling p.Trigger and receiving the
+// response header.
+//
+// The request is cancelled if the response does not arrive in time,
+// so the handler should return when its request context is done.
+func AssertLongPoll(c *qt.C, p LongPollParams) time.Duration {
+	c.Assert(p.Trigger, qt.Not(qt.IsNil), qt.Commentf("AssertLongPoll requires Trigger"))
+	if p.Wait == 0 {
+		p.Wait = 100 * time.Millisecond
+	}
+	if p.Timeout == 0 {
+		p.Timeout = 5 * time.Second
+	}
+	var latency time.Duration
+	mw := func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx, cancel := context.WithCancel(req.Context())
+			responded := false
+			defer func() {
+				// Abandon the request if it fails, including
+				// when Trigger or an assertion fails.
+				if !responded {
+					cancel()
+				}
+			}()
+			type result struct {
+				resp *http.Response
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp, err := rt.RoundTrip(req.WithContext(ctx))
+				done <- result{resp, err}
+			}()
+			select {
+			case r := <-done:
+				if r.err != nil {
+					return nil, r.err
+				}
+				r.resp.Body.Close()
+				c.Fatalf("response %q received before the trigger, less than %v after the request was sent", r.resp.Status, p.Wait)
+			case <-DefaultClock.After(p.Wait):
+			}
+			triggered := DefaultClock.Now()
+			p.Trigger(c)
+			select {
+			case r := <-done:
+				latency = DefaultClock.Now().Sub(triggered)
+				if r.err != nil {
+					return nil, r.err
+				}
+				// Keep the request context alive
+				// while the body is read.
+				responded = true
+				r.resp.Body = &cancelBody{r.resp.Body, cancel}
+				return r.resp, nil
+			case <-DefaultClock.After(p.Timeout):
+				c.Fatalf("no response within %v of the trigger", p.Timeout)
+			}
+			panic("unreachable")
+		})
+	}
+	p.RequestMiddleware = append(p.RequestMiddleware[:len(p.RequestMiddleware):len(p.RequestMiddleware)], mw)
+	AssertJSONCall(c, p.JSONCallParams)
+	return latency
+}
+
+// cancelBody calls cancel when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// eventHandler returns a handler that responds with the next event
+// sent on the returned channel, or immediately if the request has
+// the "now" query parameter.
+func eventHandler() (http.Handler, chan string) {
+	events := make(chan string, 1)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		event := "now"
+		if req.URL.Query().Get("now") == "" {
+			select {
+			case event = <-events:
+			case <-req.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"event": event})
+	}), events
+}
+
+func TestAssertLongPoll(t *testing.T) {
+	c := qt.New(t)
+	handler, events := eventHandler()
+	latency := qthttptest.AssertLongPoll(c, qthttptest.LongPollParams{
+		JSONCallParams: qthttptest.JSONCallParams{
+			Handler:    handler,
+			URL:        "/events",
+			ExpectBody: map[string]string{"event": "started"},
+		},
+		Trigger: func(c *qt.C) {
+			events <- "started"
+		},
+	})
+	c.Assert(latency < 5*time.Second, qt.Equals, true)
+}
+
+func TestAssertLongPollFailures(t *testing.T) {
+	c := qt.New(t)
+	handler, events := eventHandler()
+	checkFails(c, `response "200 OK" received before the trigger, less than 100ms after the request was sent`, func(c *qt.C) {
+		qthttptest.AssertLongPoll(c, qthttptest.LongPollParams{
+			JSONCallParams: qthttptest.JSONCallParams{
+				Handler: handler,
+				URL:     "/events?now=1",
+			},
+			Trigger: func(c *qt.C) {},
+		})
+	})
+	checkFails(c, `no response within 50ms of the trigger`, func(c *qt.C) {
+		qthttptest.AssertLongPoll(c, qthttptest.LongPollParams{
+			JSONCallParams: qthttptest.JSONCallParams{
+				Handler: handler,
+				URL:     "/events",
+			},
+			Wait:    10 * time.Millisecond,
+			Timeout: 50 * time.Millisecond,
+			Trigger: func(c *qt.C) {},
+		})
+	})
+	checkFails(c, `values are not deep equal`, func(c *qt.C) {
+		qthttptest.AssertLongPoll(c, qthttptest.LongPollParams{
+			JSONCallParams: qthttptest.JSONCallParams{
+				Handler:    handler,
+				URL:        "/events",
+				ExpectBody: map[string]string{"event": "started"},
+			},
+			Wait: 10 * time.Millisecond,
+			Trigger: func(c *qt.C) {
+				events <- "stopped"
+			},
+		})
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RequestMatcher checks whether a request matches some criterion.
+// It returns nil if the request matches, or an error
+// describing the mismatch otherwise.
+type RequestMatcher func(r RecordedRequest) error
+
+// MatchMethod returns a matcher that matches requests
+// with the given method.
+func MatchMethod(method string) RequestMatcher {
+	return func(r RecordedRequest) error {
+		if r.Method != method {
+			return fmt.Errorf("method %s does not match %s", r.Method, method)
+		}
+		return nil
+	}
+}
+
+// MatchPath returns a matcher that matches requests whose path
+// matches the given regular expression, which is anchored
+// at both ends.
+func MatchPath(pattern string) RequestMatcher {
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	return func(r RecordedRequest) error {
+		if !re.MatchString(r.URL.Path) {
+			return fmt.Errorf("path %q does not match %q", r.URL.Path, pattern)
+		}
+		return nil
+	}
+}
+
+// MatchQuery returns a matcher that matches requests with
+// a query parameter of the given name and value.
+func MatchQuery(name, value string) RequestMatcher {
+	return func(r RecordedRequest) error {
+		values, ok := r.URL.Query()[name]
+		if !ok {
+			return fmt.Errorf("no %q query parameter", name)
+		}
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("query parameter %q has value %q, not %q", name, values, value)
+	}
+}
+
+// MatchHeader returns a matcher that matches requests with a header
+// of the given name and value. If value is empty, any request
+// that has the header matches.
+func MatchHeader(name, value string) RequestMatcher {
+	return func(r RecordedRequest) error {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return fmt.Errorf("no %s header", name)
+		}
+		if value == "" {
+			return nil
+		}
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s header has value %q, not %q", name, values, value)
+	}
+}
+
+// MatchJSONBody returns a matcher that matches requests with a
+// JSON body equal to expect. As with JSONEquals, expect is
+// marshaled to JSON and unmarshaled again before comparison.
+func MatchJSONBody(expect interface{}) RequestMatcher {
+	return func(r RecordedRequest) error {
+		var got interface{}
+		if err := json.Unmarshal(r.Body, &got); err != nil {
+			return fmt.Errorf("body %q is not valid JSON: %v", r.Body, err)
+		}
+		want, err := normalizeJSON(expect)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("body %s does not match %s", r.Body, jsonString(want))
+		}
+		return nil
+	}
+}
+
+// MatchJSONSubset returns a matcher that matches requests with a JSON
+// body containing expect. Objects in the body may have members
+// that are not in the corresponding objects in expect; all
+// other values, including array lengths, must be equal.
+func MatchJSONSubset(expect interface{}) RequestMatcher {
+	return func(r RecordedRequest) error {
+		var got interface{}
+		if err := json.Unmarshal(r.Body, &got); err != nil {
+			return fmt.Errorf("body %q is not valid JSON: %v", r.Body, err)
+		}
+		want, err := normalizeJSON(expect)
+		if err != nil {
+			return err
+		}
+		if err := jsonSubset(got, want, ""); err != nil {
+			return fmt.Errorf("body %s does not match: %v", r.Body, err)
+		}
+		return nil
+	}
+}
+
+// MatchAll returns a matcher that matches
+// requests matching all the given matchers.
+func MatchAll(ms ...RequestMatcher) RequestMatcher {
+	return func(r RecordedRequest) error {
+		for _, m := range ms {
+			if err := m(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// MatchAny returns a matcher that matches requests
+// matching any of the given matchers.
+func MatchAny(ms ...RequestMatcher) RequestMatcher {
+	return func(r RecordedRequest) error {
+		var errs []string
+		for _, m := range ms {
+			err := m(r)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("no alternative matches: %s", strings.Join(errs, "; "))
+	}
+}
+
+// normalizeJSON returns x as it would be
+// unmarshaled into an interface{} value.
+func normalizeJSON(x interface{}) (interface{}, error) {
+	data, err := json.Marshal(x)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal expected value: %v", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// jsonSubset returns an error if got does not contain want,
+// as described for MatchJSONSubset. The path holds the
+// location of the values within the document.
+func jsonSubset(got, want interface{}, path string) error {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		obj, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: got %s, want object", jsonPathString(path), jsonString(got))
+		}
+		keys := make([]string, 0, len(want))
+		for k := range want {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			gv, ok := obj[k]
+			if !ok {
+				return fmt.Errorf("%s: missing member %q", jsonPathString(path), k)
+			}
+			if err := jsonSubset(gv, want[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		arr, ok := got.([]interface{})
+		if !ok || len(arr) != len(want) {
+			return fmt.Errorf("%s: got %s, want array of length %d", jsonPathString(path), jsonString(got), len(want))
+		}
+		for i := range want {
+			if err := jsonSubset(arr[i], want[i], fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("%s: got %s, want %s", jsonPathString(path), jsonString(got), jsonString(want))
+	}
+	return nil
+}
+
+func jsonPathString(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+func jsonString(x interface{}) string {
+	data, _ := json.Marshal(x)
+	return string(data)
+}
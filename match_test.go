@@ -0,0 +1,169 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var matchTests = []struct {
+	about       string
+	matcher     qthttptest.RequestMatcher
+	expectError string
+}{{
+	about:   "method",
+	matcher: qthttptest.MatchMethod("POST"),
+}, {
+	about:       "method mismatch",
+	matcher:     qthttptest.MatchMethod("PUT"),
+	expectError: `method POST does not match PUT`,
+}, {
+	about:   "path",
+	matcher: qthttptest.MatchPath(`/users/[a-z]+`),
+}, {
+	about:       "path is anchored",
+	matcher:     qthttptest.MatchPath(`/users`),
+	expectError: `path "/users/bob" does not match "/users"`,
+}, {
+	about:   "query",
+	matcher: qthttptest.MatchQuery("tag", "b"),
+}, {
+	about:       "query mismatch",
+	matcher:     qthttptest.MatchQuery("tag", "c"),
+	expectError: `query parameter "tag" has value \["a" "b"\], not "c"`,
+}, {
+	about:       "query missing",
+	matcher:     qthttptest.MatchQuery("x", ""),
+	expectError: `no "x" query parameter`,
+}, {
+	about:   "header present",
+	matcher: qthttptest.MatchHeader("authorization", ""),
+}, {
+	about:   "header value",
+	matcher: qthttptest.MatchHeader("Content-Type", "application/json"),
+}, {
+	about:       "header mismatch",
+	matcher:     qthttptest.MatchHeader("Content-Type", "text/plain"),
+	expectError: `Content-Type header has value \["application/json"\], not "text/plain"`,
+}, {
+	about:       "header missing",
+	matcher:     qthttptest.MatchHeader("X-Foo", ""),
+	expectError: `no X-Foo header`,
+}, {
+	about: "json body",
+	matcher: qthttptest.MatchJSONBody(map[string]interface{}{
+		"name": "bob",
+		"age":  42,
+		"tags": []string{"x", "y"},
+		"address": map[string]string{
+			"city": "London",
+			"zip":  "N1",
+		},
+	}),
+}, {
+	about: "json body mismatch",
+	matcher: qthttptest.MatchJSONBody(map[string]interface{}{
+		"name": "bob",
+	}),
+	expectError: `body .* does not match {"name":"bob"}`,
+}, {
+	about: "json subset",
+	matcher: qthttptest.MatchJSONSubset(map[string]interface{}{
+		"name": "bob",
+		"tags": []string{"x", "y"},
+		"address": map[string]string{
+			"city": "London",
+		},
+	}),
+}, {
+	about: "json subset value mismatch",
+	matcher: qthttptest.MatchJSONSubset(map[string]interface{}{
+		"address": map[string]string{
+			"city": "Paris",
+		},
+	}),
+	expectError: `body .* does not match: .address.city: got "London", want "Paris"`,
+}, {
+	about: "json subset missing member",
+	matcher: qthttptest.MatchJSONSubset(map[string]interface{}{
+		"email": "bob@example.com",
+	}),
+	expectError: `body .* does not match: .: missing member "email"`,
+}, {
+	about: "json subset array length",
+	matcher: qthttptest.MatchJSONSubset(map[string]interface{}{
+		"tags": []string{"x"},
+	}),
+	expectError: `body .* does not match: .tags: got \["x","y"\], want array of length 1`,
+}, {
+	about: "all",
+	matcher: qthttptest.MatchAll(
+		qthttptest.MatchMethod("POST"),
+		qthttptest.MatchQuery("tag", "a"),
+	),
+}, {
+	about: "all mismatch",
+	matcher: qthttptest.MatchAll(
+		qthttptest.MatchMethod("POST"),
+		qthttptest.MatchQuery("tag", "c"),
+	),
+	expectError: `query parameter "tag" has value \["a" "b"\], not "c"`,
+}, {
+	about: "any",
+	matcher: qthttptest.MatchAny(
+		qthttptest.MatchMethod("GET"),
+		qthttptest.MatchMethod("POST"),
+	),
+}, {
+	about: "any mismatch",
+	matcher: qthttptest.MatchAny(
+		qthttptest.MatchMethod("GET"),
+		qthttptest.MatchMethod("PUT"),
+	),
+	expectError: `no alternative matches: method POST does not match GET; method POST does not match PUT`,
+}}
+
+func TestRequestMatchers(t *testing.T) {
+	c := qt.New(t)
+	r := qthttptest.RecordedRequest{
+		Method: "POST",
+		URL: &url.URL{
+			Path:     "/users/bob",
+			RawQuery: "tag=a&tag=b",
+		},
+		Header: http.Header{
+			"Authorization": {"Bearer xxx"},
+			"Content-Type":  {"application/json"},
+		},
+		Body: []byte(`{"name":"bob","age":42,"tags":["x","y"],"address":{"city":"London","zip":"N1"}}`),
+	}
+	for _, test := range matchTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			err := test.matcher(r)
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+			} else {
+				c.Assert(err, qt.Equals, nil)
+			}
+		})
+	}
+}
+
+func TestMatchJSONInvalidBody(t *testing.T) {
+	c := qt.New(t)
+	r := qthttptest.RecordedRequest{
+		Body: []byte("not json"),
+	}
+	err := qthttptest.MatchJSONBody(nil)(r)
+	c.Assert(err, qt.ErrorMatches, `body "not json" is not valid JSON: .*`)
+	err = qthttptest.MatchJSONSubset(nil)(r)
+	c.Assert(err, qt.ErrorMatches, `body "not json" is not valid JSON: .*`)
+}
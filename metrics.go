@@ -0,0 +1,246 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// MetricSample holds a single sample parsed from
+// the Prometheus text exposition format.
+type MetricSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// String returns the sample in exposition format, with
+// the labels sorted by name.
+func (s MetricSample) String() string {
+	return seriesString(s.Name, s.Labels) + " " + strconv.FormatFloat(s.Value, 'g', -1, 64)
+}
+
+// Metrics holds the samples scraped from a metrics endpoint.
+type Metrics []MetricSample
+
+// ScrapeMetrics makes the request described by p, which should
+// return metrics in the Prometheus text exposition format, and
+// returns the parsed metrics. If p.URL is empty, "/metrics" is used.
+// The ExpectError field is ignored.
+func ScrapeMetrics(c *qt.C, p DoRequestParams) Metrics {
+	if p.URL == "" {
+		p.URL = "/metrics"
+	}
+	p.ExpectError = ""
+	resp := DoResponse(c, p)
+	resp.AssertStatus(c, http.StatusOK)
+	m, err := ParseMetrics(bytes.NewReader(resp.Body))
+	c.Assert(err, qt.Equals, nil)
+	return m
+}
+
+// ParseMetrics parses metrics in the Prometheus text exposition format.
+// Comments, including HELP and TYPE lines, are ignored.
+func ParseMetrics(r io.Reader) (Metrics, error) {
+	var m Metrics
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		name, labels, rest, err := parseSeries(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected value and optional timestamp after %q", line, name)
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", line, fields[0])
+		}
+		m = append(m, MetricSample{
+			Name:   name,
+			Labels: labels,
+			Value:  v,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Select returns all the samples that match the given selector,
+// which is a metric name optionally followed by labels in braces,
+// for example `http_requests_total{code="500"}`. A sample matches
+// if it has the given name and all the given labels; it may
+// have other labels too.
+func (m Metrics) Select(c *qt.C, selector string) Metrics {
+	name, labels, rest, err := parseSeries(selector)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("invalid selector %q", selector))
+	c.Assert(strings.TrimSpace(rest), qt.Equals, "", qt.Commentf("invalid selector %q", selector))
+	var selected Metrics
+	for _, s := range m {
+		if s.Name == name && labelsMatch(s.Labels, labels) {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+// Sum returns the sum of the values of all the samples that
+// match the given selector, as described for Select. It returns
+// zero if no samples match, as is the case for a counter that has
+// not yet been incremented.
+func (m Metrics) Sum(c *qt.C, selector string) float64 {
+	total := 0.0
+	for _, s := range m.Select(c, selector) {
+		total += s.Value
+	}
+	return total
+}
+
+// AssertMetric asserts that the sum of the samples in m
+// matching the given selector is equal to value.
+func AssertMetric(c *qt.C, m Metrics, selector string, value float64) {
+	c.Assert(m.Sum(c, selector), qt.Equals, value, qt.Commentf("metric %s; matching samples:%s", selector, m.Select(c, selector).list()))
+}
+
+// AssertMetricDelta asserts that the sum of the samples
+// matching the given selector has changed by delta
+// between the before and after metrics.
+func AssertMetricDelta(c *qt.C, before, after Metrics, selector string, delta float64) {
+	got := after.Sum(c, selector) - before.Sum(c, selector)
+	c.Assert(got, qt.Equals, delta, qt.Commentf("change in metric %s; samples before:%s\nsamples after:%s", selector, before.Select(c, selector).list(), after.Select(c, selector).list()))
+}
+
+func (m Metrics) list() string {
+	if len(m) == 0 {
+		return " none"
+	}
+	var buf strings.Builder
+	for _, s := range m {
+		buf.WriteString("\n  ")
+		buf.WriteString(s.String())
+	}
+	return buf.String()
+}
+
+// labelsMatch reports whether labels
+// contains all the labels in want.
+func labelsMatch(labels, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSeries parses a metric name followed by optional labels in
+// braces at the start of s, and returns them with the rest of s.
+func parseSeries(s string) (name string, labels map[string]string, rest string, err error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !isMetricNameChar(r)
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	if i == 0 {
+		return "", nil, "", fmt.Errorf("invalid metric name in %q", s)
+	}
+	name, s = s[:i], s[i:]
+	labels = make(map[string]string)
+	if s == "" || s[0] != '{' {
+		return name, labels, s, nil
+	}
+	s = s[1:]
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return "", nil, "", fmt.Errorf("unterminated labels for %q", name)
+		}
+		if s[0] == '}' {
+			return name, labels, s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			return "", nil, "", fmt.Errorf("expected '=' in labels for %q", name)
+		}
+		label := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return "", nil, "", fmt.Errorf("expected quoted value for label %q of %q", label, name)
+		}
+		val, n, ok := parseLabelValue(s)
+		if !ok {
+			return "", nil, "", fmt.Errorf("unterminated value for label %q of %q", label, name)
+		}
+		labels[label] = val
+		s = strings.TrimLeft(s[n:], " \t")
+		if s != "" && s[0] == ',' {
+			s = s[1:]
+		}
+	}
+}
+
+// parseLabelValue parses the quoted label value at the start of s,
+// returning the unescaped value and the number of bytes consumed.
+func parseLabelValue(s string) (string, int, bool) {
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, false
+			}
+			if s[i] == 'n' {
+				buf.WriteByte('\n')
+			} else {
+				buf.WriteByte(s[i])
+			}
+		case '"':
+			return buf.String(), i + 1, true
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
+
+func isMetricNameChar(r rune) bool {
+	return r == '_' || r == ':' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// seriesString returns the series with the given name
+// and labels in exposition format.
+func seriesString(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, k := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts[i] = k + `="` + v + `"`
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// instrumentedHandler is a handler that counts requests by method and
+// status, serving the counts in exposition format on /metrics.
+type instrumentedHandler struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (h *instrumentedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if req.URL.Path == "/metrics" {
+		fmt.Fprintln(w, "# HELP http_requests_total Total requests.")
+		fmt.Fprintln(w, "# TYPE http_requests_total counter")
+		var series []string
+		for k := range h.counts {
+			series = append(series, k)
+		}
+		sort.Strings(series)
+		for _, k := range series {
+			fmt.Fprintf(w, "http_requests_total{%s} %d\n", k, h.counts[k])
+		}
+		return
+	}
+	code := http.StatusOK
+	if req.URL.Path == "/fail" {
+		code = http.StatusInternalServerError
+	}
+	if h.counts == nil {
+		h.counts = make(map[string]int)
+	}
+	h.counts[fmt.Sprintf(`code="%d",method="%s"`, code, req.Method)]++
+	w.WriteHeader(code)
+}
+
+func TestMetricDelta(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, &instrumentedHandler{})
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/ok",
+	})
+	before := qthttptest.ScrapeMetrics(c, srv.DoRequestParams(qthttptest.DoRequestParams{}))
+	qthttptest.AssertMetric(c, before, `http_requests_total`, 1)
+	qthttptest.AssertMetric(c, before, `http_requests_total{code="500"}`, 0)
+
+	for _, method := range []string{"GET", "POST"} {
+		srv.DoRequest(c, qthttptest.DoRequestParams{
+			Method: method,
+			URL:    "/fail",
+		})
+	}
+	after := qthttptest.ScrapeMetrics(c, srv.DoRequestParams(qthttptest.DoRequestParams{}))
+	qthttptest.AssertMetricDelta(c, before, after, `http_requests_total{code="500"}`, 2)
+	qthttptest.AssertMetricDelta(c, before, after, `http_requests_total{code="500",method="POST"}`, 1)
+	qthttptest.AssertMetricDelta(c, before, after, `http_requests_total{code="200"}`, 0)
+
+	checkFails(c, `change in metric http_requests_total{code="500"}; samples before: none
+  samples after:
+    http_requests_total{code="500",method="GET"} 1
+    http_requests_total{code="500",method="POST"} 1
+got:
+  float64\(2\)
+want:
+  float64\(1\)`, func(c *qt.C) {
+		qthttptest.AssertMetricDelta(c, before, after, `http_requests_total{code="500"}`, 1)
+	})
+	checkFails(c, `invalid selector "{code=\\"500\\"}"`, func(c *qt.C) {
+		after.Sum(c, `{code="500"}`)
+	})
+}
+
+func TestScrapeMetricsIgnoresExpectError(t *testing.T) {
+	c := qt.New(t)
+	m := qthttptest.ScrapeMetrics(c, qthttptest.DoRequestParams{
+		Handler:     &instrumentedHandler{},
+		ExpectError: "some error",
+	})
+	qthttptest.AssertMetric(c, m, `http_requests_total`, 0)
+}
+
+var parseMetricsTests = []struct {
+	about       string
+	text        string
+	expect      []string
+	expectError string
+}{{
+	about: "simple",
+	text: `
+# HELP go_goroutines Number of goroutines.
+# TYPE go_goroutines gauge
+go_goroutines 12
+process_start_time_seconds 1.6e+09 1600000000000
+`,
+	expect: []string{
+		"go_goroutines 12",
+		"process_start_time_seconds 1.6e+09",
+	},
+}, {
+	about: "labels",
+	text: `
+http_request_duration_seconds_bucket{le="0.1", path="/a\\b\"c\n",} 3
+http_request_duration_seconds_bucket{le="+Inf",path="/"} 5
+`,
+	expect: []string{
+		`http_request_duration_seconds_bucket{le="0.1",path="/a\\b\"c\n"} 3`,
+		`http_request_duration_seconds_bucket{le="+Inf",path="/"} 5`,
+	},
+}, {
+	about: "special values",
+	text: `
+a NaN
+b +Inf
+c -Inf
+`,
+	expect: []string{
+		"a NaN",
+		"b +Inf",
+		"c -Inf",
+	},
+}, {
+	about:       "missing value",
+	text:        "\nfoo{a=\"b\"}\n",
+	expectError: `line 2: expected value and optional timestamp after "foo"`,
+}, {
+	about:       "invalid value",
+	text:        "foo bar",
+	expectError: `line 1: invalid value "bar"`,
+}, {
+	about:       "unquoted label",
+	text:        "foo{a=b} 1",
+	expectError: `line 1: expected quoted value for label "a" of "foo"`,
+}, {
+	about:       "unterminated labels",
+	text:        `foo{a="b" 1`,
+	expectError: `line 1: expected '=' in labels for "foo"`,
+}}
+
+func TestParseMetrics(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parseMetricsTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			m, err := qthttptest.ParseMetrics(strings.NewReader(test.text))
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+				return
+			}
+			c.Assert(err, qt.Equals, nil)
+			var got []string
+			for _, s := range m {
+				got = append(got, s.String())
+			}
+			c.Assert(got, qt.DeepEquals, test.expect)
+		})
+	}
+}
+
+func TestMetricsSelect(t *testing.T) {
+	c := qt.New(t)
+	m, err := qthttptest.ParseMetrics(strings.NewReader(`
+up 1
+rpc_calls{service="a",code="ok"} 3
+rpc_calls{service="b",code="ok"} 4
+rpc_calls{service="b",code="error"} 1
+`))
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(m.Select(c, `rpc_calls{service="b"}`), qt.HasLen, 2)
+	c.Assert(m.Sum(c, `rpc_calls`), qt.Equals, 8.0)
+	c.Assert(m.Sum(c, `rpc_calls{code="ok"}`), qt.Equals, 7.0)
+	c.Assert(m.Sum(c, `rpc_calls{code="ok",service="b"}`), qt.Equals, 4.0)
+	c.Assert(m.Sum(c, `rpc_calls{code="unknown"}`), qt.Equals, 0.0)
+	c.Assert(m.Sum(c, `up{}`), qt.Equals, 1.0)
+	c.Assert(math.IsNaN(qthttptest.Metrics{{Name: "x", Value: math.NaN()}}.Sum(c, "x")), qt.Equals, true)
+}
@@ -0,0 +1,306 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// MockServer is a stub HTTP server that responds to requests
+// with canned responses according to a set of expectations.
+// Requests that match no expectation receive a 404 response.
+//
+// When the test completes, it fails if any expectation
+// that is not optional was never matched.
+type MockServer struct {
+	*Server
+
+	c *qt.C
+	p MockServerParams
+
+	mu           sync.Mutex
+	expectations []*mockExpectation
+	requests     []RecordedRequest
+}
+
+// MockServerParams holds parameters for NewMockServer.
+type MockServerParams struct {
+	// Strict specifies that any request that matches no
+	// expectation fails the test immediately, showing the
+	// request. The request still receives a 404 response.
+	Strict bool
+}
+
+// MockExpectation describes a request expected by a MockServer
+// and the response to send when it is received.
+type MockExpectation struct {
+	// Method holds the expected request method.
+	// If it is empty, any method matches.
+	Method string
+
+	// Path holds the expected request path. A path segment of the
+	// form {name} matches any single non-empty segment and makes
+	// its value available to the response template as a path
+	// parameter. A final segment of the form {name...} matches
+	// the rest of the path. If it is empty, any path matches.
+	Path string
+
+	// Match holds additional matchers that
+	// the request must satisfy.
+	Match []RequestMatcher
+
+	// Response holds the response to send.
+	Response MockResponse
+
+	// Optional specifies that the expectation
+	// need not be matched by any request.
+	Optional bool
+}
+
+// MockResponse holds a canned response sent by a MockServer.
+type MockResponse struct {
+	// Status holds the response status.
+	// If it is zero, http.StatusOK is used.
+	Status int
+
+	// Header holds the response headers.
+	Header http.Header
+
+	// Body holds the response body. It is a text/template template
+	// executed with a MockRequest describing the request, so for
+	// example {{.Params.id}} expands to the id path parameter and
+	// {{.Header.Get "X-Request-Id"}} expands to a request header.
+	Body string
+}
+
+// MockRequest holds the request values available to
+// MockResponse.Body templates.
+type MockRequest struct {
+	Method string
+	Path   string
+
+	// Params holds the path parameters matched
+	// by the expectation's path pattern.
+	Params map[string]string
+
+	Query  url.Values
+	Header http.Header
+
+	// Body holds the request body.
+	Body string
+
+	// BodySHA256 holds the hex-encoded SHA-256
+	// hash of the request body.
+	BodySHA256 string
+
+	// JSON holds the request body decoded as JSON,
+	// or nil if it is not valid JSON.
+	JSON interface{}
+}
+
+type mockExpectation struct {
+	MockExpectation
+	body *template.Template
+
+	// matched holds the number of requests that
+	// have matched the expectation.
+	matched int
+}
+
+// spec returns the request spec that the expectation matches.
+func (e *mockExpectation) spec() RequestSpec {
+	return RequestSpec{
+		Method: e.Method,
+		Path:   e.Path,
+		Match:  e.Match,
+	}
+}
+
+// NewMockServer starts a new mock server with no expectations
+// which is shut down when the test completes, at which point
+// AssertExpectationsMet is called.
+func NewMockServer(c *qt.C, p MockServerParams) *MockServer {
+	s := &MockServer{
+		c: c,
+		p: p,
+	}
+	s.Server = NewServer(c, http.HandlerFunc(s.serveHTTP))
+	c.Cleanup(func() {
+		s.AssertExpectationsMet(c)
+	})
+	return s
+}
+
+// AssertExpectationsMet asserts that every expectation that is not
+// optional has been matched by at least one request. For each unmet
+// expectation, the failure shows the request received that came
+// closest to matching it, if any.
+func (s *MockServer) AssertExpectationsMet(c *qt.C) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unmet []string
+	for _, e := range s.expectations {
+		if e.matched > 0 || e.Optional {
+			continue
+		}
+		msg := "\n  " + e.spec().String()
+		if r, errs := e.closest(s.requests); errs != nil {
+			msg += fmt.Sprintf("\n    closest request: %s %s", r.Method, r.URL)
+			for _, err := range errs {
+				msg += "\n      " + err.Error()
+			}
+		} else {
+			msg += "\n    no requests received"
+		}
+		unmet = append(unmet, msg)
+	}
+	if len(unmet) > 0 {
+		c.Errorf("unmet mock expectations:%s", strings.Join(unmet, ""))
+	}
+}
+
+// Expect adds an expectation to the server. When more than one
+// expectation matches a request, the one added first is used.
+func (s *MockServer) Expect(c *qt.C, e MockExpectation) {
+	tmpl, err := template.New("").Option("missingkey=zero").Parse(e.Response.Body)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("invalid response body template for %s %s", e.Method, e.Path))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = append(s.expectations, &mockExpectation{
+		MockExpectation: e,
+		body:            tmpl,
+	})
+}
+
+func (s *MockServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r, err := recordRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+	e, params := s.match(r)
+	if e == nil {
+		if s.p.Strict {
+			dump, err := httputil.DumpRequest(req, true)
+			if err != nil {
+				dump = []byte(err.Error())
+			}
+			s.c.Errorf("mock server received unexpected request:\n%s", dump)
+		}
+		http.Error(w, fmt.Sprintf("no expectation matches %s %s", r.Method, r.URL.Path), http.StatusNotFound)
+		return
+	}
+	sum := sha256.Sum256(r.Body)
+	mr := MockRequest{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Params:     params,
+		Query:      r.URL.Query(),
+		Header:     r.Header,
+		Body:       string(r.Body),
+		BodySHA256: hex.EncodeToString(sum[:]),
+	}
+	if err := json.Unmarshal(r.Body, &mr.JSON); err != nil {
+		mr.JSON = nil
+	}
+	var body bytes.Buffer
+	if err := e.body.Execute(&body, mr); err != nil {
+		http.Error(w, fmt.Sprintf("cannot execute response body template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for k, v := range e.Response.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	status := e.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
+// match returns the first expectation that matches r,
+// along with the path parameters it matched.
+func (s *MockServer) match(r RecordedRequest) (*mockExpectation, map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.expectations {
+		if params, errs := e.spec().mismatches(r); len(errs) == 0 {
+			e.matched++
+			return e, params
+		}
+	}
+	return nil, nil
+}
+
+// closest returns the request that came closest to matching
+// the expectation, with the fewest mismatches, along with
+// the reasons it did not match. It returns a nil slice if
+// there are no requests.
+func (e *mockExpectation) closest(requests []RecordedRequest) (RecordedRequest, []error) {
+	var best RecordedRequest
+	var bestErrs []error
+	found := false
+	for _, r := range requests {
+		_, errs := e.spec().mismatches(r)
+		if len(errs) == 0 {
+			return r, []error{errors.New("request was matched by an earlier expectation")}
+		}
+		if !found || len(errs) < len(bestErrs) {
+			best, bestErrs, found = r, errs, true
+		}
+	}
+	return best, bestErrs
+}
+
+// matchPath reports whether path matches the given pattern,
+// as described for MockExpectation.Path, and returns
+// any path parameters.
+func matchPath(pattern, path string) (map[string]string, bool) {
+	params := make(map[string]string)
+	if pattern == "" {
+		return params, true
+	}
+	pparts := strings.Split(pattern, "/")
+	parts := strings.Split(path, "/")
+	for i, pp := range pparts {
+		if strings.HasPrefix(pp, "{") && strings.HasSuffix(pp, "...}") && i == len(pparts)-1 {
+			params[pp[1:len(pp)-len("...}")]] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		if strings.HasPrefix(pp, "{") && strings.HasSuffix(pp, "}") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[pp[1:len(pp)-1]] = parts[i]
+			continue
+		}
+		if pp != parts[i] {
+			return nil, false
+		}
+	}
+	if len(parts) != len(pparts) {
+		return nil, false
+	}
+	return params, true
+}
@@ -0,0 +1,309 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var mockServerTests = []struct {
+	about        string
+	expect       qthttptest.MockExpectation
+	req          qthttptest.DoRequestParams
+	reqBody      string
+	expectStatus int
+	expectBody   string
+}{{
+	about: "literal body",
+	expect: qthttptest.MockExpectation{
+		Method: "GET",
+		Path:   "/hello",
+		Response: qthttptest.MockResponse{
+			Body: "hello",
+		},
+	},
+	req: qthttptest.DoRequestParams{
+		URL: "/hello",
+	},
+	expectStatus: http.StatusOK,
+	expectBody:   "hello",
+}, {
+	about: "path parameters",
+	expect: qthttptest.MockExpectation{
+		Path: "/users/{id}/posts/{post}",
+		Response: qthttptest.MockResponse{
+			Status: http.StatusCreated,
+			Body:   `{"user": "{{.Params.id}}", "post": "{{.Params.post}}"}`,
+		},
+	},
+	req: qthttptest.DoRequestParams{
+		Method: "PUT",
+		URL:    "/users/bob/posts/42",
+	},
+	expectStatus: http.StatusCreated,
+	expectBody:   `{"user": "bob", "post": "42"}`,
+}, {
+	about: "rest of path",
+	expect: qthttptest.MockExpectation{
+		Path: "/files/{path...}",
+		Response: qthttptest.MockResponse{
+			Body: "{{.Params.path}}",
+		},
+	},
+	req: qthttptest.DoRequestParams{
+		URL: "/files/a/b/c.txt",
+	},
+	expectStatus: http.StatusOK,
+	expectBody:   "a/b/c.txt",
+}, {
+	about: "request values",
+	expect: qthttptest.MockExpectation{
+		Method: "POST",
+		Path:   "/echo",
+		Response: qthttptest.MockResponse{
+			Body: `{{.Method}} {{.Path}} {{.Query.Get "q"}} {{.Header.Get "X-Foo"}} {{.JSON.name}} {{.BodySHA256}}`,
+		},
+	},
+	req: qthttptest.DoRequestParams{
+		Method: "POST",
+		URL:    "/echo?q=search",
+		Header: http.Header{
+			"X-Foo": {"bar"},
+		},
+	},
+	reqBody:      `{"name":"alice"}`,
+	expectStatus: http.StatusOK,
+	expectBody:   `POST /echo search bar alice 3b8f02c64624e355de637e609642b441ab1427b619d9fb91cb6c7b0e8f8ceed1`,
+}, {
+	about: "method mismatch",
+	expect: qthttptest.MockExpectation{
+		Method:   "POST",
+		Path:     "/hello",
+		Optional: true,
+	},
+	req: qthttptest.DoRequestParams{
+		URL: "/hello",
+	},
+	expectStatus: http.StatusNotFound,
+	expectBody:   "no expectation matches GET /hello\n",
+}, {
+	about: "path mismatch",
+	expect: qthttptest.MockExpectation{
+		Path:     "/users/{id}",
+		Optional: true,
+	},
+	req: qthttptest.DoRequestParams{
+		URL: "/users/bob/posts",
+	},
+	expectStatus: http.StatusNotFound,
+	expectBody:   "no expectation matches GET /users/bob/posts\n",
+}, {
+	about: "empty parameter",
+	expect: qthttptest.MockExpectation{
+		Path:     "/users/{id}",
+		Optional: true,
+	},
+	req: qthttptest.DoRequestParams{
+		URL: "/users/",
+	},
+	expectStatus: http.StatusNotFound,
+	expectBody:   "no expectation matches GET /users/\n",
+}}
+
+func TestMockServer(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range mockServerTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+			srv.Expect(c, test.expect)
+			if test.reqBody != "" {
+				test.req.Body = strings.NewReader(test.reqBody)
+			}
+			resp := qthttptest.DoResponse(c, srv.DoRequestParams(test.req))
+			resp.AssertStatus(c, test.expectStatus)
+			c.Assert(string(resp.Body), qt.Equals, test.expectBody)
+		})
+	}
+}
+
+func TestMockServerFirstMatchWins(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+	srv.Expect(c, qthttptest.MockExpectation{
+		Path: "/users/admin",
+		Response: qthttptest.MockResponse{
+			Header: http.Header{
+				"Content-Type": {"text/plain"},
+			},
+			Body: "admin",
+		},
+	})
+	srv.Expect(c, qthttptest.MockExpectation{
+		Path: "/users/{id}",
+		Response: qthttptest.MockResponse{
+			Body: "user {{.Params.id}}",
+		},
+	})
+	resp := qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+		URL: "/users/admin",
+	}))
+	c.Assert(string(resp.Body), qt.Equals, "admin")
+	c.Assert(resp.Response.Header.Get("Content-Type"), qt.Equals, "text/plain")
+	resp = qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+		URL: "/users/bob",
+	}))
+	c.Assert(string(resp.Body), qt.Equals, "user bob")
+}
+
+func TestMockServerInvalidTemplate(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+	checkFails(c, `invalid response body template for GET /foo`, func(c *qt.C) {
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "GET",
+			Path:   "/foo",
+			Response: qthttptest.MockResponse{
+				Body: "{{.Params.id",
+			},
+		})
+	})
+}
+
+func TestMockServerMatchers(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+	srv.Expect(c, qthttptest.MockExpectation{
+		Method: "POST",
+		Match: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath(`/orders/[0-9]+`),
+			qthttptest.MatchJSONSubset(map[string]interface{}{
+				"status": "paid",
+			}),
+		},
+		Response: qthttptest.MockResponse{
+			Body: "paid",
+		},
+	})
+	srv.Expect(c, qthttptest.MockExpectation{
+		Method: "POST",
+		Match: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath(`/orders/[0-9]+`),
+		},
+		Response: qthttptest.MockResponse{
+			Body: "other",
+		},
+	})
+	call := func(path, body string) *qthttptest.Resp {
+		return qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+			Method: "POST",
+			URL:    path,
+			Body:   strings.NewReader(body),
+		}))
+	}
+	c.Assert(string(call("/orders/1", `{"id":1,"status":"paid"}`).Body), qt.Equals, "paid")
+	c.Assert(string(call("/orders/1", `{"id":1,"status":"open"}`).Body), qt.Equals, "other")
+	call("/orders/x", `{}`).AssertStatus(c, http.StatusNotFound)
+}
+
+func TestMockServerAssertExpectationsMet(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `unmet mock expectations:
+  POST /users/{id} \(with matchers\)
+    closest request: POST /users/bob
+      no X-Token header
+  DELETE \*
+    closest request: GET /users/bob
+      method GET does not match DELETE
+  GET /other
+    closest request: GET /other
+      request was matched by an earlier expectation`, func(c *qt.C) {
+		srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "GET",
+			Path:   "/users/{id}",
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "POST",
+			Path:   "/users/{id}",
+			Match: []qthttptest.RequestMatcher{
+				qthttptest.MatchHeader("X-Token", ""),
+			},
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "DELETE",
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Path: "/other",
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "GET",
+			Path:   "/other",
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method:   "PUT",
+			Optional: true,
+		})
+		for _, p := range []qthttptest.DoRequestParams{{
+			URL: "/users/bob",
+		}, {
+			Method: "POST",
+			URL:    "/users/bob",
+		}, {
+			URL: "/other",
+		}} {
+			srv.DoRequest(c, p)
+		}
+		srv.AssertExpectationsMet(c)
+	})
+}
+
+func TestMockServerNoRequests(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `unmet mock expectations:
+  GET /foo
+    no requests received`, func(c *qt.C) {
+		srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Method: "GET",
+			Path:   "/foo",
+		})
+		srv.AssertExpectationsMet(c)
+	})
+}
+
+func TestMockServerStrict(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `mock server received unexpected request:
+POST /bar HTTP/1.1\r
+Host: .*\r
+.*X-Foo: foo\r
+\r
+hello`, func(c *qt.C) {
+		srv := qthttptest.NewMockServer(c, qthttptest.MockServerParams{
+			Strict: true,
+		})
+		srv.Expect(c, qthttptest.MockExpectation{
+			Path: "/foo",
+		})
+		srv.DoRequest(c, qthttptest.DoRequestParams{
+			URL: "/foo",
+		})
+		resp := qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+			Method: "POST",
+			URL:    "/bar",
+			Header: http.Header{
+				"X-Foo": {"foo"},
+			},
+			Body: strings.NewReader("hello"),
+		}))
+		resp.AssertStatus(c, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONNormalizer returns a function suitable for
+// JSONCallParams.NormalizeBody that unmarshals the body as JSON,
+// calls f with the resulting value and marshals the value that f
+// returns. Objects are unmarshaled as map[string]interface{} and
+// arrays as []interface{}, so f can, for example, replace a
+// generated identifier with a fixed value or sort an array whose
+// order is unspecified. If the body is not valid JSON, it is
+// returned unchanged so that the usual checks report the error.
+func JSONNormalizer(f func(v interface{}) interface{}) func(body []byte) []byte {
+	return func(body []byte) []byte {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return body
+		}
+		data, err := json.Marshal(f(v))
+		if err != nil {
+			panic(fmt.Errorf("cannot marshal normalized body: %v", err))
+		}
+		return data
+	}
+}
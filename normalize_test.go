@@ -0,0 +1,83 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// volatileHandler responds with a generated id
+// and an array in no particular order.
+var volatileHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id": "id-%d", "tags": ["b", "c", "a"]}`, time.Now().UnixNano())
+})
+
+func normalizeVolatile(v interface{}) interface{} {
+	obj := v.(map[string]interface{})
+	obj["id"] = "ID"
+	tags := obj["tags"].([]interface{})
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].(string) < tags[j].(string)
+	})
+	return obj
+}
+
+func TestAssertJSONCallWithNormalizeBody(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:       volatileHandler,
+		URL:           "/",
+		NormalizeBody: qthttptest.JSONNormalizer(normalizeVolatile),
+		ExpectBody: map[string]interface{}{
+			"id":   "ID",
+			"tags": []string{"a", "b", "c"},
+		},
+	})
+
+	// A byte-level normalizer.
+	idPattern := regexp.MustCompile(`"id-[0-9]+"`)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler: volatileHandler,
+		URL:     "/",
+		NormalizeBody: func(body []byte) []byte {
+			return idPattern.ReplaceAll(body, []byte(`"ID"`))
+		},
+		ExpectBody: qthttptest.BodyAsserter(func(c *qt.C, body json.RawMessage) {
+			c.Assert(bytes.Contains(body, []byte(`"id": "ID"`)), qt.Equals, true, qt.Commentf("%s", body))
+		}),
+	})
+
+	checkFails(c, `values are not deep equal`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:       volatileHandler,
+			URL:           "/",
+			NormalizeBody: qthttptest.JSONNormalizer(normalizeVolatile),
+			ExpectBody: map[string]interface{}{
+				"id":   "ID",
+				"tags": []string{"b", "c", "a"},
+			},
+		})
+	})
+}
+
+func TestJSONNormalizerInvalidJSON(t *testing.T) {
+	c := qt.New(t)
+	normalize := qthttptest.JSONNormalizer(func(v interface{}) interface{} {
+		return "changed"
+	})
+	c.Assert(string(normalize([]byte("{"))), qt.Equals, "{")
+	c.Assert(string(normalize([]byte("{}"))), qt.Equals, `"changed"`)
+}
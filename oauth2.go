@@ -0,0 +1,301 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// OAuth2ServerParams holds parameters for NewOAuth2Server.
+type OAuth2ServerParams struct {
+	// Clients maps client ids to their secrets. Clients
+	// may authenticate with HTTP basic authentication or
+	// with client_id and client_secret form parameters.
+	// If it is empty, any client is accepted.
+	Clients map[string]string
+
+	// AccessTokenLifetime holds the lifetime of issued
+	// access tokens. If it is zero, one hour is used.
+	AccessTokenLifetime time.Duration
+
+	// IssueRefreshToken specifies that a refresh token is issued
+	// along with the access token for the client_credentials grant.
+	// A new refresh token is always issued for the refresh_token grant.
+	IssueRefreshToken bool
+
+	// Errors holds errors to respond with for successive token
+	// requests, which can be used to exercise error handling. A
+	// nil entry means that the request is handled as usual.
+	Errors []*OAuth2Error
+}
+
+// OAuth2Error holds an OAuth2 error response as
+// defined in RFC 6749, section 5.2.
+type OAuth2Error struct {
+	// Status holds the HTTP status of the response.
+	// If it is zero, http.StatusBadRequest is used.
+	Status int `json:"-"`
+
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// OAuth2TokenRequest holds a request received
+// by the token endpoint of an OAuth2Server.
+type OAuth2TokenRequest struct {
+	RecordedRequest
+
+	GrantType    string
+	ClientID     string
+	Scope        string
+	RefreshToken string
+
+	// Error holds the error code that was sent in
+	// response, or the empty string if a token was issued.
+	Error string
+}
+
+// OAuth2Server is a mock OAuth2 authorization server supporting
+// the client_credentials and refresh_token grants. Its
+// token endpoint is at the path "/token".
+type OAuth2Server struct {
+	*Server
+
+	p OAuth2ServerParams
+
+	mu            sync.Mutex
+	requests      []OAuth2TokenRequest
+	accessTokens  map[string]oauth2Token
+	refreshTokens map[string]oauth2Token
+	serial        int
+}
+
+type oauth2Token struct {
+	clientID string
+	scope    string
+	expires  time.Time
+}
+
+// NewOAuth2Server starts a new OAuth2 server
+// which is shut down when the test completes.
+func NewOAuth2Server(c *qt.C, p OAuth2ServerParams) *OAuth2Server {
+	if p.AccessTokenLifetime == 0 {
+		p.AccessTokenLifetime = time.Hour
+	}
+	s := &OAuth2Server{
+		p:             p,
+		accessTokens:  make(map[string]oauth2Token),
+		refreshTokens: make(map[string]oauth2Token),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.serveToken)
+	s.Server = NewServer(c, mux)
+	return s
+}
+
+// TokenURL returns the URL of the token endpoint.
+func (s *OAuth2Server) TokenURL() string {
+	return s.URL() + "/token"
+}
+
+// ValidAccessToken reports whether the given access
+// token was issued by the server and has not expired.
+// If so, it also returns the scope of the token.
+func (s *OAuth2Server) ValidAccessToken(token string) (scope string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.accessTokens[token]
+	if !ok || !DefaultClock.Now().Before(t.expires) {
+		return "", false
+	}
+	return t.scope, true
+}
+
+// TokenRequests returns all the token requests received so far.
+func (s *OAuth2Server) TokenRequests() []OAuth2TokenRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OAuth2TokenRequest(nil), s.requests...)
+}
+
+// AssertGrants asserts that the token requests received so far
+// used exactly the given grant types, in order.
+func (s *OAuth2Server) AssertGrants(c *qt.C, grantTypes ...string) {
+	got := []string{}
+	for _, req := range s.TokenRequests() {
+		got = append(got, req.GrantType)
+	}
+	if grantTypes == nil {
+		grantTypes = []string{}
+	}
+	c.Assert(got, qt.DeepEquals, grantTypes)
+}
+
+func (s *OAuth2Server) serveToken(w http.ResponseWriter, req *http.Request) {
+	r, err := recordRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tr := OAuth2TokenRequest{
+		RecordedRequest: r,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oerr := s.parseTokenRequest(req, &tr)
+	if oerr == nil && len(s.requests) < len(s.p.Errors) {
+		oerr = s.p.Errors[len(s.requests)]
+	}
+	var resp map[string]interface{}
+	if oerr == nil {
+		resp, oerr = s.issue(&tr)
+	}
+	if oerr != nil {
+		tr.Error = oerr.Code
+	}
+	s.requests = append(s.requests, tr)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if oerr != nil {
+		status := oerr.Status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(oerr)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseTokenRequest fills in the details of tr from req
+// and authenticates the client.
+func (s *OAuth2Server) parseTokenRequest(req *http.Request, tr *OAuth2TokenRequest) *OAuth2Error {
+	if req.Method != "POST" {
+		return &OAuth2Error{
+			Status:      http.StatusMethodNotAllowed,
+			Code:        "invalid_request",
+			Description: "token requests must use POST",
+		}
+	}
+	if err := req.ParseForm(); err != nil {
+		return &OAuth2Error{
+			Code:        "invalid_request",
+			Description: err.Error(),
+		}
+	}
+	tr.GrantType = req.PostForm.Get("grant_type")
+	tr.Scope = req.PostForm.Get("scope")
+	tr.RefreshToken = req.PostForm.Get("refresh_token")
+	clientID, secret, basic := req.BasicAuth()
+	if basic {
+		// Credentials in the Authorization header are form-encoded.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+	tr.ClientID = clientID
+	if len(s.p.Clients) > 0 {
+		if want, ok := s.p.Clients[clientID]; !ok || want != secret {
+			status := http.StatusBadRequest
+			if basic {
+				status = http.StatusUnauthorized
+			}
+			return &OAuth2Error{
+				Status:      status,
+				Code:        "invalid_client",
+				Description: fmt.Sprintf("invalid credentials for client %q", clientID),
+			}
+		}
+	}
+	return nil
+}
+
+// issue issues the tokens for the given request and returns
+// the response to send. It is called with s.mu held.
+func (s *OAuth2Server) issue(tr *OAuth2TokenRequest) (map[string]interface{}, *OAuth2Error) {
+	issueRefresh := s.p.IssueRefreshToken
+	switch tr.GrantType {
+	case "client_credentials":
+	case "refresh_token":
+		t, ok := s.refreshTokens[tr.RefreshToken]
+		if !ok || t.clientID != tr.ClientID {
+			return nil, &OAuth2Error{
+				Code:        "invalid_grant",
+				Description: "invalid refresh token",
+			}
+		}
+		if tr.Scope == "" {
+			tr.Scope = t.scope
+		} else if !scopeSubset(tr.Scope, t.scope) {
+			return nil, &OAuth2Error{
+				Code:        "invalid_scope",
+				Description: fmt.Sprintf("scope %q exceeds original scope %q", tr.Scope, t.scope),
+			}
+		}
+		// Refresh tokens are rotated.
+		delete(s.refreshTokens, tr.RefreshToken)
+		issueRefresh = true
+	case "":
+		return nil, &OAuth2Error{
+			Code:        "invalid_request",
+			Description: "missing grant_type",
+		}
+	default:
+		return nil, &OAuth2Error{
+			Code:        "unsupported_grant_type",
+			Description: fmt.Sprintf("unsupported grant type %q", tr.GrantType),
+		}
+	}
+	s.serial++
+	t := oauth2Token{
+		clientID: tr.ClientID,
+		scope:    tr.Scope,
+		expires:  DefaultClock.Now().Add(s.p.AccessTokenLifetime),
+	}
+	accessToken := fmt.Sprintf("access-token-%d", s.serial)
+	s.accessTokens[accessToken] = t
+	resp := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(s.p.AccessTokenLifetime / time.Second),
+	}
+	if tr.Scope != "" {
+		resp["scope"] = tr.Scope
+	}
+	if issueRefresh {
+		refreshToken := fmt.Sprintf("refresh-token-%d", s.serial)
+		s.refreshTokens[refreshToken] = t
+		resp["refresh_token"] = refreshToken
+	}
+	return resp, nil
+}
+
+// scopeSubset reports whether all the space-separated
+// scopes in scope are also in within.
+func scopeSubset(scope, within string) bool {
+	have := make(map[string]bool)
+	for _, s := range strings.Fields(within) {
+		have[s] = true
+	}
+	for _, s := range strings.Fields(scope) {
+		if !have[s] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestOAuth2Server(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.NewOAuth2Server(c, qthttptest.OAuth2ServerParams{
+		Clients:             map[string]string{"client1": "secret1"},
+		AccessTokenLifetime: 10 * time.Minute,
+		IssueRefreshToken:   true,
+	})
+	tokenCall := func(form url.Values, username, password string) qthttptest.DoRequestParams {
+		return qthttptest.DoRequestParams{
+			Method:   "POST",
+			URL:      s.TokenURL(),
+			Header:   http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			Body:     strings.NewReader(form.Encode()),
+			Username: username,
+			Password: password,
+		}
+	}
+	p := jsonCall(tokenCall(url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {"read write"},
+	}, "client1", "secret1"), http.StatusOK, map[string]interface{}{
+		"access_token":  "access-token-1",
+		"token_type":    "Bearer",
+		"expires_in":    600,
+		"scope":         "read write",
+		"refresh_token": "refresh-token-1",
+	})
+	p.ExpectHeader = http.Header{"Cache-Control": {"no-store"}}
+	qthttptest.AssertJSONCall(c, p)
+	scope, ok := s.ValidAccessToken("access-token-1")
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(scope, qt.Equals, "read write")
+	_, ok = s.ValidAccessToken("access-token-2")
+	c.Assert(ok, qt.Equals, false)
+
+	// Refresh with a reduced scope, sending credentials in the form.
+	qthttptest.AssertJSONCall(c, jsonCall(tokenCall(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {"refresh-token-1"},
+		"scope":         {"read"},
+		"client_id":     {"client1"},
+		"client_secret": {"secret1"},
+	}, "", ""), http.StatusOK, map[string]interface{}{
+		"access_token":  "access-token-2",
+		"token_type":    "Bearer",
+		"expires_in":    600,
+		"scope":         "read",
+		"refresh_token": "refresh-token-2",
+	}))
+
+	// The old refresh token has been rotated out.
+	qthttptest.AssertJSONCall(c, jsonCall(tokenCall(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {"refresh-token-1"},
+	}, "client1", "secret1"), http.StatusBadRequest, map[string]interface{}{
+		"error":             "invalid_grant",
+		"error_description": "invalid refresh token",
+	}))
+
+	qthttptest.AssertJSONCall(c, jsonCall(tokenCall(url.Values{
+		"grant_type": {"client_credentials"},
+	}, "client1", "wrong"), http.StatusUnauthorized, map[string]interface{}{
+		"error":             "invalid_client",
+		"error_description": `invalid credentials for client "client1"`,
+	}))
+
+	qthttptest.AssertJSONCall(c, jsonCall(tokenCall(url.Values{
+		"grant_type": {"password"},
+	}, "client1", "secret1"), http.StatusBadRequest, map[string]interface{}{
+		"error":             "unsupported_grant_type",
+		"error_description": `unsupported grant type "password"`,
+	}))
+
+	reqs := s.TokenRequests()
+	c.Assert(reqs, qt.HasLen, 5)
+	c.Assert(reqs[1].ClientID, qt.Equals, "client1")
+	c.Assert(reqs[1].RefreshToken, qt.Equals, "refresh-token-1")
+	c.Assert(reqs[2].Error, qt.Equals, "invalid_grant")
+	s.AssertGrants(c, "client_credentials", "refresh_token", "refresh_token", "client_credentials", "password")
+	checkFails(c, `values are not deep equal`, func(c *qt.C) {
+		s.AssertGrants(c)
+	})
+}
+
+func TestOAuth2ServerErrors(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.NewOAuth2Server(c, qthttptest.OAuth2ServerParams{
+		AccessTokenLifetime: time.Nanosecond,
+		Errors: []*qthttptest.OAuth2Error{{
+			Status: http.StatusServiceUnavailable,
+			Code:   "temporarily_unavailable",
+		}, nil},
+	})
+	p := qthttptest.DoRequestParams{
+		Method: "POST",
+		URL:    s.TokenURL(),
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+	}
+	p.Body = strings.NewReader("grant_type=client_credentials&client_id=any")
+	qthttptest.AssertJSONCall(c, jsonCall(p, http.StatusServiceUnavailable, map[string]interface{}{
+		"error": "temporarily_unavailable",
+	}))
+	p.Body = strings.NewReader("grant_type=client_credentials&client_id=any")
+	qthttptest.AssertJSONCall(c, jsonCall(p, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token-1",
+		"token_type":   "Bearer",
+		"expires_in":   0,
+	}))
+	time.Sleep(time.Millisecond)
+	_, ok := s.ValidAccessToken("access-token-1")
+	c.Assert(ok, qt.Equals, false)
+}
+
+func jsonCall(p qthttptest.DoRequestParams, status int, body interface{}) qthttptest.JSONCallParams {
+	return qthttptest.JSONCallParams{
+		Method:       p.Method,
+		URL:          p.URL,
+		Header:       p.Header,
+		Body:         p.Body,
+		Username:     p.Username,
+		Password:     p.Password,
+		ExpectStatus: status,
+		ExpectBody:   body,
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// OIDCProvider is a mock OpenID Connect provider. It serves
+// a discovery document at /.well-known/openid-configuration and
+// the public keys used to sign its tokens at /jwks. The
+// authorization endpoint is advertised, as required by the
+// specification, but not served.
+type OIDCProvider struct {
+	*Server
+
+	mu   sync.Mutex
+	keys []*JWTKey
+}
+
+// NewOIDCProvider starts a new OIDC provider with a newly
+// generated RS256 signing key. The provider is shut down
+// when the test completes.
+func NewOIDCProvider(c *qt.C) *OIDCProvider {
+	p := &OIDCProvider{
+		keys: []*JWTKey{NewJWTKey(c, "RS256")},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveJWKS)
+	p.Server = NewServer(c, mux)
+	return p
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *OIDCProvider) Issuer() string {
+	return p.URL()
+}
+
+// Key returns the key currently used to sign tokens.
+func (p *OIDCProvider) Key() *JWTKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keys[len(p.keys)-1]
+}
+
+// RotateKey generates a new signing key and returns it. The old
+// keys remain in the key set so that tokens signed with them can
+// still be verified.
+func (p *OIDCProvider) RotateKey(c *qt.C) *JWTKey {
+	k := NewJWTKey(c, "RS256")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, k)
+	return k
+}
+
+// IDToken returns an ID token signed with the current key. The iss,
+// aud, sub, iat and exp claims are filled in from the arguments;
+// any of them can be overridden by extra.
+func (p *OIDCProvider) IDToken(c *qt.C, audience, subject string, extra map[string]interface{}) string {
+	now := DefaultClock.Now()
+	claims := map[string]interface{}{
+		"iss": p.Issuer(),
+		"aud": audience,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return p.Key().Sign(c, claims)
+}
+
+func (p *OIDCProvider) serveDiscovery(w http.ResponseWriter, req *http.Request) {
+	issuer := p.Issuer()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code", "id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *OIDCProvider) serveJWKS(w http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	keys := make([]map[string]string, len(p.keys))
+	for i, k := range p.keys {
+		pub := k.PublicKey()
+		keys[i] = map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": k.Alg,
+			"kid": k.KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	}
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": keys,
+	})
+}
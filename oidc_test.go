@@ -0,0 +1,102 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	c := qt.New(t)
+	p := qthttptest.NewOIDCProvider(c)
+
+	var config struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	getJSON(c, p.Issuer()+"/.well-known/openid-configuration", &config)
+	c.Assert(config.Issuer, qt.Equals, p.URL())
+	c.Assert(config.JWKSURI, qt.Equals, p.URL()+"/jwks")
+
+	token := p.IDToken(c, "client1", "alice", map[string]interface{}{
+		"email": "alice@example.com",
+	})
+	oldKey := p.Key()
+	verifyWithJWKS(c, config.JWKSURI, token)
+	claims, err := oldKey.Verify(token)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(claims["iss"], qt.Equals, p.Issuer())
+	c.Assert(claims["aud"], qt.Equals, "client1")
+	c.Assert(claims["sub"], qt.Equals, "alice")
+	c.Assert(claims["email"], qt.Equals, "alice@example.com")
+
+	// After rotation, tokens signed with both keys can be verified.
+	newKey := p.RotateKey(c)
+	c.Assert(p.Key(), qt.Equals, newKey)
+	verifyWithJWKS(c, config.JWKSURI, token)
+	verifyWithJWKS(c, config.JWKSURI, p.IDToken(c, "client1", "bob", nil))
+}
+
+func getJSON(c *qt.C, url string, x interface{}) {
+	resp, err := http.Get(url)
+	c.Assert(err, qt.Equals, nil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+	err = json.NewDecoder(resp.Body).Decode(x)
+	c.Assert(err, qt.Equals, nil)
+}
+
+// verifyWithJWKS verifies the token using the key with
+// the matching id in the JWKS at the given URL.
+func verifyWithJWKS(c *qt.C, jwksURL, token string) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	getJSON(c, jwksURL, &jwks)
+	parts := strings.Split(token, ".")
+	c.Assert(parts, qt.HasLen, 3)
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	c.Assert(err, qt.Equals, nil)
+	var header struct {
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(headerData, &header)
+	c.Assert(err, qt.Equals, nil)
+	for _, k := range jwks.Keys {
+		if k.Kid != header.Kid {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		c.Assert(err, qt.Equals, nil)
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		c.Assert(err, qt.Equals, nil)
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		c.Assert(err, qt.Equals, nil)
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig)
+		c.Assert(err, qt.Equals, nil)
+		return
+	}
+	c.Fatalf("key %q not found in JWKS", header.Kid)
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// PanicCallParams holds parameters for AssertPanicCall.
+type PanicCallParams struct {
+	// DoRequestParams holds the request to make. The Handler
+	// field must be set. The ExpectError field is ignored.
+	DoRequestParams
+
+	// ExpectPanic holds a regular expression that the panic value,
+	// formatted with %v, must match. If it is empty, the handler
+	// must not panic; this can be used to check that a recovery
+	// middleware handles a panic in the handler that it wraps.
+	ExpectPanic string
+
+	// ExpectStatus holds the expected response status when
+	// ExpectPanic is empty. If it is zero,
+	// http.StatusInternalServerError is assumed. It is
+	// ignored when the handler is expected to panic.
+	ExpectStatus int
+}
+
+// AssertPanicCall makes the request described by p, recovering from
+// any panic in the handler. If p.ExpectPanic is non-empty, it asserts
+// that the handler panicked with a matching value and returns nil.
+// Otherwise it asserts that no panic escaped from the handler and that
+// the response has the expected status, and it returns the response.
+func AssertPanicCall(c *qt.C, p PanicCallParams) *Resp {
+	c.Assert(p.Handler, qt.Not(qt.IsNil), qt.Commentf("AssertPanicCall requires a handler"))
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusInternalServerError
+	}
+	var (
+		mu       sync.Mutex
+		panicked bool
+		value    interface{}
+		stack    []byte
+	)
+	handler := p.Handler
+	p.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				mu.Lock()
+				panicked, value, stack = true, v, debug.Stack()
+				mu.Unlock()
+				http.Error(w, "handler panicked", http.StatusInternalServerError)
+			}
+		}()
+		handler.ServeHTTP(w, req)
+	})
+	p.ExpectError = ""
+	resp := DoResponse(c, p.DoRequestParams)
+	mu.Lock()
+	defer mu.Unlock()
+	if p.ExpectPanic != "" {
+		c.Assert(panicked, qt.Equals, true, qt.Commentf("handler did not panic; status %d; body: %s", resp.Response.StatusCode, resp.Body))
+		c.Assert(fmt.Sprint(value), qt.Matches, p.ExpectPanic, qt.Commentf("panic value"))
+		return nil
+	}
+	if panicked {
+		c.Fatalf("handler panicked: %v\n%s", value, stack)
+	}
+	resp.AssertStatus(c, p.ExpectStatus)
+	return resp
+}
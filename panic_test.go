@@ -0,0 +1,92 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var panickingHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	panic(errors.New("nil pointer in widget lookup"))
+})
+
+// recoveryMiddleware converts panics into JSON error responses.
+func recoveryMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"error":"internal error"}`))
+			}
+		}()
+		h.ServeHTTP(w, req)
+	})
+}
+
+func TestAssertPanicCall(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: panickingHandler,
+			URL:     "/",
+		},
+		ExpectPanic: `nil pointer .*`,
+	})
+	resp := qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: recoveryMiddleware(panickingHandler),
+			URL:     "/",
+		},
+	})
+	resp.AssertJSON(c, map[string]string{
+		"error": "internal error",
+	})
+	qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: http.NotFoundHandler(),
+			URL:     "/",
+		},
+		ExpectStatus: http.StatusNotFound,
+	})
+}
+
+func TestAssertPanicCallFailures(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `handler did not panic; status 404; body: 404 page not found`, func(c *qt.C) {
+		qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: http.NotFoundHandler(),
+				URL:     "/",
+			},
+			ExpectPanic: `.*`,
+		})
+	})
+	checkFails(c, `comment:\n  panic value\ngot value:\n  "nil pointer in widget lookup"`, func(c *qt.C) {
+		qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: panickingHandler,
+				URL:     "/",
+			},
+			ExpectPanic: `index out of range`,
+		})
+	})
+	checkFails(c, `handler panicked: nil pointer in widget lookup\ngoroutine`, func(c *qt.C) {
+		qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: panickingHandler,
+				URL:     "/",
+			},
+		})
+	})
+	checkFails(c, `AssertPanicCall requires a handler`, func(c *qt.C) {
+		qthttptest.AssertPanicCall(c, qthttptest.PanicCallParams{})
+	})
+}
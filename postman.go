@@ -0,0 +1,511 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// PostmanCollection holds a Postman collection in the v2.1 format,
+// as exported by Postman. Only the parts used by
+// RunPostmanCollection are represented.
+type PostmanCollection struct {
+	Info PostmanInfo `json:"info"`
+
+	// Item holds the requests and folders
+	// at the top level of the collection.
+	Item []PostmanItem `json:"item"`
+
+	// Variable holds the collection variables.
+	Variable []PostmanKeyValue `json:"variable"`
+
+	// Auth holds the authentication used by
+	// requests that inherit it.
+	Auth *PostmanAuth `json:"auth,omitempty"`
+}
+
+// PostmanInfo holds information about a Postman collection.
+type PostmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+// PostmanItem holds a request or a folder in a Postman collection.
+// Folders have a nil Request.
+type PostmanItem struct {
+	Name string `json:"name"`
+
+	// Item holds the contents of a folder.
+	Item []PostmanItem `json:"item,omitempty"`
+
+	// Auth holds the authentication used by the
+	// requests in a folder that inherit it.
+	Auth *PostmanAuth `json:"auth,omitempty"`
+
+	Request *PostmanRequest `json:"request,omitempty"`
+
+	// Response holds the example responses
+	// saved with the request.
+	Response []PostmanResponse `json:"response,omitempty"`
+}
+
+// PostmanRequest holds a request in a Postman collection.
+type PostmanRequest struct {
+	Method string            `json:"method"`
+	Header []PostmanKeyValue `json:"header"`
+	URL    PostmanURL        `json:"url"`
+	Body   *PostmanBody      `json:"body,omitempty"`
+
+	// Auth holds the authentication for the request. If
+	// it is nil, the authentication is inherited from
+	// the enclosing folder or collection.
+	Auth *PostmanAuth `json:"auth,omitempty"`
+}
+
+// PostmanURL holds the URL of a request in a Postman collection.
+type PostmanURL struct {
+	// Raw holds the URL as entered, which may
+	// contain variable references.
+	Raw string `json:"raw"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler by accepting
+// either a string or an object holding the URL.
+func (u *PostmanURL) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &u.Raw); err == nil {
+		return nil
+	}
+	var obj struct {
+		Raw      string            `json:"raw"`
+		Protocol string            `json:"protocol"`
+		Host     []string          `json:"host"`
+		Path     []string          `json:"path"`
+		Query    []PostmanKeyValue `json:"query"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	u.Raw = obj.Raw
+	if u.Raw != "" {
+		return nil
+	}
+	// Older exports only hold the parts of the URL.
+	if obj.Protocol != "" {
+		u.Raw = obj.Protocol + "://"
+	}
+	u.Raw += strings.Join(obj.Host, ".")
+	if len(obj.Path) > 0 {
+		u.Raw += "/" + strings.Join(obj.Path, "/")
+	}
+	sep := "?"
+	for _, kv := range obj.Query {
+		if !kv.Disabled {
+			u.Raw += sep + kv.Key + "=" + kv.Value
+			sep = "&"
+		}
+	}
+	return nil
+}
+
+// PostmanBody holds the body of a request in a Postman collection.
+type PostmanBody struct {
+	// Mode holds the kind of body: one of "raw",
+	// "urlencoded", "formdata" or "graphql".
+	Mode string `json:"mode"`
+
+	Raw        string            `json:"raw,omitempty"`
+	URLEncoded []PostmanKeyValue `json:"urlencoded,omitempty"`
+	FormData   []PostmanKeyValue `json:"formdata,omitempty"`
+	GraphQL    *PostmanGraphQL   `json:"graphql,omitempty"`
+
+	// Options.Raw.Language holds the language of a raw body,
+	// such as "json", which determines its default content type.
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+// PostmanGraphQL holds a GraphQL request body.
+type PostmanGraphQL struct {
+	Query string `json:"query"`
+
+	// Variables holds the JSON encoding of the
+	// variables, or the empty string if there are none.
+	Variables string `json:"variables"`
+}
+
+// PostmanAuth holds the authentication of requests
+// in a Postman collection.
+type PostmanAuth struct {
+	// Type holds the kind of authentication. The types supported by
+	// RunPostmanCollection are "bearer", "basic", "noauth" and
+	// "inherit".
+	Type   string            `json:"type"`
+	Bearer []PostmanKeyValue `json:"bearer,omitempty"`
+	Basic  []PostmanKeyValue `json:"basic,omitempty"`
+}
+
+// PostmanResponse holds an example response saved
+// with a request in a Postman collection.
+type PostmanResponse struct {
+	Name   string            `json:"name"`
+	Code   int               `json:"code"`
+	Header []PostmanKeyValue `json:"header"`
+	Body   string            `json:"body"`
+}
+
+// PostmanKeyValue holds a header, form field, variable
+// or authentication parameter in a Postman collection.
+type PostmanKeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	// Type holds "file" for a form field
+	// that is sent from a file.
+	Type string `json:"type,omitempty"`
+}
+
+// ParsePostmanCollection parses a Postman collection
+// from its JSON encoding.
+func ParsePostmanCollection(data []byte) (*PostmanCollection, error) {
+	var coll PostmanCollection
+	if err := json.Unmarshal(data, &coll); err != nil {
+		return nil, fmt.Errorf("invalid Postman collection: %v", err)
+	}
+	return &coll, nil
+}
+
+// ReadPostmanCollection reads and parses the
+// Postman collection file at the given path.
+func ReadPostmanCollection(c *qt.C, path string) *PostmanCollection {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.Equals, nil)
+	coll, err := ParsePostmanCollection(data)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("file %s", path))
+	return coll
+}
+
+// ReadPostmanEnvironment reads the Postman environment file at the
+// given path and returns the values of its enabled variables, for
+// use in PostmanRunParams.Vars.
+func ReadPostmanEnvironment(c *qt.C, path string) map[string]string {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.Equals, nil)
+	var env struct {
+		Values []struct {
+			Key     string `json:"key"`
+			Value   string `json:"value"`
+			Enabled *bool  `json:"enabled"`
+		} `json:"values"`
+	}
+	err = json.Unmarshal(data, &env)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("invalid Postman environment in %s", path))
+	vars := make(map[string]string)
+	for _, v := range env.Values {
+		if v.Enabled == nil || *v.Enabled {
+			vars[v.Key] = v.Value
+		}
+	}
+	return vars
+}
+
+// PostmanRunParams holds parameters for RunPostmanCollection.
+type PostmanRunParams struct {
+	// Handler, if non-nil, is used to start a server
+	// that all the requests are sent to.
+	Handler http.Handler
+
+	// BaseURL, if non-empty and Handler is nil, holds the URL that
+	// the requests are sent to. If Handler or BaseURL is set, only
+	// the path and query of each request URL are used, so that a
+	// collection written for a deployed service can be run against
+	// a test server; otherwise the request URLs must be absolute.
+	BaseURL string
+
+	// Vars holds values for variables, typically read with
+	// ReadPostmanEnvironment. They take precedence over the
+	// collection variables.
+	Vars map[string]string
+
+	// Adjust, if non-nil, is called with each request and the
+	// parameters of the call made for it so that they can be
+	// changed, for example to add the expectations checked by the
+	// request's test scripts.
+	Adjust func(item PostmanItem, p *JSONCallParams)
+}
+
+// RunPostmanCollection makes the requests in coll in order, each in a
+// subtest named after it and nested in subtests for its folders.
+// Failed requests do not stop the rest of the collection from running.
+// Cookies set by responses are sent with later requests, and redirects
+// are followed, as they are by Postman.
+//
+// References to variables of the form {{name}} in request URLs,
+// headers, bodies and authentication parameters are replaced with the
+// values of the variables, which must be defined. The dynamic
+// variables {{$guid}}, {{$timestamp}} and {{$randomInt}} are also
+// supported.
+//
+// Postman test scripts cannot be run. Instead, when a request has
+// saved example responses, the first is used as the expected response,
+// as for ReplayHAR: the response must have its status and its body,
+// compared as JSON if it has a JSON content type. Otherwise, the
+// response must have a 2xx status and its body is not checked, unless
+// PostmanRunParams.Adjust sets ExpectStatus or ExpectBody, in which
+// case the call is checked as for AssertJSONCall.
+func RunPostmanCollection(c *qt.C, coll *PostmanCollection, p PostmanRunParams) {
+	vars := make(map[string]string)
+	for _, v := range coll.Variable {
+		if !v.Disabled {
+			vars[v.Key] = v.Value
+		}
+	}
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+	r := &postmanRunner{
+		p:      p,
+		vars:   vars,
+		caller: &Caller{BaseURL: p.BaseURL},
+	}
+	if p.Handler != nil {
+		r.caller = &NewServer(c, p.Handler).Caller
+	}
+	jar, err := cookiejar.New(nil)
+	c.Assert(err, qt.Equals, nil)
+	r.do = jarDo(jar, nil)
+	r.runItems(c, coll.Item, coll.Auth)
+}
+
+// postmanRunner holds the state of RunPostmanCollection.
+type postmanRunner struct {
+	p      PostmanRunParams
+	vars   map[string]string
+	caller *Caller
+	do     func(*http.Request) (*http.Response, error)
+}
+
+// runItems runs the given items, where auth holds
+// the authentication that they inherit.
+func (r *postmanRunner) runItems(c *qt.C, items []PostmanItem, auth *PostmanAuth) {
+	for _, item := range items {
+		item := item
+		if item.Request == nil {
+			itemAuth := auth
+			if item.Auth != nil && item.Auth.Type != "inherit" {
+				itemAuth = item.Auth
+			}
+			c.Run(item.Name, func(c *qt.C) {
+				r.runItems(c, item.Item, itemAuth)
+			})
+			continue
+		}
+		c.Run(item.Name, func(c *qt.C) {
+			r.runRequest(c, item, auth)
+		})
+	}
+}
+
+func (r *postmanRunner) runRequest(c *qt.C, item PostmanItem, auth *PostmanAuth) {
+	req := item.Request
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	p := JSONCallParams{
+		Method: method,
+		URL:    r.url(c, req.URL.Raw),
+		Header: make(http.Header),
+		Do:     r.do,
+	}
+	for _, h := range req.Header {
+		if !h.Disabled {
+			p.Header.Add(h.Key, r.expand(c, h.Value))
+		}
+	}
+	if req.Auth != nil && req.Auth.Type != "inherit" {
+		auth = req.Auth
+	}
+	r.setAuth(c, &p, auth)
+	if req.Body != nil {
+		r.setBody(c, &p, req.Body)
+	}
+	var expectBody []byte
+	isJSON := false
+	example := len(item.Response) > 0
+	if example {
+		resp := item.Response[0]
+		p.ExpectStatus = resp.Code
+		expectBody = []byte(resp.Body)
+		var ctype string
+		for _, h := range resp.Header {
+			if http.CanonicalHeaderKey(h.Key) == "Content-Type" {
+				ctype = h.Value
+			}
+		}
+		isJSON = expectRecordedBody(&p, ctype, expectBody)
+	}
+	if r.p.Adjust != nil {
+		r.p.Adjust(item, &p)
+	}
+	if example || p.ExpectStatus != 0 || p.ExpectBody != nil {
+		assertRecordedResponse(c, r.caller, p, expectBody, isJSON)
+		return
+	}
+	resp := DoResponse(c, r.caller.DoRequestParams(p.doRequestParams()))
+	status := resp.Response.StatusCode
+	c.Assert(status >= 200 && status < 300, qt.Equals, true, qt.Commentf("status %s; body: %s", resp.Response.Status, indentedJSON(resp.Body)))
+}
+
+// url returns the URL to use for a request
+// with the given raw URL.
+func (r *postmanRunner) url(c *qt.C, raw string) string {
+	raw = r.expand(c, raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	if r.p.Handler == nil && r.p.BaseURL == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("invalid request URL"))
+	return u.RequestURI()
+}
+
+// setAuth sets the authentication for a request in p.
+func (r *postmanRunner) setAuth(c *qt.C, p *JSONCallParams, auth *PostmanAuth) {
+	if auth == nil {
+		return
+	}
+	param := func(kvs []PostmanKeyValue, key string) string {
+		for _, kv := range kvs {
+			if kv.Key == key {
+				return r.expand(c, kv.Value)
+			}
+		}
+		return ""
+	}
+	switch auth.Type {
+	case "bearer":
+		p.Header.Set("Authorization", "Bearer "+param(auth.Bearer, "token"))
+	case "basic":
+		p.Username = param(auth.Basic, "username")
+		p.Password = param(auth.Basic, "password")
+	case "noauth", "inherit":
+	default:
+		c.Fatalf("unsupported Postman auth type %q", auth.Type)
+	}
+}
+
+// postmanRawContentTypes holds the content types used for raw
+// bodies in the given languages if the request has no
+// Content-Type header.
+var postmanRawContentTypes = map[string]string{
+	"html":       "text/html",
+	"javascript": "application/javascript",
+	"json":       "application/json",
+	"text":       "text/plain",
+	"xml":        "application/xml",
+}
+
+// setBody sets the body of a request in p.
+func (r *postmanRunner) setBody(c *qt.C, p *JSONCallParams, body *PostmanBody) {
+	var data []byte
+	ctype := ""
+	switch body.Mode {
+	case "", "none":
+		return
+	case "raw":
+		data = []byte(r.expand(c, body.Raw))
+		ctype = postmanRawContentTypes[body.Options.Raw.Language]
+	case "urlencoded":
+		form := make(url.Values)
+		for _, kv := range body.URLEncoded {
+			if !kv.Disabled {
+				form.Add(r.expand(c, kv.Key), r.expand(c, kv.Value))
+			}
+		}
+		data = []byte(form.Encode())
+		ctype = "application/x-www-form-urlencoded"
+	case "formdata":
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for _, kv := range body.FormData {
+			if kv.Disabled {
+				continue
+			}
+			if kv.Type == "file" {
+				c.Fatalf("file form field %q is not supported", kv.Key)
+			}
+			err := w.WriteField(r.expand(c, kv.Key), r.expand(c, kv.Value))
+			c.Assert(err, qt.Equals, nil)
+		}
+		c.Assert(w.Close(), qt.Equals, nil)
+		data = buf.Bytes()
+		ctype = w.FormDataContentType()
+	case "graphql":
+		c.Assert(body.GraphQL, qt.Not(qt.IsNil), qt.Commentf("graphql body with no query"))
+		req := map[string]interface{}{
+			"query": r.expand(c, body.GraphQL.Query),
+		}
+		if vars := r.expand(c, body.GraphQL.Variables); strings.TrimSpace(vars) != "" {
+			req["variables"] = json.RawMessage(vars)
+		}
+		var err error
+		data, err = json.Marshal(req)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("invalid GraphQL variables"))
+		ctype = "application/json"
+	default:
+		c.Fatalf("unsupported Postman body mode %q", body.Mode)
+	}
+	if ctype != "" && p.Header.Get("Content-Type") == "" {
+		p.Header.Set("Content-Type", ctype)
+	}
+	p.Body = bytes.NewReader(data)
+}
+
+// postmanDynamicVars holds the dynamic variables
+// supported by RunPostmanCollection.
+var postmanDynamicVars = map[string]func() string{
+	"$guid": func() string {
+		h := randomHex(16)
+		return h[:8] + "-" + h[8:12] + "-4" + h[13:16] + "-a" + h[17:20] + "-" + h[20:]
+	},
+	"$timestamp": func() string {
+		return strconv.FormatInt(DefaultClock.Now().Unix(), 10)
+	},
+	"$randomInt": func() string {
+		n, _ := strconv.ParseUint(randomHex(2), 16, 16)
+		return strconv.FormatUint(n%1001, 10)
+	},
+}
+
+// expand returns s with all variable references replaced.
+func (r *postmanRunner) expand(c *qt.C, s string) string {
+	return templateVarPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := templateVarPattern.FindStringSubmatch(ref)[1]
+		if val, ok := r.vars[name]; ok {
+			return val
+		}
+		if f := postmanDynamicVars[name]; f != nil {
+			return f()
+		}
+		c.Fatalf("undefined Postman variable %q", name)
+		return ""
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+const testPostmanCollection = `{
+	"info": {
+		"name": "items",
+		"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+	},
+	"auth": {
+		"type": "bearer",
+		"bearer": [{"key": "token", "value": "{{token}}", "type": "string"}]
+	},
+	"variable": [
+		{"key": "baseUrl", "value": "https://api.example.com"},
+		{"key": "name", "value": "default"}
+	],
+	"item": [{
+		"name": "create item",
+		"request": {
+			"method": "POST",
+			"header": [
+				{"key": "X-Request-Id", "value": "{{$guid}}"},
+				{"key": "X-Disabled", "value": "x", "disabled": true}
+			],
+			"url": {
+				"raw": "{{baseUrl}}/items",
+				"host": ["{{baseUrl}}"],
+				"path": ["items"]
+			},
+			"body": {
+				"mode": "raw",
+				"raw": "{\"name\": \"{{name}}\"}",
+				"options": {"raw": {"language": "json"}}
+			}
+		},
+		"response": [{
+			"name": "created",
+			"code": 201,
+			"header": [{"key": "Content-Type", "value": "application/json"}],
+			"body": "{\"id\": 1, \"name\": \"widget\"}"
+		}]
+	}, {
+		"name": "public",
+		"auth": {"type": "noauth"},
+		"item": [{
+			"name": "search",
+			"request": {
+				"method": "POST",
+				"header": [],
+				"url": "{{baseUrl}}/search?q={{name}}",
+				"body": {
+					"mode": "urlencoded",
+					"urlencoded": [{"key": "sort", "value": "name"}]
+				}
+			}
+		}]
+	}]
+}`
+
+// postmanHandler returns a handler that serves the requests made
+// for testPostmanCollection, recording the calls made.
+func postmanHandler(calls *[]string) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		*calls = append(*calls, req.Method+" "+req.URL.String()+" "+req.Header.Get("Authorization"))
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/items":
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil || req.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "bad body", http.StatusBadRequest)
+				return
+			}
+			if len(req.Header.Get("X-Request-Id")) != 36 || req.Header.Get("X-Disabled") != "" {
+				http.Error(w, "bad headers", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":   1,
+				"name": body.Name,
+			})
+		case "/search":
+			if req.PostFormValue("sort") != "name" {
+				http.Error(w, "bad form", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("results"))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
+
+func TestRunPostmanCollection(t *testing.T) {
+	c := qt.New(t)
+	dir := c.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "collection.json"), []byte(testPostmanCollection), 0666)
+	c.Assert(err, qt.Equals, nil)
+	err = ioutil.WriteFile(filepath.Join(dir, "env.json"), []byte(`{
+		"name": "test",
+		"values": [
+			{"key": "token", "value": "secret", "enabled": true},
+			{"key": "name", "value": "widget", "enabled": true},
+			{"key": "unused", "value": "x", "enabled": false}
+		]
+	}`), 0666)
+	c.Assert(err, qt.Equals, nil)
+	coll := qthttptest.ReadPostmanCollection(c, filepath.Join(dir, "collection.json"))
+	c.Assert(coll.Item[0].Request.URL.Raw, qt.Equals, "{{baseUrl}}/items")
+	vars := qthttptest.ReadPostmanEnvironment(c, filepath.Join(dir, "env.json"))
+	c.Assert(vars, qt.DeepEquals, map[string]string{
+		"token": "secret",
+		"name":  "widget",
+	})
+
+	var calls []string
+	qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+		Handler: postmanHandler(&calls),
+		Vars:    vars,
+	})
+	c.Assert(calls, qt.DeepEquals, []string{
+		"POST /items Bearer secret",
+		"POST /search?q=widget ",
+	})
+
+	// The saved example is checked.
+	srv := qthttptest.NewServer(c, postmanHandler(&calls))
+	checkFails(c, `values are not deep equal`, func(c *qt.C) {
+		qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+			BaseURL: srv.URL(),
+			Vars: map[string]string{
+				"token": "secret",
+			},
+		})
+	})
+
+	// Adjust can change the expectations.
+	qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+		BaseURL: srv.URL(),
+		Vars: map[string]string{
+			"token": "secret",
+		},
+		Adjust: func(item qthttptest.PostmanItem, p *qthttptest.JSONCallParams) {
+			if item.Name == "create item" {
+				p.ExpectBody = map[string]interface{}{
+					"id":   1,
+					"name": "default",
+				}
+			}
+		},
+	})
+
+	checkFails(c, `undefined Postman variable "token"`, func(c *qt.C) {
+		qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+			BaseURL: srv.URL(),
+		})
+	})
+	checkFails(c, `status 404 Not Found; body: 404 page not found`, func(c *qt.C) {
+		qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+			Handler: http.NotFoundHandler(),
+			Vars:    vars,
+		})
+	})
+}
+
+func TestRunPostmanCollectionCookiesWithRedirect(t *testing.T) {
+	c := qt.New(t)
+	coll, err := qthttptest.ParsePostmanCollection([]byte(`{
+		"info": {"name": "login"},
+		"item": [{
+			"name": "login",
+			"request": {"method": "POST", "url": "/login"}
+		}, {
+			"name": "home",
+			"request": {"method": "GET", "url": "/home"}
+		}]
+	}`))
+	c.Assert(err, qt.Equals, nil)
+	qthttptest.RunPostmanCollection(c, coll, qthttptest.PostmanRunParams{
+		Handler: redirectingLoginHandler(),
+	})
+}
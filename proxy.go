@@ -0,0 +1,77 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// PatchProxy arranges for requests to be sent through the proxy at
+// the given URL for the rest of the test. It sets the proxy
+// environment variables, with NO_PROXY set to the given hosts, and
+// replaces http.DefaultTransport with a copy that uses the proxy, as
+// by PatchDefaultTransport, because http.ProxyFromEnvironment reads
+// the environment only once. Unlike http.ProxyFromEnvironment,
+// requests to localhost are proxied, so that requests to test servers
+// can be sent through a test proxy. The transport is restored when
+// the test completes and the environment when c.Done is called, as
+// for c.Setenv, so the test must call it. Because this changes global
+// state, tests using it must not run in parallel.
+//
+// Transports other than http.DefaultTransport can use ProxyFunc
+// to the same effect.
+func PatchProxy(c *qt.C, proxyURL string, noProxy ...string) {
+	proxy := ProxyFunc(c, proxyURL, noProxy...)
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		c.Setenv(name, proxyURL)
+	}
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		c.Setenv(name, strings.Join(noProxy, ","))
+	}
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = t.Clone()
+		t.Proxy = proxy
+		PatchDefaultTransport(c, t)
+		c.Cleanup(t.CloseIdleConnections)
+	}
+}
+
+// ProxyFunc returns a function suitable for use as
+// http.Transport.Proxy that sends all requests through the proxy at
+// the given URL except those to the given hosts. A host may be a host
+// name, which also matches its subdomains, or an IP address; it
+// may include a port, in which case only that port matches.
+func ProxyFunc(c *qt.C, proxyURL string, noProxy ...string) func(*http.Request) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	c.Assert(err, qt.Equals, nil)
+	return func(req *http.Request) (*url.URL, error) {
+		for _, h := range noProxy {
+			if proxyExcluded(req.URL, h) {
+				return nil, nil
+			}
+		}
+		return u, nil
+	}
+}
+
+// proxyExcluded reports whether the given URL
+// matches the given NO_PROXY entry.
+func proxyExcluded(u *url.URL, entry string) bool {
+	host, port := u.Hostname(), u.Port()
+	entryHost, entryPort, err := net.SplitHostPort(entry)
+	if err != nil {
+		entryHost, entryPort = entry, ""
+	}
+	if entryPort != "" && entryPort != port {
+		return false
+	}
+	entryHost = strings.TrimPrefix(strings.ToLower(entryHost), ".")
+	host = strings.ToLower(host)
+	return host == entryHost || strings.HasSuffix(host, "."+entryHost)
+}
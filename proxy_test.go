@@ -0,0 +1,81 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestPatchProxy(t *testing.T) {
+	c := qt.New(t)
+	proxy := qthttptest.NewRecordingServer(c, nil)
+	direct := qthttptest.NewRecordingServer(c, nil)
+	directHost := strings.TrimPrefix(direct.URL(), "http://")
+
+	oldProxy := os.Getenv("HTTP_PROXY")
+	oldTransport := http.DefaultTransport
+	c.Run("patched", func(c *qt.C) {
+		defer c.Done()
+		qthttptest.PatchProxy(c, proxy.URL(), directHost)
+		c.Assert(os.Getenv("HTTP_PROXY"), qt.Equals, proxy.URL())
+		c.Assert(os.Getenv("no_proxy"), qt.Equals, directHost)
+		c.Assert(http.DefaultTransport, qt.Not(qt.Equals), oldTransport)
+
+		qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+			URL: "http://example.invalid/foo",
+		})
+		qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+			URL: direct.URL() + "/bar",
+		})
+	})
+	reqs := proxy.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].URL.String(), qt.Equals, "http://example.invalid/foo")
+	reqs = direct.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].URL.String(), qt.Equals, "/bar")
+
+	// Everything is restored after the test.
+	c.Assert(os.Getenv("HTTP_PROXY"), qt.Equals, oldProxy)
+	c.Assert(http.DefaultTransport, qt.Equals, oldTransport)
+	qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		URL: direct.URL() + "/baz",
+	})
+	c.Assert(proxy.Requests(), qt.HasLen, 1)
+	c.Assert(direct.Requests(), qt.HasLen, 2)
+}
+
+func TestProxyFunc(t *testing.T) {
+	c := qt.New(t)
+	proxy := qthttptest.ProxyFunc(c, "http://proxy:3128", "example.com", "10.0.0.1:8080")
+	for _, test := range []struct {
+		url    string
+		direct bool
+	}{
+		{"http://example.com/", true},
+		{"http://sub.example.com:1234/", true},
+		{"http://notexample.com/", false},
+		{"http://10.0.0.1:8080/", true},
+		{"http://10.0.0.1/", false},
+		{"http://localhost/", false},
+	} {
+		u, err := url.Parse(test.url)
+		c.Assert(err, qt.Equals, nil)
+		got, err := proxy(&http.Request{URL: u})
+		c.Assert(err, qt.Equals, nil)
+		if test.direct {
+			c.Assert(got, qt.IsNil, qt.Commentf("%s", test.url))
+		} else {
+			c.Assert(got.String(), qt.Equals, "http://proxy:3128", qt.Commentf("%s", test.url))
+		}
+	}
+}
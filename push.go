@@ -0,0 +1,108 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"net/textproto"
+	"sync"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Push holds a server push initiated by a handler with http.Pusher.
+type Push struct {
+	// Target holds the path of the pushed resource.
+	Target string
+
+	// Method holds the method of the promised request.
+	Method string
+
+	// Header holds the headers of the promised request.
+	Header http.Header
+}
+
+// PushRecorder records the resources pushed by a handler. Because
+// the Go HTTP client does not accept server pushes, pushes are
+// recorded at the handler rather than on the wire: the
+// http.ResponseWriter passed to the handler always implements
+// http.Pusher, and pushes always succeed. The zero value is
+// ready to use.
+type PushRecorder struct {
+	mu     sync.Mutex
+	pushes []Push
+}
+
+// Handler returns a handler that calls h with a
+// ResponseWriter that records pushes in r.
+func (r *PushRecorder) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(&pushResponseWriter{ResponseWriter: w, r: r}, req)
+	})
+}
+
+// Pushes returns all the pushes recorded so far.
+func (r *PushRecorder) Pushes() []Push {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Push(nil), r.pushes...)
+}
+
+// AssertPushes asserts that the recorded pushes match expect in
+// order. The Target of each push must be equal. If Method is
+// non-empty, it must be equal too; otherwise GET is expected.
+// Only the headers mentioned in Header are checked.
+func (r *PushRecorder) AssertPushes(c *qt.C, expect []Push) {
+	pushes := r.Pushes()
+	targets := func(ps []Push) []string {
+		ts := []string{}
+		for _, p := range ps {
+			ts = append(ts, p.Target)
+		}
+		return ts
+	}
+	c.Assert(targets(pushes), qt.DeepEquals, targets(expect), qt.Commentf("pushed targets"))
+	for i, want := range expect {
+		got := pushes[i]
+		method := want.Method
+		if method == "" {
+			method = "GET"
+		}
+		c.Assert(got.Method, qt.Equals, method, qt.Commentf("method of push %q", got.Target))
+		for k, v := range want.Header {
+			c.Assert(got.Header[textproto.CanonicalMIMEHeaderKey(k)], qt.DeepEquals, v, qt.Commentf("header %q of push %q", k, got.Target))
+		}
+	}
+}
+
+type pushResponseWriter struct {
+	http.ResponseWriter
+	r *PushRecorder
+}
+
+// Push implements http.Pusher.
+func (w *pushResponseWriter) Push(target string, opts *http.PushOptions) error {
+	p := Push{
+		Target: target,
+		Method: "GET",
+		Header: make(http.Header),
+	}
+	if opts != nil {
+		if opts.Method != "" {
+			p.Method = opts.Method
+		}
+		p.Header = cloneHeader(opts.Header)
+	}
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+	w.r.pushes = append(w.r.pushes, p)
+	return nil
+}
+
+// Flush implements http.Flusher.
+func (w *pushResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
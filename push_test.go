@@ -0,0 +1,74 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var pushingHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	if pusher, ok := w.(http.Pusher); ok {
+		pusher.Push("/static/app.css", nil)
+		pusher.Push("/static/app.js", &http.PushOptions{
+			Header: http.Header{"Accept-Encoding": {"gzip"}},
+		})
+	}
+})
+
+func TestPushRecorder(t *testing.T) {
+	c := qt.New(t)
+	var r qthttptest.PushRecorder
+	srv := qthttptest.NewServer(c, r.Handler(pushingHandler))
+	srv.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/",
+	})
+	c.Assert(r.Pushes(), qt.DeepEquals, []qthttptest.Push{{
+		Target: "/static/app.css",
+		Method: "GET",
+		Header: http.Header{},
+	}, {
+		Target: "/static/app.js",
+		Method: "GET",
+		Header: http.Header{"Accept-Encoding": {"gzip"}},
+	}})
+	r.AssertPushes(c, []qthttptest.Push{{
+		Target: "/static/app.css",
+	}, {
+		Target: "/static/app.js",
+		Header: http.Header{"accept-encoding": {"gzip"}},
+	}})
+	checkFails(c, `header "Accept-Encoding" of push "/static/app.js"`, func(c *qt.C) {
+		r.AssertPushes(c, []qthttptest.Push{{
+			Target: "/static/app.css",
+		}, {
+			Target: "/static/app.js",
+			Header: http.Header{"Accept-Encoding": {"br"}},
+		}})
+	})
+}
+
+func TestAssertJSONCallWithExpectPushes(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler: pushingHandler,
+		URL:     "/",
+		ExpectPushes: []qthttptest.Push{{
+			Target: "/static/app.css",
+		}, {
+			Target: "/static/app.js",
+		}},
+	})
+	checkFails(c, `pushed targets`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler:      pushingHandler,
+			URL:          "/",
+			ExpectPushes: []qthttptest.Push{},
+		})
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// RangeCallParams holds parameters for AssertRangeCall.
+type RangeCallParams struct {
+	DoRequestParams
+
+	// Range holds the value of the Range header to send,
+	// for example "bytes=0-99" or "bytes=-500".
+	Range string
+
+	// Content holds the full content of the resource.
+	Content []byte
+}
+
+// byteRange holds an inclusive range of bytes.
+type byteRange struct {
+	start, end int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// AssertRangeCall makes a request with the Range header specified in
+// p and asserts that the response holds the corresponding parts of
+// p.Content. If one range is requested, the response must have
+// status 206 (Partial Content) and a matching Content-Range header.
+// If several ranges are requested, the response must be a
+// multipart/byteranges document holding each part in order. If none
+// of the ranges can be satisfied, the response must have status 416
+// (Range Not Satisfiable) and a Content-Range header holding the
+// size of the content.
+//
+// It returns the response.
+func AssertRangeCall(c *qt.C, p RangeCallParams) *Resp {
+	size := int64(len(p.Content))
+	ranges, err := parseRange(p.Range, size)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("invalid Range %q", p.Range))
+	p.Header = cloneHeader(p.Header)
+	p.Header.Set("Range", p.Range)
+	resp := DoResponse(c, p.DoRequestParams)
+	if resp == nil {
+		return nil
+	}
+	h := resp.Response.Header
+	switch len(ranges) {
+	case 0:
+		resp.AssertStatus(c, http.StatusRequestedRangeNotSatisfiable)
+		c.Assert(h.Get("Content-Range"), qt.Equals, fmt.Sprintf("bytes */%d", size))
+	case 1:
+		resp.AssertStatus(c, http.StatusPartialContent)
+		r := ranges[0]
+		c.Assert(h.Get("Content-Range"), qt.Equals, r.contentRange(size))
+		if cl := h.Get("Content-Length"); cl != "" {
+			c.Assert(cl, qt.Equals, strconv.FormatInt(r.end-r.start+1, 10), qt.Commentf("Content-Length"))
+		}
+		assertRangeContent(c, resp.Body, p.Content, r)
+	default:
+		resp.AssertStatus(c, http.StatusPartialContent)
+		mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+		c.Assert(err, qt.Equals, nil)
+		c.Assert(mediaType, qt.Equals, "multipart/byteranges")
+		mr := multipart.NewReader(bytes.NewReader(resp.Body), params["boundary"])
+		for i, r := range ranges {
+			part, err := mr.NextPart()
+			c.Assert(err, qt.Equals, nil, qt.Commentf("part %d", i))
+			c.Assert(part.Header.Get("Content-Range"), qt.Equals, r.contentRange(size), qt.Commentf("part %d", i))
+			data, err := ioutil.ReadAll(part)
+			c.Assert(err, qt.Equals, nil)
+			assertRangeContent(c, data, p.Content, r)
+		}
+		_, err = mr.NextPart()
+		c.Assert(err, qt.ErrorMatches, "EOF", qt.Commentf("unexpected extra parts"))
+	}
+	return resp
+}
+
+func assertRangeContent(c *qt.C, got, content []byte, r byteRange) {
+	c.Assert(string(got), qt.Equals, string(content[r.start:r.end+1]), qt.Commentf("content of range %d-%d", r.start, r.end))
+}
+
+// parseRange parses a Range header value as specified in RFC 7233
+// and returns the satisfiable ranges for content of the given size.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, fmt.Errorf("unsupported range unit")
+	}
+	var ranges []byteRange
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid range %q", spec)
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var r byteRange
+		if first == "" {
+			// A suffix range specifies the final bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid range %q", spec)
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{size - n, size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid range %q", spec)
+			}
+			r = byteRange{start, size - 1}
+			if last != "" {
+				end, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, fmt.Errorf("invalid range %q", spec)
+				}
+				if end < size {
+					r.end = end
+				}
+			}
+		}
+		if r.start >= size {
+			// Unsatisfiable.
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
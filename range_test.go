@@ -0,0 +1,103 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var rangeContent = []byte(strings.Repeat("0123456789", 100))
+
+var assertRangeCallTests = []struct {
+	about string
+	rng   string
+}{{
+	about: "first bytes",
+	rng:   "bytes=0-99",
+}, {
+	about: "open-ended",
+	rng:   "bytes=990-",
+}, {
+	about: "suffix",
+	rng:   "bytes=-25",
+}, {
+	about: "end beyond content",
+	rng:   "bytes=995-2000",
+}, {
+	about: "multiple ranges",
+	rng:   "bytes=0-9, 20-29,-5",
+}, {
+	about: "unsatisfiable",
+	rng:   "bytes=1000-1010",
+}}
+
+func TestAssertRangeCall(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "data.txt", time.Time{}, bytes.NewReader(rangeContent))
+	})
+	for _, test := range assertRangeCallTests {
+		c.Run(test.about, func(c *qt.C) {
+			qthttptest.AssertRangeCall(c, qthttptest.RangeCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: handler,
+					URL:     "/data.txt",
+				},
+				Range:   test.rng,
+				Content: rangeContent,
+			})
+		})
+	}
+}
+
+func TestAssertRangeCallFailures(t *testing.T) {
+	c := qt.New(t)
+	// offByOne serves the bytes one after those requested.
+	offByOne := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-9/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(rangeContent[1:11])
+	})
+	checkFails(c, `content of range 0-9`, func(c *qt.C) {
+		qthttptest.AssertRangeCall(c, qthttptest.RangeCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: offByOne,
+				URL:     "/",
+			},
+			Range:   "bytes=0-9",
+			Content: rangeContent,
+		})
+	})
+	ignoresRange := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(rangeContent)
+	})
+	checkFails(c, `(?s)got:\s+int\(200\)\s+want:\s+int\(206\)`, func(c *qt.C) {
+		qthttptest.AssertRangeCall(c, qthttptest.RangeCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: ignoresRange,
+				URL:     "/",
+			},
+			Range:   "bytes=0-9",
+			Content: rangeContent,
+		})
+	})
+	checkFails(c, `invalid Range "bytes=x-1"`, func(c *qt.C) {
+		qthttptest.AssertRangeCall(c, qthttptest.RangeCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: ignoresRange,
+				URL:     "/",
+			},
+			Range:   "bytes=x-1",
+			Content: rangeContent,
+		})
+	})
+}
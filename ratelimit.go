@@ -0,0 +1,122 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// RateLimit holds rate limit information parsed from
+// response headers by ParseRateLimit.
+type RateLimit struct {
+	// Limit holds the number of requests allowed in the window.
+	Limit int
+
+	// Remaining holds the number of requests
+	// remaining in the current window.
+	Remaining int
+
+	// Reset holds the time at which the current window resets.
+	Reset time.Time
+}
+
+// resetEpochThreshold is the value above which a reset header is
+// taken to hold a Unix time rather than a number of seconds.
+const resetEpochThreshold = 1e9
+
+// ParseRateLimit parses the rate limit headers in h. The
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+// are used if present; otherwise the X-RateLimit-* equivalents are
+// used. RateLimit-Reset holds the number of seconds until the window
+// resets; X-RateLimit-Reset may hold either that or a Unix time.
+// Relative reset times are taken relative to the Date header if
+// present, or to the current time according to DefaultClock
+// otherwise.
+//
+// For the RateLimit-Limit header, any quota policy following the
+// first comma or semicolon is ignored.
+func ParseRateLimit(h http.Header) (RateLimit, error) {
+	prefix := "RateLimit-"
+	if h.Get("RateLimit-Limit") == "" {
+		prefix = "X-RateLimit-"
+	}
+	var rl RateLimit
+	var err error
+	if rl.Limit, err = rateLimitValue(h, prefix+"Limit"); err != nil {
+		return RateLimit{}, err
+	}
+	if rl.Remaining, err = rateLimitValue(h, prefix+"Remaining"); err != nil {
+		return RateLimit{}, err
+	}
+	reset, err := rateLimitValue(h, prefix+"Reset")
+	if err != nil {
+		return RateLimit{}, err
+	}
+	if reset >= resetEpochThreshold {
+		rl.Reset = time.Unix(int64(reset), 0)
+		return rl, nil
+	}
+	now := DefaultClock.Now()
+	if date := h.Get("Date"); date != "" {
+		if t, err := http.ParseTime(date); err == nil {
+			now = t
+		}
+	}
+	rl.Reset = now.Add(time.Duration(reset) * time.Second)
+	return rl, nil
+}
+
+func rateLimitValue(h http.Header, key string) (int, error) {
+	v := h.Get(key)
+	if v == "" {
+		return 0, fmt.Errorf("missing %s header", key)
+	}
+	if i := strings.IndexAny(v, ",;"); i != -1 {
+		v = v[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s header %q", key, h.Get(key))
+	}
+	return n, nil
+}
+
+// RateLimitTracker checks the rate limit headers in a sequence of
+// responses from the same rate-limited resource. The zero value
+// is ready to use.
+type RateLimitTracker struct {
+	prev *RateLimit
+}
+
+// Observe parses the rate limit headers in h and asserts that they
+// are consistent: the remaining count must not exceed the limit and
+// the reset time must not be in the past. If a previous response has
+// been observed in the same window, it also asserts that the limit
+// is unchanged and the remaining count has been decremented by one.
+// A response is taken to be in a new window when its reset time is
+// more than a second after the previous one. It returns the
+// parsed rate limit.
+func (t *RateLimitTracker) Observe(c *qt.C, h http.Header) RateLimit {
+	rl, err := ParseRateLimit(h)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(rl.Remaining <= rl.Limit, qt.Equals, true, qt.Commentf("remaining %d exceeds limit %d", rl.Remaining, rl.Limit))
+	// Allow a second for the truncation of reset times to seconds.
+	c.Assert(rl.Reset.Add(time.Second).Before(DefaultClock.Now()), qt.Equals, false, qt.Commentf("reset time %v is in the past", rl.Reset))
+	if prev := t.prev; prev != nil && !rl.Reset.After(prev.Reset.Add(time.Second)) {
+		c.Assert(rl.Limit, qt.Equals, prev.Limit, qt.Commentf("limit changed within window"))
+		want := prev.Remaining - 1
+		if want < 0 {
+			want = 0
+		}
+		c.Assert(rl.Remaining, qt.Equals, want, qt.Commentf("remaining count not decremented"))
+	}
+	t.prev = &rl
+	return rl
+}
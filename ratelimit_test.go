@@ -0,0 +1,115 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	c := qt.New(t)
+	rl, err := qthttptest.ParseRateLimit(http.Header{
+		"Ratelimit-Limit":     {"100, 100;w=60"},
+		"Ratelimit-Remaining": {"42"},
+		"Ratelimit-Reset":     {"30"},
+		"X-Ratelimit-Limit":   {"5"},
+		"Date":                {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	})
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(rl, qt.DeepEquals, qthttptest.RateLimit{
+		Limit:     100,
+		Remaining: 42,
+		Reset:     time.Date(2006, 1, 2, 15, 4, 35, 0, time.UTC),
+	})
+
+	rl, err = qthttptest.ParseRateLimit(http.Header{
+		"X-Ratelimit-Limit":     {"5"},
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {"1136214245"},
+	})
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(rl.Limit, qt.Equals, 5)
+	c.Assert(rl.Remaining, qt.Equals, 0)
+	c.Assert(rl.Reset.Equal(time.Unix(1136214245, 0)), qt.Equals, true)
+
+	_, err = qthttptest.ParseRateLimit(http.Header{
+		"X-Ratelimit-Limit": {"5"},
+	})
+	c.Assert(err, qt.ErrorMatches, `missing X-RateLimit-Remaining header`)
+
+	_, err = qthttptest.ParseRateLimit(http.Header{
+		"Ratelimit-Limit":     {"5"},
+		"Ratelimit-Remaining": {"-1"},
+	})
+	c.Assert(err, qt.ErrorMatches, `invalid RateLimit-Remaining header "-1"`)
+}
+
+// rateLimitHandler returns a handler that allows limit
+// requests per window and decrements by step each time.
+func rateLimitHandler(limit, step int) http.Handler {
+	var mu sync.Mutex
+	remaining := limit
+	reset := time.Now().Add(time.Minute)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		remaining -= step
+		if remaining < 0 {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if remaining == 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+}
+
+func TestRateLimitTracker(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, rateLimitHandler(3, 1))
+	var tracker qthttptest.RateLimitTracker
+	for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		rec := srv.DoRequest(c, qthttptest.DoRequestParams{
+			URL: "/",
+		})
+		c.Assert(rec.Code, qt.Equals, status)
+		rl := tracker.Observe(c, rec.Header())
+		c.Assert(rl.Remaining, qt.Equals, []int{2, 1, 0, 0}[i])
+	}
+
+	srv = qthttptest.NewServer(c, rateLimitHandler(10, 2))
+	tracker = qthttptest.RateLimitTracker{}
+	tracker.Observe(c, srv.DoRequest(c, qthttptest.DoRequestParams{URL: "/"}).Header())
+	checkFails(c, `remaining count not decremented`, func(c *qt.C) {
+		tracker.Observe(c, srv.DoRequest(c, qthttptest.DoRequestParams{URL: "/"}).Header())
+	})
+
+	checkFails(c, `reset time .* is in the past`, func(c *qt.C) {
+		var tracker qthttptest.RateLimitTracker
+		tracker.Observe(c, http.Header{
+			"Ratelimit-Limit":     {"5"},
+			"Ratelimit-Remaining": {"5"},
+			"Ratelimit-Reset":     {"1"},
+			"Date":                {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		})
+	})
+	checkFails(c, `remaining 6 exceeds limit 5`, func(c *qt.C) {
+		var tracker qthttptest.RateLimitTracker
+		tracker.Observe(c, http.Header{
+			"Ratelimit-Limit":     {"5"},
+			"Ratelimit-Remaining": {"6"},
+			"Ratelimit-Reset":     {"1"},
+		})
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Canned malformed responses for use with RawResponse. Each
+// exercises a different kind of protocol error in the client.
+const (
+	// RawInvalidStatusLine has a non-numeric status code.
+	RawInvalidStatusLine = "HTTP/1.1 abc OK\r\n\r\n"
+
+	// RawGarbageHeader has a header line with no colon.
+	RawGarbageHeader = "HTTP/1.1 200 OK\r\nthis is not a header\r\n\r\n"
+
+	// RawBadChunkSize has a chunked body with an invalid chunk size.
+	RawBadChunkSize = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n"
+
+	// RawPrematureEOF has a body shorter than its Content-Length.
+	RawPrematureEOF = "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\nshort"
+
+	// RawConflictingLength has two different Content-Length headers.
+	RawConflictingLength = "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!"
+
+	// RawNoResponse closes the connection without sending anything.
+	RawNoResponse = ""
+)
+
+// RawHandler responds to a request received by a RawServer by
+// writing directly to the connection. The request header has
+// already been read; the body has not. The connection is closed
+// when the handler returns.
+type RawHandler func(conn net.Conn, req *http.Request)
+
+// RawResponse returns a RawHandler that writes the given
+// response verbatim, ignoring the request.
+func RawResponse(response string) RawHandler {
+	return func(conn net.Conn, req *http.Request) {
+		io.WriteString(conn, response)
+	}
+}
+
+// RawServer is a TCP server that can send arbitrary bytes in
+// response to an HTTP request, including malformed HTTP that
+// the net/http server cannot produce. Each connection is used
+// for a single request.
+type RawServer struct {
+	l       net.Listener
+	handler RawHandler
+	wg      sync.WaitGroup
+}
+
+// NewRawServer starts a new raw server that responds to requests
+// with the given handler. It is shut down when the test completes.
+func NewRawServer(c *qt.C, handler RawHandler) *RawServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.Equals, nil)
+	s := &RawServer{
+		l:       l,
+		handler: handler,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	c.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the URL of the server.
+func (s *RawServer) URL() string {
+	return "http://" + s.l.Addr().String()
+}
+
+// Close shuts down the server and waits for
+// any active handlers to return.
+func (s *RawServer) Close() {
+	s.l.Close()
+	s.wg.Wait()
+}
+
+func (s *RawServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				return
+			}
+			s.handler(conn, req)
+			if tc, ok := conn.(*net.TCPConn); ok {
+				// Let the client read the response before it sees
+				// the connection close rather than a reset.
+				tc.CloseWrite()
+				tc.SetReadDeadline(time.Now().Add(time.Second))
+				io.Copy(ioutil.Discard, conn)
+			}
+		}()
+	}
+}
+
+// RawReply holds the reply to a request sent by SendRaw.
+type RawReply struct {
+	// Raw holds all the bytes received from the server.
+	Raw []byte
+
+	// Response holds the first response parsed from Raw, or nil
+	// if it could not be parsed. Its body has been read into Body.
+	Response *http.Response
+	Body     []byte
+
+	// Err holds the error from parsing the response, if any.
+	Err error
+}
+
+// sendRawTimeout holds how long SendRaw waits for a reply.
+const sendRawTimeout = 5 * time.Second
+
+// SendRaw opens a TCP connection to addr, which may be a host:port
+// pair or a URL such as that returned by Server.URL, writes the given
+// bytes to it verbatim, and returns the server's reply. This can be
+// used to check how a server handles requests that net/http would
+// not send, such as those with folded header lines or an
+// absolute-form request target.
+//
+// SendRaw returns once the first response has been read, the server
+// closes the connection or five seconds have passed. If the request
+// starts with "HEAD ", the response is parsed as a response to a HEAD
+// request.
+func SendRaw(c *qt.C, addr string, request []byte) RawReply {
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		c.Assert(err, qt.Equals, nil)
+		addr = u.Host
+	}
+	conn, err := net.Dial("tcp", addr)
+	c.Assert(err, qt.Equals, nil)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sendRawTimeout))
+	_, err = conn.Write(request)
+	c.Assert(err, qt.Equals, nil)
+
+	var raw bytes.Buffer
+	br := bufio.NewReader(io.TeeReader(conn, &raw))
+	method := "GET"
+	if bytes.HasPrefix(request, []byte("HEAD ")) {
+		method = "HEAD"
+	}
+	var reply RawReply
+	resp, err := http.ReadResponse(br, &http.Request{Method: method})
+	if err == nil {
+		reply.Response = resp
+		reply.Body, err = ioutil.ReadAll(resp.Body)
+	}
+	if err != nil {
+		reply.Err = err
+		// Read whatever else the server sends so
+		// that the reply is as complete as possible.
+		io.Copy(ioutil.Discard, br)
+	}
+	reply.Raw = raw.Bytes()
+	return reply
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var rawServerTests = []struct {
+	about           string
+	response        string
+	expectError     string
+	expectBodyError string
+}{{
+	about:       "invalid status line",
+	response:    qthttptest.RawInvalidStatusLine,
+	expectError: `.*malformed HTTP status code "abc"`,
+}, {
+	about:       "garbage header",
+	response:    qthttptest.RawGarbageHeader,
+	expectError: `.*malformed MIME header.*`,
+}, {
+	about:           "bad chunk size",
+	response:        qthttptest.RawBadChunkSize,
+	expectBodyError: `invalid byte in chunk length`,
+}, {
+	about:           "premature EOF",
+	response:        qthttptest.RawPrematureEOF,
+	expectBodyError: `unexpected EOF`,
+}, {
+	about:       "conflicting length",
+	response:    qthttptest.RawConflictingLength,
+	expectError: `.*message cannot contain multiple Content-Length headers.*`,
+}, {
+	about:       "no response",
+	response:    qthttptest.RawNoResponse,
+	expectError: `.*EOF`,
+}}
+
+func TestRawServer(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range rawServerTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			srv := qthttptest.NewRawServer(c, qthttptest.RawResponse(test.response))
+			p := qthttptest.DoRequestParams{
+				Method:      "POST",
+				URL:         srv.URL() + "/",
+				ExpectError: test.expectError,
+			}
+			resp := qthttptest.Do(c, p)
+			if test.expectError != "" {
+				return
+			}
+			defer resp.Body.Close()
+			_, err := ioutil.ReadAll(resp.Body)
+			c.Assert(err, qt.ErrorMatches, test.expectBodyError)
+		})
+	}
+}
+
+func TestRawServerHandler(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRawServer(c, func(conn net.Conn, req *http.Request) {
+		body := req.Method + " " + req.URL.Path
+		fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	})
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/foo",
+	})
+	resp.AssertStatus(c, http.StatusOK)
+	c.Assert(string(resp.Body), qt.Equals, "GET /foo")
+}
+
+var sendRawTests = []struct {
+	about        string
+	request      string
+	expectStatus int
+	expectBody   string
+}{{
+	about:        "origin form",
+	request:      "GET /foo?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	expectStatus: http.StatusOK,
+	expectBody:   `GET /foo\?x=1 example.com HTTP/1.1 \[\]`,
+}, {
+	about:        "absolute form",
+	request:      "GET http://example.com/foo?x=1 HTTP/1.1\r\nHost: other.com\r\n\r\n",
+	expectStatus: http.StatusOK,
+	expectBody:   `GET http://example.com/foo\?x=1 example.com HTTP/1.1 \[\]`,
+}, {
+	about:        "HTTP/1.0 without host",
+	request:      "GET /foo HTTP/1.0\r\n\r\n",
+	expectStatus: http.StatusOK,
+	expectBody:   `GET /foo  HTTP/1.0 \[\]`,
+}, {
+	about:        "HEAD",
+	request:      "HEAD /foo HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	expectStatus: http.StatusOK,
+}, {
+	about:        "folded header",
+	request:      "GET / HTTP/1.1\r\nHost: example.com\r\nX-Folded: a\r\n b\r\n\r\n",
+	expectStatus: http.StatusOK,
+	expectBody:   `GET / example.com HTTP/1.1 \[a b\]`,
+}, {
+	about:        "HTTP/0.9",
+	request:      "GET /\r\n",
+	expectStatus: http.StatusBadRequest,
+	expectBody:   `(?s)400 Bad Request.*`,
+}}
+
+func TestSendRaw(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s %s %s %s [%s]", req.Method, req.RequestURI, req.Host, req.Proto, req.Header.Get("X-Folded"))
+	}))
+	for _, test := range sendRawTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			reply := qthttptest.SendRaw(c, srv.URL(), []byte(test.request))
+			c.Assert(reply.Err, qt.Equals, nil)
+			c.Assert(reply.Response.StatusCode, qt.Equals, test.expectStatus, qt.Commentf("raw reply: %q", reply.Raw))
+			c.Assert(string(reply.Body), qt.Matches, test.expectBody)
+			c.Assert(strings.HasSuffix(string(reply.Raw), string(reply.Body)), qt.Equals, true)
+		})
+	}
+}
+
+func TestSendRawIncompleteReply(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRawServer(c, qthttptest.RawResponse("HTTP/1.1 200 OK\r\nX-Foo: a"))
+	reply := qthttptest.SendRaw(c, srv.URL(), []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	c.Assert(reply.Err, qt.ErrorMatches, `unexpected EOF`)
+	c.Assert(reply.Response, qt.IsNil)
+	c.Assert(string(reply.Raw), qt.Equals, "HTTP/1.1 200 OK\r\nX-Foo: a")
+}
@@ -0,0 +1,266 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// RecordedRequest holds a request captured by a RecordingHandler.
+type RecordedRequest struct {
+	Method string
+	URL    *url.URL
+	Proto  string
+	Host   string
+	Header http.Header
+	Body   []byte
+}
+
+// RecordingHandler is an http.Handler that records all the
+// requests it receives before passing them on to Handler.
+// The zero value is ready to use and responds with
+// http.StatusOK to all requests.
+type RecordingHandler struct {
+	// Handler, if non-nil, is used to respond to requests.
+	// The request body it sees can be read in full
+	// even though it has already been recorded.
+	Handler http.Handler
+
+	requestLog
+}
+
+// ServeHTTP implements http.Handler.
+func (h *RecordingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r, err := recordRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.record(r)
+	if h.Handler != nil {
+		h.Handler.ServeHTTP(w, req)
+	}
+}
+
+// recordRequest reads the body of req, replacing it so that
+// it can be read again, and returns the recorded request.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return RecordedRequest{}, fmt.Errorf("cannot read request body: %v", err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL,
+		Proto:  req.Proto,
+		Host:   req.Host,
+		Header: cloneHeader(req.Header),
+		Body:   body,
+	}, nil
+}
+
+// requestLog holds a log of recorded requests. It implements
+// the methods shared by RecordingHandler and RecordingTransport.
+type requestLog struct {
+	mu       sync.Mutex
+	requests []RecordedRequest
+	changed  chan struct{}
+}
+
+func (h *requestLog) record(r RecordedRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, r)
+	notifyChange(&h.changed)
+}
+
+// Requests returns all the requests recorded so far.
+func (h *requestLog) Requests() []RecordedRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]RecordedRequest(nil), h.requests...)
+}
+
+// Reset discards all the recorded requests.
+func (h *requestLog) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = nil
+}
+
+// AssertReceivedQuery asserts that the most recently recorded
+// request has exactly the given query parameters, after decoding.
+// The order of the parameters, including the order of multiple
+// values for the same parameter, is ignored.
+func (h *requestLog) AssertReceivedQuery(c *qt.C, expect url.Values) {
+	u := h.lastRequest(c).URL
+	got, err := url.ParseQuery(u.RawQuery)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("query %q", u.RawQuery))
+	c.Assert(sortedQuery(got), qt.DeepEquals, sortedQuery(expect), qt.Commentf("query %q", u.RawQuery))
+}
+
+// AssertReceivedJSONBody asserts that the most recently recorded
+// request has a body that, when unmarshaled as JSON, is equal to
+// expect, as checked by qt.JSONEquals.
+func (h *requestLog) AssertReceivedJSONBody(c *qt.C, expect interface{}) {
+	r := h.lastRequest(c)
+	c.Assert(r.Body, qt.JSONEquals, expect, qt.Commentf("%s %s", r.Method, r.URL))
+}
+
+// AssertReceivedJSONSubset asserts that the most recently recorded
+// request has a JSON body containing expect, as described for
+// MatchJSONSubset.
+func (h *requestLog) AssertReceivedJSONSubset(c *qt.C, expect interface{}) {
+	r := h.lastRequest(c)
+	if err := MatchJSONSubset(expect)(r); err != nil {
+		c.Fatalf("%s %s: %v", r.Method, r.URL, err)
+	}
+}
+
+// lastRequest returns the most recently recorded request,
+// failing the test if there is none.
+func (h *requestLog) lastRequest(c *qt.C) RecordedRequest {
+	reqs := h.Requests()
+	c.Assert(reqs, qt.Not(qt.HasLen), 0, qt.Commentf("no requests recorded"))
+	return reqs[len(reqs)-1]
+}
+
+// sortedQuery returns a copy of v with
+// the values for each key sorted.
+func sortedQuery(v url.Values) url.Values {
+	sorted := make(url.Values)
+	for key, vals := range v {
+		vals = append([]string(nil), vals...)
+		sort.Strings(vals)
+		sorted[key] = vals
+	}
+	return sorted
+}
+
+// WaitForRequests waits until at least n requests have been
+// recorded and returns them. It fails the test if that does
+// not happen within the given timeout.
+func (h *requestLog) WaitForRequests(c *qt.C, n int, timeout time.Duration) []RecordedRequest {
+	var reqs []RecordedRequest
+	ok := waitForChange(&h.mu, &h.changed, timeout, func() bool {
+		reqs = append([]RecordedRequest(nil), h.requests...)
+		return len(reqs) >= n
+	})
+	if !ok {
+		c.Fatalf("timed out after %v waiting for %d requests (got %d)", timeout, n, len(reqs))
+	}
+	return reqs
+}
+
+// waitForChange calls done with mu held until it returns true,
+// waiting between calls until *changed is closed by notifyChange.
+// It reports whether done returned true within the given timeout.
+func waitForChange(mu *sync.Mutex, changed *chan struct{}, timeout time.Duration, done func() bool) bool {
+	deadline := time.After(timeout)
+	for {
+		mu.Lock()
+		if done() {
+			mu.Unlock()
+			return true
+		}
+		if *changed == nil {
+			*changed = make(chan struct{})
+		}
+		ch := *changed
+		mu.Unlock()
+		select {
+		case <-ch:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// notifyChange wakes any waitForChange calls waiting on
+// *changed. It must be called with their mutex held.
+func notifyChange(changed *chan struct{}) {
+	if *changed != nil {
+		close(*changed)
+		*changed = nil
+	}
+}
+
+// RecordingTransport is an http.RoundTripper that records all the
+// requests made through it before passing them on to Transport.
+// The zero value is ready to use and uses http.DefaultTransport.
+type RecordingTransport struct {
+	// Transport, if non-nil, is used to make requests.
+	Transport http.RoundTripper
+
+	requestLog
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The request must not be modified, so record a copy.
+	req1 := req.Clone(req.Context())
+	if req.Body != nil {
+		defer req.Body.Close()
+		r, err := recordRequest(req1)
+		if err != nil {
+			return nil, err
+		}
+		t.recordClient(r)
+	} else {
+		t.recordClient(RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL,
+			Proto:  req.Proto,
+			Host:   req.Host,
+			Header: cloneHeader(req.Header),
+		})
+	}
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req1)
+}
+
+// recordClient records a request made by a client,
+// filling in the fields that a server would see.
+func (t *RecordingTransport) recordClient(r RecordedRequest) {
+	if r.Method == "" {
+		r.Method = "GET"
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	t.record(r)
+}
+
+// RecordingServer is a Server that records all
+// the requests it receives.
+type RecordingServer struct {
+	*Server
+	*RecordingHandler
+}
+
+// NewRecordingServer starts a new server that records all requests
+// and passes them on to the given handler, which may be nil. The
+// server is shut down when the test completes.
+func NewRecordingServer(c *qt.C, handler http.Handler) *RecordingServer {
+	h := &RecordingHandler{
+		Handler: handler,
+	}
+	return &RecordingServer{
+		Server:           NewServer(c, h),
+		RecordingHandler: h,
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestRecordingServer(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + string(data) + `"`))
+	}))
+	srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/x?a=b",
+		Header:     http.Header{"X-Foo": {"bar"}},
+		Body:       strings.NewReader("hello"),
+		ExpectBody: "hello",
+	})
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].Method, qt.Equals, "POST")
+	c.Assert(reqs[0].URL.String(), qt.Equals, "/x?a=b")
+	c.Assert(reqs[0].Header.Get("X-Foo"), qt.Equals, "bar")
+	c.Assert(string(reqs[0].Body), qt.Equals, "hello")
+
+	srv.Reset()
+	c.Assert(srv.Requests(), qt.HasLen, 0)
+}
+
+func TestRecordingHandlerWaitForRequests(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	go func() {
+		for i := 0; i < 2; i++ {
+			resp, err := http.Get(srv.URL() + "/")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+	reqs := srv.WaitForRequests(c, 2, 5*time.Second)
+	c.Assert(reqs, qt.HasLen, 2)
+
+	checkFails(c, `timed out after 10ms waiting for 3 requests \(got 2\)`, func(c *qt.C) {
+		srv.WaitForRequests(c, 3, 10*time.Millisecond)
+	})
+}
+
+func TestRecordingTransport(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		w.Write(data)
+	}))
+	transport := &qthttptest.RecordingTransport{}
+	client := &http.Client{
+		Transport: transport,
+	}
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Method: "PUT",
+		URL:    srv.URL() + "/foo?x=1",
+		Header: http.Header{
+			"X-Foo": {"bar"},
+		},
+		Body: strings.NewReader("hello"),
+		Do:   client.Do,
+	})
+	c.Assert(string(resp.Body), qt.Equals, "hello")
+	qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: srv.URL() + "/bar",
+		Do:  client.Do,
+	})
+	reqs := transport.Requests()
+	c.Assert(reqs, qt.HasLen, 2)
+	c.Assert(reqs[0].Method, qt.Equals, "PUT")
+	c.Assert(reqs[0].URL.Path, qt.Equals, "/foo")
+	c.Assert(reqs[0].URL.RawQuery, qt.Equals, "x=1")
+	c.Assert(reqs[0].Host, qt.Equals, strings.TrimPrefix(srv.URL(), "http://"))
+	c.Assert(reqs[0].Header.Get("X-Foo"), qt.Equals, "bar")
+	c.Assert(string(reqs[0].Body), qt.Equals, "hello")
+	c.Assert(reqs[1].Method, qt.Equals, "GET")
+	c.Assert(reqs[1].URL.Path, qt.Equals, "/bar")
+	c.Assert(reqs[1].Body, qt.IsNil)
+
+	transport.Reset()
+	c.Assert(transport.Requests(), qt.HasLen, 0)
+}
+
+func TestRecordingServerAssertReceivedQuery(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	checkFails(c, `no requests recorded`, func(c *qt.C) {
+		srv.AssertReceivedQuery(c, nil)
+	})
+	// Client code under test.
+	resp, err := http.Get(srv.URL() + "/x?b=2&a=x%2Fy&b=1&c=a+b")
+	c.Assert(err, qt.Equals, nil)
+	resp.Body.Close()
+	srv.AssertReceivedQuery(c, url.Values{
+		"a": {"x/y"},
+		"b": {"1", "2"},
+		"c": {"a b"},
+	})
+	checkFails(c, `comment:
+  query "b=2&a=x%2Fy&b=1&c=a\+b"
+`, func(c *qt.C) {
+		srv.AssertReceivedQuery(c, url.Values{
+			"a": {"x/y"},
+			"b": {"1"},
+			"c": {"a b"},
+		})
+	})
+
+	resp, err = http.Get(srv.URL() + "/x")
+	c.Assert(err, qt.Equals, nil)
+	resp.Body.Close()
+	srv.AssertReceivedQuery(c, nil)
+	checkFails(c, `values are not deep equal`, func(c *qt.C) {
+		srv.AssertReceivedQuery(c, url.Values{"a": {""}})
+	})
+}
+
+func TestRecordingTransportAssertReceivedJSONBody(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.NotFoundHandler())
+	transport := &qthttptest.RecordingTransport{}
+	checkFails(c, `no requests recorded`, func(c *qt.C) {
+		transport.AssertReceivedJSONBody(c, nil)
+	})
+	qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		Method: "POST",
+		URL:    srv.URL() + "/items",
+		JSONBody: map[string]interface{}{
+			"name": "x",
+			"tags": []string{"a", "b"},
+			"meta": map[string]int{"n": 1, "m": 2},
+		},
+		Do: (&http.Client{Transport: transport}).Do,
+	})
+	transport.AssertReceivedJSONBody(c, map[string]interface{}{
+		"name": "x",
+		"tags": []string{"a", "b"},
+		"meta": map[string]int{"m": 2, "n": 1},
+	})
+	transport.AssertReceivedJSONSubset(c, map[string]interface{}{
+		"tags": []string{"a", "b"},
+		"meta": map[string]int{"n": 1},
+	})
+	checkFails(c, `comment:
+  POST http://.*/items
+`, func(c *qt.C) {
+		transport.AssertReceivedJSONBody(c, map[string]interface{}{
+			"name": "x",
+		})
+	})
+	checkFails(c, `POST http://.*/items: body .* does not match: .meta.n: got 1, want 2`, func(c *qt.C) {
+		transport.AssertReceivedJSONSubset(c, map[string]interface{}{
+			"meta": map[string]int{"n": 2},
+		})
+	})
+}
+
+func TestRecordingServerAssertReceivedJSONBodyInvalid(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	resp, err := http.Post(srv.URL()+"/", "application/json", strings.NewReader("{"))
+	c.Assert(err, qt.Equals, nil)
+	resp.Body.Close()
+	checkFails(c, `cannot unmarshal obtained contents: unexpected end of JSON input`, func(c *qt.C) {
+		srv.AssertReceivedJSONBody(c, map[string]interface{}{})
+	})
+	checkFails(c, `POST /: body "{" is not valid JSON: unexpected end of JSON input`, func(c *qt.C) {
+		srv.AssertReceivedJSONSubset(c, map[string]interface{}{})
+	})
+}
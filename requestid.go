@@ -0,0 +1,89 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// RequestIDCallParams holds parameters for AssertRequestID.
+type RequestIDCallParams struct {
+	// DoRequestParams holds the request to make. It is made
+	// twice, with and without a request id. The ExpectError
+	// field is ignored.
+	DoRequestParams
+
+	// IDHeader holds the name of the request id header.
+	// If it is empty, "X-Request-Id" is used.
+	IDHeader string
+
+	// Downstream, if non-nil, records the outbound requests made
+	// by the handler, all of which must carry the request id.
+	Downstream RequestRecorder
+
+	// ExpectStatus holds the expected status of both responses.
+	// If it is zero, http.StatusOK is assumed.
+	ExpectStatus int
+}
+
+// AssertRequestID asserts that the handler supports request ids
+// as most request id middleware does. The request is made first
+// with a random request id, which must be echoed in the response
+// and passed on in every downstream request, and then without one,
+// in which case the handler must generate an id, return it in the
+// response and pass it on in the same way. It returns the
+// generated id.
+func AssertRequestID(c *qt.C, p RequestIDCallParams) string {
+	if p.IDHeader == "" {
+		p.IDHeader = "X-Request-Id"
+	}
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	p.ExpectError = ""
+	var body []byte
+	if p.Body != nil {
+		data, err := ioutil.ReadAll(p.Body)
+		c.Assert(err, qt.Equals, nil)
+		body = data
+	}
+	do := func(id string) string {
+		dp := p.DoRequestParams
+		if body != nil {
+			dp.Body = bytes.NewReader(body)
+		}
+		dp.Header = cloneHeader(dp.Header)
+		dp.Header.Del(p.IDHeader)
+		desc := "generated request id"
+		if id != "" {
+			dp.Header.Set(p.IDHeader, id)
+			desc = fmt.Sprintf("request id %q", id)
+		}
+		before := 0
+		if p.Downstream != nil {
+			before = len(p.Downstream.Requests())
+		}
+		resp := DoResponse(c, dp)
+		resp.AssertStatus(c, p.ExpectStatus)
+		got := resp.Response.Header.Get(p.IDHeader)
+		if id != "" {
+			c.Assert(got, qt.Equals, id, qt.Commentf("%s not echoed in %s response header", desc, p.IDHeader))
+		} else {
+			c.Assert(got, qt.Not(qt.Equals), "", qt.Commentf("no request id generated in %s response header", p.IDHeader))
+		}
+		if p.Downstream != nil {
+			for _, r := range p.Downstream.Requests()[before:] {
+				c.Assert(r.Header.Get(p.IDHeader), qt.Equals, got, qt.Commentf("%s not propagated to downstream request %s %s", desc, r.Method, r.URL))
+			}
+		}
+		return got
+	}
+	do("qthttptest-" + randomHex(8))
+	return do("")
+}
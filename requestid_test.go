@@ -0,0 +1,96 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// requestIDHandler returns a handler that implements request ids
+// using the given header, calling downstream if it is not empty.
+// The generate, echo and propagate flags control which parts of
+// request id handling are implemented.
+func requestIDHandler(header, downstream string, generate, echo, propagate bool) http.Handler {
+	var serial int64
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(header)
+		if id == "" && generate {
+			id = fmt.Sprintf("generated-%d", atomic.AddInt64(&serial, 1))
+		}
+		if echo {
+			w.Header().Set(header, id)
+		}
+		if downstream != "" {
+			out, _ := http.NewRequest("GET", downstream+"/call", nil)
+			if propagate {
+				out.Header.Set(header, id)
+			}
+			resp, err := http.DefaultClient.Do(out)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			resp.Body.Close()
+		}
+	})
+}
+
+func TestAssertRequestID(t *testing.T) {
+	c := qt.New(t)
+	downstream := qthttptest.NewRecordingServer(c, nil)
+	id := qthttptest.AssertRequestID(c, qthttptest.RequestIDCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: requestIDHandler("X-Request-Id", downstream.URL(), true, true, true),
+			URL:     "/",
+		},
+		Downstream: downstream,
+	})
+	c.Assert(id, qt.Equals, "generated-1")
+	c.Assert(downstream.Requests(), qt.HasLen, 2)
+
+	qthttptest.AssertRequestID(c, qthttptest.RequestIDCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: requestIDHandler("X-Correlation-Id", "", true, true, false),
+			URL:     "/",
+		},
+		IDHeader: "X-Correlation-Id",
+	})
+}
+
+func TestAssertRequestIDFailures(t *testing.T) {
+	c := qt.New(t)
+	downstream := qthttptest.NewRecordingServer(c, nil)
+	checkFails(c, `request id "qthttptest-[0-9a-f]+" not echoed in X-Request-Id response header`, func(c *qt.C) {
+		qthttptest.AssertRequestID(c, qthttptest.RequestIDCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: requestIDHandler("X-Request-Id", "", true, false, false),
+				URL:     "/",
+			},
+		})
+	})
+	checkFails(c, `no request id generated in X-Request-Id response header`, func(c *qt.C) {
+		qthttptest.AssertRequestID(c, qthttptest.RequestIDCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: requestIDHandler("X-Request-Id", "", false, true, false),
+				URL:     "/",
+			},
+		})
+	})
+	checkFails(c, `request id "qthttptest-[0-9a-f]+" not propagated to downstream request GET /call`, func(c *qt.C) {
+		qthttptest.AssertRequestID(c, qthttptest.RequestIDCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: requestIDHandler("X-Request-Id", downstream.URL(), true, true, false),
+				URL:     "/",
+			},
+			Downstream: downstream,
+		})
+	})
+}
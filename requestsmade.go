@@ -0,0 +1,169 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// RequestSpec describes a request expected by AssertRequestsMade.
+type RequestSpec struct {
+	// Method holds the expected request method.
+	// If it is empty, any method matches.
+	Method string
+
+	// Path holds the expected request path, in the
+	// form described for MockExpectation.Path.
+	// If it is empty, any path matches.
+	Path string
+
+	// Match holds additional matchers that the request
+	// must satisfy, such as MatchJSONBody.
+	Match []RequestMatcher
+}
+
+// String returns a description of the spec.
+func (spec RequestSpec) String() string {
+	method, path := spec.Method, spec.Path
+	if method == "" {
+		method = "*"
+	}
+	if path == "" {
+		path = "*"
+	}
+	s := method + " " + path
+	if len(spec.Match) > 0 {
+		s += " (with matchers)"
+	}
+	return s
+}
+
+// mismatches returns all the reasons that r does not match
+// the spec, or the path parameters if it matches.
+func (spec RequestSpec) mismatches(r RecordedRequest) (map[string]string, []error) {
+	var errs []error
+	if spec.Method != "" {
+		if err := MatchMethod(spec.Method)(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	params, ok := matchPath(spec.Path, r.URL.Path)
+	if !ok {
+		errs = append(errs, fmt.Errorf("path %q does not match %q", r.URL.Path, spec.Path))
+	}
+	for _, m := range spec.Match {
+		if err := m(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return params, errs
+}
+
+// RequestsMadeOpts holds options for AssertRequestsMade.
+type RequestsMadeOpts struct {
+	// Unordered specifies that the requests may
+	// have been made in any order.
+	Unordered bool
+
+	// Ignore holds matchers for requests that are not
+	// considered, such as health checks. A request is
+	// ignored if it matches any of them.
+	Ignore []RequestMatcher
+}
+
+// AssertRequestsMade asserts that the given requests, as returned
+// by RecordingServer.Requests or RecordingTransport.Requests for
+// example, match the expected specs one to one, in the same
+// order unless opts.Unordered is set.
+func AssertRequestsMade(c *qt.C, requests []RecordedRequest, expect []RequestSpec, opts RequestsMadeOpts) {
+	var reqs []RecordedRequest
+	for _, r := range requests {
+		if !matchesAny(opts.Ignore, r) {
+			reqs = append(reqs, r)
+		}
+	}
+	if len(reqs) != len(expect) {
+		c.Fatalf("got %d requests, want %d; requests:%s", len(reqs), len(expect), requestList(reqs))
+	}
+	if !opts.Unordered {
+		for i, spec := range expect {
+			if _, errs := spec.mismatches(reqs[i]); len(errs) > 0 {
+				c.Fatalf("request %d (%s %s) does not match %v:%s\nrequests:%s", i, reqs[i].Method, reqs[i].URL, spec, errorList(errs), requestList(reqs))
+			}
+		}
+		return
+	}
+	// Find a one to one matching between the requests
+	// and the specs using augmenting paths.
+	matches := make([][]bool, len(expect))
+	for i, spec := range expect {
+		matches[i] = make([]bool, len(reqs))
+		for j, r := range reqs {
+			_, errs := spec.mismatches(r)
+			matches[i][j] = len(errs) == 0
+		}
+	}
+	reqSpec := make([]int, len(reqs))
+	for j := range reqSpec {
+		reqSpec[j] = -1
+	}
+	var augment func(i int, seen []bool) bool
+	augment = func(i int, seen []bool) bool {
+		for j := range reqs {
+			if !matches[i][j] || seen[j] {
+				continue
+			}
+			seen[j] = true
+			if reqSpec[j] == -1 || augment(reqSpec[j], seen) {
+				reqSpec[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	var unmatched []string
+	for i, spec := range expect {
+		if !augment(i, make([]bool, len(reqs))) {
+			unmatched = append(unmatched, "\n  "+spec.String())
+		}
+	}
+	if len(unmatched) > 0 {
+		var leftover []RecordedRequest
+		for j, r := range reqs {
+			if reqSpec[j] == -1 {
+				leftover = append(leftover, r)
+			}
+		}
+		c.Fatalf("no requests match:%s\nunmatched requests:%s", strings.Join(unmatched, ""), requestList(leftover))
+	}
+}
+
+// matchesAny reports whether r matches any of the given matchers.
+func matchesAny(ms []RequestMatcher, r RecordedRequest) bool {
+	for _, m := range ms {
+		if m(r) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func requestList(reqs []RecordedRequest) string {
+	var buf strings.Builder
+	for _, r := range reqs {
+		fmt.Fprintf(&buf, "\n  %s %s", r.Method, r.URL)
+	}
+	return buf.String()
+}
+
+func errorList(errs []error) string {
+	var buf strings.Builder
+	for _, err := range errs {
+		fmt.Fprintf(&buf, "\n  %v", err)
+	}
+	return buf.String()
+}
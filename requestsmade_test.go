@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/url"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func recordedRequest(method, path, body string) qthttptest.RecordedRequest {
+	return qthttptest.RecordedRequest{
+		Method: method,
+		URL: &url.URL{
+			Path: path,
+		},
+		Body: []byte(body),
+	}
+}
+
+var assertRequestsMadeRequests = []qthttptest.RecordedRequest{
+	recordedRequest("GET", "/healthz", ""),
+	recordedRequest("POST", "/users", `{"name":"bob"}`),
+	recordedRequest("GET", "/users/1", ""),
+	recordedRequest("GET", "/healthz", ""),
+	recordedRequest("DELETE", "/users/1", ""),
+}
+
+var assertRequestsMadeTests = []struct {
+	about       string
+	expect      []qthttptest.RequestSpec
+	opts        qthttptest.RequestsMadeOpts
+	expectError string
+}{{
+	about: "ordered",
+	expect: []qthttptest.RequestSpec{
+		{Method: "GET", Path: "/healthz"},
+		{Method: "POST", Path: "/users", Match: []qthttptest.RequestMatcher{
+			qthttptest.MatchJSONBody(map[string]string{"name": "bob"}),
+		}},
+		{Method: "GET", Path: "/users/{id}"},
+		{Path: "/healthz"},
+		{Method: "DELETE"},
+	},
+}, {
+	about: "ignore noise",
+	expect: []qthttptest.RequestSpec{
+		{Method: "POST", Path: "/users"},
+		{Method: "GET", Path: "/users/1"},
+		{Method: "DELETE", Path: "/users/1"},
+	},
+	opts: qthttptest.RequestsMadeOpts{
+		Ignore: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath("/healthz"),
+		},
+	},
+}, {
+	about: "wrong order",
+	expect: []qthttptest.RequestSpec{
+		{Method: "POST", Path: "/users"},
+		{Method: "DELETE", Path: "/users/1"},
+		{Method: "GET", Path: "/users/1"},
+	},
+	opts: qthttptest.RequestsMadeOpts{
+		Ignore: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath("/healthz"),
+		},
+	},
+	expectError: `request 1 \(GET /users/1\) does not match DELETE /users/1:
+  method GET does not match DELETE
+requests:
+  POST /users
+  GET /users/1
+  DELETE /users/1`,
+}, {
+	about: "body mismatch",
+	expect: []qthttptest.RequestSpec{
+		{Method: "POST", Path: "/users", Match: []qthttptest.RequestMatcher{
+			qthttptest.MatchJSONSubset(map[string]string{"name": "alice"}),
+		}},
+		{Method: "GET", Path: "/users/1"},
+		{Method: "DELETE", Path: "/users/1"},
+	},
+	opts: qthttptest.RequestsMadeOpts{
+		Ignore: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath("/healthz"),
+		},
+	},
+	expectError: `request 0 \(POST /users\) does not match POST /users \(with matchers\):
+  body {"name":"bob"} does not match: .name: got "bob", want "alice"`,
+}, {
+	about: "wrong count",
+	expect: []qthttptest.RequestSpec{
+		{Method: "POST", Path: "/users"},
+	},
+	expectError: `got 5 requests, want 1; requests:
+  GET /healthz
+  POST /users
+  GET /users/1
+  GET /healthz
+  DELETE /users/1`,
+}, {
+	about: "unordered",
+	expect: []qthttptest.RequestSpec{
+		{Method: "DELETE", Path: "/users/1"},
+		// This spec matches both GET requests, so a greedy
+		// match would use up the one needed by the GET /healthz spec.
+		{Method: "GET"},
+		{Method: "POST", Path: "/users"},
+		{Method: "GET", Path: "/users/{id}"},
+		{Path: "/healthz"},
+	},
+	opts: qthttptest.RequestsMadeOpts{
+		Unordered: true,
+	},
+}, {
+	about: "unordered mismatch",
+	expect: []qthttptest.RequestSpec{
+		{Method: "DELETE", Path: "/users/1"},
+		{Method: "PUT", Path: "/users/1"},
+		{Method: "POST", Path: "/users"},
+	},
+	opts: qthttptest.RequestsMadeOpts{
+		Unordered: true,
+		Ignore: []qthttptest.RequestMatcher{
+			qthttptest.MatchPath("/healthz"),
+		},
+	},
+	expectError: `no requests match:
+  PUT /users/1
+unmatched requests:
+  GET /users/1`,
+}}
+
+func TestAssertRequestsMade(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertRequestsMadeTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			if test.expectError != "" {
+				checkFails(c, test.expectError, func(c *qt.C) {
+					qthttptest.AssertRequestsMade(c, assertRequestsMadeRequests, test.expect, test.opts)
+				})
+			} else {
+				qthttptest.AssertRequestsMade(c, assertRequestsMadeRequests, test.expect, test.opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Resp holds a response returned by DoResponse. It provides
+// methods for making assertions on the response.
+type Resp struct {
+	// Response holds the HTTP response. Its body has already
+	// been read but has been replaced so that it can
+	// be read again.
+	Response *http.Response
+
+	// Body holds the response body with any
+	// content encoding removed.
+	Body []byte
+
+	// EncodedLength holds the length of the response
+	// body as received, before any content encoding
+	// was removed.
+	EncodedLength int
+}
+
+// DoResponse is like DoRequest except that it returns a Resp that
+// can be used to make further assertions about the response. It
+// returns nil if p.ExpectError is non-empty.
+func DoResponse(c *qt.C, p DoRequestParams) *Resp {
+	resp := Do(c, p)
+	if p.ExpectError != "" {
+		return nil
+	}
+	rec := recordResponse(c, resp)
+	body, err := decodeContent(resp.Header, rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil)
+	return &Resp{
+		Response:      resp,
+		Body:          body,
+		EncodedLength: rec.Body.Len(),
+	}
+}
+
+// AssertStatus asserts that the response has the given status code.
+func (r *Resp) AssertStatus(c *qt.C, status int) *Resp {
+	c.Assert(r.Response.StatusCode, qt.Equals, status, qt.Commentf("body: %s", r.Body))
+	return r
+}
+
+// AssertJSON asserts that the response has a JSON content type
+// and a body that matches expectBody, which may be a BodyAsserter or
+// a ResponseAsserter as for JSONCallParams.ExpectBody.
+func (r *Resp) AssertJSON(c *qt.C, expectBody interface{}) *Resp {
+	c.Assert(r.Response.Header.Get("Content-Type"), ContentTypeMatches, "application/json")
+	assertJSONBody(c, r.Response, r.Body, expectBody, nil)
+	return r
+}
+
+// AssertNoBody asserts that the response has no body.
+func (r *Resp) AssertNoBody(c *qt.C) *Resp {
+	c.Assert(r.Body, qt.HasLen, 0, qt.Commentf("unexpected body: %q", r.Body))
+	return r
+}
+
+// Header asserts that the response has the given header
+// and returns its first value.
+func (r *Resp) Header(c *qt.C, key string) string {
+	vals := r.Response.Header.Values(key)
+	c.Assert(vals, qt.Not(qt.HasLen), 0, qt.Commentf("header %q not found", key))
+	return vals[0]
+}
+
+// Cookie asserts that the response sets a cookie with the given
+// name and returns it.
+func (r *Resp) Cookie(c *qt.C, name string) *http.Cookie {
+	for _, cookie := range r.Response.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	c.Fatalf("cookie %q not found in response", name)
+	return nil
+}
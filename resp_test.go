@@ -0,0 +1,53 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestDoResponse(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: "/foo",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1234"})
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":1}`))
+		}),
+	})
+	resp.AssertStatus(c, http.StatusCreated).AssertJSON(c, map[string]int{"id": 1})
+	c.Assert(resp.Header(c, "etag"), qt.Equals, `"abc"`)
+	c.Assert(resp.Cookie(c, "session").Value, qt.Equals, "1234")
+
+	checkFails(c, `header "X-Missing" not found`, func(c *qt.C) {
+		resp.Header(c, "X-Missing")
+	})
+	checkFails(c, `cookie "other" not found in response`, func(c *qt.C) {
+		resp.Cookie(c, "other")
+	})
+	checkFails(c, `unexpected body: "\{\\"id\\":1\}"`, func(c *qt.C) {
+		resp.AssertNoBody(c)
+	})
+}
+
+func TestDoResponseWithExpectError(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+		URL: "/",
+		Do: func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("some error")
+		},
+		ExpectError: "some error",
+	})
+	c.Assert(resp, qt.IsNil)
+}
@@ -0,0 +1,282 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strconv"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Scenario holds an ordered sequence of calls that together
+// exercise a multi-step API flow. Values captured from the
+// response to one step can be used in the requests of later
+// steps, and cookies set by the server are sent in
+// subsequent requests.
+type Scenario struct {
+	// Handler, if non-nil, is used to start a server
+	// that is used for all steps with a host-less URL.
+	Handler http.Handler
+
+	// Vars holds values that can be referenced in step templates.
+	// Captured values are added to it as the scenario runs.
+	// It is created if nil.
+	Vars map[string]string
+
+	// Steps holds the steps of the scenario.
+	Steps []ScenarioStep
+}
+
+// ScenarioStep holds one step of a Scenario.
+//
+// Occurrences of {{name}} in the URL, header values, JSONBody and
+// ExpectHeader values of Params are replaced with the value of the
+// scenario variable with that name before the call is made. In
+// JSONBody, only string values are substituted.
+type ScenarioStep struct {
+	// Name holds the name of the subtest for the step.
+	Name string
+
+	// Params holds the parameters for the call.
+	Params JSONCallParams
+
+	// Capture maps variable names to the location in the response
+	// from which to capture their values. A location may be one of:
+	//
+	//	header:<name>	the value of the named header
+	//	cookie:<name>	the value of the cookie set with the given name
+	//	json:<path>	the value at the given dot-separated path
+	//			in the JSON body, for example "items.0.id"
+	//	html:<name>	the value of the HTML input element or
+	//			the content of the meta element with the given name
+	Capture map[string]string
+}
+
+// Run runs all the steps in the scenario in order, each in its own
+// subtest. If a step fails, the remaining steps are not run.
+func (s *Scenario) Run(c *qt.C) {
+	s.run(c, nil)
+}
+
+// run runs the scenario. If hook is non-nil, it is called before
+// each step with the index of the step, and once more with the
+// number of steps after the last step has succeeded.
+func (s *Scenario) run(c *qt.C, hook func(i int, caller *Caller, jar http.CookieJar)) {
+	if s.Vars == nil {
+		s.Vars = make(map[string]string)
+	}
+	jar, err := cookiejar.New(nil)
+	c.Assert(err, qt.Equals, nil)
+	caller := &Caller{}
+	if s.Handler != nil {
+		caller = &NewServer(c, s.Handler).Caller
+	}
+	for i, step := range s.Steps {
+		step := step
+		if hook != nil {
+			hook(i, caller, jar)
+		}
+		ok := c.Run(step.Name, func(c *qt.C) {
+			s.runStep(c, caller, jar, step)
+		})
+		if !ok {
+			return
+		}
+	}
+	if hook != nil {
+		hook(len(s.Steps), caller, jar)
+	}
+}
+
+func (s *Scenario) runStep(c *qt.C, caller *Caller, jar http.CookieJar, step ScenarioStep) {
+	p := step.Params
+	p.URL = s.expand(c, p.URL)
+	p.Header = s.expandHeader(c, p.Header)
+	p.ExpectHeader = s.expandHeader(c, p.ExpectHeader)
+	if p.JSONBody != nil {
+		p.JSONBody = s.expandJSON(c, p.JSONBody)
+	}
+	do := jarDo(jar, p.Do)
+	var resp *http.Response
+	p.Do = func(req *http.Request) (*http.Response, error) {
+		r, err := do(req)
+		resp = r
+		return r, err
+	}
+	caller.AssertJSONCall(c, p)
+	if len(step.Capture) == 0 || resp == nil {
+		return
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, qt.Equals, nil)
+	body, err := decodeContent(resp.Header, data)
+	c.Assert(err, qt.Equals, nil)
+	for name, loc := range step.Capture {
+		val, err := capture(resp, body, loc)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("cannot capture %q", name))
+		c.Logf("captured %s=%q", name, val)
+		s.Vars[name] = val
+	}
+}
+
+var templateVarPattern = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// expand returns s with all variable references replaced.
+func (s *Scenario) expand(c *qt.C, str string) string {
+	return templateVarPattern.ReplaceAllStringFunc(str, func(ref string) string {
+		name := templateVarPattern.FindStringSubmatch(ref)[1]
+		val, ok := s.Vars[name]
+		if !ok {
+			c.Fatalf("undefined scenario variable %q", name)
+		}
+		return val
+	})
+}
+
+func (s *Scenario) expandHeader(c *qt.C, h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	h1 := make(http.Header, len(h))
+	for k, vs := range h {
+		for _, v := range vs {
+			h1[k] = append(h1[k], s.expand(c, v))
+		}
+	}
+	return h1
+}
+
+// expandJSON returns the JSON encoding of v with variable
+// references in all string values replaced.
+func (s *Scenario) expandJSON(c *qt.C, v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	c.Assert(err, qt.Equals, nil)
+	var x interface{}
+	err = json.Unmarshal(data, &x)
+	c.Assert(err, qt.Equals, nil)
+	data, err = json.Marshal(s.expandValue(c, x))
+	c.Assert(err, qt.Equals, nil)
+	return data
+}
+
+func (s *Scenario) expandValue(c *qt.C, x interface{}) interface{} {
+	switch x := x.(type) {
+	case string:
+		return s.expand(c, x)
+	case []interface{}:
+		for i := range x {
+			x[i] = s.expandValue(c, x[i])
+		}
+	case map[string]interface{}:
+		for k := range x {
+			x[k] = s.expandValue(c, x[k])
+		}
+	}
+	return x
+}
+
+// capture returns the value at the given location
+// in the response, as described in ScenarioStep.Capture.
+func capture(resp *http.Response, body []byte, loc string) (string, error) {
+	i := strings.Index(loc, ":")
+	if i == -1 {
+		return "", fmt.Errorf("invalid capture location %q", loc)
+	}
+	kind, arg := loc[:i], loc[i+1:]
+	switch kind {
+	case "header":
+		vals := resp.Header.Values(arg)
+		if len(vals) == 0 {
+			return "", fmt.Errorf("header %q not found", arg)
+		}
+		return vals[0], nil
+	case "cookie":
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == arg {
+				return cookie.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cookie %q not found", arg)
+	case "json":
+		return jsonPathValue(body, arg)
+	case "html":
+		return htmlFieldValue(body, arg)
+	}
+	return "", fmt.Errorf("unknown capture kind %q", kind)
+}
+
+var (
+	htmlTagPattern  = regexp.MustCompile(`(?is)<(input|meta)\b[^>]*>`)
+	htmlAttrPattern = regexp.MustCompile(`(?is)([a-z][a-z0-9_:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// htmlFieldValue returns the value of the input element or the
+// content of the meta element with the given name in the given HTML
+// document. This is intended for extracting values such as CSRF tokens
+// rather than as a general HTML parser.
+func htmlFieldValue(data []byte, name string) (string, error) {
+	for _, tag := range htmlTagPattern.FindAllSubmatch(data, -1) {
+		attrs := make(map[string]string)
+		for _, m := range htmlAttrPattern.FindAllSubmatch(tag[0], -1) {
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(string(m[2]) + string(m[3]) + string(m[4]))
+		}
+		if attrs["name"] != name {
+			continue
+		}
+		if strings.EqualFold(string(tag[1]), "meta") {
+			return attrs["content"], nil
+		}
+		return attrs["value"], nil
+	}
+	return "", fmt.Errorf("HTML field %q not found", name)
+}
+
+// jsonPathValue returns the value at the given dot-separated path
+// in the JSON document data. Strings are returned as is; other values
+// are returned in their JSON encoding.
+func jsonPathValue(data []byte, path string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return "", fmt.Errorf("cannot unmarshal body: %v", err)
+	}
+	if path != "" {
+		for _, elem := range strings.Split(path, ".") {
+			switch y := x.(type) {
+			case map[string]interface{}:
+				v, ok := y[elem]
+				if !ok {
+					return "", fmt.Errorf("field %q not found in path %q", elem, path)
+				}
+				x = v
+			case []interface{}:
+				i, err := strconv.Atoi(elem)
+				if err != nil || i < 0 || i >= len(y) {
+					return "", fmt.Errorf("invalid index %q in path %q", elem, path)
+				}
+				x = y[i]
+			default:
+				return "", fmt.Errorf("cannot index %T with %q in path %q", x, elem, path)
+			}
+		}
+	}
+	if s, ok := x.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(x)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// itemsHandler implements a simple item store for scenario tests.
+// All requests except login require a session cookie.
+type itemsHandler struct {
+	mu     sync.Mutex
+	nextID int
+	items  map[string]string
+}
+
+func (h *itemsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if req.URL.Path == "/login" {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		return
+	}
+	if cookie, err := req.Cookie("session"); err != nil || cookie.Value != "s1" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	var body struct {
+		Name string
+	}
+	switch {
+	case req.Method == "POST" && req.URL.Path == "/items":
+		json.NewDecoder(req.Body).Decode(&body)
+		h.nextID++
+		id := fmt.Sprint(h.nextID)
+		h.items[id] = body.Name
+		w.Header().Set("Location", "/items/"+id)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"item": map[string]interface{}{"id": h.nextID}})
+	case req.Method == "PUT":
+		json.NewDecoder(req.Body).Decode(&body)
+		h.items[strings.TrimPrefix(req.URL.Path, "/items/")] = body.Name
+		json.NewEncoder(w).Encode(body)
+	case req.Method == "DELETE":
+		delete(h.items, strings.TrimPrefix(req.URL.Path, "/items/"))
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestScenario(t *testing.T) {
+	c := qt.New(t)
+	h := &itemsHandler{items: make(map[string]string)}
+	s := &qthttptest.Scenario{
+		Handler: h,
+		Vars:    map[string]string{"name": "widget"},
+		Steps: []qthttptest.ScenarioStep{{
+			Name: "login",
+			Params: qthttptest.JSONCallParams{
+				Method: "POST",
+				URL:    "/login",
+			},
+			Capture: map[string]string{"session": "cookie:session"},
+		}, {
+			Name: "create",
+			Params: qthttptest.JSONCallParams{
+				Method:       "POST",
+				URL:          "/items",
+				JSONBody:     map[string]string{"Name": "{{name}}"},
+				ExpectStatus: http.StatusCreated,
+				ExpectBody:   map[string]interface{}{"item": map[string]interface{}{"id": 1}},
+			},
+			Capture: map[string]string{
+				"id":       "json:item.id",
+				"location": "header:Location",
+			},
+		}, {
+			Name: "update",
+			Params: qthttptest.JSONCallParams{
+				Method:     "PUT",
+				URL:        "{{location}}",
+				JSONBody:   map[string]string{"Name": "{{name}}-{{id}}"},
+				ExpectBody: map[string]string{"Name": "widget-1"},
+			},
+		}, {
+			Name: "delete",
+			Params: qthttptest.JSONCallParams{
+				Method:       "DELETE",
+				URL:          "/items/{{ id }}",
+				ExpectStatus: http.StatusNoContent,
+			},
+		}},
+	}
+	s.Run(c)
+	c.Assert(s.Vars, qt.DeepEquals, map[string]string{
+		"name":     "widget",
+		"session":  "s1",
+		"id":       "1",
+		"location": "/items/1",
+	})
+	c.Assert(h.items, qt.HasLen, 0)
+}
+
+func TestScenarioLoginRedirect(t *testing.T) {
+	c := qt.New(t)
+	s := &qthttptest.Scenario{
+		Handler: redirectingLoginHandler(),
+		Steps: []qthttptest.ScenarioStep{{
+			Name: "login",
+			Params: qthttptest.JSONCallParams{
+				Method:     "POST",
+				URL:        "/login",
+				ExpectBody: "s1",
+			},
+		}, {
+			Name: "home",
+			Params: qthttptest.JSONCallParams{
+				URL:        "/home",
+				ExpectBody: "s1",
+			},
+		}},
+	}
+	s.Run(c)
+}
+
+func TestScenarioStopsOnFailure(t *testing.T) {
+	c := qt.New(t)
+	ran := false
+	checkFails(c, `undefined scenario variable "missing"`, func(c *qt.C) {
+		s := &qthttptest.Scenario{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				ran = true
+			}),
+			Steps: []qthttptest.ScenarioStep{{
+				Name: "first",
+				Params: qthttptest.JSONCallParams{
+					URL: "/{{missing}}",
+				},
+			}, {
+				Name: "second",
+				Params: qthttptest.JSONCallParams{
+					URL: "/",
+				},
+			}},
+		}
+		s.Run(c)
+	})
+	c.Assert(ran, qt.Equals, false)
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Server is a test HTTP server that is shut down automatically when
+// the test completes. It embeds a Caller whose BaseURL refers to the
+// server, so calls with a host-less URL are made against it.
+type Server struct {
+	Caller
+
+	handler http.Handler
+
+	// wrapListener, if non-nil, wraps the
+	// listener each time the server is started.
+	wrapListener func(net.Listener) net.Listener
+
+	mu   sync.Mutex
+	addr string
+	srv  *httptest.Server
+}
+
+// NewServer starts a new server running the given handler
+// and registers a cleanup function with c to shut it down.
+func NewServer(c *qt.C, handler http.Handler) *Server {
+	s := &Server{
+		handler: handler,
+	}
+	s.start(httptest.NewServer(handler))
+	c.Cleanup(func() {
+		// Stop waits for outstanding requests,
+		// which may be blocked on unread bodies.
+		closeOpenBodies(c)
+		s.Stop()
+	})
+	return s
+}
+
+// NewServerOnPort is like NewServer except that the server listens
+// on the given port on 127.0.0.1, which is useful for testing clients
+// that require a fixed port, such as for OAuth2 callbacks. If the
+// port is in use, it retries for a short time before failing. Use
+// FreePort to allocate a port that is not used by other tests.
+func NewServerOnPort(c *qt.C, handler http.Handler, port int) *Server {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	l, err := listenRetry(addr)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("cannot start server on %s", addr))
+	s := &Server{
+		handler: handler,
+	}
+	s.start(startOnListener(handler, l))
+	c.Cleanup(func() {
+		// Stop waits for outstanding requests,
+		// which may be blocked on unread bodies.
+		closeOpenBodies(c)
+		s.Stop()
+	})
+	return s
+}
+
+var allocatedPorts = struct {
+	sync.Mutex
+	ports map[int]bool
+}{
+	ports: make(map[int]bool),
+}
+
+// FreePort returns a port on 127.0.0.1 that was free when it was
+// allocated. The same port is never returned twice in the same
+// process, so tests that use FreePort do not conflict with each
+// other, although another process could still take the port before
+// it is used.
+func FreePort(c *qt.C) int {
+	allocatedPorts.Lock()
+	defer allocatedPorts.Unlock()
+	for i := 0; i < 100; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, qt.Equals, nil)
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if !allocatedPorts.ports[port] {
+			allocatedPorts.ports[port] = true
+			return port
+		}
+	}
+	c.Fatalf("cannot allocate a free port")
+	return 0
+}
+
+// URL returns the base URL of the server, of the
+// form http://ipaddr:port with no trailing slash.
+func (s *Server) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return "http://" + s.addr
+}
+
+// Stop shuts down the server, blocking until all
+// outstanding requests have completed. It does nothing
+// if the server is already stopped.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.mu.Unlock()
+	if srv != nil {
+		srv.Close()
+	}
+}
+
+// Start starts a stopped server listening on the same address as
+// before, so that the URL remains valid. It does nothing if the
+// server is already running.
+func (s *Server) Start(c *qt.C) {
+	s.mu.Lock()
+	running := s.srv != nil
+	addr := s.addr
+	s.mu.Unlock()
+	if running {
+		return
+	}
+	// The port may take a moment to become available
+	// again after the server has been closed.
+	l, err := listenRetry(addr)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("cannot restart server on %s", addr))
+	if s.wrapListener != nil {
+		l = s.wrapListener(l)
+	}
+	s.start(startOnListener(s.handler, l))
+}
+
+// Restart stops the server and starts it again on the same address.
+func (s *Server) Restart(c *qt.C) {
+	s.Stop()
+	s.Start(c)
+}
+
+// listenRetry listens on the given address,
+// retrying for a while if it is in use.
+func listenRetry(addr string) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	for i := 0; i < 50; i++ {
+		l, err = net.Listen("tcp", addr)
+		if err == nil {
+			return l, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, err
+}
+
+// startOnListener starts a test server running
+// the given handler on l.
+func startOnListener(handler http.Handler, l net.Listener) *httptest.Server {
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	return srv
+}
+
+// start records srv as the running server. A restarted server has
+// the same URL, so the Caller's BaseURL is set only the first time,
+// before the Server is returned by its constructor; it must not be
+// written later as it is read without holding s.mu.
+func (s *Server) start(srv *httptest.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.addr == "" {
+		s.Caller.BaseURL = srv.URL
+	}
+	s.srv = srv
+	s.addr = srv.Listener.Addr().String()
+}
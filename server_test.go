@@ -0,0 +1,93 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestServer(t *testing.T) {
+	c := qt.New(t)
+	var srv *qthttptest.Server
+	c.Run("server", func(c *qt.C) {
+		srv = qthttptest.NewServer(c, makeHandler(c, http.StatusOK, "application/json"))
+		srv.Header = http.Header{"X-Tenant": {"t1"}}
+		expectBody := handlerResponse{
+			URL:    "/foo",
+			Method: "GET",
+			Header: http.Header{"X-Tenant": {"t1"}},
+		}
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:        "/foo",
+			ExpectBody: expectBody,
+		})
+		url := srv.URL()
+
+		srv.Stop()
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:         "/foo",
+			ExpectError: ".*connection refused",
+		})
+
+		srv.Start(c)
+		c.Assert(srv.URL(), qt.Equals, url)
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:        "/foo",
+			ExpectBody: expectBody,
+		})
+
+		srv.Restart(c)
+		c.Assert(srv.URL(), qt.Equals, url)
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:        "/foo",
+			ExpectBody: expectBody,
+		})
+	})
+	// The server is shut down when the test completes.
+	_, err := http.Get(srv.URL())
+	c.Assert(err, qt.ErrorMatches, ".*connection refused")
+}
+
+func TestNewServerOnPort(t *testing.T) {
+	c := qt.New(t)
+	port := qthttptest.FreePort(c)
+	c.Assert(qthttptest.FreePort(c), qt.Not(qt.Equals), port)
+	srv := qthttptest.NewServerOnPort(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"callback"`))
+	}), port)
+	c.Assert(srv.URL(), qt.Equals, fmt.Sprintf("http://127.0.0.1:%d", port))
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:        fmt.Sprintf("http://127.0.0.1:%d/cb", port),
+		ExpectBody: "callback",
+	})
+
+	// The port is in use, so a second server cannot start.
+	checkFails(c, fmt.Sprintf(`cannot start server on 127.0.0.1:%d`, port), func(c *qt.C) {
+		qthttptest.NewServerOnPort(c, nil, port)
+	})
+}
+
+func TestServerRestartConcurrentWithCalls(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.NotFoundHandler())
+	url := srv.URL()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			p := srv.DoRequestParams(qthttptest.DoRequestParams{})
+			c.Check(p.BaseURL, qt.Equals, url)
+		}
+	}()
+	srv.Restart(c)
+	<-done
+	c.Assert(srv.BaseURL, qt.Equals, url)
+}
@@ -0,0 +1,233 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// NewLeakCheckedServer is like NewServer except that when the test
+// completes, it also asserts that the server shut down cleanly: that
+// no handler is still running, that every connection to the server,
+// including hijacked ones, has been closed, and that no goroutine or,
+// on Linux, file descriptor created since the server was started is
+// still in use. Failures name the request that was last made on an
+// offending connection and show the stack of any handler that is
+// still running.
+//
+// As all the goroutines and file descriptors in the process are
+// considered, it should not be used in parallel tests.
+func NewLeakCheckedServer(c *qt.C, handler http.Handler) *Server {
+	lc := &leakChecker{
+		goroutines: goroutineStacks(),
+		fds:        openFDs(),
+		conns:      make(map[string]*leakCheckedConn),
+		handlers:   make(map[int]string),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.Equals, nil)
+	handler = lc.handler(handler)
+	s := &Server{
+		handler:      handler,
+		wrapListener: lc.listener,
+	}
+	s.start(startOnListener(handler, s.wrapListener(l)))
+	c.Cleanup(func() {
+		closeOpenBodies(c)
+		lc.stop(c, s)
+	})
+	return s
+}
+
+// leakChecker tracks the connections and
+// running handlers of a server.
+type leakChecker struct {
+	goroutines map[int]string
+	fds        int
+
+	mu sync.Mutex
+	// conns holds all the connections accepted
+	// by the server, keyed by remote address.
+	conns map[string]*leakCheckedConn
+	// handlers holds the requests being handled,
+	// keyed by the id of the goroutine handling them.
+	handlers map[int]string
+}
+
+func (lc *leakChecker) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := currentGoroutineID()
+		call := fmt.Sprintf("%s %s", req.Method, req.URL)
+		lc.mu.Lock()
+		lc.handlers[id] = call
+		if conn := lc.conns[req.RemoteAddr]; conn != nil {
+			conn.lastCall = call
+		}
+		lc.mu.Unlock()
+		defer func() {
+			lc.mu.Lock()
+			delete(lc.handlers, id)
+			lc.mu.Unlock()
+		}()
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (lc *leakChecker) listener(l net.Listener) net.Listener {
+	return &leakCheckedListener{
+		Listener: l,
+		lc:       lc,
+	}
+}
+
+// stop stops the server and checks that it has not leaked anything.
+func (lc *leakChecker) stop(c *qt.C, s *Server) {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.Stop()
+	}()
+	deadline := time.After(leakTimeout)
+	select {
+	case <-stopped:
+	case <-deadline:
+		// Close blocks until all handlers have returned,
+		// so report the ones that are stuck.
+		lc.mu.Lock()
+		var stuck []string
+		stacks := goroutineStacks()
+		for id, call := range lc.handlers {
+			stuck = append(stuck, fmt.Sprintf("handler for %s still running:\n%s", call, stacks[id]))
+		}
+		lc.mu.Unlock()
+		sort.Strings(stuck)
+		c.Errorf("server did not shut down within %v:\n\n%s", leakTimeout, strings.Join(stuck, "\n\n"))
+		if srv != nil {
+			srv.CloseClientConnections()
+		}
+		return
+	}
+	var leaked []string
+	for {
+		leaked = lc.leaks()
+		if len(leaked) == 0 {
+			return
+		}
+		select {
+		case <-deadline:
+			c.Errorf("server leaked resources after shutting down:\n\n%s", strings.Join(leaked, "\n\n"))
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// leaks returns descriptions of the connections,
+// goroutines and file descriptors that remain open.
+func (lc *leakChecker) leaks() []string {
+	var conns, goroutines []string
+	lc.mu.Lock()
+	for addr, conn := range lc.conns {
+		if !conn.closed {
+			last := "no requests"
+			if conn.lastCall != "" {
+				last = "last request " + conn.lastCall
+			}
+			conns = append(conns, fmt.Sprintf("connection from %s not closed; %s", addr, last))
+		}
+	}
+	lc.mu.Unlock()
+	for id, stack := range goroutineStacks() {
+		if _, ok := lc.goroutines[id]; !ok && id != currentGoroutineID() {
+			goroutines = append(goroutines, "goroutine still running: "+stack)
+		}
+	}
+	sort.Strings(conns)
+	sort.Strings(goroutines)
+	leaked := append(conns, goroutines...)
+	if n := openFDs(); n > lc.fds {
+		leaked = append(leaked, fmt.Sprintf("%d more file descriptors open than when the server started", n-lc.fds))
+	}
+	return leaked
+}
+
+type leakCheckedListener struct {
+	net.Listener
+	lc *leakChecker
+}
+
+func (l *leakCheckedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	lconn := &leakCheckedConn{
+		Conn: conn,
+		lc:   l.lc,
+	}
+	l.lc.mu.Lock()
+	l.lc.conns[conn.RemoteAddr().String()] = lconn
+	l.lc.mu.Unlock()
+	return lconn, nil
+}
+
+// leakCheckedConn records when a server connection is closed.
+type leakCheckedConn struct {
+	net.Conn
+	lc *leakChecker
+
+	// closed and lastCall are guarded by lc.mu.
+	closed   bool
+	lastCall string
+}
+
+func (c *leakCheckedConn) Close() error {
+	c.lc.mu.Lock()
+	c.closed = true
+	c.lc.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// currentGoroutineID returns the id of the calling goroutine.
+func currentGoroutineID() int {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// The stack starts with a line like "goroutine 23 [running]:".
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.Atoi(fields[1])
+	return id
+}
+
+// openFDs returns the number of open file descriptors,
+// or zero if that is not known.
+func openFDs() int {
+	if runtime.GOOS != "linux" {
+		return 0
+	}
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	return len(fds)
+}
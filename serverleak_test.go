@@ -0,0 +1,104 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// cleanupTB is a failingTB that runs cleanup
+// functions when runCleanups is called.
+type cleanupTB struct {
+	*failingTB
+	cleanups []func()
+}
+
+func (t *cleanupTB) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *cleanupTB) runCleanups() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func TestNewLeakCheckedServer(t *testing.T) {
+	c := qt.New(t)
+	tb := &cleanupTB{failingTB: &failingTB{TB: t}}
+	srv := qthttptest.NewLeakCheckedServer(qt.New(tb), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"ok"`))
+	}))
+	for i := 0; i < 3; i++ {
+		srv.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:        "/",
+			ExpectBody: "ok",
+		})
+	}
+	// A body that is left open is closed before the server stops.
+	qthttptest.Do(qt.New(tb), qthttptest.DoRequestParams{
+		URL: srv.URL() + "/",
+	})
+	tb.runCleanups()
+	c.Assert(tb.Failed(), qt.Equals, false, qt.Commentf("%s", strings.Join(tb.msgs, "\n")))
+}
+
+func TestNewLeakCheckedServerWithStuckHandler(t *testing.T) {
+	c := qt.New(t)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	tb := &cleanupTB{failingTB: &failingTB{TB: t}}
+	srv := qthttptest.NewLeakCheckedServer(qt.New(tb), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(entered)
+		<-release
+	}))
+	go func() {
+		resp, err := http.Get(srv.URL() + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	tb.runCleanups()
+	close(release)
+	c.Assert(tb.Failed(), qt.Equals, true)
+	c.Assert(strings.Join(tb.msgs, "\n"), qt.Matches, `(?s)server did not shut down within 2s:\n\nhandler for GET /stuck still running:\ngoroutine \d+ .*serverleak_test.go.*`)
+}
+
+func TestNewLeakCheckedServerWithHijackedConnection(t *testing.T) {
+	c := qt.New(t)
+	hijacked := make(chan net.Conn, 1)
+	tb := &cleanupTB{failingTB: &failingTB{TB: t}}
+	srv := qthttptest.NewLeakCheckedServer(qt.New(tb), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		hijacked <- conn
+	}))
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL(), "http://"))
+	c.Assert(err, qt.Equals, nil)
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /upgrade HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(resp.StatusCode, qt.Equals, http.StatusSwitchingProtocols)
+	serverConn := <-hijacked
+	defer serverConn.Close()
+
+	tb.runCleanups()
+	c.Assert(tb.Failed(), qt.Equals, true)
+	c.Assert(strings.Join(tb.msgs, "\n"), qt.Matches, `(?s)server leaked resources after shutting down:\n\nconnection from 127\.0\.0\.1:\d+ not closed; last request GET /upgrade\n.*`)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ServerTiming holds a metric parsed from a Server-Timing header
+// as specified by the W3C Server Timing recommendation.
+type ServerTiming struct {
+	// Name holds the name of the metric, for example "db".
+	Name string
+
+	// Duration holds the value of the dur parameter,
+	// or zero if it is not present.
+	Duration time.Duration
+
+	// Description holds the value of the desc parameter.
+	Description string
+
+	// Params holds all the parameters, keyed by
+	// lower-case name, including dur and desc.
+	Params map[string]string
+}
+
+// ParseServerTiming parses all the Server-Timing headers in h.
+func ParseServerTiming(h http.Header) ([]ServerTiming, error) {
+	var metrics []ServerTiming
+	for _, v := range h.Values("Server-Timing") {
+		m, err := parseServerTimingHeader(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Server-Timing header %q: %v", v, err)
+		}
+		metrics = append(metrics, m...)
+	}
+	return metrics, nil
+}
+
+// AssertServerTiming asserts that the Server-Timing headers in h are
+// well formed, that no metric has a negative duration and that there
+// is a metric with each of the given names. It returns all the
+// metrics keyed by name. When a name is repeated, the first metric
+// with that name is used.
+func AssertServerTiming(c *qt.C, h http.Header, names ...string) map[string]ServerTiming {
+	metrics, err := ParseServerTiming(h)
+	c.Assert(err, qt.Equals, nil)
+	byName := make(map[string]ServerTiming)
+	for _, m := range metrics {
+		c.Assert(m.Duration >= 0, qt.Equals, true, qt.Commentf("%q metric has negative duration %v", m.Name, m.Duration))
+		if _, ok := byName[m.Name]; !ok {
+			byName[m.Name] = m
+		}
+	}
+	for _, name := range names {
+		_, ok := byName[name]
+		c.Assert(ok, qt.Equals, true, qt.Commentf("no %q metric found in %q", name, h.Values("Server-Timing")))
+	}
+	return byName
+}
+
+// parseServerTimingHeader parses a single Server-Timing header value,
+// which may hold several comma-separated metrics.
+func parseServerTimingHeader(s string) ([]ServerTiming, error) {
+	var metrics []ServerTiming
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return metrics, nil
+		}
+		i := strings.IndexAny(s, ";,")
+		if i == -1 {
+			i = len(s)
+		}
+		m := ServerTiming{
+			Name:   strings.TrimSpace(s[:i]),
+			Params: make(map[string]string),
+		}
+		if m.Name == "" || strings.ContainsAny(m.Name, " \t\"=") {
+			return nil, fmt.Errorf("invalid metric name %q", m.Name)
+		}
+		s = s[i:]
+		for {
+			s = strings.TrimLeft(s, " \t")
+			if s == "" || s[0] == ',' {
+				break
+			}
+			if s[0] != ';' {
+				return nil, fmt.Errorf("expected ';' at %q", s)
+			}
+			s = strings.TrimLeft(s[1:], " \t")
+			i := strings.IndexAny(s, "=;,")
+			if i == -1 {
+				i = len(s)
+			}
+			name := strings.ToLower(strings.TrimSpace(s[:i]))
+			s = s[i:]
+			val := ""
+			if s != "" && s[0] == '=' {
+				var err error
+				val, s, err = parseParamValue(strings.TrimLeft(s[1:], " \t"))
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, ok := m.Params[name]; !ok {
+				m.Params[name] = val
+			}
+		}
+		if dur, ok := m.Params["dur"]; ok {
+			ms, err := strconv.ParseFloat(dur, 64)
+			if err != nil || math.IsInf(ms, 0) || math.IsNaN(ms) {
+				return nil, fmt.Errorf("invalid duration %q for metric %q", dur, m.Name)
+			}
+			m.Duration = time.Duration(ms * float64(time.Millisecond))
+		}
+		m.Description = m.Params["desc"]
+		metrics = append(metrics, m)
+	}
+}
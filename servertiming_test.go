@@ -0,0 +1,88 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	c := qt.New(t)
+	h := http.Header{
+		"Server-Timing": {
+			`cache;desc="Cache Read";dur=23.2, db;dur=53`,
+			`miss, app; DUR = 47.2 ;desc="a, \"quoted\" description"`,
+		},
+	}
+	metrics, err := qthttptest.ParseServerTiming(h)
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(metrics, qt.DeepEquals, []qthttptest.ServerTiming{{
+		Name:        "cache",
+		Duration:    23200 * time.Microsecond,
+		Description: "Cache Read",
+		Params:      map[string]string{"desc": "Cache Read", "dur": "23.2"},
+	}, {
+		Name:     "db",
+		Duration: 53 * time.Millisecond,
+		Params:   map[string]string{"dur": "53"},
+	}, {
+		Name:   "miss",
+		Params: map[string]string{},
+	}, {
+		Name:        "app",
+		Duration:    47200 * time.Microsecond,
+		Description: `a, "quoted" description`,
+		Params:      map[string]string{"desc": `a, "quoted" description`, "dur": "47.2"},
+	}})
+
+	byName := qthttptest.AssertServerTiming(c, h, "db", "miss")
+	c.Assert(byName, qt.HasLen, 4)
+	c.Assert(byName["db"].Duration, qt.Equals, 53*time.Millisecond)
+	checkFails(c, `no "total" metric found`, func(c *qt.C) {
+		qthttptest.AssertServerTiming(c, h, "db", "total")
+	})
+	checkFails(c, `"db" metric has negative duration -1ms`, func(c *qt.C) {
+		qthttptest.AssertServerTiming(c, http.Header{"Server-Timing": {"db;dur=-1"}})
+	})
+}
+
+func TestParseServerTimingError(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range []struct {
+		header      string
+		expectError string
+	}{{
+		header:      `db;dur=fast`,
+		expectError: `invalid Server-Timing header .*: invalid duration "fast" for metric "db"`,
+	}, {
+		header:      `db;desc="unterminated`,
+		expectError: `invalid Server-Timing header .*: unterminated quoted string`,
+	}, {
+		header:      `;dur=1`,
+		expectError: `invalid Server-Timing header .*: invalid metric name ""`,
+	}, {
+		header:      `db;desc="x"y`,
+		expectError: `invalid Server-Timing header .*: expected ';' at "y"`,
+	}} {
+		_, err := qthttptest.ParseServerTiming(http.Header{"Server-Timing": {test.header}})
+		c.Assert(err, qt.ErrorMatches, test.expectError, qt.Commentf("header %q", test.header))
+	}
+}
+
+func TestAssertJSONCallWithExpectServerTiming(t *testing.T) {
+	c := qt.New(t)
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL: "/items",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Server-Timing", "db;dur=12.5, total;dur=20")
+		}),
+		ExpectServerTiming: []string{"db", "total"},
+	})
+}
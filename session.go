@@ -0,0 +1,259 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Session makes calls that share a cookie jar, so that cookies set
+// by one response are sent with subsequent requests, as a browser
+// would. The embedded Caller holds defaults for all calls.
+type Session struct {
+	Caller
+
+	// Jar holds the cookies for the session.
+	Jar http.CookieJar
+
+	// Carry holds values, such as CSRF tokens, to extract from each
+	// response and inject into subsequent requests.
+	Carry []Carry
+
+	mu      sync.Mutex
+	carried map[Carry]string
+}
+
+// Carry describes a value to extract from responses and inject into
+// later requests made in a Session.
+type Carry struct {
+	// From holds the location of the value in each response, in one
+	// of the forms described in ScenarioStep.Capture. Responses that
+	// do not contain the value leave the current value unchanged.
+	From string
+
+	// To holds where to inject the value into requests. It may be
+	// one of:
+	//
+	//	header:<name>	set the named header
+	//	form:<name>	set the named field in a request body
+	//			of type application/x-www-form-urlencoded
+	//
+	// Nothing is injected until a value has been extracted.
+	To string
+}
+
+// NewSession returns a new session with an empty cookie jar.
+func NewSession(c *qt.C) *Session {
+	jar, err := cookiejar.New(nil)
+	c.Assert(err, qt.Equals, nil)
+	return &Session{
+		Jar: jar,
+	}
+}
+
+// AssertJSONCall is like the AssertJSONCall function except that
+// it uses the session's cookie jar and defaults.
+func (s *Session) AssertJSONCall(c *qt.C, p JSONCallParams) {
+	p.setDoRequestParams(s.DoRequestParams(p.doRequestParams()))
+	AssertJSONCall(c, p)
+}
+
+// DoRequest is like the DoRequest function except that
+// it uses the session's cookie jar and defaults.
+func (s *Session) DoRequest(c *qt.C, p DoRequestParams) *httptest.ResponseRecorder {
+	return DoRequest(c, s.DoRequestParams(p))
+}
+
+// DoRequestParams returns p with the session's defaults applied
+// and its Do function wrapped to use the session's cookie jar.
+func (s *Session) DoRequestParams(p DoRequestParams) DoRequestParams {
+	p = s.Caller.DoRequestParams(p)
+	p.Do = jarDo(s.Jar, p.Do)
+	if len(s.Carry) > 0 {
+		p.Do = s.carryDo(p.Do)
+	}
+	return p
+}
+
+// carryDo returns a function that calls do, injecting
+// carried values into the request and extracting them
+// from the response.
+func (s *Session) carryDo(do func(*http.Request) (*http.Response, error)) func(*http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		s.mu.Lock()
+		for _, carry := range s.Carry {
+			if val, ok := s.carried[carry]; ok {
+				if err := inject(req, carry.To, val); err != nil {
+					s.mu.Unlock()
+					return nil, err
+				}
+			}
+		}
+		s.mu.Unlock()
+		resp, err := do(req)
+		if err != nil {
+			return resp, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		body, err := decodeContent(resp.Header, data)
+		if err != nil {
+			body = nil
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, carry := range s.Carry {
+			if val, err := capture(resp, body, carry.From); err == nil {
+				if s.carried == nil {
+					s.carried = make(map[Carry]string)
+				}
+				s.carried[carry] = val
+			}
+		}
+		return resp, nil
+	}
+}
+
+// inject adds the given value to the request
+// at the given location, as described in Carry.To.
+func inject(req *http.Request, loc, val string) error {
+	i := strings.Index(loc, ":")
+	if i == -1 {
+		return fmt.Errorf("invalid injection location %q", loc)
+	}
+	kind, arg := loc[:i], loc[i+1:]
+	switch kind {
+	case "header":
+		req.Header.Set(arg, val)
+		return nil
+	case "form":
+		if req.Body == nil {
+			return nil
+		}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" {
+			return nil
+		}
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return fmt.Errorf("cannot read request body: %v", err)
+		}
+		form, err := url.ParseQuery(string(data))
+		if err != nil {
+			return fmt.Errorf("cannot parse form body: %v", err)
+		}
+		form.Set(arg, val)
+		data = []byte(form.Encode())
+		req.Body = readSeekNopCloser{bytes.NewReader(data)}
+		req.ContentLength = int64(len(data))
+		return nil
+	}
+	return fmt.Errorf("unknown injection kind %q", kind)
+}
+
+// Cookies returns the cookies in the jar that would be sent
+// to the given URL. A URL without a host is resolved relative
+// to the session's BaseURL, or to the local host used by
+// temporary servers if that is empty.
+func (s *Session) Cookies(c *qt.C, u string) []*http.Cookie {
+	return s.Jar.Cookies(s.resolve(c, u))
+}
+
+// AssertCookie asserts that the jar holds a cookie
+// for the given URL with the given name and value.
+func (s *Session) AssertCookie(c *qt.C, u, name, value string) {
+	for _, cookie := range s.Cookies(c, u) {
+		if cookie.Name == name {
+			c.Assert(cookie.Value, qt.Equals, value, qt.Commentf("cookie %q", name))
+			return
+		}
+	}
+	c.Fatalf("cookie %q not found in jar for %q", name, u)
+}
+
+// AssertNoCookie asserts that the jar holds no cookie
+// for the given URL with the given name.
+func (s *Session) AssertNoCookie(c *qt.C, u, name string) {
+	for _, cookie := range s.Cookies(c, u) {
+		c.Assert(cookie.Name, qt.Not(qt.Equals), name, qt.Commentf("unexpected cookie found in jar for %q", u))
+	}
+}
+
+func (s *Session) resolve(c *qt.C, u string) *url.URL {
+	return resolveURL(c, s.BaseURL, u)
+}
+
+// resolveURL resolves u relative to base, or to the local
+// host used by temporary servers if base is empty.
+func resolveURL(c *qt.C, base, u string) *url.URL {
+	if base == "" {
+		base = "http://127.0.0.1"
+	}
+	baseURL, err := url.Parse(base)
+	c.Assert(err, qt.Equals, nil)
+	ref, err := url.Parse(u)
+	c.Assert(err, qt.Equals, nil)
+	if ref.Host != "" {
+		return ref
+	}
+	return baseURL.ResolveReference(ref)
+}
+
+// jarDo returns a function that makes requests with do, adding
+// cookies from jar to the request and storing in jar the cookies set
+// by the response and by any redirect responses that led to it. If
+// do is nil, an http.Client that uses jar is used, so cookies are also
+// sent on the redirected requests. A non-nil do is given only the
+// cookies for the original request.
+func jarDo(jar http.CookieJar, do func(*http.Request) (*http.Response, error)) func(*http.Request) (*http.Response, error) {
+	if do == nil {
+		return (&http.Client{Jar: jar}).Do
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		for _, cookie := range jar.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+		resp, err := do(req)
+		if err != nil {
+			return resp, err
+		}
+		storeCookies(jar, req, resp)
+		return resp, nil
+	}
+}
+
+// storeCookies stores in jar the cookies set by resp, the response
+// to req, and by the redirect responses that led to it, earliest
+// first, each against the URL of the request that received it.
+func storeCookies(jar http.CookieJar, req *http.Request, resp *http.Response) {
+	var hops []*http.Response
+	for r := resp; r != nil; r = r.Request.Response {
+		hops = append(hops, r)
+		if r.Request == nil {
+			break
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		u := req.URL
+		if hops[i].Request != nil {
+			u = hops[i].Request.URL
+		}
+		jar.SetCookies(u, hops[i].Cookies())
+	}
+}
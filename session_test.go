@@ -0,0 +1,158 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestSession(t *testing.T) {
+	c := qt.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+	})
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + cookie.Value + `"`))
+	})
+	s := qthttptest.NewSession(c)
+	s.Handler = mux
+
+	s.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:          "/whoami",
+		ExpectStatus: http.StatusUnauthorized,
+	})
+	s.AssertNoCookie(c, "/", "session")
+
+	s.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/login",
+	})
+	s.AssertCookie(c, "/", "session", "s1")
+	s.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:        "/whoami",
+		ExpectBody: "s1",
+	})
+
+	s.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/logout",
+	})
+	s.AssertNoCookie(c, "/", "session")
+	checkFails(c, `cookie "session" not found in jar for "/"`, func(c *qt.C) {
+		s.AssertCookie(c, "/", "session", "s1")
+	})
+}
+
+func redirectingLoginHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		http.Redirect(w, req, "/home", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + cookie.Value + `"`))
+	})
+	return mux
+}
+
+func TestSessionLoginRedirect(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.NewSession(c)
+	s.Handler = redirectingLoginHandler()
+	s.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Method:     "POST",
+		URL:        "/login",
+		ExpectBody: "s1",
+	})
+	s.AssertCookie(c, "/", "session", "s1")
+}
+
+func TestSessionLoginRedirectWithDo(t *testing.T) {
+	c := qt.New(t)
+	s := qthttptest.NewSession(c)
+	s.Handler = redirectingLoginHandler()
+	// The client has no jar, so the redirected request is
+	// made without the cookie, but the cookie is still stored.
+	s.Do = http.DefaultClient.Do
+	s.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Method:       "POST",
+		URL:          "/login",
+		ExpectStatus: http.StatusUnauthorized,
+	})
+	s.AssertCookie(c, "/", "session", "s1")
+	s.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:        "/home",
+		ExpectBody: "s1",
+	})
+}
+
+func TestSessionCarry(t *testing.T) {
+	c := qt.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/form", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta name="csrf-header" content="hdr&amp;1"></head>` +
+			`<form><input type="hidden" name="csrf_token" value='tok1'></form></html>`))
+	})
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, req *http.Request) {
+		if req.PostFormValue("csrf_token") != "tok1" || req.PostFormValue("other") != "x" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if req.Header.Get("X-CSRF-Token") != "hdr&1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"ok"`))
+	})
+	s := qthttptest.NewSession(c)
+	s.Handler = mux
+	s.Carry = []qthttptest.Carry{{
+		From: "html:csrf_token",
+		To:   "form:csrf_token",
+	}, {
+		From: "html:csrf-header",
+		To:   "header:X-CSRF-Token",
+	}}
+	submit := qthttptest.JSONCallParams{
+		Method: "POST",
+		URL:    "/submit",
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+	}
+
+	// Without the token, the submission is rejected.
+	p := submit
+	p.Body = strings.NewReader("other=x")
+	p.ExpectStatus = http.StatusForbidden
+	s.AssertJSONCall(c, p)
+
+	s.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "/form",
+	})
+	p = submit
+	p.Body = strings.NewReader("other=x")
+	p.ExpectBody = "ok"
+	s.AssertJSONCall(c, p)
+}
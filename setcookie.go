@@ -0,0 +1,168 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// CookieExpectation describes a cookie that a response must set with
+// a Set-Cookie header. Only the attributes that are specified are
+// checked.
+type CookieExpectation struct {
+	// Name holds the name of the cookie.
+	Name string
+
+	// Value, if non-empty, holds the expected value of the cookie.
+	Value string
+
+	// ValueMatches, if non-empty, holds a regular expression
+	// that the whole value must match.
+	ValueMatches string
+
+	// Domain and Path, if non-empty, hold the expected Domain and
+	// Path attributes. Domain is compared case-insensitively and
+	// without any leading dot.
+	Domain string
+	Path   string
+
+	// MinLifetime and MaxLifetime, if non-zero, bound the lifetime
+	// of the cookie, which is given by its Max-Age attribute or,
+	// failing that, by the time from the response Date header, or
+	// the current time if there is none, to its Expires attribute.
+	// A cookie with neither attribute does not satisfy either bound.
+	MinLifetime time.Duration
+	MaxLifetime time.Duration
+
+	// Session specifies that the cookie must have neither
+	// a Max-Age nor an Expires attribute.
+	Session bool
+
+	// Deleted specifies that the cookie must be deleted, with
+	// a Max-Age of zero or less or an Expires time in the past.
+	Deleted bool
+
+	// Secure and HttpOnly specify that the cookie must
+	// have the corresponding attribute.
+	Secure   bool
+	HttpOnly bool
+
+	// SameSite, if non-zero, holds the expected SameSite attribute.
+	// http.SameSiteDefaultMode means that the attribute is present
+	// without a value.
+	SameSite http.SameSite
+}
+
+// AssertSetCookies asserts that the Set-Cookie headers in h set
+// cookies as described by expect. Cookies that are not mentioned
+// in expect are ignored. If a cookie is set more than once, the
+// first is checked.
+func AssertSetCookies(c *qt.C, h http.Header, expect []CookieExpectation) {
+	cookies := (&http.Response{Header: h}).Cookies()
+	now := DefaultClock.Now()
+	if date, err := http.ParseTime(h.Get("Date")); err == nil {
+		now = date
+	}
+	for _, e := range expect {
+		cookie := findCookie(cookies, e.Name)
+		if cookie == nil {
+			c.Fatalf("no cookie %q set; Set-Cookie headers: %q", e.Name, h.Values("Set-Cookie"))
+		}
+		comment := qt.Commentf("Set-Cookie: %s", cookie.Raw)
+		if e.Value != "" {
+			c.Assert(cookie.Value, qt.Equals, e.Value, comment)
+		}
+		if e.ValueMatches != "" {
+			c.Assert(cookie.Value, qt.Matches, e.ValueMatches, comment)
+		}
+		if e.Domain != "" {
+			c.Assert(canonicalCookieDomain(cookie.Domain), qt.Equals, canonicalCookieDomain(e.Domain), qt.Commentf("Domain of Set-Cookie: %s", cookie.Raw))
+		}
+		if e.Path != "" {
+			c.Assert(cookie.Path, qt.Equals, e.Path, qt.Commentf("Path of Set-Cookie: %s", cookie.Raw))
+		}
+		lifetime, persistent := cookieLifetime(cookie, now)
+		if e.Session {
+			c.Assert(persistent, qt.Equals, false, qt.Commentf("cookie %q is not a session cookie; Set-Cookie: %s", e.Name, cookie.Raw))
+		}
+		if e.Deleted {
+			c.Assert(persistent && lifetime <= 0, qt.Equals, true, qt.Commentf("cookie %q is not deleted; Set-Cookie: %s", e.Name, cookie.Raw))
+		}
+		if e.MinLifetime != 0 || e.MaxLifetime != 0 {
+			c.Assert(persistent, qt.Equals, true, qt.Commentf("cookie %q has no Max-Age or Expires attribute; Set-Cookie: %s", e.Name, cookie.Raw))
+		}
+		if e.MinLifetime != 0 && lifetime < e.MinLifetime {
+			c.Fatalf("cookie %q has lifetime %v, want at least %v; Set-Cookie: %s", e.Name, lifetime, e.MinLifetime, cookie.Raw)
+		}
+		if e.MaxLifetime != 0 && lifetime > e.MaxLifetime {
+			c.Fatalf("cookie %q has lifetime %v, want at most %v; Set-Cookie: %s", e.Name, lifetime, e.MaxLifetime, cookie.Raw)
+		}
+		if e.Secure {
+			c.Assert(cookie.Secure, qt.Equals, true, qt.Commentf("cookie %q is not Secure; Set-Cookie: %s", e.Name, cookie.Raw))
+		}
+		if e.HttpOnly {
+			c.Assert(cookie.HttpOnly, qt.Equals, true, qt.Commentf("cookie %q is not HttpOnly; Set-Cookie: %s", e.Name, cookie.Raw))
+		}
+		if e.SameSite != 0 {
+			c.Assert(sameSiteString(cookie.SameSite), qt.Equals, sameSiteString(e.SameSite), qt.Commentf("SameSite of Set-Cookie: %s", cookie.Raw))
+		}
+	}
+}
+
+// AssertSetCookies asserts that the response sets cookies
+// as described for the AssertSetCookies function.
+func (r *Resp) AssertSetCookies(c *qt.C, expect ...CookieExpectation) *Resp {
+	AssertSetCookies(c, r.Response.Header, expect)
+	return r
+}
+
+// canonicalCookieDomain returns the cookie domain d
+// in lower case without a leading dot.
+func canonicalCookieDomain(d string) string {
+	return strings.ToLower(strings.TrimPrefix(d, "."))
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// cookieLifetime returns the lifetime of the cookie relative to now,
+// and whether it has one at all. Max-Age takes precedence over
+// Expires as specified by RFC 6265.
+func cookieLifetime(cookie *http.Cookie, now time.Time) (time.Duration, bool) {
+	switch {
+	case cookie.MaxAge > 0:
+		return time.Duration(cookie.MaxAge) * time.Second, true
+	case cookie.MaxAge < 0:
+		return 0, true
+	case !cookie.Expires.IsZero():
+		return cookie.Expires.Sub(now), true
+	}
+	return 0, false
+}
+
+func sameSiteString(s http.SameSite) string {
+	switch s {
+	case 0:
+		return "unset"
+	case http.SameSiteDefaultMode:
+		return "SameSite"
+	case http.SameSiteLaxMode:
+		return "SameSite=Lax"
+	case http.SameSiteStrictMode:
+		return "SameSite=Strict"
+	case http.SameSiteNoneMode:
+		return "SameSite=None"
+	}
+	return "unknown"
+}
@@ -0,0 +1,241 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+const cookieDate = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var assertSetCookiesTests = []struct {
+	about       string
+	setCookie   []string
+	expect      qthttptest.CookieExpectation
+	expectError string
+}{{
+	about:     "all attributes",
+	setCookie: []string{"other=x", "session=abc123; Domain=.Example.com; Path=/app; Max-Age=3600; Secure; HttpOnly; SameSite=Strict"},
+	expect: qthttptest.CookieExpectation{
+		Name:         "session",
+		Value:        "abc123",
+		ValueMatches: "[a-z0-9]+",
+		Domain:       "example.com",
+		Path:         "/app",
+		MinLifetime:  time.Hour,
+		MaxLifetime:  time.Hour,
+		Secure:       true,
+		HttpOnly:     true,
+		SameSite:     http.SameSiteStrictMode,
+	},
+}, {
+	about:     "lifetime from Expires relative to Date",
+	setCookie: []string{"id=1; Expires=Tue, 03 Jan 2006 15:04:05 GMT"},
+	expect: qthttptest.CookieExpectation{
+		Name:        "id",
+		MinLifetime: 23 * time.Hour,
+		MaxLifetime: 25 * time.Hour,
+	},
+}, {
+	about:     "session cookie",
+	setCookie: []string{"id=1; SameSite"},
+	expect: qthttptest.CookieExpectation{
+		Name:     "id",
+		Session:  true,
+		SameSite: http.SameSiteDefaultMode,
+	},
+}, {
+	about:     "deleted with Max-Age",
+	setCookie: []string{"id=; Max-Age=0"},
+	expect: qthttptest.CookieExpectation{
+		Name:    "id",
+		Deleted: true,
+	},
+}, {
+	about:     "deleted with Expires",
+	setCookie: []string{"id=; Expires=Thu, 01 Jan 1970 00:00:00 GMT"},
+	expect: qthttptest.CookieExpectation{
+		Name:    "id",
+		Deleted: true,
+	},
+}, {
+	about:     "missing cookie",
+	setCookie: []string{"other=x"},
+	expect: qthttptest.CookieExpectation{
+		Name: "id",
+	},
+	expectError: `no cookie "id" set; Set-Cookie headers: \["other=x"\]`,
+}, {
+	about:     "wrong value",
+	setCookie: []string{"id=1"},
+	expect: qthttptest.CookieExpectation{
+		Name:  "id",
+		Value: "2",
+	},
+	expectError: `\ncomment:\n  Set-Cookie: id=1\n.*got:\n  "1"\nwant:\n  "2"\n.*`,
+}, {
+	about:     "value does not match",
+	setCookie: []string{"id=1"},
+	expect: qthttptest.CookieExpectation{
+		Name:         "id",
+		ValueMatches: "[a-z]+",
+	},
+	expectError: `\nerror:\n  value does not match regexp\ncomment:\n  Set-Cookie: id=1\n.*`,
+}, {
+	about:     "wrong domain",
+	setCookie: []string{"id=1; Domain=example.com"},
+	expect: qthttptest.CookieExpectation{
+		Name:   "id",
+		Domain: "example.org",
+	},
+	expectError: `\ncomment:\n  Domain of Set-Cookie: id=1; Domain=example.com\n.*`,
+}, {
+	about:     "wrong path",
+	setCookie: []string{"id=1; Path=/"},
+	expect: qthttptest.CookieExpectation{
+		Name: "id",
+		Path: "/app",
+	},
+	expectError: `\ncomment:\n  Path of Set-Cookie: id=1; Path=/\n.*`,
+}, {
+	about:     "lifetime too short",
+	setCookie: []string{"id=1; Max-Age=60"},
+	expect: qthttptest.CookieExpectation{
+		Name:        "id",
+		MinLifetime: time.Hour,
+	},
+	expectError: `cookie "id" has lifetime 1m0s, want at least 1h0m0s; Set-Cookie: id=1; Max-Age=60`,
+}, {
+	about:     "lifetime too long",
+	setCookie: []string{"id=1; Max-Age=86400"},
+	expect: qthttptest.CookieExpectation{
+		Name:        "id",
+		MaxLifetime: time.Hour,
+	},
+	expectError: `cookie "id" has lifetime 24h0m0s, want at most 1h0m0s; Set-Cookie: id=1; Max-Age=86400`,
+}, {
+	about:     "no lifetime",
+	setCookie: []string{"id=1"},
+	expect: qthttptest.CookieExpectation{
+		Name:        "id",
+		MaxLifetime: time.Hour,
+	},
+	expectError: `\ncomment:\n  cookie "id" has no Max-Age or Expires attribute; Set-Cookie: id=1\n.*`,
+}, {
+	about:     "not a session cookie",
+	setCookie: []string{"id=1; Max-Age=60"},
+	expect: qthttptest.CookieExpectation{
+		Name:    "id",
+		Session: true,
+	},
+	expectError: `\ncomment:\n  cookie "id" is not a session cookie; Set-Cookie: id=1; Max-Age=60\n.*`,
+}, {
+	about:     "not deleted",
+	setCookie: []string{"id=1"},
+	expect: qthttptest.CookieExpectation{
+		Name:    "id",
+		Deleted: true,
+	},
+	expectError: `\ncomment:\n  cookie "id" is not deleted; Set-Cookie: id=1\n.*`,
+}, {
+	about:     "not secure",
+	setCookie: []string{"id=1; HttpOnly"},
+	expect: qthttptest.CookieExpectation{
+		Name:     "id",
+		Secure:   true,
+		HttpOnly: true,
+	},
+	expectError: `\ncomment:\n  cookie "id" is not Secure; Set-Cookie: id=1; HttpOnly\n.*`,
+}, {
+	about:     "not HttpOnly",
+	setCookie: []string{"id=1; Secure"},
+	expect: qthttptest.CookieExpectation{
+		Name:     "id",
+		Secure:   true,
+		HttpOnly: true,
+	},
+	expectError: `\ncomment:\n  cookie "id" is not HttpOnly; Set-Cookie: id=1; Secure\n.*`,
+}, {
+	about:     "wrong SameSite",
+	setCookie: []string{"id=1; SameSite=None"},
+	expect: qthttptest.CookieExpectation{
+		Name:     "id",
+		SameSite: http.SameSiteLaxMode,
+	},
+	expectError: `\ncomment:\n  SameSite of Set-Cookie: id=1; SameSite=None\ngot:\n  "SameSite=None"\nwant:\n  "SameSite=Lax"\n.*`,
+}, {
+	about:     "SameSite missing",
+	setCookie: []string{"id=1"},
+	expect: qthttptest.CookieExpectation{
+		Name:     "id",
+		SameSite: http.SameSiteLaxMode,
+	},
+	expectError: `.*got:\n  "unset"\nwant:\n  "SameSite=Lax"\n.*`,
+}}
+
+func TestAssertSetCookies(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertSetCookiesTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			h := http.Header{
+				"Date":       {cookieDate},
+				"Set-Cookie": test.setCookie,
+			}
+			expect := []qthttptest.CookieExpectation{test.expect}
+			if test.expectError == "" {
+				qthttptest.AssertSetCookies(c, h, expect)
+				return
+			}
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertSetCookies(c, h, expect)
+			})
+		})
+	}
+}
+
+func TestExpectSetCookies(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session",
+			Value:    "abc",
+			Path:     "/",
+			MaxAge:   3600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		Handler:    handler,
+		URL:        "/",
+		ExpectBody: map[string]interface{}{},
+		ExpectSetCookies: []qthttptest.CookieExpectation{{
+			Name:        "session",
+			Path:        "/",
+			MaxLifetime: time.Hour,
+			Secure:      true,
+			HttpOnly:    true,
+			SameSite:    http.SameSiteLaxMode,
+		}},
+	})
+	checkFails(c, `cookie "session" is not a session cookie`, func(c *qt.C) {
+		qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+			Handler: handler,
+			URL:     "/",
+		}).AssertSetCookies(c, qthttptest.CookieExpectation{
+			Name:    "session",
+			Session: true,
+		})
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ShutdownParams holds parameters for AssertGracefulShutdown.
+type ShutdownParams struct {
+	// Server holds the server to shut down. Its Handler is wrapped
+	// so that the in-flight request can be detected, and it must
+	// not already be serving. If it is nil, a server
+	// running Handler is used.
+	Server *http.Server
+
+	// Handler holds the handler to use when Server is nil.
+	Handler http.Handler
+
+	// InFlight holds the request that is in flight when the server
+	// is shut down. Its URL should not contain a host and the
+	// handler should take long enough to respond that the shutdown
+	// starts first. It is made as by Do, except that the Handler,
+	// BaseURL and ExpectError fields are ignored and, if Do is
+	// nil, redirects are not followed.
+	InFlight DoRequestParams
+
+	// ExpectStatus holds the expected status of the in-flight
+	// response. http.StatusOK is assumed if this is zero.
+	ExpectStatus int
+
+	// Timeout holds the maximum time allowed for the shutdown.
+	// If it is zero, ten seconds is used.
+	Timeout time.Duration
+}
+
+// AssertGracefulShutdown starts the in-flight request specified in
+// p, calls Shutdown on the server while the request is being handled,
+// and asserts that new connections are refused while the in-flight
+// response completes normally, and that Shutdown then returns without
+// error. It returns the in-flight response.
+func AssertGracefulShutdown(c *qt.C, p ShutdownParams) *Resp {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if p.Timeout == 0 {
+		p.Timeout = 10 * time.Second
+	}
+	srv := p.Server
+	if srv == nil {
+		srv = &http.Server{
+			Handler: p.Handler,
+		}
+	}
+	handler := srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	started := make(chan struct{})
+	var once sync.Once
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() {
+			close(started)
+		})
+		handler.ServeHTTP(w, req)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.Equals, nil)
+	addr := l.Addr().String()
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	// Make sure the server is not left running if the test fails.
+	c.Cleanup(func() {
+		srv.Close()
+	})
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	dp := p.InFlight
+	dp.Handler = nil
+	dp.ExpectError = ""
+	dp.BaseURL = ""
+	if dp.Do == nil {
+		dp.Do = transport.RoundTrip
+	}
+	dp.URL = "http://" + addr + dp.URL
+	dp, closeServer := prepareDo(c, dp)
+	defer closeServer()
+	req, err := newRequest(dp)
+	c.Assert(err, qt.Equals, nil)
+	if dp.BeforeRequest != nil {
+		dp.BeforeRequest(c, req)
+	}
+	type result struct {
+		resp    *http.Response
+		err     error
+		elapsed time.Duration
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		start := DefaultClock.Now()
+		resp, err := dp.Do(req)
+		inFlight <- result{resp, err, DefaultClock.Now().Sub(start)}
+	}()
+	select {
+	case <-started:
+	case r := <-inFlight:
+		c.Fatalf("in-flight request completed before reaching the handler: %v", r.err)
+	case <-time.After(p.Timeout):
+		c.Fatalf("in-flight request did not reach the handler within %v", p.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	// Shutdown closes the listener first, so new
+	// connections are refused soon after it is called.
+	deadline := time.Now().Add(p.Timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			c.Fatalf("new connections were still accepted after %v", p.Timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var r result
+	select {
+	case r = <-inFlight:
+	case <-time.After(p.Timeout):
+		c.Fatalf("in-flight request did not complete within %v", p.Timeout)
+	}
+	logCall(c, req, r.resp, r.err, r.elapsed)
+	c.Assert(r.err, qt.Equals, nil, qt.Commentf("in-flight request failed"))
+	if dp.AfterResponse != nil {
+		dp.AfterResponse(c, r.resp)
+	}
+	rec := recordResponse(c, r.resp)
+	body, err := decodeContent(r.resp.Header, rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil)
+	resp := &Resp{
+		Response: r.resp,
+		Body:     body,
+	}
+	resp.AssertStatus(c, p.ExpectStatus)
+
+	select {
+	case err = <-shutdown:
+	case <-time.After(p.Timeout):
+		c.Fatalf("Shutdown did not return within %v", p.Timeout)
+	}
+	c.Assert(err, qt.Equals, nil, qt.Commentf("Shutdown failed"))
+	c.Assert(<-served, qt.Equals, http.ErrServerClosed)
+	return resp
+}
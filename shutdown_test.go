@@ -0,0 +1,127 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func slowHandler(d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(d)
+		fmt.Fprintf(w, "done %s", req.URL.Path)
+	})
+}
+
+func TestAssertGracefulShutdown(t *testing.T) {
+	c := qt.New(t)
+	resp := qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+		Handler: slowHandler(200 * time.Millisecond),
+		InFlight: qthttptest.DoRequestParams{
+			URL: "/slow",
+		},
+	})
+	c.Assert(string(resp.Body), qt.Equals, "done /slow")
+}
+
+func TestAssertGracefulShutdownWithServer(t *testing.T) {
+	c := qt.New(t)
+	shutdownCalled := make(chan struct{})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusAccepted)
+		}),
+	}
+	srv.RegisterOnShutdown(func() {
+		close(shutdownCalled)
+	})
+	qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+		Server: srv,
+		InFlight: qthttptest.DoRequestParams{
+			Method: "POST",
+			URL:    "/",
+		},
+		ExpectStatus: http.StatusAccepted,
+	})
+	// Shutdown runs the hook in its own goroutine.
+	select {
+	case <-shutdownCalled:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("shutdown hook not called")
+	}
+}
+
+func TestAssertGracefulShutdownRequestOptions(t *testing.T) {
+	c := qt.New(t)
+	var middleware, after int
+	resp := qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(req.Header.Get("X-Before")))
+		}),
+		InFlight: qthttptest.DoRequestParams{
+			URL: "/",
+			BeforeRequest: func(c *qt.C, req *http.Request) {
+				req.Header.Set("X-Before", "yes")
+			},
+			AfterResponse: func(c *qt.C, resp *http.Response) {
+				after++
+			},
+			RequestMiddleware: []func(http.RoundTripper) http.RoundTripper{
+				func(rt http.RoundTripper) http.RoundTripper {
+					return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						middleware++
+						return rt.RoundTrip(req)
+					})
+				},
+			},
+		},
+	})
+	c.Assert(string(resp.Body), qt.Equals, "yes")
+	c.Assert(middleware, qt.Equals, 1)
+	c.Assert(after, qt.Equals, 1)
+}
+
+func TestAssertGracefulShutdownFailures(t *testing.T) {
+	c := qt.New(t)
+	checkFails(c, `in-flight request failed`, func(c *qt.C) {
+		// The handler aborts the connection, so the in-flight
+		// request does not complete normally.
+		qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+				panic(http.ErrAbortHandler)
+			}),
+			InFlight: qthttptest.DoRequestParams{
+				URL: "/",
+			},
+		})
+	})
+	checkFails(c, `in-flight request did not complete within 50ms`, func(c *qt.C) {
+		qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+			Handler: slowHandler(200 * time.Millisecond),
+			InFlight: qthttptest.DoRequestParams{
+				URL: "/",
+			},
+			Timeout: 50 * time.Millisecond,
+		})
+	})
+	checkFails(c, `body: done /\ngot:\n  int\(200\)\nwant:\n  int\(404\)`, func(c *qt.C) {
+		qthttptest.AssertGracefulShutdown(c, qthttptest.ShutdownParams{
+			Handler: slowHandler(50 * time.Millisecond),
+			InFlight: qthttptest.DoRequestParams{
+				URL: "/",
+			},
+			ExpectStatus: http.StatusNotFound,
+		})
+	})
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColorMode specifies when SideBySideFormatter uses color.
+type ColorMode int
+
+const (
+	// ColorAuto uses color when standard output is a terminal
+	// and the NO_COLOR environment variable is not set.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways always uses color.
+	ColorAlways
+
+	// ColorNever never uses color.
+	ColorNever
+)
+
+const (
+	colorGot   = "\x1b[31m"
+	colorWant  = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// maxSideBySideLines bounds the size of the
+// documents that SideBySideFormatter compares.
+const maxSideBySideLines = 2000
+
+// SideBySideFormatter is a FailureFormatter that appends the obtained
+// and expected JSON bodies, indented and side by side, to the
+// failure report when the response body does not match
+// ExpectBody. Lines that differ are marked with "|", and lines
+// that are present on only one side with "<" or ">". Other
+// failures are reported unchanged, as are calls whose ExpectBody is
+// a BodyAsserter or ResponseAsserter.
+//
+// To use it for all calls, set CallFailureFormatter:
+//
+//	qthttptest.CallFailureFormatter = qthttptest.SideBySideFormatter{}
+type SideBySideFormatter struct {
+	// Width holds the total width of the output. If it
+	// is zero, 160 is used.
+	Width int
+
+	// Color specifies when to highlight the differences.
+	Color ColorMode
+}
+
+// FormatFailure implements FailureFormatter.FormatFailure.
+func (f SideBySideFormatter) FormatFailure(failure CallFailure) string {
+	got, want, ok := sideBySideDocs(failure)
+	if !ok {
+		return failure.Message
+	}
+	width := f.Width
+	if width == 0 {
+		width = 160
+	}
+	return failure.Message + "\n" + renderSideBySide(got, want, width, f.useColor())
+}
+
+func (f SideBySideFormatter) useColor() bool {
+	switch f.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// sideBySideDocs returns the lines of the indented obtained and
+// expected bodies of the failed call, if they can be compared and
+// are different.
+func sideBySideDocs(f CallFailure) (got, want []string, ok bool) {
+	if f.Response == nil || f.ExpectBody == nil {
+		return nil, nil, false
+	}
+	switch f.ExpectBody.(type) {
+	case BodyAsserter, ResponseAsserter:
+		return nil, nil, false
+	}
+	body, err := decodeContent(f.Response.Header, f.Body)
+	if err != nil {
+		return nil, nil, false
+	}
+	body, err = decodeBodyCharset(f.Response.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, nil, false
+	}
+	var gotv interface{}
+	if err := json.Unmarshal(body, &gotv); err != nil {
+		return nil, nil, false
+	}
+	wantv, err := normalizeJSON(f.ExpectBody)
+	if err != nil {
+		return nil, nil, false
+	}
+	got, want = indentedLines(gotv), indentedLines(wantv)
+	if len(got) > maxSideBySideLines || len(want) > maxSideBySideLines {
+		return nil, nil, false
+	}
+	if strings.Join(got, "\n") == strings.Join(want, "\n") {
+		return nil, nil, false
+	}
+	return got, want, true
+}
+
+func indentedLines(v interface{}) []string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return strings.Split(string(data), "\n")
+}
+
+// renderSideBySide renders got and want in two columns
+// aligned according to their longest common subsequence.
+func renderSideBySide(got, want []string, width int, color bool) string {
+	col := (width - 3) / 2
+	if col < 10 {
+		col = 10
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s   %s\n", pad("got:", col), "want:")
+	for _, row := range alignLines(got, want) {
+		left, right := fit(row.got, col), fit(row.want, col)
+		mark := " "
+		switch {
+		case row.gotOnly:
+			mark = "<"
+		case row.wantOnly:
+			mark = ">"
+		case row.got != row.want:
+			mark = "|"
+		}
+		padding := strings.Repeat(" ", col-utf8.RuneCountInString(left))
+		if color && mark != " " {
+			if left != "" {
+				left = colorGot + left + colorReset
+			}
+			if right != "" {
+				right = colorWant + right + colorReset
+			}
+		}
+		line := left + padding + " " + mark + " " + right
+		buf.WriteString(strings.TrimRight(line, " "))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// alignedLine holds one row of side-by-side output.
+type alignedLine struct {
+	got, want         string
+	gotOnly, wantOnly bool
+}
+
+// alignLines aligns got and want using their longest common
+// subsequence of lines. Runs of removed and added lines between
+// common lines are paired up so that changed values are shown on
+// the same row.
+func alignLines(got, want []string) []alignedLine {
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of got[i:] and want[j:].
+	lcs := make([][]int, len(got)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(want)+1)
+	}
+	for i := len(got) - 1; i >= 0; i-- {
+		for j := len(want) - 1; j >= 0; j-- {
+			switch {
+			case got[i] == want[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var rows []alignedLine
+	var removed, added []string
+	flush := func() {
+		for len(removed) > 0 || len(added) > 0 {
+			var row alignedLine
+			switch {
+			case len(removed) > 0 && len(added) > 0:
+				row.got, row.want = removed[0], added[0]
+				removed, added = removed[1:], added[1:]
+			case len(removed) > 0:
+				row.got, row.gotOnly = removed[0], true
+				removed = removed[1:]
+			default:
+				row.want, row.wantOnly = added[0], true
+				added = added[1:]
+			}
+			rows = append(rows, row)
+		}
+	}
+	i, j := 0, 0
+	for i < len(got) || j < len(want) {
+		switch {
+		case i < len(got) && j < len(want) && got[i] == want[j]:
+			flush()
+			rows = append(rows, alignedLine{got: got[i], want: want[j]})
+			i++
+			j++
+		case j == len(want) || i < len(got) && lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, got[i])
+			i++
+		default:
+			added = append(added, want[j])
+			j++
+		}
+	}
+	flush()
+	return rows
+}
+
+// fit truncates s to at most n runes.
+func fit(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// pad pads s with spaces to n runes.
+func pad(s string, n int) string {
+	if k := utf8.RuneCountInString(s); k < n {
+		return s + strings.Repeat(" ", n-k)
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var wideHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id": 1, "name": "widget", "tags": ["a", "b"], "extra": true}`))
+})
+
+func TestSideBySideFormatter(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.CallFailureFormatter, qthttptest.SideBySideFormatter{
+		Width: 51,
+		Color: qthttptest.ColorNever,
+	})
+	checkFails(c, regexp.QuoteMeta(`
+got:                       want:
+{                          {
+  "extra": true,         <
+  "id": 1,                   "id": 1,
+  "name": "widget",      |   "name": "gadget",
+  "tags": [                  "tags": [
+    "a",                       "a",
+    "b"                  |     "b",
+                         >     "c"
+  ]                          ]
+}                          }
+`), func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler: wideHandler,
+			URL:     "/",
+			ExpectBody: map[string]interface{}{
+				"id":   1,
+				"name": "gadget",
+				"tags": []string{"a", "b", "c"},
+			},
+		})
+	})
+}
+
+func TestSideBySideFormatterColor(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	c.Patch(&qthttptest.CallFailureFormatter, qthttptest.SideBySideFormatter{
+		Color: qthttptest.ColorAlways,
+	})
+	checkFails(c, regexp.QuoteMeta("\x1b[31m  \"name\": \"widget\",\x1b[0m")+` +\| `+regexp.QuoteMeta("\x1b[32m  \"name\": \"gadget\",\x1b[0m"), func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			Handler: wideHandler,
+			URL:     "/",
+			ExpectBody: map[string]interface{}{
+				"id":    1,
+				"name":  "gadget",
+				"tags":  []string{"a", "b"},
+				"extra": true,
+			},
+		})
+	})
+}
+
+func TestSideBySideFormatterUnchanged(t *testing.T) {
+	c := qt.New(t)
+	f := qthttptest.SideBySideFormatter{
+		Color: qthttptest.ColorNever,
+	}
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": {"application/json"}},
+	}
+	for _, failure := range []qthttptest.CallFailure{{
+		Message:    "no response",
+		ExpectBody: "x",
+	}, {
+		Message:    "no expected body",
+		Response:   resp,
+		Body:       []byte(`"x"`),
+		ExpectBody: nil,
+	}, {
+		Message:  "body asserter",
+		Response: resp,
+		Body:     []byte(`"x"`),
+		ExpectBody: qthttptest.BodyAsserter(func(c *qt.C, body json.RawMessage) {
+		}),
+	}, {
+		Message:    "invalid JSON",
+		Response:   resp,
+		Body:       []byte(`{`),
+		ExpectBody: "x",
+	}, {
+		Message:    "same body",
+		Response:   resp,
+		Body:       []byte(`{"a": 1}`),
+		ExpectBody: map[string]int{"a": 1},
+	}} {
+		c.Assert(f.FormatFailure(failure), qt.Equals, failure.Message)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// SlowRequestParams holds parameters for SendSlowRequest.
+type SlowRequestParams struct {
+	// Method holds the request method.
+	// If it is empty, GET is used.
+	Method string
+
+	// URL holds the URL of the request, which must
+	// refer to an HTTP server.
+	URL string
+
+	// Header holds headers to add to the request.
+	Header http.Header
+
+	// Body holds the request body.
+	Body []byte
+
+	// ChunkSize holds the number of bytes of the raw request,
+	// including the header, sent at a time. If it is zero,
+	// 1 is used.
+	ChunkSize int
+
+	// Delay holds the time to wait before sending each chunk.
+	Delay time.Duration
+
+	// Truncate, if positive, holds the number of bytes
+	// of the raw request to send. The rest is never sent,
+	// although the connection is held open.
+	Truncate int
+
+	// Timeout holds how long to wait for the server to
+	// respond or close the connection once the request
+	// has been sent. If it is zero, ten seconds is used.
+	Timeout time.Duration
+}
+
+// SlowRequestResult holds the result of SendSlowRequest.
+type SlowRequestResult struct {
+	// BytesSent holds the number of bytes of the
+	// raw request that were sent.
+	BytesSent int
+
+	// Response holds the response, if any. Its
+	// body has been read into Body.
+	Response *http.Response
+	Body     []byte
+
+	// Err holds the error from reading the response, which
+	// is io.EOF or io.ErrUnexpectedEOF if the server closed
+	// the connection without responding.
+	Err error
+
+	// TimedOut records that the server neither responded nor
+	// closed the connection within the timeout.
+	TimedOut bool
+
+	// Elapsed holds the time from the start of the request until
+	// the server responded or closed the connection.
+	Elapsed time.Duration
+}
+
+// SendSlowRequest sends the request described by p over a new
+// connection, writing it slowly or incompletely as specified, and
+// waits for the server to respond or close the connection. Sending
+// stops as soon as the server does either. This can be used to
+// check that a server defends itself against slow clients, for
+// example by setting http.Server.ReadHeaderTimeout.
+func SendSlowRequest(c *qt.C, p SlowRequestParams) SlowRequestResult {
+	if p.Method == "" {
+		p.Method = "GET"
+	}
+	if p.ChunkSize <= 0 {
+		p.ChunkSize = 1
+	}
+	if p.Timeout == 0 {
+		p.Timeout = 10 * time.Second
+	}
+	req, err := http.NewRequest(p.Method, p.URL, bytes.NewReader(p.Body))
+	c.Assert(err, qt.Equals, nil)
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+	var raw bytes.Buffer
+	err = req.Write(&raw)
+	c.Assert(err, qt.Equals, nil)
+	data := raw.Bytes()
+	if p.Truncate > 0 && p.Truncate < len(data) {
+		data = data[:p.Truncate]
+	}
+	conn, err := net.Dial("tcp", req.URL.Host)
+	c.Assert(err, qt.Equals, nil)
+	defer conn.Close()
+
+	start := time.Now()
+	var result SlowRequestResult
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		result.Elapsed = time.Since(start)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		result.Response = resp
+		result.Body, result.Err = ioutil.ReadAll(resp.Body)
+	}()
+	sent := 0
+send:
+	for len(data) > 0 {
+		if p.Delay > 0 {
+			select {
+			case <-done:
+				break send
+			case <-time.After(p.Delay):
+			}
+		}
+		chunk := data
+		if len(chunk) > p.ChunkSize {
+			chunk = chunk[:p.ChunkSize]
+		}
+		n, err := conn.Write(chunk)
+		sent += n
+		if err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	select {
+	case <-done:
+	case <-time.After(p.Timeout):
+		conn.Close()
+		<-done
+		result.TimedOut = true
+		result.Elapsed = time.Since(start)
+	}
+	result.BytesSent = sent
+	return result
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func newReadHeaderTimeoutServer(c *qt.C, timeout time.Duration) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write([]byte(req.Method + " " + req.URL.Path + " " + string(body)))
+	}))
+	srv.Config.ReadHeaderTimeout = timeout
+	srv.Start()
+	c.Cleanup(srv.Close)
+	return srv
+}
+
+// assertRejected asserts that the server gave up on the request,
+// either by closing the connection or by responding with an error.
+func assertRejected(c *qt.C, result qthttptest.SlowRequestResult) {
+	c.Assert(result.TimedOut, qt.Equals, false)
+	if result.Response == nil {
+		c.Assert(result.Err, qt.Not(qt.IsNil))
+		return
+	}
+	c.Assert(result.Response.StatusCode >= 400, qt.Equals, true, qt.Commentf("status %d", result.Response.StatusCode))
+}
+
+func TestSendSlowRequest(t *testing.T) {
+	c := qt.New(t)
+	srv := newReadHeaderTimeoutServer(c, 200*time.Millisecond)
+	result := qthttptest.SendSlowRequest(c, qthttptest.SlowRequestParams{
+		Method:    "PUT",
+		URL:       srv.URL + "/foo",
+		Body:      []byte("hello"),
+		ChunkSize: 1000,
+	})
+	c.Assert(result.Err, qt.Equals, nil)
+	c.Assert(result.TimedOut, qt.Equals, false)
+	c.Assert(result.Response.StatusCode, qt.Equals, http.StatusOK)
+	c.Assert(string(result.Body), qt.Equals, "PUT /foo hello")
+}
+
+func TestSendSlowRequestReadHeaderTimeout(t *testing.T) {
+	c := qt.New(t)
+	srv := newReadHeaderTimeoutServer(c, 100*time.Millisecond)
+	result := qthttptest.SendSlowRequest(c, qthttptest.SlowRequestParams{
+		URL:   srv.URL + "/foo",
+		Delay: 20 * time.Millisecond,
+	})
+	assertRejected(c, result)
+	c.Assert(result.BytesSent > 0, qt.Equals, true)
+	c.Assert(result.BytesSent < 30, qt.Equals, true, qt.Commentf("sent %d bytes", result.BytesSent))
+}
+
+func TestSendSlowRequestTruncated(t *testing.T) {
+	c := qt.New(t)
+	srv := newReadHeaderTimeoutServer(c, 100*time.Millisecond)
+	result := qthttptest.SendSlowRequest(c, qthttptest.SlowRequestParams{
+		URL:       srv.URL + "/foo",
+		ChunkSize: 1000,
+		Truncate:  10,
+	})
+	assertRejected(c, result)
+	c.Assert(result.BytesSent, qt.Equals, 10)
+	c.Assert(result.Elapsed >= 100*time.Millisecond, qt.Equals, true, qt.Commentf("elapsed %v", result.Elapsed))
+}
+
+func TestSendSlowRequestTimedOut(t *testing.T) {
+	c := qt.New(t)
+	srv := newReadHeaderTimeoutServer(c, 0)
+	result := qthttptest.SendSlowRequest(c, qthttptest.SlowRequestParams{
+		URL:      srv.URL + "/foo",
+		Truncate: 10,
+		Timeout:  100 * time.Millisecond,
+	})
+	c.Assert(result.Response, qt.IsNil)
+	c.Assert(result.TimedOut, qt.Equals, true)
+	c.Assert(result.BytesSent, qt.Equals, 10)
+}
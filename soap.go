@@ -0,0 +1,244 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// SOAPCallParams holds parameters for AssertSOAPCall.
+type SOAPCallParams struct {
+	// DoRequestParams holds the parameters used to make the
+	// request. The Method and body fields (Body, BodyFile,
+	// JSONBody and JSONBodyFile) are ignored: the envelope is
+	// always POSTed.
+	DoRequestParams
+
+	// SOAP12 specifies that SOAP 1.2 should be used
+	// rather than SOAP 1.1.
+	SOAP12 bool
+
+	// Action holds the SOAP action for the request. It is sent
+	// in the SOAPAction header for SOAP 1.1 or the action
+	// parameter of the content type for SOAP 1.2.
+	Action string
+
+	// RequestBody holds the content of the request SOAP Body
+	// element. If it is a string or a byte slice, it is used as
+	// is. Otherwise it is marshaled with encoding/xml.
+	RequestBody interface{}
+
+	// ExpectStatus holds the expected HTTP status code.
+	// If this is zero, http.StatusOK is assumed, or
+	// http.StatusInternalServerError if ExpectFault is set.
+	ExpectStatus int
+
+	// ExpectBody holds the expected content of the response
+	// SOAP Body element. If it is a function of type
+	// func(*qt.C, []byte), it is called with the raw XML content.
+	// Otherwise the content is unmarshaled with encoding/xml into a
+	// new value of the same type as ExpectBody, which must
+	// then deep-equal ExpectBody.
+	ExpectBody interface{}
+
+	// ExpectFault, if non-nil, holds the expected SOAP fault. The
+	// Code and String fields are regular expressions. The Detail
+	// field, if non-empty, must match the raw XML of the detail
+	// exactly once leading and trailing space is removed.
+	ExpectFault *SOAPFault
+}
+
+// SOAPFault holds a SOAP fault. For SOAP 1.2 faults, Code holds the
+// code value and String holds the reason text.
+type SOAPFault struct {
+	Code   string
+	String string
+	Detail string
+}
+
+// AssertSOAPCall asserts that when the SOAP request described by
+// p is sent, the response is a SOAP envelope with the
+// expected status, body or fault.
+func AssertSOAPCall(c *qt.C, p SOAPCallParams) {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+		if p.ExpectFault != nil {
+			p.ExpectStatus = http.StatusInternalServerError
+		}
+	}
+	var content []byte
+	switch body := p.RequestBody.(type) {
+	case nil:
+	case string:
+		content = []byte(body)
+	case []byte:
+		content = body
+	default:
+		data, err := xml.Marshal(body)
+		c.Assert(err, qt.Equals, nil)
+		content = data
+	}
+	ns, ctype := soap11Namespace, "text/xml"
+	if p.SOAP12 {
+		ns, ctype = soap12Namespace, "application/soap+xml"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<soap:Envelope xmlns:soap="%s"><soap:Body>`, ns)
+	buf.Write(content)
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+
+	dp := p.DoRequestParams
+	dp.Method = "POST"
+	dp.JSONBody = nil
+	dp.JSONBodyFile = ""
+	dp.BodyFile = ""
+	dp.Body = bytes.NewReader(buf.Bytes())
+	dp.Header = cloneHeader(dp.Header)
+	reqCtype := mime.FormatMediaType(ctype, map[string]string{"charset": "utf-8"})
+	if p.SOAP12 && p.Action != "" {
+		reqCtype = mime.FormatMediaType(ctype, map[string]string{"charset": "utf-8", "action": p.Action})
+	}
+	dp.Header.Set("Content-Type", reqCtype)
+	if !p.SOAP12 {
+		dp.Header.Set("SOAPAction", `"`+p.Action+`"`)
+	}
+
+	rec := DoRequest(c, dp)
+	if dp.ExpectError != "" {
+		return
+	}
+	c.Assert(rec.Code, qt.Equals, p.ExpectStatus, qt.Commentf("body: %s", rec.Body.Bytes()))
+	c.Assert(rec.Header().Get("Content-Type"), ContentTypeMatches, ctype)
+	body, err := decodeContent(rec.Header(), rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil)
+	inner, err := soapBodyContent(rec.Header().Get("Content-Type"), body, ns)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("body: %s", body))
+
+	fault, err := parseSOAPFault(inner)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("body: %s", inner))
+	if p.ExpectFault == nil {
+		c.Assert(fault, qt.IsNil, qt.Commentf("unexpected SOAP fault"))
+	} else {
+		c.Assert(fault, qt.Not(qt.IsNil), qt.Commentf("no SOAP fault found in body %s", inner))
+		c.Assert(fault.Code, qt.Matches, p.ExpectFault.Code, qt.Commentf("fault code"))
+		c.Assert(fault.String, qt.Matches, p.ExpectFault.String, qt.Commentf("fault string"))
+		if p.ExpectFault.Detail != "" {
+			c.Assert(fault.Detail, qt.Equals, p.ExpectFault.Detail, qt.Commentf("fault detail"))
+		}
+		return
+	}
+	switch expect := p.ExpectBody.(type) {
+	case nil:
+	case func(*qt.C, []byte):
+		expect(c, inner)
+	default:
+		v := reflect.New(reflect.TypeOf(expect))
+		err := xml.Unmarshal(inner, v.Interface())
+		c.Assert(err, qt.Equals, nil, qt.Commentf("body: %s", inner))
+		c.Assert(v.Elem().Interface(), qt.DeepEquals, expect)
+	}
+}
+
+// soapBodyContent returns the raw XML content of the Body element of
+// the SOAP envelope in data, checking that the envelope has the
+// expected namespace. Character sets are handled according to
+// the given content type and any XML declaration.
+func soapBodyContent(ctype string, data []byte, ns string) ([]byte, error) {
+	data, err := decodeBodyCharset(ctype, data)
+	if err != nil {
+		return nil, err
+	}
+	var env struct {
+		XMLName xml.Name
+		Body    struct {
+			Content []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		if _, params, _ := mime.ParseMediaType(ctype); params["charset"] != "" {
+			// Already transcoded above.
+			return r, nil
+		}
+		decode := charsetDecoders[strings.ToLower(label)]
+		if decode == nil {
+			return nil, fmt.Errorf("unsupported charset %q", label)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err = decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	if err := dec.Decode(&env); err != nil {
+		return nil, fmt.Errorf("cannot parse SOAP envelope: %v", err)
+	}
+	if env.XMLName.Local != "Envelope" || env.XMLName.Space != ns {
+		return nil, fmt.Errorf("unexpected root element {%s}%s, want {%s}Envelope", env.XMLName.Space, env.XMLName.Local, ns)
+	}
+	return bytes.TrimSpace(env.Body.Content), nil
+}
+
+// parseSOAPFault returns the SOAP 1.1 or 1.2 fault in the given
+// SOAP Body content, or nil if there is none.
+func parseSOAPFault(content []byte) (*SOAPFault, error) {
+	var body struct {
+		Fault *struct {
+			// SOAP 1.1
+			FaultCode   string `xml:"faultcode"`
+			FaultString string `xml:"faultstring"`
+			FaultDetail struct {
+				Content []byte `xml:",innerxml"`
+			} `xml:"detail"`
+			// SOAP 1.2
+			Code   string `xml:"Code>Value"`
+			Reason string `xml:"Reason>Text"`
+			Detail struct {
+				Content []byte `xml:",innerxml"`
+			} `xml:"Detail"`
+		} `xml:"Fault"`
+	}
+	// Wrap the content so that a Fault element is found
+	// even when it is preceded by other elements.
+	wrapped := append(append([]byte("<Body>"), content...), "</Body>"...)
+	if err := xml.Unmarshal(wrapped, &body); err != nil {
+		return nil, fmt.Errorf("cannot parse SOAP body: %v", err)
+	}
+	if body.Fault == nil {
+		return nil, nil
+	}
+	f := body.Fault
+	if f.Code != "" || f.Reason != "" {
+		return &SOAPFault{
+			Code:   strings.TrimSpace(f.Code),
+			String: strings.TrimSpace(f.Reason),
+			Detail: string(bytes.TrimSpace(f.Detail.Content)),
+		}, nil
+	}
+	return &SOAPFault{
+		Code:   strings.TrimSpace(f.FaultCode),
+		String: strings.TrimSpace(f.FaultString),
+		Detail: string(bytes.TrimSpace(f.FaultDetail.Content)),
+	}, nil
+}
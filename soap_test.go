@@ -0,0 +1,116 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+type getPriceRequest struct {
+	XMLName xml.Name `xml:"GetPrice"`
+	Item    string
+}
+
+type getPriceResponse struct {
+	XMLName xml.Name `xml:"GetPriceResponse"`
+	Price   float64
+}
+
+func TestAssertSOAPCall(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Method, qt.Equals, "POST")
+		c.Check(req.Header.Get("Content-Type"), qt.Equals, "text/xml; charset=utf-8")
+		c.Check(req.Header.Get("SOAPAction"), qt.Equals, `"urn:GetPrice"`)
+		body, err := ioutil.ReadAll(req.Body)
+		c.Check(err, qt.Equals, nil)
+		c.Check(string(body), qt.Equals, xml.Header+
+			`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">`+
+			`<soap:Body><GetPrice><Item>apple</Item></GetPrice></soap:Body></soap:Envelope>`)
+		w.Header().Set("Content-Type", "text/xml; charset=iso-8859-1")
+		w.Write([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <GetPriceResponse><Price>1.5</Price></GetPriceResponse>
+  </s:Body>
+</s:Envelope>`))
+	})
+	qthttptest.AssertSOAPCall(c, qthttptest.SOAPCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/soap",
+			Handler: handler,
+		},
+		Action:      "urn:GetPrice",
+		RequestBody: getPriceRequest{Item: "apple"},
+		ExpectBody: getPriceResponse{
+			XMLName: xml.Name{Local: "GetPriceResponse"},
+			Price:   1.5,
+		},
+	})
+	called := false
+	qthttptest.AssertSOAPCall(c, qthttptest.SOAPCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/soap",
+			Handler: handler,
+			// The body fields are ignored.
+			BodyFile:     "no-such-file",
+			JSONBodyFile: "no-such-file",
+		},
+		Action:      "urn:GetPrice",
+		RequestBody: "<GetPrice><Item>apple</Item></GetPrice>",
+		ExpectBody: func(c *qt.C, body []byte) {
+			c.Assert(string(body), qt.Equals, "<GetPriceResponse><Price>1.5</Price></GetPriceResponse>")
+			called = true
+		},
+	})
+	c.Assert(called, qt.Equals, true)
+}
+
+func TestAssertSOAPCallFault(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Check(req.Header.Get("Content-Type"), qt.Equals, `application/soap+xml; action="urn:GetPrice"; charset=utf-8`)
+		c.Check(req.Header.Get("SOAPAction"), qt.Equals, "")
+		w.Header().Set("Content-Type", "application/soap+xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+<env:Body><env:Fault>
+  <env:Code><env:Value>env:Sender</env:Value></env:Code>
+  <env:Reason><env:Text xml:lang="en">unknown item</env:Text></env:Reason>
+  <env:Detail><item>pear</item></env:Detail>
+</env:Fault></env:Body></env:Envelope>`))
+	})
+	qthttptest.AssertSOAPCall(c, qthttptest.SOAPCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL:     "/soap",
+			Handler: handler,
+		},
+		SOAP12:      true,
+		Action:      "urn:GetPrice",
+		RequestBody: getPriceRequest{Item: "pear"},
+		ExpectFault: &qthttptest.SOAPFault{
+			Code:   ".*:Sender",
+			String: "unknown .*",
+			Detail: "<item>pear</item>",
+		},
+	})
+	checkFails(c, "unexpected SOAP fault", func(c *qt.C) {
+		qthttptest.AssertSOAPCall(c, qthttptest.SOAPCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				URL:     "/soap",
+				Handler: handler,
+			},
+			SOAP12:       true,
+			Action:       "urn:GetPrice",
+			ExpectStatus: http.StatusInternalServerError,
+		})
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// StaticFilesParams holds parameters for AssertStaticFiles.
+type StaticFilesParams struct {
+	// Handler holds the handler that serves the files.
+	Handler http.Handler
+
+	// Files holds the files that the handler is expected to serve,
+	// for example an embed.FS or the result of os.DirFS.
+	Files fs.FS
+
+	// Prefix holds the URL path, without any escaping, under which
+	// the files are served. If it is empty, "/" is assumed.
+	Prefix string
+
+	// Missing holds paths, relative to Prefix, that must not be
+	// found. Like Prefix, they are not escaped. A randomly named
+	// path is always checked as well.
+	Missing []string
+}
+
+// AssertStaticFiles asserts that p.Handler serves all the regular
+// files in p.Files. For each file, it asserts that a GET request for
+// its path succeeds with the same content, after removing any content
+// encoding, and with a Content-Type that matches the one implied by
+// its extension or, if it has no known extension, the one sniffed from
+// its content by http.DetectContentType. A file named index.html is
+// requested by the path of its directory, as http.FileServer
+// redirects requests for it there.
+//
+// It also asserts that each path in p.Missing returns a 404
+// Not Found response.
+func AssertStaticFiles(c *qt.C, p StaticFilesParams) {
+	if p.Prefix == "" {
+		p.Prefix = "/"
+	}
+	if !strings.HasSuffix(p.Prefix, "/") {
+		p.Prefix += "/"
+	}
+	n := 0
+	err := fs.WalkDir(p.Files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		content, err := fs.ReadFile(p.Files, name)
+		if err != nil {
+			return err
+		}
+		urlPath := p.Prefix + name
+		if path.Base(name) == "index.html" {
+			urlPath = strings.TrimSuffix(urlPath, "index.html")
+		}
+		resp := DoResponse(c, DoRequestParams{
+			Handler: p.Handler,
+			URL:     escapePath(urlPath),
+		})
+		comment := qt.Commentf("GET %s", urlPath)
+		c.Assert(resp.Response.StatusCode, qt.Equals, http.StatusOK, comment)
+		c.Assert(string(resp.Body), qt.Equals, string(content), comment)
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = http.DetectContentType(content)
+		}
+		c.Assert(resp.Response.Header.Get("Content-Type"), ContentTypeMatches, ctype, comment)
+		n++
+		return nil
+	})
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(n, qt.Not(qt.Equals), 0, qt.Commentf("no files found"))
+	missing := append([]string{"no-such-file-" + randomHex(8)}, p.Missing...)
+	for _, name := range missing {
+		urlPath := p.Prefix + strings.TrimPrefix(name, "/")
+		resp := DoResponse(c, DoRequestParams{
+			Handler: p.Handler,
+			URL:     escapePath(urlPath),
+		})
+		c.Assert(resp.Response.StatusCode, qt.Equals, http.StatusNotFound, qt.Commentf("GET %s", urlPath))
+	}
+}
+
+// escapePath returns the URL path p escaped so that it
+// can be used as a URL, for example to request a file
+// whose name contains "%", "?" or "#".
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
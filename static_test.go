@@ -0,0 +1,144 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+var staticFiles = fstest.MapFS{
+	"hello.txt":       {Data: []byte("hello\n")},
+	"style.css":       {Data: []byte("p { color: red }\n")},
+	"logo":            {Data: []byte("\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR")},
+	"docs/index.html": {Data: []byte("<html><body>docs</body></html>\n")},
+	"docs/intro.html": {Data: []byte("<html><body>intro</body></html>\n")},
+}
+
+var assertStaticFilesTests = []struct {
+	about       string
+	handler     http.Handler
+	prefix      string
+	missing     []string
+	expectError string
+}{{
+	about:   "file server",
+	handler: http.FileServer(http.FS(staticFiles)),
+	missing: []string{"docs/missing.html", "/hello.txt/x"},
+}, {
+	about:   "prefix",
+	handler: http.StripPrefix("/static", http.FileServer(http.FS(staticFiles))),
+	prefix:  "/static",
+}, {
+	about: "different content",
+	handler: http.FileServer(http.FS(fstest.MapFS{
+		"hello.txt": {Data: []byte("goodbye\n")},
+	})),
+	expectError: `values are not equal
+comment:
+  GET /docs/
+got:
+  int\(404\)
+want:
+  int\(200\)
+`,
+}, {
+	about: "wrong content type",
+	handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.FileServer(http.FS(staticFiles)).ServeHTTP(w, req)
+	}),
+	expectError: `media type "application/octet-stream" does not match "text/html"
+comment:
+  GET /docs/
+`,
+}, {
+	about: "missing path found",
+	handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/gone.txt" {
+			w.Write([]byte("still here"))
+			return
+		}
+		http.FileServer(http.FS(staticFiles)).ServeHTTP(w, req)
+	}),
+	missing: []string{"gone.txt"},
+	expectError: `values are not equal
+comment:
+  GET /gone.txt
+got:
+  int\(200\)
+want:
+  int\(404\)
+`,
+}}
+
+func TestAssertStaticFiles(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertStaticFilesTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			p := qthttptest.StaticFilesParams{
+				Handler: test.handler,
+				Files:   staticFiles,
+				Prefix:  test.prefix,
+				Missing: test.missing,
+			}
+			if test.expectError == "" {
+				qthttptest.AssertStaticFiles(c, p)
+				return
+			}
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertStaticFiles(c, p)
+			})
+		})
+	}
+}
+
+func TestAssertStaticFilesSpecialNames(t *testing.T) {
+	c := qt.New(t)
+	files := fstest.MapFS{
+		"100%.txt":    {Data: []byte("all\n")},
+		"c#.txt":      {Data: []byte("sharp\n")},
+		"what?.txt":   {Data: []byte("question\n")},
+		"a dir/b.txt": {Data: []byte("space\n")},
+	}
+	qthttptest.AssertStaticFiles(c, qthttptest.StaticFilesParams{
+		Handler: http.FileServer(http.FS(files)),
+		Files:   files,
+		Missing: []string{"50%.txt"},
+	})
+}
+
+func TestAssertStaticFilesContent(t *testing.T) {
+	c := qt.New(t)
+	files := fstest.MapFS{
+		"hello.txt": {Data: []byte("hello\n")},
+	}
+	checkFails(c, `values are not equal
+comment:
+  GET /hello.txt
+got:
+  "goodbye\\n"
+want:
+  "hello\\n"
+`, func(c *qt.C) {
+		qthttptest.AssertStaticFiles(c, qthttptest.StaticFilesParams{
+			Handler: http.FileServer(http.FS(fstest.MapFS{
+				"hello.txt": {Data: []byte("goodbye\n")},
+			})),
+			Files: files,
+		})
+	})
+	checkFails(c, `no files found`, func(c *qt.C) {
+		qthttptest.AssertStaticFiles(c, qthttptest.StaticFilesParams{
+			Handler: http.FileServer(http.FS(files)),
+			Files:   fstest.MapFS{},
+		})
+	})
+}
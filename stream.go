@@ -0,0 +1,225 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// StreamCallParams holds parameters for AssertStreamCall.
+type StreamCallParams struct {
+	DoRequestParams
+
+	// ExpectStatus holds the expected HTTP status code.
+	// http.StatusOK is assumed if this is zero.
+	ExpectStatus int
+
+	// ExpectBody, if non-nil, holds the expected response body,
+	// which is compared incrementally with the actual body.
+	ExpectBody io.Reader
+
+	// ExpectBodyFile, if non-empty, holds the name of a file
+	// holding the expected response body. It is ignored
+	// if ExpectBody is non-nil.
+	ExpectBodyFile string
+
+	// ExpectSHA256, if non-empty, holds the hex-encoded SHA-256
+	// hash of the expected response body.
+	ExpectSHA256 string
+
+	// ExpectLength, if non-zero, holds the expected length
+	// of the response body. Use a negative value to
+	// expect an empty body.
+	ExpectLength int64
+
+	// ReceiveChunk, if non-nil, is called with each chunk of the
+	// response body as it is read, after any content encoding has
+	// been removed. This can be used to check that a handler sends
+	// its output progressively rather than all at once when it
+	// has finished.
+	ReceiveChunk func(c *qt.C, chunk StreamChunk)
+
+	// ExpectFirstByteWithin, if non-zero, holds the maximum time
+	// between sending the request and receiving the first byte of
+	// the response body.
+	ExpectFirstByteWithin time.Duration
+}
+
+// StreamChunk holds a chunk of a response body
+// received by AssertStreamCall.
+type StreamChunk struct {
+	// Data holds the content of the chunk.
+	Data []byte
+
+	// Offset holds the offset of the chunk in the body.
+	Offset int64
+
+	// Elapsed holds the time from sending the
+	// request to receiving the chunk.
+	Elapsed time.Duration
+}
+
+// streamChunkSize holds the size of the chunks
+// in which response bodies are compared.
+const streamChunkSize = 64 * 1024
+
+// AssertStreamCall makes the request specified in p and checks the
+// response body against the expectations in p without holding the
+// whole body in memory, which makes it suitable for very large
+// responses. Any content encoding is removed before the body is
+// checked. It returns the length of the decoded body.
+func AssertStreamCall(c *qt.C, p StreamCallParams) int64 {
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if reqURL, err := url.Parse(p.URL); err == nil && reqURL.Host == "" && (p.Handler != nil || p.BaseURL == "") {
+		// Do would close its temporary server while the body
+		// is still being read, so start one that lasts
+		// for the rest of the test.
+		handler := p.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		if p.HandlerTimeout != 0 {
+			handler = withHandlerTimeout(handler, p.HandlerTimeout)
+		}
+		p.BaseURL = NewServer(c, handler).URL()
+		p.Handler = nil
+	}
+	expect := p.ExpectBody
+	if expect == nil && p.ExpectBodyFile != "" {
+		f, err := os.Open(p.ExpectBodyFile)
+		c.Assert(err, qt.Equals, nil)
+		defer f.Close()
+		expect = f
+	}
+	start := DefaultClock.Now()
+	resp := Do(c, p.DoRequestParams)
+	if p.ExpectError != "" {
+		return 0
+	}
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, qt.Equals, p.ExpectStatus)
+	body, err := decodeContentReader(resp.Header, resp.Body)
+	c.Assert(err, qt.Equals, nil)
+	chunks := &chunkReader{
+		c:       c,
+		r:       body,
+		start:   start,
+		receive: p.ReceiveChunk,
+	}
+	body = chunks
+
+	hash := sha256.New()
+	body = io.TeeReader(body, hash)
+	var n int64
+	if expect != nil {
+		n, err = compareReaders(body, expect)
+	} else {
+		n, err = io.Copy(ioutil.Discard, body)
+	}
+	c.Assert(err, qt.Equals, nil)
+	switch {
+	case p.ExpectLength > 0:
+		c.Assert(n, qt.Equals, p.ExpectLength, qt.Commentf("body length"))
+	case p.ExpectLength < 0:
+		c.Assert(n, qt.Equals, int64(0), qt.Commentf("body length"))
+	}
+	if p.ExpectSHA256 != "" {
+		c.Assert(hex.EncodeToString(hash.Sum(nil)), qt.Equals, p.ExpectSHA256, qt.Commentf("SHA-256 of %d byte body", n))
+	}
+	if p.ExpectFirstByteWithin > 0 {
+		c.Assert(chunks.n, qt.Not(qt.Equals), int64(0), qt.Commentf("no body received"))
+		c.Assert(chunks.firstByte <= p.ExpectFirstByteWithin, qt.Equals, true, qt.Commentf("first byte received after %v, later than %v", chunks.firstByte, p.ExpectFirstByteWithin))
+	}
+	return n
+}
+
+// chunkReader passes each chunk read from r to receive, if it
+// is non-nil, and records when the first byte was received.
+type chunkReader struct {
+	c         *qt.C
+	r         io.Reader
+	start     time.Time
+	receive   func(c *qt.C, chunk StreamChunk)
+	n         int64
+	firstByte time.Duration
+}
+
+func (r *chunkReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if n > 0 {
+		elapsed := DefaultClock.Now().Sub(r.start)
+		if r.n == 0 {
+			r.firstByte = elapsed
+		}
+		if r.receive != nil {
+			r.receive(r.c, StreamChunk{
+				Data:    append([]byte(nil), buf[:n]...),
+				Offset:  r.n,
+				Elapsed: elapsed,
+			})
+		}
+		r.n += int64(n)
+	}
+	return n, err
+}
+
+// compareReaders reads from got and expect in chunks and returns an
+// error describing the first difference between them, if any.
+// It returns the number of bytes read from got.
+func compareReaders(got, expect io.Reader) (int64, error) {
+	gotBuf := make([]byte, streamChunkSize)
+	expectBuf := make([]byte, streamChunkSize)
+	var offset int64
+	for {
+		n1, err1 := io.ReadFull(got, gotBuf)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return offset + int64(n1), fmt.Errorf("cannot read body: %v", err1)
+		}
+		n2, err2 := io.ReadFull(expect, expectBuf)
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return offset + int64(n1), fmt.Errorf("cannot read expected body: %v", err2)
+		}
+		g, e := gotBuf[:n1], expectBuf[:n2]
+		if !bytes.Equal(g, e) {
+			i := 0
+			for i < len(g) && i < len(e) && g[i] == e[i] {
+				i++
+			}
+			if i == len(g) {
+				return offset + int64(n1), fmt.Errorf("body too short: got %d bytes, expected more", offset+int64(i))
+			}
+			if i == len(e) {
+				return offset + int64(n1), fmt.Errorf("body too long: expected %d bytes, got more", offset+int64(i))
+			}
+			return offset + int64(n1), fmt.Errorf("body differs at offset %d: got %q, expected %q", offset+int64(i), excerpt(g, i), excerpt(e, i))
+		}
+		offset += int64(n1)
+		if err1 != nil {
+			// Both readers are exhausted.
+			return offset, nil
+		}
+	}
+}
+
+// excerpt returns a short excerpt of data starting at i.
+func excerpt(data []byte, i int) []byte {
+	end := i + 32
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[i:end]
+}
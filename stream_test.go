@@ -0,0 +1,224 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// patternReader returns a reader that generates n bytes of a
+// repeating pattern, with the byte at offset flip changed.
+func patternReader(n int64, flip int64) io.Reader {
+	return &patternGen{n: n, flip: flip}
+}
+
+type patternGen struct {
+	off, n, flip int64
+}
+
+func (g *patternGen) Read(buf []byte) (int, error) {
+	if g.off >= g.n {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > g.n-g.off {
+		buf = buf[:g.n-g.off]
+	}
+	for i := range buf {
+		b := byte('a' + (g.off+int64(i))%26)
+		if g.off+int64(i) == g.flip {
+			b = '!'
+		}
+		buf[i] = b
+	}
+	g.off += int64(len(buf))
+	return len(buf), nil
+}
+
+func patternHandler(n int64, gzipped bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var out io.Writer = w
+		if gzipped {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			defer zw.Close()
+			out = zw
+		}
+		io.Copy(out, patternReader(n, -1))
+	})
+}
+
+func TestAssertStreamCall(t *testing.T) {
+	c := qt.New(t)
+	const size = 10 << 20
+	hash := sha256.New()
+	io.Copy(hash, patternReader(size, -1))
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	n := qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: patternHandler(size, false),
+			URL:     "/export",
+		},
+		ExpectBody:   patternReader(size, -1),
+		ExpectSHA256: sum,
+		ExpectLength: size,
+	})
+	c.Assert(n, qt.Equals, int64(size))
+
+	qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: patternHandler(size, true),
+			URL:     "/export",
+			Header:  http.Header{"Accept-Encoding": {"gzip"}},
+		},
+		ExpectSHA256: sum,
+	})
+
+	checkFails(c, `body differs at offset 1234567: got "jklmno.*", expected "!klmno.*"`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: patternHandler(size, false),
+				URL:     "/export",
+			},
+			ExpectBody: patternReader(size, 1234567),
+		})
+	})
+	checkFails(c, `body too short: got 100 bytes, expected more`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: patternHandler(100, false),
+				URL:     "/export",
+			},
+			ExpectBody: patternReader(100000, -1),
+		})
+	})
+	checkFails(c, `body too long: expected 65536 bytes, got more`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: patternHandler(100000, false),
+				URL:     "/export",
+			},
+			ExpectBody: patternReader(65536, -1),
+		})
+	})
+	checkFails(c, `SHA-256 of 100 byte body`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: patternHandler(100, false),
+				URL:     "/export",
+			},
+			ExpectSHA256: sum,
+		})
+	})
+}
+
+func TestAssertStreamCallWithChunks(t *testing.T) {
+	c := qt.New(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+			fmt.Fprintf(w, "event %d\n", i)
+			w.(http.Flusher).Flush()
+		}
+	})
+	var chunks []qthttptest.StreamChunk
+	qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: handler,
+			URL:     "/events",
+		},
+		ExpectBody: strings.NewReader("event 0\nevent 1\nevent 2\n"),
+		ReceiveChunk: func(c *qt.C, chunk qthttptest.StreamChunk) {
+			chunks = append(chunks, chunk)
+		},
+		ExpectFirstByteWithin: 5 * time.Second,
+	})
+	c.Assert(chunks, qt.HasLen, 3)
+	for i, chunk := range chunks {
+		c.Assert(string(chunk.Data), qt.Equals, fmt.Sprintf("event %d\n", i))
+		c.Assert(chunk.Offset, qt.Equals, int64(i*len("event 0\n")))
+		if i > 0 {
+			gap := chunk.Elapsed - chunks[i-1].Elapsed
+			c.Assert(gap >= 40*time.Millisecond, qt.Equals, true, qt.Commentf("gap %v", gap))
+		}
+	}
+
+	checkFails(c, `first byte received after .*, later than 10ms`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: handler,
+				URL:     "/slow",
+			},
+			ExpectFirstByteWithin: 10 * time.Millisecond,
+		})
+	})
+}
+
+var registerStreamHandler sync.Once
+
+func TestAssertStreamCallWithDefaultServeMux(t *testing.T) {
+	c := qt.New(t)
+	const size = 10 << 20
+	// The handler cannot be registered twice, in case
+	// the test is run more than once.
+	registerStreamHandler.Do(func() {
+		http.Handle("/qthttptest/stream", patternHandler(size, false))
+	})
+	qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			URL: "/qthttptest/stream",
+		},
+		ExpectBody:   patternReader(size, -1),
+		ExpectLength: size,
+	})
+}
+
+func TestAssertStreamCallWithExpectBodyFile(t *testing.T) {
+	c := qt.New(t)
+	defer c.Done()
+	file := filepath.Join(c.Mkdir(), "expect")
+	data, err := ioutil.ReadAll(patternReader(200000, -1))
+	c.Assert(err, qt.Equals, nil)
+	err = ioutil.WriteFile(file, data, 0644)
+	c.Assert(err, qt.Equals, nil)
+	qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+		DoRequestParams: qthttptest.DoRequestParams{
+			Handler: patternHandler(200000, false),
+			URL:     "/export",
+		},
+		ExpectBodyFile: file,
+	})
+	checkFails(c, `body length`, func(c *qt.C) {
+		qthttptest.AssertStreamCall(c, qthttptest.StreamCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write(bytes.Repeat([]byte("x"), 10))
+				}),
+				URL: "/",
+			},
+			ExpectLength: -1,
+		})
+	})
+}
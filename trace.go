@@ -0,0 +1,238 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// TraceFormat identifies a trace context propagation format.
+type TraceFormat int
+
+const (
+	// TraceW3C is the W3C Trace Context format, which
+	// uses the traceparent and tracestate headers.
+	TraceW3C TraceFormat = iota
+
+	// TraceB3Multi is the Zipkin B3 format using
+	// multiple X-B3-* headers.
+	TraceB3Multi
+
+	// TraceB3Single is the Zipkin B3 format
+	// using the single b3 header.
+	TraceB3Single
+)
+
+func (f TraceFormat) String() string {
+	switch f {
+	case TraceW3C:
+		return "W3C"
+	case TraceB3Multi:
+		return "B3 multi-header"
+	case TraceB3Single:
+		return "B3 single-header"
+	}
+	return fmt.Sprintf("TraceFormat(%d)", int(f))
+}
+
+// TraceContext holds the trace context of a request.
+type TraceContext struct {
+	// TraceID holds the trace id as 32 lower-case hex digits.
+	TraceID string
+
+	// SpanID holds the id of the span as 16 lower-case hex digits.
+	SpanID string
+
+	// Sampled holds whether the trace is sampled.
+	Sampled bool
+
+	// State holds the W3C tracestate header value, if any.
+	State string
+}
+
+// NewTraceContext returns a sampled trace
+// context with random trace and span ids.
+func NewTraceContext() TraceContext {
+	return TraceContext{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+		Sampled: true,
+	}
+}
+
+// Header returns the headers that propagate the
+// trace context in the given format.
+func (t TraceContext) Header(format TraceFormat) http.Header {
+	h := make(http.Header)
+	sampled := "0"
+	if t.Sampled {
+		sampled = "1"
+	}
+	switch format {
+	case TraceW3C:
+		h.Set("Traceparent", fmt.Sprintf("00-%s-%s-0%s", t.TraceID, t.SpanID, sampled))
+		if t.State != "" {
+			h.Set("Tracestate", t.State)
+		}
+	case TraceB3Multi:
+		h.Set("X-B3-Traceid", t.TraceID)
+		h.Set("X-B3-Spanid", t.SpanID)
+		h.Set("X-B3-Sampled", sampled)
+	case TraceB3Single:
+		h.Set("B3", t.TraceID+"-"+t.SpanID+"-"+sampled)
+	default:
+		panic(fmt.Sprintf("unknown trace format %v", format))
+	}
+	return h
+}
+
+var (
+	traceparentRE = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+	b3SingleRE    = regexp.MustCompile(`^([0-9a-f]{16}|[0-9a-f]{32})-([0-9a-f]{16})(?:-([01d]))?(?:-([0-9a-f]{16}))?$`)
+	traceIDRE     = regexp.MustCompile(`^(?:[0-9a-f]{16}|[0-9a-f]{32})$`)
+	spanIDRE      = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// ParseTraceContext parses the trace context from h in the given
+// format. The SpanID field of the result holds the span id sent in
+// the headers, which is the parent span of the receiver.
+func ParseTraceContext(h http.Header, format TraceFormat) (TraceContext, error) {
+	switch format {
+	case TraceW3C:
+		v := h.Get("Traceparent")
+		if v == "" {
+			return TraceContext{}, fmt.Errorf("no traceparent header")
+		}
+		m := traceparentRE.FindStringSubmatch(v)
+		if m == nil || m[1] == "ff" {
+			return TraceContext{}, fmt.Errorf("invalid traceparent header %q", v)
+		}
+		if strings.Trim(m[2], "0") == "" || strings.Trim(m[3], "0") == "" {
+			return TraceContext{}, fmt.Errorf("all-zero id in traceparent header %q", v)
+		}
+		flags, _ := hex.DecodeString(m[4])
+		return TraceContext{
+			TraceID: m[2],
+			SpanID:  m[3],
+			Sampled: flags[0]&1 != 0,
+			State:   h.Get("Tracestate"),
+		}, nil
+	case TraceB3Multi:
+		traceID, spanID := h.Get("X-B3-Traceid"), h.Get("X-B3-Spanid")
+		if traceID == "" || spanID == "" {
+			return TraceContext{}, fmt.Errorf("missing X-B3-TraceId or X-B3-SpanId header")
+		}
+		if !traceIDRE.MatchString(traceID) {
+			return TraceContext{}, fmt.Errorf("invalid X-B3-TraceId header %q", traceID)
+		}
+		if !spanIDRE.MatchString(spanID) {
+			return TraceContext{}, fmt.Errorf("invalid X-B3-SpanId header %q", spanID)
+		}
+		return TraceContext{
+			TraceID: traceID,
+			SpanID:  spanID,
+			Sampled: h.Get("X-B3-Sampled") == "1" || h.Get("X-B3-Flags") == "1",
+		}, nil
+	case TraceB3Single:
+		v := h.Get("B3")
+		if v == "" {
+			return TraceContext{}, fmt.Errorf("no b3 header")
+		}
+		m := b3SingleRE.FindStringSubmatch(v)
+		if m == nil {
+			return TraceContext{}, fmt.Errorf("invalid b3 header %q", v)
+		}
+		return TraceContext{
+			TraceID: m[1],
+			SpanID:  m[2],
+			Sampled: m[3] == "1" || m[3] == "d",
+		}, nil
+	}
+	return TraceContext{}, fmt.Errorf("unknown trace format %v", format)
+}
+
+// RequestRecorder is implemented by types that record requests,
+// such as RecordingServer and RecordingTransport.
+type RequestRecorder interface {
+	Requests() []RecordedRequest
+}
+
+// TraceCallParams holds parameters for AssertTracePropagation.
+type TraceCallParams struct {
+	// DoRequestParams holds the request to make. The
+	// trace context headers are added to it.
+	DoRequestParams
+
+	// Format holds the propagation format to use.
+	Format TraceFormat
+
+	// Trace holds the trace context to send. If its TraceID
+	// is empty, a new trace context is used.
+	Trace TraceContext
+
+	// Downstream records the outbound requests made by the handler,
+	// for example a RecordingServer that the handler calls.
+	Downstream RequestRecorder
+
+	// ExpectStatus holds the expected response status.
+	// If it is zero, http.StatusOK is assumed.
+	ExpectStatus int
+}
+
+// AssertTracePropagation makes the request described by p with trace
+// context headers and asserts that every request recorded by
+// p.Downstream during the call, of which there must be at least one,
+// carries the same trace in the same format: the trace id and sampling
+// decision must be unchanged, the span id must be valid, and for the
+// W3C format the tracestate must have been passed on. It returns the
+// response.
+func AssertTracePropagation(c *qt.C, p TraceCallParams) *Resp {
+	c.Assert(p.Downstream, qt.Not(qt.IsNil), qt.Commentf("no downstream recorder specified"))
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if p.Trace.TraceID == "" {
+		p.Trace = NewTraceContext()
+		if p.Format == TraceW3C {
+			p.Trace.State = "qthttptest=" + randomHex(4)
+		}
+	}
+	p.Header = cloneHeader(p.Header)
+	for k, v := range p.Trace.Header(p.Format) {
+		p.Header[k] = v
+	}
+	p.ExpectError = ""
+	before := len(p.Downstream.Requests())
+	resp := DoResponse(c, p.DoRequestParams)
+	resp.AssertStatus(c, p.ExpectStatus)
+	reqs := p.Downstream.Requests()[before:]
+	c.Assert(len(reqs) > 0, qt.Equals, true, qt.Commentf("no downstream requests were made"))
+	for _, r := range reqs {
+		desc := fmt.Sprintf("downstream request %s %s", r.Method, r.URL)
+		got, err := ParseTraceContext(r.Header, p.Format)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("%s has no valid %v trace context", desc, p.Format))
+		c.Assert(got.TraceID, qt.Equals, p.Trace.TraceID, qt.Commentf("%s: trace id", desc))
+		c.Assert(got.Sampled, qt.Equals, p.Trace.Sampled, qt.Commentf("%s: sampled flag", desc))
+		if p.Format == TraceW3C {
+			c.Assert(got.State, qt.Equals, p.Trace.State, qt.Commentf("%s: tracestate", desc))
+		}
+	}
+	return resp
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
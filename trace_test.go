@@ -0,0 +1,232 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// tracingHandler returns a handler that calls downstream,
+// propagating the trace context with the given function.
+func tracingHandler(downstream string, propagate func(in, out http.Header)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		out, err := http.NewRequest("GET", downstream+"/call", nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		propagate(req.Header, out.Header)
+		resp, err := http.DefaultClient.Do(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+	})
+}
+
+// propagateChildSpan propagates the trace context in
+// the given format with a new span id.
+func propagateChildSpan(format qthttptest.TraceFormat) func(in, out http.Header) {
+	return func(in, out http.Header) {
+		t, err := qthttptest.ParseTraceContext(in, format)
+		if err != nil {
+			return
+		}
+		t.SpanID = qthttptest.NewTraceContext().SpanID
+		for k, v := range t.Header(format) {
+			out[k] = v
+		}
+	}
+}
+
+var traceFormats = []qthttptest.TraceFormat{
+	qthttptest.TraceW3C,
+	qthttptest.TraceB3Multi,
+	qthttptest.TraceB3Single,
+}
+
+func TestAssertTracePropagation(t *testing.T) {
+	c := qt.New(t)
+	for _, format := range traceFormats {
+		format := format
+		c.Run(format.String(), func(c *qt.C) {
+			downstream := qthttptest.NewRecordingServer(c, nil)
+			handler := tracingHandler(downstream.URL(), propagateChildSpan(format))
+			qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: handler,
+					URL:     "/",
+				},
+				Format:     format,
+				Downstream: downstream,
+			})
+			trace := qthttptest.NewTraceContext()
+			trace.Sampled = false
+			qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: handler,
+					URL:     "/",
+				},
+				Format:     format,
+				Trace:      trace,
+				Downstream: downstream,
+			})
+		})
+	}
+}
+
+func TestAssertTracePropagationFailures(t *testing.T) {
+	c := qt.New(t)
+	downstream := qthttptest.NewRecordingServer(c, nil)
+	checkFails(c, `downstream request GET /call has no valid W3C trace context`, func(c *qt.C) {
+		qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: tracingHandler(downstream.URL(), func(in, out http.Header) {}),
+				URL:     "/",
+			},
+			Downstream: downstream,
+		})
+	})
+	checkFails(c, `downstream request GET /call: trace id`, func(c *qt.C) {
+		// The handler starts a new trace instead of continuing it.
+		qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: tracingHandler(downstream.URL(), func(in, out http.Header) {
+					for k, v := range qthttptest.NewTraceContext().Header(qthttptest.TraceB3Multi) {
+						out[k] = v
+					}
+				}),
+				URL: "/",
+			},
+			Format:     qthttptest.TraceB3Multi,
+			Downstream: downstream,
+		})
+	})
+	checkFails(c, `downstream request GET /call: tracestate`, func(c *qt.C) {
+		qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: tracingHandler(downstream.URL(), func(in, out http.Header) {
+					out.Set("Traceparent", in.Get("Traceparent"))
+				}),
+				URL: "/",
+			},
+			Downstream: downstream,
+		})
+	})
+	checkFails(c, `no downstream requests were made`, func(c *qt.C) {
+		qthttptest.AssertTracePropagation(c, qthttptest.TraceCallParams{
+			DoRequestParams: qthttptest.DoRequestParams{
+				Handler: http.NotFoundHandler(),
+				URL:     "/",
+			},
+			Downstream:   downstream,
+			ExpectStatus: http.StatusNotFound,
+		})
+	})
+}
+
+var parseTraceContextTests = []struct {
+	about       string
+	header      http.Header
+	format      qthttptest.TraceFormat
+	expect      qthttptest.TraceContext
+	expectError string
+}{{
+	about: "w3c",
+	header: http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":  {"congo=t61rcWkgMzE"},
+	},
+	format: qthttptest.TraceW3C,
+	expect: qthttptest.TraceContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+		Sampled: true,
+		State:   "congo=t61rcWkgMzE",
+	},
+}, {
+	about: "w3c not sampled",
+	header: http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+	},
+	format: qthttptest.TraceW3C,
+	expect: qthttptest.TraceContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	},
+}, {
+	about: "w3c zero trace id",
+	header: http.Header{
+		"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+	},
+	format:      qthttptest.TraceW3C,
+	expectError: `all-zero id in traceparent header .*`,
+}, {
+	about: "w3c invalid",
+	header: http.Header{
+		"Traceparent": {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+	},
+	format:      qthttptest.TraceW3C,
+	expectError: `invalid traceparent header .*`,
+}, {
+	about: "b3 multi",
+	header: http.Header{
+		"X-B3-Traceid": {"463ac35c9f6413ad"},
+		"X-B3-Spanid":  {"a2fb4a1d1a96d312"},
+		"X-B3-Sampled": {"1"},
+	},
+	format: qthttptest.TraceB3Multi,
+	expect: qthttptest.TraceContext{
+		TraceID: "463ac35c9f6413ad",
+		SpanID:  "a2fb4a1d1a96d312",
+		Sampled: true,
+	},
+}, {
+	about: "b3 multi missing span",
+	header: http.Header{
+		"X-B3-Traceid": {"463ac35c9f6413ad"},
+	},
+	format:      qthttptest.TraceB3Multi,
+	expectError: `missing X-B3-TraceId or X-B3-SpanId header`,
+}, {
+	about: "b3 single with parent",
+	header: http.Header{
+		"B3": {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d-05e3ac9a4f6e3b90"},
+	},
+	format: qthttptest.TraceB3Single,
+	expect: qthttptest.TraceContext{
+		TraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+		SpanID:  "e457b5a2e4d86bd1",
+		Sampled: true,
+	},
+}, {
+	about: "b3 single invalid",
+	header: http.Header{
+		"B3": {"0"},
+	},
+	format:      qthttptest.TraceB3Single,
+	expectError: `invalid b3 header "0"`,
+}}
+
+func TestParseTraceContext(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range parseTraceContextTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			got, err := qthttptest.ParseTraceContext(test.header, test.format)
+			if test.expectError != "" {
+				c.Assert(err, qt.ErrorMatches, test.expectError)
+				return
+			}
+			c.Assert(err, qt.Equals, nil)
+			c.Assert(got, qt.DeepEquals, test.expect)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// PatchDefaultTransport replaces http.DefaultTransport with rt for
+// the rest of the test, so that code using the default client can
+// be tested. If http.DefaultClient has a nil Transport or uses
+// http.DefaultTransport, it will use rt too. The original transport
+// is restored when the test completes. Because this changes global
+// state, tests using it must not run in parallel.
+//
+// If rt is a URLRewritingTransport with a nil RoundTripper, the
+// original transport is used for the rewritten requests rather than
+// rt itself.
+func PatchDefaultTransport(c *qt.C, rt http.RoundTripper) {
+	old := http.DefaultTransport
+	switch t := rt.(type) {
+	case URLRewritingTransport:
+		if t.RoundTripper == nil {
+			t.RoundTripper = old
+			rt = t
+		}
+	case *URLRewritingTransport:
+		if t.RoundTripper == nil {
+			t1 := *t
+			t1.RoundTripper = old
+			rt = &t1
+		}
+	}
+	oldClientTransport := http.DefaultClient.Transport
+	http.DefaultTransport = rt
+	if oldClientTransport == old {
+		http.DefaultClient.Transport = rt
+	}
+	c.Cleanup(func() {
+		http.DefaultTransport = old
+		http.DefaultClient.Transport = oldClientTransport
+	})
+}
+
+// OverrideDialer returns a function suitable for use as
+// http.Transport.DialContext that connects to the address mapped from
+// the dialed host in hosts instead of resolving it. This redirects
+// requests to test servers at the dial layer, so the request URL, the
+// Host header and the TLS server name all remain unchanged.
+//
+// The keys of hosts may be host names, which match any port, or
+// host:port pairs, which take precedence. The values are addresses of
+// the form host:port; for convenience, a URL such as that returned by
+// Server.URL may be used instead. Addresses that do not match are
+// dialed as usual.
+func OverrideDialer(hosts map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		target, ok := hosts[addr]
+		if !ok {
+			target, ok = hosts[host]
+		}
+		if ok {
+			if u, err := url.Parse(target); err == nil && u.Host != "" {
+				target = u.Host
+			}
+			addr = target
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// NewOverrideTransport returns a copy of base that dials the test
+// servers in hosts as described in OverrideDialer. If base is nil,
+// http.DefaultTransport is used, which must be an *http.Transport.
+// Proxies are disabled in the returned transport so that the
+// overridden addresses are dialed directly.
+func NewOverrideTransport(base *http.Transport, hosts map[string]string) *http.Transport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := base.Clone()
+	t.DialContext = OverrideDialer(hosts)
+	t.Proxy = nil
+	return t
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestPatchDefaultTransport(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	oldTransport := http.DefaultTransport
+	c.Run("patched", func(c *qt.C) {
+		qthttptest.PatchDefaultTransport(c, qthttptest.URLRewritingTransport{
+			MatchPrefix: "http://legacy.example.com",
+			Replace:     srv.URL(),
+		})
+		// Code using the default client directly is redirected.
+		resp, err := http.Get("http://legacy.example.com/api?x=1")
+		c.Assert(err, qt.Equals, nil)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		c.Assert(resp.StatusCode, qt.Equals, http.StatusOK)
+	})
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].URL.String(), qt.Equals, "/api?x=1")
+	c.Assert(http.DefaultTransport, qt.Equals, oldTransport)
+	c.Assert(http.DefaultClient.Transport, qt.IsNil)
+}
+
+func TestNewOverrideTransport(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewRecordingServer(c, nil)
+	client := &http.Client{
+		Transport: qthttptest.NewOverrideTransport(nil, map[string]string{
+			"api.example.com": srv.URL(),
+		}),
+	}
+	qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "http://api.example.com:8080/x",
+		Do:  client.Do,
+	})
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 1)
+	c.Assert(reqs[0].Host, qt.Equals, "api.example.com:8080")
+	c.Assert(reqs[0].URL.String(), qt.Equals, "/x")
+
+	// A matching host:port takes precedence over a host.
+	other := qthttptest.NewRecordingServer(c, nil)
+	client.Transport = qthttptest.NewOverrideTransport(nil, map[string]string{
+		"api.example.com":    srv.URL(),
+		"api.example.com:80": strings.TrimPrefix(other.URL(), "http://"),
+	})
+	qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		URL: "http://api.example.com/y",
+		Do:  client.Do,
+	})
+	c.Assert(srv.Requests(), qt.HasLen, 1)
+	c.Assert(other.Requests(), qt.HasLen, 1)
+}
+
+func TestNewOverrideTransportPreservesServerName(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]string{req.Host, req.TLS.ServerName})
+	}))
+	defer srv.Close()
+	// The test server's certificate is valid for example.com.
+	transport := qthttptest.NewOverrideTransport(srv.Client().Transport.(*http.Transport), map[string]string{
+		"example.com": srv.Listener.Addr().String(),
+	})
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:        "https://example.com/",
+		Do:         (&http.Client{Transport: transport}).Do,
+		ExpectBody: []string{"example.com", "example.com"},
+	})
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// ExpectBodyAs returns a BodyAsserter that unmarshals the response
+// body as JSON into a value of type T and calls check with the
+// result. It can be used as the value of JSONCallParams.ExpectBody.
+// For example:
+//
+//	ExpectBody: qthttptest.ExpectBodyAs(func(c *qt.C, resp params.ListResponse) {
+//		c.Assert(resp.Items, qt.HasLen, 3)
+//	}),
+func ExpectBodyAs[T any](check func(c *qt.C, v T)) BodyAsserter {
+	return func(c *qt.C, body json.RawMessage) {
+		var v T
+		err := json.Unmarshal(body, &v)
+		c.Assert(err, qt.Equals, nil, qt.Commentf("cannot unmarshal body into %T: %s", v, body))
+		check(c, v)
+	}
+}
+
+// DecodeJSONResponse asserts that the given response recorder
+// has recorded a JSON response and returns its body
+// unmarshaled into a value of type T. Any content encoding
+// and charset are handled as for AssertJSONResponse.
+func DecodeJSONResponse[T any](c *qt.C, rec *httptest.ResponseRecorder) T {
+	c.Assert(rec.Header().Get("Content-Type"), ContentTypeMatches, "application/json")
+	body, err := decodeContent(rec.Header(), rec.Body.Bytes())
+	c.Assert(err, qt.Equals, nil)
+	body, err = decodeBodyCharset(rec.Header().Get("Content-Type"), body)
+	c.Assert(err, qt.Equals, nil)
+	var v T
+	err = json.Unmarshal(body, &v)
+	c.Assert(err, qt.Equals, nil, qt.Commentf("cannot unmarshal body into %T: %s", v, body))
+	return v
+}
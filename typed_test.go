@@ -0,0 +1,46 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestExpectBodyAs(t *testing.T) {
+	c := qt.New(t)
+	called := false
+	qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+		URL:     "/foo",
+		Handler: makeHandler(c, http.StatusOK, "application/json"),
+		ExpectBody: qthttptest.ExpectBodyAs(func(c *qt.C, resp handlerResponse) {
+			c.Assert(resp.URL, qt.Equals, "/foo")
+			c.Assert(resp.Method, qt.Equals, "GET")
+			called = true
+		}),
+	})
+	c.Assert(called, qt.Equals, true)
+
+	checkFails(c, `cannot unmarshal body into int: .*`, func(c *qt.C) {
+		qthttptest.AssertJSONCall(c, qthttptest.JSONCallParams{
+			URL:        "/foo",
+			Handler:    makeHandler(c, http.StatusOK, "application/json"),
+			ExpectBody: qthttptest.ExpectBodyAs(func(c *qt.C, resp int) {}),
+		})
+	})
+}
+
+func TestDecodeJSONResponse(t *testing.T) {
+	c := qt.New(t)
+	rec := qthttptest.DoRequest(c, qthttptest.DoRequestParams{
+		URL:     "/foo",
+		Handler: makeHandler(c, http.StatusOK, "application/json; charset=utf-8"),
+	})
+	resp := qthttptest.DecodeJSONResponse[handlerResponse](c, rec)
+	c.Assert(resp.URL, qt.Equals, "/foo")
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// VaryCallParams holds parameters for AssertVary.
+type VaryCallParams struct {
+	// DoRequestParams holds the request to make. The
+	// ExpectError field is ignored.
+	DoRequestParams
+
+	// Variants holds the values to try for each request header
+	// that the response might be negotiated on, for example
+	//
+	//	http.Header{
+	//		"Accept-Encoding": {"gzip", "identity"},
+	//		"Accept":          {"application/json", "text/html"},
+	//	}
+	//
+	// Each header is varied in turn, with the other headers
+	// taking their values from DoRequestParams.Header.
+	Variants http.Header
+}
+
+// varyResponse holds a response to one variant of a request.
+type varyResponse struct {
+	value   string
+	resp    *http.Response
+	raw     []byte
+	decoded []byte
+}
+
+func (r varyResponse) String() string {
+	return fmt.Sprintf("%q: status %d; Content-Type %q; Content-Encoding %q; Vary %q; body %d bytes", r.value, r.resp.StatusCode, r.resp.Header.Get("Content-Type"), r.resp.Header.Get("Content-Encoding"), r.resp.Header.Values("Vary"), len(r.raw))
+}
+
+// key returns the parts of the response that
+// are affected by content negotiation.
+func (r varyResponse) key() string {
+	h := r.resp.Header
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s\x00%s", r.resp.StatusCode, h.Get("Content-Type"), h.Get("Content-Encoding"), h.Get("Content-Language"), r.raw)
+}
+
+// AssertVary makes the request described by p once for each value of
+// each header in p.Variants, and asserts that the responses are
+// consistent with their Vary headers, so that a shared cache cannot
+// serve one variant in place of another. For each header, if the
+// responses differ in status, Content-Type, Content-Encoding,
+// Content-Language or body, every response must list the header in
+// its Vary header (or use "*").
+//
+// In addition, for Accept-Encoding every response must use a
+// content coding that was accepted, and the decoded bodies of
+// responses with the same status and Content-Type must be the same;
+// for Accept, the Content-Type of every successful response must
+// match one of the accepted media ranges.
+func AssertVary(c *qt.C, p VaryCallParams) {
+	c.Assert(p.Variants, qt.Not(qt.HasLen), 0, qt.Commentf("no variants specified"))
+	names := make([]string, 0, len(p.Variants))
+	for name := range p.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var resps []varyResponse
+		for _, value := range p.Variants[name] {
+			dp := p.DoRequestParams
+			dp.ExpectError = ""
+			dp.Header = cloneHeader(dp.Header)
+			dp.Header.Set(name, value)
+			resp := Do(c, dp)
+			rec := recordResponse(c, resp)
+			raw := rec.Body.Bytes()
+			decoded, err := decodeContent(resp.Header, raw)
+			c.Assert(err, qt.Equals, nil, qt.Commentf("response with %s: %q", name, value))
+			resps = append(resps, varyResponse{
+				value:   value,
+				resp:    resp,
+				raw:     raw,
+				decoded: decoded,
+			})
+		}
+		assertVaryHeader(c, name, resps)
+		switch http.CanonicalHeaderKey(name) {
+		case "Accept-Encoding":
+			assertAcceptEncodingVariants(c, resps)
+		case "Accept":
+			assertAcceptVariants(c, resps)
+		}
+	}
+}
+
+// assertVaryHeader asserts that, if the responses differ, they
+// all list the given request header in their Vary header.
+func assertVaryHeader(c *qt.C, name string, resps []varyResponse) {
+	differ := false
+	for _, r := range resps[1:] {
+		if r.key() != resps[0].key() {
+			differ = true
+			break
+		}
+	}
+	if !differ {
+		return
+	}
+	for _, r := range resps {
+		if !varies(r.resp.Header, name) {
+			c.Fatalf("responses differ with %s but the response to %s: %q does not list it in Vary; responses:%s", name, name, r.value, varyResponseList(resps))
+		}
+	}
+}
+
+// varies reports whether the Vary header in h lists the
+// given request header name or is "*".
+func varies(h http.Header, name string) bool {
+	for _, v := range splitHeaderList(h.Values("Vary")) {
+		if v == "*" || strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func assertAcceptEncodingVariants(c *qt.C, resps []varyResponse) {
+	for _, r := range resps {
+		for _, coding := range contentCodings(r.resp.Header) {
+			if !acceptsCoding(r.value, coding) {
+				c.Fatalf("response to Accept-Encoding: %q uses unaccepted content coding %q; responses:%s", r.value, coding, varyResponseList(resps))
+			}
+		}
+	}
+	for i, r := range resps {
+		for _, r1 := range resps[:i] {
+			if r.resp.StatusCode != r1.resp.StatusCode || r.resp.Header.Get("Content-Type") != r1.resp.Header.Get("Content-Type") {
+				continue
+			}
+			if !bytes.Equal(r.decoded, r1.decoded) {
+				c.Fatalf("decoded bodies differ between responses to Accept-Encoding: %q and %q; responses:%s", r1.value, r.value, varyResponseList(resps))
+			}
+		}
+	}
+}
+
+func assertAcceptVariants(c *qt.C, resps []varyResponse) {
+	for _, r := range resps {
+		if r.resp.StatusCode < 200 || r.resp.StatusCode >= 300 {
+			continue
+		}
+		ctype := r.resp.Header.Get("Content-Type")
+		ok := false
+		for _, elem := range splitHeaderList([]string{r.value}) {
+			mediaRange := strings.TrimSpace(strings.SplitN(elem, ";", 2)[0])
+			if isZeroQuality(elem) {
+				continue
+			}
+			if matchContentType(ctype, mediaRange) == nil {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			c.Fatalf("response to Accept: %q has unaccepted Content-Type %q; responses:%s", r.value, ctype, varyResponseList(resps))
+		}
+	}
+}
+
+// acceptsCoding reports whether the given Accept-Encoding
+// value accepts the given content coding.
+func acceptsCoding(accept, coding string) bool {
+	for _, elem := range splitHeaderList([]string{accept}) {
+		name := strings.TrimSpace(strings.SplitN(elem, ";", 2)[0])
+		if (name == "*" || strings.EqualFold(name, coding)) && !isZeroQuality(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroQuality reports whether the given list element
+// has a quality value of zero, such as "gzip;q=0".
+func isZeroQuality(elem string) bool {
+	for _, param := range strings.Split(elem, ";")[1:] {
+		param = strings.ReplaceAll(param, " ", "")
+		if strings.HasPrefix(param, "q=") && strings.Trim(param[2:], "0.") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func varyResponseList(resps []varyResponse) string {
+	var buf strings.Builder
+	for _, r := range resps {
+		buf.WriteString("\n  ")
+		buf.WriteString(r.String())
+	}
+	return buf.String()
+}
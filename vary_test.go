@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// negotiatingHandler returns a handler that negotiates the content
+// type and encoding, listing the given headers in Vary.
+func negotiatingHandler(vary ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		for _, v := range vary {
+			w.Header().Add("Vary", v)
+		}
+		body := []byte(`{"a":1}`)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(req.Header.Get("Accept"), "text/html") {
+			body = []byte("<p>a=1</p>")
+			w.Header().Set("Content-Type", "text/html")
+		}
+		if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			gw.Write(body)
+			gw.Close()
+			body = buf.Bytes()
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		w.Write(body)
+	}
+}
+
+var assertVaryTests = []struct {
+	about       string
+	handler     http.Handler
+	variants    http.Header
+	expectError string
+}{{
+	about:   "correct Vary",
+	handler: negotiatingHandler("Accept", "Accept-Encoding"),
+	variants: http.Header{
+		"Accept-Encoding": {"gzip", "identity", "br;q=1, gzip;q=0.5"},
+		"Accept":          {"application/json", "text/html", "*/*"},
+	},
+}, {
+	about:   "Vary as a comma-separated list",
+	handler: negotiatingHandler("accept, accept-encoding"),
+	variants: http.Header{
+		"Accept-Encoding": {"gzip", "identity"},
+		"Accept":          {"application/json", "text/html"},
+	},
+}, {
+	about:   "Vary star",
+	handler: negotiatingHandler("*"),
+	variants: http.Header{
+		"Accept-Encoding": {"gzip", "identity"},
+	},
+}, {
+	about:   "header that makes no difference need not be listed",
+	handler: negotiatingHandler("Accept-Encoding"),
+	variants: http.Header{
+		"Accept-Language": {"en", "fr"},
+	},
+}, {
+	about:   "missing Vary",
+	handler: negotiatingHandler("Accept"),
+	variants: http.Header{
+		"Accept-Encoding": {"gzip", "identity"},
+	},
+	expectError: `responses differ with Accept-Encoding but the response to Accept-Encoding: "gzip" does not list it in Vary; responses:
+  "gzip": status 200; Content-Type "application/json"; Content-Encoding "gzip"; Vary \["Accept"\]; body \d+ bytes
+  "identity": status 200; Content-Type "application/json"; Content-Encoding ""; Vary \["Accept"\]; body 7 bytes`,
+}, {
+	about: "Vary only on some responses",
+	handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") == "text/plain" {
+			w.Header().Set("Vary", "Accept")
+		}
+		w.Header().Set("Content-Type", req.Header.Get("Accept"))
+	}),
+	variants: http.Header{
+		"Accept": {"text/plain", "text/html"},
+	},
+	expectError: `responses differ with Accept but the response to Accept: "text/html" does not list it in Vary; .*`,
+}, {
+	about:   "unaccepted content coding",
+	handler: negotiatingHandler("Accept-Encoding"),
+	variants: http.Header{
+		"Accept-Encoding": {"identity", "br, gzip;q=0"},
+	},
+	expectError: `response to Accept-Encoding: "br, gzip;q=0" uses unaccepted content coding "gzip"; .*`,
+}, {
+	about: "decoded bodies differ",
+	handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Write([]byte(req.Header.Get("Accept-Encoding")))
+	}),
+	variants: http.Header{
+		"Accept-Encoding": {"identity", "*"},
+	},
+	expectError: `decoded bodies differ between responses to Accept-Encoding: "identity" and "\*"; .*`,
+}, {
+	about:   "unaccepted media type",
+	handler: negotiatingHandler("Accept"),
+	variants: http.Header{
+		"Accept": {"application/json", "application/xml"},
+	},
+	expectError: `response to Accept: "application/xml" has unaccepted Content-Type "application/json"; .*`,
+}}
+
+func TestAssertVary(t *testing.T) {
+	c := qt.New(t)
+	for _, test := range assertVaryTests {
+		test := test
+		c.Run(test.about, func(c *qt.C) {
+			p := qthttptest.VaryCallParams{
+				DoRequestParams: qthttptest.DoRequestParams{
+					Handler: test.handler,
+					URL:     "/",
+				},
+				Variants: test.variants,
+			}
+			if test.expectError == "" {
+				qthttptest.AssertVary(c, p)
+				return
+			}
+			checkFails(c, test.expectError, func(c *qt.C) {
+				qthttptest.AssertVary(c, p)
+			})
+		})
+	}
+}
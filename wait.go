@@ -0,0 +1,99 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// waitPollInterval holds the time between
+// requests made by WaitForURL.
+const waitPollInterval = 50 * time.Millisecond
+
+// WaitForURL makes GET requests to the given URL until one succeeds
+// with a 2xx status. It fails the test, showing the result of the
+// last attempt, if that does not happen within the given timeout
+// as measured by DefaultClock.
+// It is useful for waiting for a server in another process to
+// become ready.
+func WaitForURL(c *qt.C, url string, timeout time.Duration) {
+	waitForURL(c, url, timeout, func(*http.Response, []byte) error {
+		return nil
+	})
+}
+
+// WaitForHealthy is like WaitForURL except that the response must
+// also have a JSON body containing expect, as for MatchJSONSubset.
+// For example, a health check that reports {"status": "starting"}
+// until it is ready can be waited for with an expect value of
+// map[string]string{"status": "ok"}.
+func WaitForHealthy(c *qt.C, url string, timeout time.Duration, expect interface{}) {
+	match := MatchJSONSubset(expect)
+	waitForURL(c, url, timeout, func(resp *http.Response, body []byte) error {
+		return match(RecordedRequest{
+			Body: body,
+		})
+	})
+}
+
+// waitForURL waits until a GET request to url returns a 2xx
+// status and check returns nil for the response.
+func waitForURL(c *qt.C, url string, timeout time.Duration, check func(resp *http.Response, body []byte) error) {
+	clock := DefaultClock
+	deadline := clock.Now().Add(timeout)
+	// The requests themselves are always bounded
+	// by the timeout in real time.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		lastErr = tryURL(ctx, url, check)
+		if lastErr == nil {
+			return
+		}
+		// Give up at the deadline rather than making
+		// another attempt.
+		wait, last := deadline.Sub(clock.Now()), true
+		if wait > waitPollInterval {
+			wait, last = waitPollInterval, false
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-clock.After(wait):
+				if !last {
+					continue
+				}
+			}
+		}
+		c.Fatalf("%s not ready after %v (%d attempts); last attempt: %v", url, timeout, attempt, lastErr)
+	}
+}
+
+// tryURL makes a single request for waitForURL.
+func tryURL(ctx context.Context, url string, check func(resp *http.Response, body []byte) error) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d; body: %s", resp.StatusCode, body)
+	}
+	return check(resp, body)
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+// startingHandler returns a handler that responds with
+// http.StatusServiceUnavailable to the first n requests.
+func startingHandler(n int64) http.Handler {
+	var count int64
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt64(&count, 1) <= n {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"status":"starting"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","version":"1.0"}`)
+	})
+}
+
+func TestWaitForURL(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, startingHandler(2))
+	qthttptest.WaitForURL(c, srv.URL()+"/health", 5*time.Second)
+}
+
+func TestWaitForURLNotListening(t *testing.T) {
+	c := qt.New(t)
+	port := qthttptest.FreePort(c)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		qthttptest.NewServerOnPort(c, startingHandler(0), port)
+	}()
+	qthttptest.WaitForURL(c, fmt.Sprintf("http://127.0.0.1:%d/", port), 5*time.Second)
+}
+
+func TestWaitForURLTimeout(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, startingHandler(1000))
+	checkFails(c, `http://.*/health not ready after 200ms \([0-9]+ attempts\); last attempt: status 503; body: {"status":"starting"}`, func(c *qt.C) {
+		qthttptest.WaitForURL(c, srv.URL()+"/health", 200*time.Millisecond)
+	})
+}
+
+func TestWaitForHealthy(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, startingHandler(2))
+	qthttptest.WaitForHealthy(c, srv.URL()+"/health", 5*time.Second, map[string]string{
+		"status": "ok",
+	})
+	checkFails(c, `last attempt: body {"status":"ok","version":"1.0"} does not match: .version: got "1.0", want "2.0"`, func(c *qt.C) {
+		qthttptest.WaitForHealthy(c, srv.URL()+"/health", 200*time.Millisecond, map[string]string{
+			"version": "2.0",
+		})
+	})
+}
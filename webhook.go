@@ -0,0 +1,115 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// WebhookReceiverParams holds parameters for NewWebhookReceiver.
+type WebhookReceiverParams struct {
+	// Signature, if non-nil, specifies how deliveries are signed.
+	// Deliveries without a valid signature are
+	// responded to with http.StatusUnauthorized.
+	Signature *HMACSignature
+
+	// Statuses holds the status codes to respond with for
+	// each successive delivery, which can be used to exercise
+	// retry logic. When they are exhausted, or if it is empty,
+	// http.StatusOK is used.
+	Statuses []int
+}
+
+// WebhookDelivery holds a delivery received by a WebhookReceiver.
+type WebhookDelivery struct {
+	RecordedRequest
+
+	// Status holds the status code that was sent in response.
+	Status int
+
+	// SignatureError holds the reason that the
+	// signature was invalid, if it was.
+	SignatureError error
+}
+
+// WebhookReceiver is a test server that receives webhook deliveries.
+type WebhookReceiver struct {
+	*Server
+
+	p WebhookReceiverParams
+
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+	waited     int
+	changed    chan struct{}
+}
+
+// NewWebhookReceiver starts a new webhook receiver which
+// is shut down when the test completes.
+func NewWebhookReceiver(c *qt.C, p WebhookReceiverParams) *WebhookReceiver {
+	w := &WebhookReceiver{
+		p: p,
+	}
+	w.Server = NewServer(c, http.HandlerFunc(w.serveHTTP))
+	return w
+}
+
+func (w *WebhookReceiver) serveHTTP(rw http.ResponseWriter, req *http.Request) {
+	r, err := recordRequest(req)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d := WebhookDelivery{
+		RecordedRequest: r,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.p.Signature != nil {
+		d.SignatureError = w.p.Signature.Verify(&d.RecordedRequest)
+	}
+	switch {
+	case d.SignatureError != nil:
+		d.Status = http.StatusUnauthorized
+	case len(w.deliveries) < len(w.p.Statuses):
+		d.Status = w.p.Statuses[len(w.deliveries)]
+	default:
+		d.Status = http.StatusOK
+	}
+	w.deliveries = append(w.deliveries, d)
+	notifyChange(&w.changed)
+	rw.WriteHeader(d.Status)
+}
+
+// Deliveries returns all the deliveries received so far.
+func (w *WebhookReceiver) Deliveries() []WebhookDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]WebhookDelivery(nil), w.deliveries...)
+}
+
+// WaitForDelivery waits for the next delivery that has not been
+// returned by a previous call and returns it. It fails the test if
+// no delivery arrives within the given timeout or if the delivery
+// does not have a valid signature.
+func (w *WebhookReceiver) WaitForDelivery(c *qt.C, timeout time.Duration) WebhookDelivery {
+	var d WebhookDelivery
+	ok := waitForChange(&w.mu, &w.changed, timeout, func() bool {
+		if w.waited == len(w.deliveries) {
+			return false
+		}
+		d = w.deliveries[w.waited]
+		w.waited++
+		return true
+	})
+	if !ok {
+		c.Fatalf("no webhook delivery received within %v", timeout)
+	}
+	c.Assert(d.SignatureError, qt.IsNil, qt.Commentf("invalid signature on %s %s", d.Method, d.URL))
+	return d
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestWebhookReceiver(t *testing.T) {
+	c := qt.New(t)
+	sig := &qthttptest.HMACSignature{
+		Header: "X-Signature",
+		Key:    []byte("secret"),
+	}
+	w := qthttptest.NewWebhookReceiver(c, qthttptest.WebhookReceiverParams{
+		Signature: sig,
+		Statuses:  []int{http.StatusServiceUnavailable},
+	})
+	deliver := func(body string, signature string) int {
+		req, err := http.NewRequest("POST", w.URL()+"/hook", bytes.NewReader([]byte(body)))
+		c.Assert(err, qt.Equals, nil)
+		if signature != "" {
+			req.Header.Set("X-Signature", signature)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, qt.Equals, nil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	go deliver(`{"n":1}`, sig.Sign([]byte(`{"n":1}`)))
+	d := w.WaitForDelivery(c, 5*time.Second)
+	c.Assert(string(d.Body), qt.Equals, `{"n":1}`)
+	c.Assert(d.URL.Path, qt.Equals, "/hook")
+	c.Assert(d.Status, qt.Equals, http.StatusServiceUnavailable)
+
+	c.Assert(deliver(`{"n":1}`, sig.Sign([]byte(`{"n":1}`))), qt.Equals, http.StatusOK)
+	d = w.WaitForDelivery(c, 5*time.Second)
+	c.Assert(d.Status, qt.Equals, http.StatusOK)
+
+	c.Assert(deliver(`{"n":2}`, sig.Sign([]byte(`{"n":1}`))), qt.Equals, http.StatusUnauthorized)
+	checkFails(c, `invalid signature on POST /hook`, func(c *qt.C) {
+		w.WaitForDelivery(c, 5*time.Second)
+	})
+	c.Assert(deliver(`{"n":3}`, ""), qt.Equals, http.StatusUnauthorized)
+	c.Assert(w.Deliveries()[3].SignatureError, qt.ErrorMatches, `missing X-Signature header`)
+
+	c.Assert(w.Deliveries(), qt.HasLen, 4)
+	checkFails(c, `invalid signature on POST /hook`, func(c *qt.C) {
+		w.WaitForDelivery(c, 5*time.Second)
+	})
+	checkFails(c, `no webhook delivery received within 10ms`, func(c *qt.C) {
+		w.WaitForDelivery(c, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,366 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// WireCapture records the exact bytes sent and received on network
+// connections, so that tests can make assertions about details of
+// HTTP/1.x serialization, such as header order and chunk boundaries,
+// that are hidden by http.Request and http.Response. Connections are
+// captured by using the listener returned by Listener on a server, or
+// by using DialContext or Transport on a client. TLS connections are
+// captured in their encrypted form, so only plain HTTP is useful.
+//
+// The zero value is ready to use.
+type WireCapture struct {
+	mu    sync.Mutex
+	conns []*CapturedConn
+}
+
+// Listener returns a listener that captures all the
+// connections accepted from l.
+func (w *WireCapture) Listener(l net.Listener) net.Listener {
+	return &captureListener{
+		Listener: l,
+		w:        w,
+	}
+}
+
+// DialContext dials the given address as for net.Dialer.DialContext
+// and captures the resulting connection. It can be used as the
+// DialContext field of an http.Transport.
+func (w *WireCapture) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return w.capture(conn, true), nil
+}
+
+// Transport returns a new HTTP/1.1 transport that
+// captures all the connections it makes.
+func (w *WireCapture) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext: w.DialContext,
+	}
+}
+
+// Conns returns all the connections captured so far,
+// in the order that they were made.
+func (w *WireCapture) Conns() []*CapturedConn {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*CapturedConn(nil), w.conns...)
+}
+
+// Reset discards all the captured connections.
+func (w *WireCapture) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conns = nil
+}
+
+// Requests returns the requests sent on all the captured
+// connections, in connection order. It fails the test if they
+// cannot be parsed.
+func (w *WireCapture) Requests(c *qt.C) []WireMessage {
+	var msgs []WireMessage
+	for i, conn := range w.Conns() {
+		m, err := conn.Requests()
+		c.Assert(err, qt.Equals, nil, qt.Commentf("connection %d", i))
+		msgs = append(msgs, m...)
+	}
+	return msgs
+}
+
+// Responses returns the responses sent on all the captured
+// connections, in connection order. It fails the test if they
+// cannot be parsed.
+func (w *WireCapture) Responses(c *qt.C) []WireMessage {
+	var msgs []WireMessage
+	for i, conn := range w.Conns() {
+		m, err := conn.Responses()
+		c.Assert(err, qt.Equals, nil, qt.Commentf("connection %d", i))
+		msgs = append(msgs, m...)
+	}
+	return msgs
+}
+
+func (w *WireCapture) capture(conn net.Conn, client bool) *CapturedConn {
+	cc := &CapturedConn{
+		Conn:   conn,
+		Client: client,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conns = append(w.conns, cc)
+	return cc
+}
+
+// NewCaptureServer is like NewServer except that all the connections
+// to the server are captured by w.
+func NewCaptureServer(c *qt.C, handler http.Handler, w *WireCapture) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.Equals, nil)
+	s := &Server{
+		handler:      handler,
+		wrapListener: w.Listener,
+	}
+	s.start(startOnListener(handler, s.wrapListener(l)))
+	c.Cleanup(s.Stop)
+	return s
+}
+
+type captureListener struct {
+	net.Listener
+	w *WireCapture
+}
+
+func (l *captureListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.w.capture(conn, false), nil
+}
+
+// CapturedConn is a connection captured by a WireCapture.
+type CapturedConn struct {
+	net.Conn
+
+	// Client reports whether this is the client side of the
+	// connection, in which case requests are sent and responses
+	// received; otherwise it is the server side.
+	Client bool
+
+	mu       sync.Mutex
+	sent     bytes.Buffer
+	received bytes.Buffer
+}
+
+// Read implements net.Conn.Read.
+func (c *CapturedConn) Read(buf []byte) (int, error) {
+	n, err := c.Conn.Read(buf)
+	c.mu.Lock()
+	c.received.Write(buf[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// Write implements net.Conn.Write.
+func (c *CapturedConn) Write(buf []byte) (int, error) {
+	n, err := c.Conn.Write(buf)
+	c.mu.Lock()
+	c.sent.Write(buf[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// Sent returns all the bytes written to the connection so far.
+func (c *CapturedConn) Sent() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.sent.Bytes()...)
+}
+
+// Received returns all the bytes read from the connection so far.
+func (c *CapturedConn) Received() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.received.Bytes()...)
+}
+
+// Requests parses the requests sent on the connection so far.
+func (c *CapturedConn) Requests() ([]WireMessage, error) {
+	data := c.Received()
+	if c.Client {
+		data = c.Sent()
+	}
+	return parseWireMessages(data, nil)
+}
+
+// Responses parses the responses sent on the connection so
+// far. The requests are parsed too, so that responses to HEAD
+// requests can be recognized.
+func (c *CapturedConn) Responses() ([]WireMessage, error) {
+	reqs, err := c.Requests()
+	if err != nil {
+		return nil, err
+	}
+	methods := make([]string, len(reqs))
+	for i, req := range reqs {
+		methods[i] = strings.SplitN(req.StartLine, " ", 2)[0]
+	}
+	data := c.Sent()
+	if c.Client {
+		data = c.Received()
+	}
+	return parseWireMessages(data, methods)
+}
+
+// WireMessage holds an HTTP/1.x request or
+// response exactly as sent on the wire.
+type WireMessage struct {
+	// StartLine holds the request line or status line,
+	// without the terminating CRLF.
+	StartLine string
+
+	// Header holds the header fields in the order they were sent.
+	Header WireHeader
+
+	// Chunks holds the data of each chunk of a chunked body,
+	// not including the final empty chunk. It is nil if the
+	// body was not chunked.
+	Chunks [][]byte
+
+	// Body holds the body with any chunked
+	// encoding removed.
+	Body []byte
+
+	// Trailer holds the trailer fields of a chunked body.
+	Trailer WireHeader
+
+	// Raw holds all the bytes of the message.
+	Raw []byte
+}
+
+// parseWireMessages parses the HTTP/1.x messages in data. If methods
+// is nil, the messages are requests; otherwise they are responses
+// to requests with the given methods.
+func parseWireMessages(data []byte, methods []string) ([]WireMessage, error) {
+	var msgs []WireMessage
+	for len(data) > 0 {
+		m, n, err := parseWireMessage(data, methods)
+		if err != nil {
+			return msgs, fmt.Errorf("message %d: %v", len(msgs), err)
+		}
+		if len(methods) > 0 && !isInformational(m.StartLine) {
+			// Interim responses such as 100 Continue
+			// precede the final response to a request.
+			methods = methods[1:]
+		}
+		msgs = append(msgs, m)
+		data = data[n:]
+	}
+	return msgs, nil
+}
+
+// parseWireMessage parses the message at the start of data and
+// returns it along with the number of bytes that it occupies.
+func parseWireMessage(data []byte, methods []string) (WireMessage, int, error) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end == -1 {
+		return WireMessage{}, 0, fmt.Errorf("incomplete header")
+	}
+	block := data[:end+2]
+	m := WireMessage{
+		StartLine: string(block[:bytes.IndexByte(block, '\n')-1]),
+		Header:    parseWireHeader(block),
+	}
+	n := end + 4
+	hasBody := true
+	if methods != nil {
+		fields := strings.Fields(m.StartLine)
+		if len(fields) < 2 {
+			return WireMessage{}, 0, fmt.Errorf("invalid status line %q", m.StartLine)
+		}
+		status, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return WireMessage{}, 0, fmt.Errorf("invalid status line %q", m.StartLine)
+		}
+		hasBody = status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified &&
+			!(len(methods) > 0 && methods[0] == "HEAD")
+	}
+	switch te, cl := m.Header.get("Transfer-Encoding"), m.Header.get("Content-Length"); {
+	case !hasBody:
+	case strings.HasSuffix(strings.ToLower(te), "chunked"):
+		m.Chunks = [][]byte{}
+		for {
+			i := bytes.Index(data[n:], []byte("\r\n"))
+			if i == -1 {
+				return WireMessage{}, 0, fmt.Errorf("incomplete chunk size")
+			}
+			sizeStr := string(data[n : n+i])
+			if j := strings.IndexByte(sizeStr, ';'); j != -1 {
+				sizeStr = sizeStr[:j]
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+			if err != nil || size < 0 {
+				return WireMessage{}, 0, fmt.Errorf("invalid chunk size %q", data[n:n+i])
+			}
+			n += i + 2
+			if size == 0 {
+				break
+			}
+			if int64(len(data)-n) < size+2 {
+				return WireMessage{}, 0, fmt.Errorf("incomplete chunk")
+			}
+			chunk := data[n : n+int(size)]
+			m.Chunks = append(m.Chunks, chunk)
+			m.Body = append(m.Body, chunk...)
+			n += int(size) + 2
+		}
+		i := bytes.Index(data[n:], []byte("\r\n"))
+		if i > 0 {
+			i = bytes.Index(data[n:], []byte("\r\n\r\n"))
+			if i == -1 {
+				return WireMessage{}, 0, fmt.Errorf("incomplete trailer")
+			}
+			// parseWireHeader expects a start line, so
+			// include the CRLF before the trailer.
+			m.Trailer = parseWireHeader(data[n-2 : n+i+2])
+			n += i + 4
+		} else if i == 0 {
+			n += 2
+		} else {
+			return WireMessage{}, 0, fmt.Errorf("incomplete trailer")
+		}
+	case cl != "":
+		size, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || size < 0 {
+			return WireMessage{}, 0, fmt.Errorf("invalid Content-Length %q", cl)
+		}
+		if int64(len(data)-n) < size {
+			return WireMessage{}, 0, fmt.Errorf("incomplete body")
+		}
+		m.Body = data[n : n+int(size)]
+		n += int(size)
+	case methods != nil:
+		// The response body is terminated by closing the connection.
+		m.Body = data[n:]
+		n = len(data)
+	}
+	m.Raw = data[:n]
+	return m, n, nil
+}
+
+// isInformational reports whether the given
+// status line has a 1xx status.
+func isInformational(statusLine string) bool {
+	fields := strings.Fields(statusLine)
+	return len(fields) >= 2 && len(fields[1]) == 3 && fields[1][0] == '1'
+}
+
+// get returns the value of the first field with the given
+// name, which is compared case-insensitively.
+func (h WireHeader) get(name string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func chunkedHandler(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	w.Header().Set("Trailer", "X-Checksum")
+	w.Write([]byte("hello"))
+	w.(http.Flusher).Flush()
+	w.Write(body)
+	w.Header().Set("X-Checksum", "abc")
+}
+
+func TestCaptureServer(t *testing.T) {
+	c := qt.New(t)
+	var capture qthttptest.WireCapture
+	srv := qthttptest.NewCaptureServer(c, http.HandlerFunc(chunkedHandler), &capture)
+	resp := qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+		Method:  "POST",
+		URL:     "/foo",
+		Body:    strings.NewReader("world"),
+		Chunked: true,
+		Header: http.Header{
+			"X-B": {"1"},
+			"X-A": {"2"},
+		},
+	}))
+	resp.AssertStatus(c, http.StatusOK)
+	c.Assert(string(resp.Body), qt.Equals, "helloworld")
+
+	conns := capture.Conns()
+	c.Assert(conns, qt.HasLen, 1)
+	c.Assert(conns[0].Client, qt.Equals, false)
+
+	reqs := capture.Requests(c)
+	c.Assert(reqs, qt.HasLen, 1)
+	req := reqs[0]
+	c.Assert(req.StartLine, qt.Equals, "POST /foo HTTP/1.1")
+	c.Assert(req.Header.Names(), qt.DeepEquals, []string{"Host", "User-Agent", "Transfer-Encoding", "X-A", "X-B", "Accept-Encoding"})
+	c.Assert(req.Chunks, qt.DeepEquals, [][]byte{[]byte("world")})
+	c.Assert(string(req.Body), qt.Equals, "world")
+	c.Assert(string(req.Raw), qt.Equals, string(conns[0].Received()))
+
+	resps := capture.Responses(c)
+	c.Assert(resps, qt.HasLen, 1)
+	r := resps[0]
+	c.Assert(r.StartLine, qt.Equals, "HTTP/1.1 200 OK")
+	c.Assert(r.Header.Values("Transfer-Encoding"), qt.DeepEquals, []string{"chunked"})
+	c.Assert(r.Chunks, qt.DeepEquals, [][]byte{[]byte("hello"), []byte("world")})
+	c.Assert(r.Trailer, qt.DeepEquals, qthttptest.WireHeader{{Name: "X-Checksum", Value: "abc"}})
+	c.Assert(string(r.Raw), qt.Equals, string(conns[0].Sent()))
+
+	capture.Reset()
+	c.Assert(capture.Conns(), qt.HasLen, 0)
+}
+
+func TestCaptureServerRestart(t *testing.T) {
+	c := qt.New(t)
+	var capture qthttptest.WireCapture
+	srv := qthttptest.NewCaptureServer(c, nil, &capture)
+	srv.Restart(c)
+	qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+		URL: "/",
+	})).AssertStatus(c, http.StatusNotFound)
+	c.Assert(capture.Requests(c), qt.HasLen, 1)
+}
+
+func TestCaptureTransport(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "HEAD" {
+			w.Header().Set("Content-Length", "100")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	var capture qthttptest.WireCapture
+	client := &http.Client{
+		Transport: capture.Transport(),
+	}
+	for _, method := range []string{"HEAD", "PUT"} {
+		qthttptest.DoResponse(c, srv.DoRequestParams(qthttptest.DoRequestParams{
+			Do:     client.Do,
+			Method: method,
+			URL:    "/",
+			Body:   strings.NewReader("x"),
+		}))
+	}
+	conns := capture.Conns()
+	c.Assert(conns, qt.HasLen, 1)
+	c.Assert(conns[0].Client, qt.Equals, true)
+	reqs, err := conns[0].Requests()
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(reqs, qt.HasLen, 2)
+	c.Assert(reqs[0].StartLine, qt.Equals, "HEAD / HTTP/1.1")
+	c.Assert(reqs[1].StartLine, qt.Equals, "PUT / HTTP/1.1")
+	c.Assert(reqs[1].Header.Values("Content-Length"), qt.DeepEquals, []string{"1"})
+	c.Assert(reqs[1].Chunks, qt.IsNil)
+	c.Assert(string(reqs[1].Body), qt.Equals, "x")
+
+	resps, err := conns[0].Responses()
+	c.Assert(err, qt.Equals, nil)
+	c.Assert(resps, qt.HasLen, 2)
+	c.Assert(resps[0].StartLine, qt.Equals, "HTTP/1.1 200 OK")
+	c.Assert(resps[0].Body, qt.HasLen, 0)
+	c.Assert(resps[1].StartLine, qt.Equals, "HTTP/1.1 201 Created")
+	c.Assert(string(resps[1].Body), qt.Equals, "created")
+}
+
+func TestCaptureIncompleteRequest(t *testing.T) {
+	c := qt.New(t)
+	var capture qthttptest.WireCapture
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.Equals, nil)
+	l = capture.Listener(l)
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	c.Assert(err, qt.Equals, nil)
+	fmt.Fprintf(conn, "PUT / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\nabc")
+	conn.Close()
+	sconn, err := l.Accept()
+	c.Assert(err, qt.Equals, nil)
+	ioutil.ReadAll(sconn)
+	sconn.Close()
+	_, err = capture.Conns()[0].Requests()
+	c.Assert(err, qt.ErrorMatches, `message 0: incomplete body`)
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// HeaderField holds a single header field.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// WireHeader holds the header fields of a request in the order
+// they were sent and with their names exactly as sent.
+type WireHeader []HeaderField
+
+// Names returns the names of all the fields in order.
+func (h WireHeader) Names() []string {
+	names := make([]string, len(h))
+	for i, f := range h {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Values returns the values of all the fields with the given name,
+// which is compared case-sensitively, unlike http.Header.Values.
+func (h WireHeader) Values(name string) []string {
+	var values []string
+	for _, f := range h {
+		if f.Name == name {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// WireHeaderServer is a test HTTP server that records the header of
+// each request it receives as it was sent on the wire, before net/http
+// canonicalizes it, as well as recording the requests as they are seen
+// by handlers. This can be used to check how a client or proxy writes
+// header names. Keep-alives are disabled so that each request uses a
+// new connection.
+type WireHeaderServer struct {
+	*RecordingHandler
+
+	srv     *httptest.Server
+	mu      sync.Mutex
+	headers []WireHeader
+}
+
+type wireConnKey struct{}
+
+// NewWireHeaderServer starts a new server that records all requests
+// and passes them on to the given handler, which may be nil. The
+// server is shut down when the test completes.
+func NewWireHeaderServer(c *qt.C, handler http.Handler) *WireHeaderServer {
+	s := &WireHeaderServer{
+		RecordingHandler: &RecordingHandler{
+			Handler: handler,
+		},
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	srv.Listener = &wireListener{srv.Listener}
+	srv.Config.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		return context.WithValue(ctx, wireConnKey{}, conn)
+	}
+	srv.Config.SetKeepAlivesEnabled(false)
+	srv.Start()
+	s.srv = srv
+	c.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the base URL of the server, of the
+// form http://ipaddr:port with no trailing slash.
+func (s *WireHeaderServer) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts down the server, blocking until all
+// outstanding requests have completed.
+func (s *WireHeaderServer) Close() {
+	s.srv.Close()
+}
+
+// WireHeaders returns the wire headers of all the requests
+// received so far, in the same order as Requests.
+func (s *WireHeaderServer) WireHeaders() []WireHeader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WireHeader(nil), s.headers...)
+}
+
+// Reset discards all the recorded requests and headers.
+func (s *WireHeaderServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RecordingHandler.Reset()
+	s.headers = nil
+}
+
+func (s *WireHeaderServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	conn := req.Context().Value(wireConnKey{}).(*wireConn)
+	s.mu.Lock()
+	s.headers = append(s.headers, parseWireHeader(conn.header()))
+	// Record the request while holding the lock so that
+	// the requests and headers stay in the same order.
+	r, err := recordRequest(req)
+	if err == nil {
+		s.record(r)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Handler != nil {
+		s.Handler.ServeHTTP(w, req)
+	}
+}
+
+// parseWireHeader parses the header fields from a
+// request header block, including the request line.
+func parseWireHeader(data []byte) WireHeader {
+	lines := strings.Split(string(data), "\n")
+	h := WireHeader{}
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		h = append(h, HeaderField{
+			Name:  line[:i],
+			Value: strings.Trim(line[i+1:], " \t"),
+		})
+	}
+	return h
+}
+
+// wireListener wraps the connections it
+// accepts so that their headers are recorded.
+type wireListener struct {
+	net.Listener
+}
+
+func (l *wireListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &wireConn{Conn: conn}, nil
+}
+
+// wireConn records the data read from the connection
+// up to the end of the first request header.
+type wireConn struct {
+	net.Conn
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done bool
+}
+
+func (c *wireConn) Read(buf []byte) (int, error) {
+	n, err := c.Conn.Read(buf)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.buf.Write(buf[:n])
+		if i := bytes.Index(c.buf.Bytes(), []byte("\r\n\r\n")); i != -1 {
+			c.buf.Truncate(i + 2)
+			c.done = true
+		}
+	}
+	return n, err
+}
+
+// header returns the recorded request header.
+func (c *wireConn) header() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Bytes()
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package qthttptest_test
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/juju/qthttptest"
+)
+
+func TestWireHeaderServer(t *testing.T) {
+	c := qt.New(t)
+	srv := qthttptest.NewWireHeaderServer(c, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("X-My-Header")))
+	}))
+	for i := 0; i < 2; i++ {
+		resp := qthttptest.DoResponse(c, qthttptest.DoRequestParams{
+			Method: "PUT",
+			URL:    srv.URL() + "/foo",
+			Header: http.Header{
+				"x-my-header": {"a", "b"},
+				"X-OTHER":     {"c"},
+			},
+			Body: strings.NewReader("body"),
+		})
+		resp.AssertStatus(c, http.StatusOK)
+		c.Assert(string(resp.Body), qt.Equals, "a")
+	}
+	headers := srv.WireHeaders()
+	c.Assert(headers, qt.HasLen, 2)
+	for _, h := range headers {
+		c.Assert(h.Values("x-my-header"), qt.DeepEquals, []string{"a", "b"})
+		c.Assert(h.Values("X-My-Header"), qt.IsNil)
+		c.Assert(h.Values("X-OTHER"), qt.DeepEquals, []string{"c"})
+		c.Assert(h.Names(), qt.Contains, "Host")
+	}
+	reqs := srv.Requests()
+	c.Assert(reqs, qt.HasLen, 2)
+	c.Assert(reqs[0].Header["X-My-Header"], qt.DeepEquals, []string{"a", "b"})
+	c.Assert(string(reqs[0].Body), qt.Equals, "body")
+
+	srv.Reset()
+	c.Assert(srv.WireHeaders(), qt.HasLen, 0)
+	c.Assert(srv.Requests(), qt.HasLen, 0)
+}
+
+func TestWireHeaderServerBehindProxy(t *testing.T) {
+	c := qt.New(t)
+	backend := qthttptest.NewWireHeaderServer(c, nil)
+	u, err := url.Parse(backend.URL())
+	c.Assert(err, qt.Equals, nil)
+	proxy := qthttptest.NewServer(c, httputil.NewSingleHostReverseProxy(u))
+	resp := qthttptest.DoResponse(c, proxy.DoRequestParams(qthttptest.DoRequestParams{
+		URL: "/",
+		Header: http.Header{
+			"x-my-header": {"a"},
+		},
+	}))
+	resp.AssertStatus(c, http.StatusOK)
+	// The proxy sees the canonical form of the header name,
+	// so that is what it passes on.
+	headers := backend.WireHeaders()
+	c.Assert(headers, qt.HasLen, 1)
+	c.Assert(headers[0].Values("x-my-header"), qt.IsNil)
+	c.Assert(headers[0].Values("X-My-Header"), qt.DeepEquals, []string{"a"})
+}